@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cache"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runCache implements the cache command.
+func runCache(opts *cmd.Options) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		exitf(1, "cache error: %v", err)
+	}
+	c := cache.New(dir, 0)
+	action := ""
+	if len(opts.Args) > 0 {
+		action = opts.Args[0]
+	}
+	switch action {
+	case "path":
+		fmt.Println(c.Dir())
+	case "clear":
+		if err := c.Clear(); err != nil {
+			exitf(1, "cache error: %v", err)
+		}
+	default:
+		n, err := c.Entries()
+		if err != nil {
+			exitf(1, "cache error: %v", err)
+		}
+		fmt.Printf("cache: %s (%d entries)\n", c.Dir(), n)
+	}
+}
+
+// searchRetriever wraps the client in the on-disk result cache unless
+// --no-cache is set, the traffic is recorded or replayed, or --unmask is set,
+// so unmasked messages are never written to the cache. The cache is
+// skipped with a warning when the account cannot be resolved, since entries
+// are keyed by it.
+func searchRetriever(ctx context.Context, opts *cmd.Options, cw *client.CloudWatchClient) inspector.CloudWatchLogsRetriever {
+	if opts.NoCache || opts.Record != "" || opts.Replay != "" || opts.Unmask {
+		return cw
+	}
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		warnf("result cache disabled: %v", err)
+		return cw
+	}
+	account, region, err := cw.Identity(ctx)
+	if err != nil {
+		warnf("result cache disabled: %v", err)
+		return cw
+	}
+	return cache.New(dir, opts.CacheTTL).Wrap(cw, account, region)
+}
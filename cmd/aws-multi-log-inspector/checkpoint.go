@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/checkpoint"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runCheckpointedSearch implements search --checkpoint/--resume: results are
+// written page by page and each page is recorded in the checkpoint file, so a
+// failed search can be continued with --resume without repeating output.
+func runCheckpointedSearch(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+	setupExport(ctx, opts, cw)
+
+	var cp *checkpoint.Checkpoint
+	var err error
+	if opts.Resume != "" {
+		cp, err = checkpoint.Load(opts.Resume)
+	} else {
+		cp, err = checkpoint.Create(opts.Checkpoint, opts.Region, opts.FilterPattern, groups, start.UnixMilli(), end.UnixMilli())
+	}
+	if err != nil {
+		exitf(1, "checkpoint error: %v", err)
+	}
+	path := opts.Checkpoint
+	if path == "" {
+		path = opts.Resume
+	}
+
+	emit, flush := recordStream(os.Stdout, opts)
+	// Flush every page before it is recorded as written
+	err = cp.Run(ctx, cw, opts.Concurrency, func(records []model.LogRecord) error {
+		if err := emit(records); err != nil {
+			return err
+		}
+		exportRecords(ctx, records)
+		return flush()
+	})
+	if err != nil {
+		exitf(1, "search error: %v\n%d records written; continue with: %s search --resume %s", err, cp.Written(), cmd.ProgramName, path)
+	}
+	fmt.Fprintf(os.Stderr, "search complete: %d records from %d groups (checkpoint %s)\n", cp.Written(), len(cp.Groups), path)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runConfig implements the config command.
+func runConfig(opts *cmd.Options) {
+	path := opts.ConfigPath
+	if path == "" {
+		path = cmd.DefaultConfigPath()
+	}
+	cfg, err := cmd.LoadConfig(opts.ConfigPath)
+	if err != nil {
+		exitf(1, "config error: %v", err)
+	}
+	action := ""
+	if len(opts.Args) > 0 {
+		action = opts.Args[0]
+	}
+	switch action {
+	case "path":
+		fmt.Println(path)
+	case "show":
+		b, err := yaml.Marshal(cfg)
+		if err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+		_, _ = os.Stdout.Write(b)
+	case "searches":
+		// One name per line; shell completion for `run` relies on this
+		names := make([]string, 0, len(cfg.Searches))
+		for n := range cfg.Searches {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Println(n)
+		}
+	default:
+		status := "found"
+		if _, err := os.Stat(path); err != nil {
+			status = "not found"
+		}
+		fmt.Printf("config: %s (%s)\n", path, status)
+		fmt.Printf("environments: %d, group sets: %d, saved searches: %d\n", len(cfg.Environments), len(cfg.GroupSets), len(cfg.Searches))
+		if cfg.DefaultEnvironment != "" {
+			fmt.Printf("default environment: %s\n", cfg.DefaultEnvironment)
+		}
+	}
+}
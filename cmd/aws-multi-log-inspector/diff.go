@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/diff"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runDiff implements the diff command: the same search over a baseline window
+// and the comparison window, reported as signature changes per group.
+func runDiff(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	start, end := resolveWindow(opts)
+	// Validate already checked the offset
+	offset, _ := cmd.ParseSince(opts.Baseline)
+	baseStart, baseEnd := start.Add(-offset), end.Add(-offset)
+	cw := newClient(ctx, opts)
+	retriever := searchRetriever(ctx, opts, cw)
+
+	baseline, err := newInspector(retriever, opts, groups, baseStart, baseEnd).Search(ctx, opts.FilterPattern)
+	if err != nil {
+		exitf(1, "baseline search error: %v", err)
+	}
+	comparison, err := newInspector(retriever, opts, groups, start, end).Search(ctx, opts.FilterPattern)
+	if err != nil {
+		exitf(1, "search error: %v", err)
+	}
+	// Signatures are built from redacted messages, so they show placeholders
+	redactor.Records(baseline)
+	redactor.Records(comparison)
+	changes, err := diff.Compare(baseline, comparison, diff.Options{
+		By:        opts.By,
+		Format:    parserFormat(opts),
+		Threshold: opts.ClusterThreshold,
+		MinRatio:  opts.MinRatio,
+	})
+	if err != nil {
+		exitf(2, "diff error: %v", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if opts.PrettyJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(changes); err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+		return
+	}
+	fmt.Fprintf(w, "baseline   %s .. %s (%d events)\n", baseStart.UTC().Format(time.RFC3339), baseEnd.UTC().Format(time.RFC3339), len(baseline))
+	fmt.Fprintf(w, "comparison %s .. %s (%d events)\n\n", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), len(comparison))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "status\tbaseline\tcomparison\tratio\tgroup\tsignature")
+	unchanged := 0
+	for _, c := range changes {
+		if c.Status == diff.StatusSame {
+			unchanged++
+			continue
+		}
+		ratio := "-"
+		if c.Ratio != 0 {
+			ratio = fmt.Sprintf("x%.2f", c.Ratio)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", c.Status, c.Baseline, c.Comparison, ratio, c.Group, c.Signature)
+	}
+	_ = tw.Flush()
+	if unchanged > 0 {
+		fmt.Fprintf(w, "\n%d unchanged signatures (ratio below x%g)\n", unchanged, opts.MinRatio)
+	}
+}
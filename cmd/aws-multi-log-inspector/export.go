@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// sink receives the printed records with --export; nil exports nothing.
+var sink export.Sink
+
+// exported counts the records passed to sink.
+var exported int
+
+// exportTimeout bounds sending the last batch when the command ends.
+const exportTimeout = 30 * time.Second
+
+// setupExport creates the --export sink. The records' resource is the
+// account and region of the credentials, when they can be resolved.
+func setupExport(ctx context.Context, opts *cmd.Options, cw *client.CloudWatchClient) {
+	if opts.Export == "" {
+		return
+	}
+	res := export.Resource{Region: opts.Region}
+	if replay == nil {
+		account, region, err := cw.Identity(ctx)
+		if err != nil {
+			warnf("export: cannot resolve the AWS account: %v", err)
+		} else {
+			res = export.Resource{Account: account, Region: region}
+		}
+	}
+	cfg := opts.ExportConfig()
+	cfg.Resource, cfg.Format, cfg.Logger = res, parserFormat(opts), logger
+	var err error
+	if sink, err = export.New(opts.Export, cfg); err != nil {
+		exitf(2, "error: --export: %v", err)
+	}
+}
+
+// exportRecords passes printed records to the sink. Records whose batch was
+// interrupted by Ctrl-C stay queued for closeExport.
+func exportRecords(ctx context.Context, records []model.LogRecord) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Write(ctx, records); err != nil && ctx.Err() == nil {
+		exitf(1, "export error: %v", err)
+	}
+	exported += len(records)
+}
+
+// flushExport sends the records queued so far, so that the backend receives
+// each poll of tail without waiting for a full batch.
+func flushExport(ctx context.Context) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Flush(ctx); err != nil && ctx.Err() == nil {
+		exitf(1, "export error: %v", err)
+	}
+}
+
+// closeExport sends the records still queued, even after Ctrl-C stopped the
+// command.
+func closeExport(ctx context.Context) {
+	if sink == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), exportTimeout)
+	defer cancel()
+	if err := sink.Flush(ctx); err != nil {
+		exitf(1, "export error: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d records to %s\n", exported, sink.URL())
+}
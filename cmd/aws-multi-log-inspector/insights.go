@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runInsights implements the insights command. Rows are printed as one JSON
+// object per line, or as an indented array with --pretty.
+func runInsights(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+
+	rows, err := cw.RunInsightsQuery(ctx, groups, opts.Args[0], start.UnixMilli(), end.UnixMilli(), opts.Limit)
+	if err != nil {
+		exitf(1, "insights error: %v", err)
+	}
+	if redactor != nil {
+		for _, row := range rows {
+			for k, v := range row {
+				row[k] = redactor.String(v)
+			}
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Fprintf(os.Stderr, "No results %s\n", windowDescription(opts, start, end))
+		return
+	}
+	if opts.PrettyJSON {
+		encodeIndented(rows)
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(w)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+	}
+	_ = w.Flush()
+}
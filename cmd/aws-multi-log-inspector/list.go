@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runGroups implements the groups command. The default output is one name per
+// line, which shell completion relies on.
+func runGroups(ctx context.Context, opts *cmd.Options) {
+	cw := newClient(ctx, opts)
+	groups, err := cw.ListGroups(ctx, opts.Prefix)
+	if err != nil {
+		exitf(1, "list groups error: %v", err)
+	}
+	if opts.PrettyJSON {
+		encodeIndented(groups)
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for _, g := range groups {
+		if !opts.Long {
+			fmt.Fprintln(w, g.Name)
+			continue
+		}
+		retention := "never-expire"
+		if g.RetentionDays > 0 {
+			retention = fmt.Sprintf("%dd", g.RetentionDays)
+		}
+		fmt.Fprintf(w, "%s %12s %-12s %s\n", g.CreationTime.UTC().Format(time.RFC3339), humanBytes(g.StoredBytes), retention, g.Name)
+	}
+	_ = w.Flush()
+}
+
+// runStreams implements the streams command.
+func runStreams(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	cw := newClient(ctx, opts)
+	var streams []model.LogStream
+	for _, g := range groups {
+		s, err := cw.ListStreams(ctx, g, opts.Prefix, opts.Limit)
+		if err != nil {
+			exitf(1, "list streams error for %s: %v", g, err)
+		}
+		streams = append(streams, s...)
+	}
+	if opts.PrettyJSON {
+		encodeIndented(streams)
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for _, s := range streams {
+		last := "-"
+		if !s.LastEventTime.IsZero() {
+			last = s.LastEventTime.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s %s/%s\n", last, s.LogGroup, s.Name)
+	}
+	_ = w.Flush()
+}
+
+func encodeIndented(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		exitf(1, "encode error: %v", err)
+	}
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
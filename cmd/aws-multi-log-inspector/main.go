@@ -1,176 +1,344 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"time"
 
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/progress"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"golang.org/x/term"
 
 	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
 )
 
-func usage() {
-	fmt.Fprintln(os.Stderr, "Usage: aws-multi-log-inspector --filter-pattern <pattern> [--groups g1,g2] [--region us-east-1] [--start RFC3339] [--end RFC3339]")
-	fmt.Fprintln(os.Stderr, "Environment: LOG_GROUP_NAMES can provide comma-separated groups; AWS credentials from default sources.")
+// usage prints help for the command (or the command list) and exits(2).
+func usage(command string) {
+	if c, ok := cmd.LookupCommand(command); ok {
+		c.PrintUsage(os.Stderr)
+	} else {
+		cmd.PrintUsage(os.Stderr)
+	}
 	os.Exit(2)
 }
 
+// runNow is the reference time for relative windows. A replay uses the time
+// of the recorded run so that --since resolves to the recorded window.
+var runNow = time.Now()
+
+// replay serves FilterLogEvents when --replay is set.
+var replay *client.Replayer
+
+// recordFile receives the FilterLogEvents traffic with --record.
+var recordFile *os.File
+
+// redactor masks sensitive values in output with --redact (or redact.enabled
+// in the config file); nil prints messages as they are.
+var redactor *redact.Redactor
+
+// logger receives diagnostics on stderr: warnings by default, per-group
+// progress with -v, pages and AWS SDK traffic with --debug. With
+// --log-format json, errors and warnings are written through it as well.
+var (
+	logger   = slog.New(slog.DiscardHandler)
+	jsonLogs bool
+)
+
+// bar shows the progress of searches on stderr; nil when not shown.
+var bar *progress.Bar
+
+// telemetry records the run's searches for /metrics and --stats-json.
+var telemetry = metrics.NewSearch(metrics.NewRegistry())
+
 func main() {
-	// Parse flags/env and validate relationships
+	// Parse subcommand, flags, env and config, then validate relationships
 	opts := cmd.CollectOptions()
 	if msg, code := opts.Validate(); code != 0 {
-		if opts.FilterPattern == "" {
-			usage()
+		if msg == "" {
+			usage(opts.Command)
 		}
 		fmt.Fprintln(os.Stderr, msg)
 		os.Exit(code)
 	}
 
-	// Parse groups
-	groups := cmd.ParseGroupsCSV(opts.GroupsCSV)
-	if len(groups) == 0 {
-		fmt.Fprintln(os.Stderr, "error: no log groups provided (use --groups or LOG_GROUP_NAMES)")
-		os.Exit(1)
-	}
+	setupLogger(opts)
 
-	// Resolve search window: RFC3339 flags or last 24h by default
-	start, end, err := cmd.ResolveTimeWindow(opts.StartRFC3339, opts.EndRFC3339, time.Now())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "invalid time window: %v\n", err)
-		os.Exit(2)
+	if opts.Replay != "" {
+		f, err := os.Open(opts.Replay)
+		if err != nil {
+			exitf(1, "replay error: %v", err)
+		}
+		replay, err = client.LoadReplay(f)
+		f.Close()
+		if err != nil {
+			exitf(1, "replay error: %v", err)
+		}
+		runNow = replay.Now()
 	}
 
-	ctx := context.Background()
-	authOpts := client.AuthOptions{
-		Region:  opts.Region,
-		Profile: opts.Profile,
+	if opts.Redact {
+		// Validate already checked the rules
+		redactor, _ = redact.New(opts.RedactConfig)
 	}
-	cwOpts := client.NewCloudWatchOptions(authOpts)
-	cw, err := client.NewCloudWatchClient(ctx, cwOpts...)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create CloudWatch client: %v\n", err)
-		os.Exit(1)
+	if opts.StatsJSON != "" {
+		statsJSON = &runSummary{path: opts.StatsJSON, Command: opts.Command, Started: time.Now()}
 	}
 
-	insp := inspector.New(cw, groups, start, end)
-	// Configure concurrency (bounded by number of groups, minimum 1)
-	workers := opts.Concurrency
-	if workers <= 0 {
-		workers = 1
-	}
-	if workers > len(groups) {
-		workers = len(groups)
-	}
-	insp.SetWorkers(workers)
-	records, err := insp.Search(ctx, opts.FilterPattern)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "search error: %v\n", err)
-		os.Exit(1)
-	}
-	if len(records) == 0 {
-		// Report accurate time window in the message
-		windowMsg := "in the last 24h."
-		if opts.StartRFC3339 != "" || opts.EndRFC3339 != "" {
-			windowMsg = fmt.Sprintf("between %s and %s.", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	// The shell handles Ctrl-C itself, canceling only the running command
+	if opts.Command == "shell" {
+		runShell(opts)
+		if err := closeRecordFile(); err != nil {
+			exitf(1, "record error: %v", err)
 		}
-		fmt.Printf("No logs found for the given pattern `%s` %s\n", opts.FilterPattern, windowMsg)
 		return
 	}
 
-	// If --extract is not used, print first search results
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	if opts.Extract == "" {
-		// Align --pretty output format with --next-filter: emit JSON array
-		if opts.PrettyJSON {
-			if err := enc.Encode(records); err != nil {
-				fmt.Fprintf(os.Stderr, "encode error: %v\n", err)
-				os.Exit(1)
-			}
-			return
-		}
+	// Cancel in-flight requests on Ctrl-C; long-running commands stop cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	setupProgress(ctx, opts)
+	setupOutputFile(opts)
 
-		w := bufio.NewWriter(os.Stdout)
-		for _, r := range records {
-			ts := r.Timestamp.UTC().Format(time.RFC3339)
-			prefix := fmt.Sprintf("%s %s/%s", ts, r.LogGroup, r.LogStream)
-			fmt.Fprintf(w, "%s %s\n", prefix, r.Message)
+	switch opts.Command {
+	case "help":
+		runHelp(opts)
+	case "completion":
+		if err := cmd.WriteCompletion(os.Stdout, opts.Args[0]); err != nil {
+			exitf(1, "completion error: %v", err)
 		}
-		_ = w.Flush()
+	case "config":
+		runConfig(opts)
+	case "cache":
+		runCache(opts)
+	case "groups":
+		runGroups(ctx, opts)
+	case "streams":
+		runStreams(ctx, opts)
+	case "insights":
+		runInsights(ctx, opts)
+	case "tail":
+		runTail(ctx, opts)
+	case "watch":
+		runWatch(ctx, opts)
+	case "trace":
+		runTrace(ctx, opts)
+	case "stats":
+		runStats(ctx, opts)
+	case "diff":
+		runDiff(ctx, opts)
+	case "serve":
+		runServe(ctx, opts)
+	default:
+		runSearch(ctx, opts)
+	}
+	closeOutputFile()
+	closeExport(ctx)
+	if err := closeRecordFile(); err != nil {
+		exitf(1, "record error: %v", err)
+	}
+	statsJSON.write(0)
+}
+
+func runHelp(opts *cmd.Options) {
+	if len(opts.Args) == 0 {
+		cmd.PrintUsage(os.Stdout)
 		return
 	}
+	c, ok := cmd.LookupCommand(opts.Args[0])
+	if !ok {
+		exitf(2, "error: unknown command %q", opts.Args[0])
+	}
+	c.PrintUsage(os.Stdout)
+}
 
-	// Extract flow
-	// Parse extract flag: name=path
-	extractName, extractPath, err := opts.ParseExtractSpec()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(2)
+// setupLogger configures logger from -v, --debug and --log-format, and makes
+// it the default and the util package's logger.
+func setupLogger(opts *cmd.Options) {
+	level := slog.LevelWarn
+	switch {
+	case opts.Debug:
+		level = slog.LevelDebug
+	case opts.Verbose:
+		level = slog.LevelInfo
 	}
+	hopts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, hopts)
+	if opts.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, hopts)
+		jsonLogs = true
+	}
+	logger = slog.New(h)
+	slog.SetDefault(logger)
+	util.SetLogger(logger)
+}
 
-	// Build minimal []types.FilteredLogEvent with only Message populated
-	evs := make([]types.FilteredLogEvent, 0, len(records))
-	for _, r := range records {
-		msg := r.Message
-		evs = append(evs, types.FilteredLogEvent{Message: aws.String(msg)})
+// setupProgress starts the progress display of one-shot searches when stderr
+// is a terminal, unless --no-progress, -v or --debug is given.
+func setupProgress(ctx context.Context, opts *cmd.Options) {
+	switch opts.Command {
+	case "search", "trace", "stats", "diff":
+	default:
+		return
+	}
+	fd := int(os.Stderr.Fd())
+	if opts.NoProgress || opts.Verbose || opts.Debug || opts.TUI || !term.IsTerminal(fd) {
+		return
 	}
+	bar = progress.New(os.Stderr)
+	bar.Width = func() int {
+		w, _, _ := term.GetSize(fd)
+		return w
+	}
+	go bar.Run(ctx, progress.DefaultInterval)
+}
 
-	extracted, ok, err := util.ExtractFirstValue(evs, extractPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "extract error: %v\n", err)
-		os.Exit(1)
+// exitf prints a message to stderr and exits with code.
+func exitf(code int, format string, args ...any) {
+	if bar != nil {
+		bar.Done()
 	}
-	if !ok {
-		fmt.Fprintln(os.Stderr, "no extractable value found from initial logs")
-		os.Exit(3)
+	discardOutputFile()
+	msg := fmt.Sprintf(format, args...)
+	if err := closeRecordFile(); err != nil {
+		msg += fmt.Sprintf("\nrecord error: %v", err)
+	}
+	if jsonLogs {
+		logger.Error(msg, "exit_code", code)
+	} else {
+		fmt.Fprintln(os.Stderr, msg)
 	}
+	statsJSON.write(code)
+	os.Exit(code)
+}
 
-	// If no --next-filter, just output {"value": "..."}
-	if opts.NextFilter == "" {
-		out := map[string]string{"value": extracted}
-		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
-			fmt.Fprintf(os.Stderr, "encode error: %v\n", err)
-			os.Exit(1)
-		}
+// warnf reports a problem that does not stop the command.
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if jsonLogs {
+		logger.Warn(msg)
 		return
 	}
+	fmt.Fprintln(os.Stderr, "warning: "+msg)
+}
 
-	// Build next filter pattern
-	replaced := util.ReplacePlaceholder(opts.NextFilter, extractName, extracted)
-	nextPattern, err := util.BuildNextFilter(replaced, extracted)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "next-filter build error: %v\n", err)
-		os.Exit(1)
+// requireGroups returns the configured groups or exits(1) when there are none.
+func requireGroups(opts *cmd.Options) []string {
+	groups := cmd.ParseGroupsCSV(opts.GroupsCSV)
+	if len(groups) == 0 {
+		exitf(1, "error: no log groups provided (use --groups or LOG_GROUP_NAMES)")
 	}
+	return groups
+}
 
-	// Second search using the nextPattern (exactly as given), across groups
-	nextInspector := inspector.New(cw, groups, start, end)
-	nextInspector.SetWorkers(workers)
-	nextRecords, err := nextInspector.Search(ctx, nextPattern)
+// resolveWindow resolves the search window: RFC3339 flags, --since, or last 24h by default.
+func resolveWindow(opts *cmd.Options) (time.Time, time.Time) {
+	start, end, err := cmd.ResolveTimeWindowSince(opts.StartRFC3339, opts.EndRFC3339, opts.Since, runNow)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "second search error: %v\n", err)
-		os.Exit(1)
+		exitf(2, "invalid time window: %v", err)
 	}
+	return start, end
+}
 
-	// Output JSON array of results
-	if opts.PrettyJSON {
-		if err := enc.Encode(nextRecords); err != nil {
-			fmt.Fprintf(os.Stderr, "encode error: %v\n", err)
-			os.Exit(1)
+// windowDescription reports the time window for "no logs found" messages.
+func windowDescription(opts *cmd.Options, start, end time.Time) string {
+	switch {
+	case opts.Since != "" && opts.EndRFC3339 == "":
+		return fmt.Sprintf("in the last %s.", opts.Since)
+	case opts.StartRFC3339 != "" || opts.EndRFC3339 != "" || opts.Since != "":
+		return fmt.Sprintf("between %s and %s.", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	}
+	return "in the last 24h."
+}
+
+// newClient returns the CloudWatch client, or one backed by the --replay
+// recording. With --record, the client's FilterLogEvents traffic is written
+// to the file as it happens.
+func newClient(ctx context.Context, opts *cmd.Options) *client.CloudWatchClient {
+	if replay != nil {
+		return client.NewCloudWatchClientFromAPI(replay, client.WithMetrics(telemetry), client.WithLogger(logger))
+	}
+	authOpts := client.AuthOptions{
+		Region:  opts.Region,
+		Profile: opts.Profile,
+	}
+	cwOpts := append(client.NewCloudWatchOptions(authOpts), client.WithMetrics(telemetry), client.WithLogger(logger))
+	if bar != nil {
+		cwOpts = append(cwOpts, client.WithProgress(func(p client.PageProgress) { bar.Page(p.Group, p.Events, p.Newest) }))
+	}
+	if opts.Unmask {
+		cwOpts = append(cwOpts, client.WithUnmask())
+	}
+	if opts.Record != "" {
+		f, err := os.Create(opts.Record)
+		if err != nil {
+			exitf(1, "record error: %v", err)
 		}
-		return
+		recordFile = f
+		cwOpts = append(cwOpts, client.WithRecording(f, runNow))
 	}
-	if err := json.NewEncoder(os.Stdout).Encode(nextRecords); err != nil {
-		fmt.Fprintf(os.Stderr, "encode error: %v\n", err)
-		os.Exit(1)
+	cw, err := client.NewCloudWatchClient(ctx, cwOpts...)
+	if err != nil {
+		exitf(1, "failed to create CloudWatch client: %v", err)
+	}
+	return cw
+}
+
+// closeRecordFile closes the --record file, if any; a failed close may have
+// lost the end of the recording.
+func closeRecordFile() error {
+	f := recordFile
+	if f == nil {
+		return nil
+	}
+	recordFile = nil
+	return f.Close()
+}
+
+func newInspector(r inspector.CloudWatchLogsRetriever, opts *cmd.Options, groups []string, start, end time.Time) *inspector.Inspector {
+	insp := inspector.New(r, groups, start, end)
+	// Configure concurrency (bounded by number of groups, minimum 1)
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	insp.SetWorkers(workers)
+	insp.SetMetrics(telemetry)
+	insp.SetLogger(logger)
+	if bar != nil {
+		insp.SetProgress(inspector.Progress{
+			SearchStarted: bar.Start,
+			GroupDone:     func(group string, _ int, _ error) { bar.GroupDone(group) },
+			SearchDone:    func(int, error) { bar.Done() },
+		})
+	}
+	return insp
+}
+
+// parserFormat returns the validated --parser format; empty means auto-detect.
+func parserFormat(opts *cmd.Options) parser.Format {
+	format, _ := parser.ParseFormat(opts.Parser)
+	return format
+}
+
+// writeRecordLines prints one "<RFC3339> <group>/<stream> <message>" line per record.
+func writeRecordLines(w io.Writer, records []model.LogRecord) {
+	for _, r := range records {
+		ts := r.Timestamp.UTC().Format(time.RFC3339)
+		prefix := fmt.Sprintf("%s %s/%s", ts, r.LogGroup, r.LogStream)
+		fmt.Fprintf(w, "%s %s\n", prefix, r.Message)
 	}
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// useReplay serves the command's AWS traffic from a recording in testdata.
+func useReplay(t *testing.T, name string) {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rp, err := client.LoadReplay(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldReplay, oldNow := replay, runNow
+	replay, runNow = rp, rp.Now()
+	t.Cleanup(func() { replay, runNow = oldReplay, oldNow })
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = old }()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestSearchReplay(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api,/aws/lambda/worker", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() { runSearch(context.Background(), opts) })
+	want := strings.Join([]string{
+		"2025-08-31T11:10:00Z /aws/lambda/api/2025/08/31/[$LATEST]abc ERROR payment 42 failed",
+		"2025-08-31T11:15:00Z /aws/lambda/worker/w1 ERROR queue timeout",
+		"2025-08-31T11:20:00Z /aws/lambda/api/2025/08/31/[$LATEST]abc ERROR payment 43 failed",
+	}, "\n") + "\n"
+	if out != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSearchReplayRedact(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	cfg := "redact:\n  enabled: true\n  rules:\n    - {name: payment, regex: 'payment (\\d+)'}\n"
+	if err := os.MkdirAll(filepath.Dir(cmd.DefaultConfigPath()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cmd.DefaultConfigPath(), []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := redactor
+	redactor, _ = redact.New(opts.RedactConfig)
+	t.Cleanup(func() { redactor = old })
+
+	out := captureStdout(t, func() { runSearch(context.Background(), opts) })
+	if !opts.Redact || strings.Count(out, "ERROR payment [payment:") != 2 || strings.Contains(out, "42") {
+		t.Fatalf("output:\n%s", out)
+	}
+}
+
+func TestSearchReplayStatsJSON(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path := filepath.Join(dir, "stats.json")
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api,/aws/lambda/worker", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl", "--stats-json", path}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldTelemetry := telemetry
+	telemetry = metrics.NewSearch(metrics.NewRegistry())
+	statsJSON = &runSummary{path: opts.StatsJSON, Command: opts.Command, Started: time.Now()}
+	t.Cleanup(func() { telemetry, statsJSON = oldTelemetry, nil })
+
+	captureStdout(t, func() { runSearch(context.Background(), opts) })
+	statsJSON.write(0)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runSummary
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Command != "search" || got.Searches != 1 || got.Records != 3 || len(got.Groups) != 2 || got.Total.Events != 3 || got.Total.Searches != 2 || got.Total.Pages < 2 {
+		t.Fatalf("summary:\n%s", b)
+	}
+}
+
+func TestSearchReplayExport(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, b)
+		io.WriteString(w, "{}")
+	}))
+	defer srv.Close()
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api,/aws/lambda/worker", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl",
+		"--region", "us-east-1", "--export", "otlp", "--export-protocol", "http/json", "--export-endpoint", srv.URL}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink, exported = nil, 0 })
+
+	captureStdout(t, func() {
+		runSearch(context.Background(), opts)
+		closeExport(context.Background())
+	})
+	if len(bodies) != 1 || exported != 3 {
+		t.Fatalf("%d requests, %d records exported", len(bodies), exported)
+	}
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value struct{ StringValue string }
+				}
+			}
+			ScopeLogs []struct {
+				LogRecords []struct{ Body struct{ StringValue string } }
+			}
+		}
+	}
+	if err := json.Unmarshal(bodies[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	var bodiesByService []string
+	for _, rl := range req.ResourceLogs {
+		attrs := map[string]string{}
+		for _, a := range rl.Resource.Attributes {
+			attrs[a.Key] = a.Value.StringValue
+		}
+		if attrs["cloud.region"] != "us-east-1" {
+			t.Errorf("resource attributes = %v", attrs)
+		}
+		for _, r := range rl.ScopeLogs[0].LogRecords {
+			bodiesByService = append(bodiesByService, attrs["service.name"]+": "+r.Body.StringValue)
+		}
+	}
+	want := []string{"api: ERROR payment 42 failed", "api: ERROR payment 43 failed", "worker: ERROR queue timeout"}
+	if !slices.Equal(bodiesByService, want) {
+		t.Fatalf("records = %q", bodiesByService)
+	}
+}
+
+func TestSearchReplayOutputFile(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "out.ndjson.gz")
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api,/aws/lambda/worker", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl",
+		"--output-file", path, "--flatten-fields"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() {
+		setupOutputFile(opts)
+		runSearch(context.Background(), opts)
+		closeOutputFile()
+	})
+	if out != "" {
+		t.Fatalf("stdout = %q", out)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(zr)
+	var messages []string
+	for dec.More() {
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, row["log_group"].(string)+": "+row["message"].(string))
+	}
+	want := []string{"/aws/lambda/api: ERROR payment 42 failed", "/aws/lambda/worker: ERROR queue timeout", "/aws/lambda/api: ERROR payment 43 failed"}
+	if !slices.Equal(messages, want) {
+		t.Fatalf("rows = %q", messages)
+	}
+}
+
+func TestSearchReplaySQL(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	opts, err := cmd.Parse([]string{"--groups", "/aws/lambda/api,/aws/lambda/worker", "--filter-pattern", "ERROR", "--since", "1h", "--replay", "testdata/search.replay.jsonl",
+		"--sql", "SELECT log_group, count(*) AS n, max(timestamp) AS last FROM records GROUP BY 1 ORDER BY n DESC"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() { runSearch(context.Background(), opts) })
+	want := "" +
+		"log_group           n  last\n" +
+		"/aws/lambda/api     2  2025-08-31T11:20:00.000Z\n" +
+		"/aws/lambda/worker  1  2025-08-31T11:15:00.000Z\n"
+	if out != want {
+		t.Fatalf("stdout:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestSearchInputSQL(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "saved.parquet")
+	f, err := recordfile.Create(path, recordfile.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2025, 8, 31, 11, 0, 0, 0, time.UTC)
+	f.Write([]model.LogRecord{
+		{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "s1", Message: `{"level":"error","user":"ann","token":"secret"}`},
+		{Timestamp: t0.Add(time.Minute), LogGroup: "/aws/lambda/api", LogStream: "s1", Message: `{"level":"info","user":"bob"}`},
+	})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := cmd.Parse([]string{"--input", path, "--pretty", "--sql", "SELECT user, level FROM records WHERE level = 'error'"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := captureStdout(t, func() { runSearch(context.Background(), opts) })
+	var got []map[string]any
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if len(got) != 1 || got[0]["user"] != "ann" || got[0]["level"] != "error" {
+		t.Fatalf("rows = %v", got)
+	}
+}
+
+func TestCloseRecordFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "run.replay.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordFile = f
+	if err := closeRecordFile(); err != nil || recordFile != nil {
+		t.Fatalf("closeRecordFile() = %v, recordFile = %v", err, recordFile)
+	}
+	if _, err := f.WriteString("x"); err == nil {
+		t.Fatal("record file still open")
+	}
+	if err := closeRecordFile(); err != nil {
+		t.Fatalf("second closeRecordFile() = %v", err)
+	}
+}
+
+func TestShellReplay(t *testing.T) {
+	useReplay(t, "search.replay.jsonl")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	opts, err := cmd.Parse([]string{"shell", "--groups", "/aws/lambda/api", "--since", "1h", "--replay", "testdata/search.replay.jsonl"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "groups +/aws/lambda/worker\nsearch ERROR\nextract msg=message\nexit\nsearch never-run\n")
+	w.Close()
+	old := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = old }()
+
+	out := captureStdout(t, func() { runShell(opts) })
+	want := strings.Join([]string{
+		"groups: /aws/lambda/api,/aws/lambda/worker",
+		"2025-08-31T11:10:00Z /aws/lambda/api/2025/08/31/[$LATEST]abc ERROR payment 42 failed",
+		"2025-08-31T11:15:00Z /aws/lambda/worker/w1 ERROR queue timeout",
+		"2025-08-31T11:20:00Z /aws/lambda/api/2025/08/31/[$LATEST]abc ERROR payment 43 failed",
+		"(3 records for ERROR)",
+		"msg = ERROR payment 42 failed",
+	}, "\n") + "\n"
+	if out != want {
+		t.Fatalf("output:\n%s\nwant:\n%s", out, want)
+	}
+}
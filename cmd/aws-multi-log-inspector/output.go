@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// outFile receives the records with --output-file; nil prints them.
+var outFile *recordfile.File
+
+// setupOutputFile starts writing the --output-file.
+func setupOutputFile(opts *cmd.Options) {
+	if opts.OutputFile == "" {
+		return
+	}
+	f, err := recordfile.Create(opts.OutputFile, recordfile.Options{Flatten: opts.FlattenFields, Parser: parserFormat(opts)})
+	if err != nil {
+		exitf(1, "output file error: %v", err)
+	}
+	outFile = f
+}
+
+// writeOutputFile writes records to the --output-file and reports whether
+// there is one; without one, the caller prints them.
+func writeOutputFile(records []model.LogRecord) bool {
+	if outFile == nil {
+		return false
+	}
+	if err := outFile.Write(records); err != nil {
+		exitf(1, "output file error: %v", err)
+	}
+	return true
+}
+
+// closeOutputFile completes the --output-file.
+func closeOutputFile() {
+	f := outFile
+	if f == nil {
+		return
+	}
+	outFile = nil
+	if err := f.Close(); err != nil {
+		exitf(1, "output file error: %v", err)
+	}
+	if f.Dropped > 0 {
+		warnf("%d flattened values did not match the type of their Parquet column and were left out of %s", f.Dropped, f.Path())
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d records to %s\n", f.Records, f.Path())
+}
+
+// discardOutputFile removes the unfinished --output-file of a failed run.
+func discardOutputFile() {
+	if outFile != nil {
+		outFile.Remove()
+		outFile = nil
+	}
+}
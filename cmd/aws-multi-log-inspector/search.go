@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cluster"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/invocation"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runSearch implements the search command (and `run <saved-search>`).
+func runSearch(ctx context.Context, opts *cmd.Options) {
+	if opts.Checkpoint != "" || opts.Resume != "" {
+		runCheckpointedSearch(ctx, opts)
+		return
+	}
+	if opts.TUI {
+		runTUI(ctx, opts)
+		return
+	}
+	if len(opts.Input) > 0 {
+		runInputQuery(opts)
+		return
+	}
+	groups := requireGroups(opts)
+	format := parserFormat(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+	setupExport(ctx, opts, cw)
+	retriever := searchRetriever(ctx, opts, cw)
+
+	insp := newInspector(retriever, opts, groups, start, end)
+	records, err := insp.Search(ctx, opts.FilterPattern)
+	if err != nil {
+		exitf(1, "search error: %v", err)
+	}
+	if len(records) == 0 {
+		// A query still has a result, e.g. a count of 0
+		if !printQuery(opts, records) {
+			fmt.Printf("No logs found for the given pattern `%s` %s\n", opts.FilterPattern, windowDescription(opts, start, end))
+		}
+		return
+	}
+	if opts.Parser != "" {
+		parser.Annotate(records, format)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if opts.LambdaInvocation {
+		invs, err := invocation.Reconstruct(ctx, cw, records)
+		if err != nil {
+			exitf(1, "invocation search error: %v", err)
+		}
+		if len(invs) == 0 {
+			fmt.Fprintln(os.Stderr, "no Lambda request IDs found in matched records")
+			return
+		}
+		for i := range invs {
+			if opts.Parser != "" {
+				parser.Annotate(invs[i].Records, format)
+			}
+			redactor.Records(invs[i].Records)
+			exportRecords(ctx, invs[i].Records)
+		}
+		if outFile != nil {
+			for _, inv := range invs {
+				writeOutputFile(inv.Records)
+			}
+			return
+		}
+		if opts.SQL != "" {
+			var all []model.LogRecord
+			for _, inv := range invs {
+				all = append(all, inv.Records...)
+			}
+			printQuery(opts, all)
+			return
+		}
+		if opts.PrettyJSON {
+			if err := enc.Encode(invs); err != nil {
+				exitf(1, "encode error: %v", err)
+			}
+			return
+		}
+		w := bufio.NewWriter(os.Stdout)
+		for _, inv := range invs {
+			fmt.Fprintln(w, inv.Summary())
+			for _, r := range inv.Records {
+				fmt.Fprintf(w, "%s %s\n", r.Timestamp.UTC().Format(time.RFC3339Nano), strings.TrimRight(r.Message, "\n"))
+			}
+		}
+		_ = w.Flush()
+		return
+	}
+
+	if opts.Cluster {
+		redactor.Records(records)
+		clusters := cluster.Build(records, cluster.Options{Threshold: opts.ClusterThreshold})
+		if opts.PrettyJSON {
+			if err := enc.Encode(clusters); err != nil {
+				exitf(1, "encode error: %v", err)
+			}
+			return
+		}
+		w := bufio.NewWriter(os.Stdout)
+		writeClusters(w, clusters)
+		_ = w.Flush()
+		return
+	}
+
+	// If --extract is not used, print first search results
+	if opts.Extract == "" {
+		redactor.Records(records)
+		exportRecords(ctx, records)
+		if writeOutputFile(records) || printQuery(opts, records) {
+			return
+		}
+		// Align --pretty output format with --next-filter: emit JSON array
+		if opts.PrettyJSON {
+			if err := enc.Encode(records); err != nil {
+				exitf(1, "encode error: %v", err)
+			}
+			return
+		}
+
+		w := bufio.NewWriter(os.Stdout)
+		writeRecordLines(w, records)
+		_ = w.Flush()
+		return
+	}
+
+	// Extract flow
+	// Parse extract flag: name=path
+	extractName, extractPath, err := opts.ParseExtractSpec()
+	if err != nil {
+		exitf(2, "%s", err.Error())
+	}
+
+	// Build minimal []types.FilteredLogEvent with only Message populated
+	evs := make([]types.FilteredLogEvent, 0, len(records))
+	for _, r := range records {
+		msg := r.Message
+		evs = append(evs, types.FilteredLogEvent{Message: aws.String(msg)})
+	}
+
+	extracted, ok, err := util.ExtractFirstValueWithParser(evs, extractPath, format)
+	if err != nil {
+		exitf(1, "extract error: %v", err)
+	}
+	if !ok {
+		exitf(3, "no extractable value found from initial logs")
+	}
+	warnMasked(opts, records)
+
+	// If no --next-filter, just output {"value": "..."}
+	if opts.NextFilter == "" {
+		out := map[string]string{"value": redactor.String(extracted)}
+		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+		return
+	}
+
+	// Build next filter pattern
+	replaced := util.ReplacePlaceholder(opts.NextFilter, extractName, extracted)
+	nextPattern, err := util.BuildNextFilter(replaced, extracted)
+	if err != nil {
+		exitf(1, "next-filter build error: %v", err)
+	}
+
+	// Second search using the nextPattern (exactly as given), across groups
+	nextInspector := newInspector(retriever, opts, groups, start, end)
+	nextRecords, err := nextInspector.Search(ctx, nextPattern)
+	if err != nil {
+		exitf(1, "second search error: %v", err)
+	}
+	if opts.Parser != "" {
+		parser.Annotate(nextRecords, format)
+	}
+	redactor.Records(nextRecords)
+	exportRecords(ctx, nextRecords)
+	if writeOutputFile(nextRecords) || printQuery(opts, nextRecords) {
+		return
+	}
+
+	// Output JSON array of results
+	if opts.PrettyJSON {
+		if err := enc.Encode(nextRecords); err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+		return
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(nextRecords); err != nil {
+		exitf(1, "encode error: %v", err)
+	}
+}
+
+// writeClusters prints each template with its count, first/last seen time,
+// affected groups and an example record.
+func writeClusters(w io.Writer, clusters []*cluster.Cluster) {
+	for _, c := range clusters {
+		fmt.Fprintf(w, "%d\t%s .. %s\t%s\n", c.Count, c.FirstSeen.UTC().Format(time.RFC3339), c.LastSeen.UTC().Format(time.RFC3339), strings.Join(c.Groups, ","))
+		fmt.Fprintf(w, "  %s\n", c.Template)
+		fmt.Fprint(w, "  e.g. ")
+		writeRecordLines(w, []model.LogRecord{c.Example})
+	}
+}
+
+// warnMasked warns when an extract ran over records masked by a data
+// protection policy, whose values may be asterisks rather than data.
+func warnMasked(opts *cmd.Options, records []model.LogRecord) {
+	if opts.Unmask {
+		return
+	}
+	masked := 0
+	for _, r := range records {
+		if r.Masked() {
+			masked++
+		}
+	}
+	if masked > 0 {
+		warnf("%d of %d records look masked by a data protection policy; the extracted value may be masked (use --unmask, which needs logs:Unmask)", masked, len(records))
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/server"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// shutdownTimeout bounds how long in-flight requests may finish after Ctrl-C.
+const shutdownTimeout = 10 * time.Second
+
+// runServe implements the serve command: the HTTP/JSON API until Ctrl-C.
+func runServe(ctx context.Context, opts *cmd.Options) {
+	cw := newClient(ctx, opts)
+	h := server.New(server.Config{
+		Retriever:     searchRetriever(ctx, opts, cw),
+		Groups:        cmd.ParseGroupsCSV(opts.GroupsCSV),
+		Workers:       opts.Concurrency,
+		MaxConcurrent: opts.MaxConcurrent,
+		Timeout:       opts.RequestTimeout,
+		Window: func(start, end, since string) (time.Time, time.Time, error) {
+			return cmd.ResolveTimeWindowSince(start, end, since, time.Now())
+		},
+		Redactor: redactor,
+		Metrics:  telemetry,
+		Logger:   logger,
+	})
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		exitf(1, "serve error: %v", err)
+	}
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = srv.Shutdown(sctx)
+	}()
+	fmt.Fprintf(os.Stderr, "serving on http://%s (OpenAPI description at /openapi.json, metrics at /metrics)\n", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		exitf(1, "serve error: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/shell"
+
+	"golang.org/x/term"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// shellPrompt is shown before each shell command on a terminal.
+const shellPrompt = "inspector> "
+
+// runShell implements the shell command. On a terminal it offers line
+// editing, history and tab completion; otherwise it runs the commands read
+// from stdin, one per line.
+func runShell(opts *cmd.Options) {
+	ctx := context.Background()
+	cw := newClient(ctx, opts)
+	retriever := searchRetriever(ctx, opts, cw)
+	format := parserFormat(opts)
+
+	cfg := shell.Config{
+		Search: func(ctx context.Context, groups []string, start, end time.Time, pattern string) ([]model.LogRecord, error) {
+			records, err := newInspector(retriever, opts, groups, start, end).Search(ctx, pattern)
+			if err == nil && opts.Parser != "" {
+				parser.Annotate(records, format)
+			}
+			return records, err
+		},
+		ListGroups: func(ctx context.Context, prefix string) ([]string, error) {
+			groups, err := cw.ListGroups(ctx, prefix)
+			names := make([]string, 0, len(groups))
+			for _, g := range groups {
+				names = append(names, g.Name)
+			}
+			return names, err
+		},
+		ParseDuration: cmd.ParseSince,
+		Groups:        cmd.ParseGroupsCSV(opts.GroupsCSV),
+		Format:        format,
+		Redactor:      redactor,
+		Unmask:        opts.Unmask,
+	}
+	if replay != nil {
+		cfg.Now = replay.Now
+	}
+	// Without an explicit window the session follows the last 24h (or --since).
+	if opts.StartRFC3339 == "" && opts.EndRFC3339 == "" {
+		cfg.Since = 24 * time.Hour
+		if opts.Since != "" {
+			cfg.Since, _ = cmd.ParseSince(opts.Since)
+		}
+	} else {
+		cfg.Start, cfg.End = resolveWindow(opts)
+	}
+	sess := shell.New(cfg)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if !execShell(sess, sc.Text(), os.Stdout) {
+				return
+			}
+		}
+		return
+	}
+
+	hist, err := shell.LoadHistory(filepath.Join(filepath.Dir(cmd.DefaultConfigPath()), "shell_history"), shell.DefaultHistorySize)
+	if err != nil {
+		warnf("shell history not loaded: %v", err)
+		hist, _ = shell.LoadHistory("", shell.DefaultHistorySize)
+	}
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, shellPrompt)
+	t.History = hist
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' || pos != len(line) {
+			return "", 0, false
+		}
+		completed, ok := sess.Complete(ctx, line)
+		return completed, len(completed), ok
+	}
+	fmt.Fprintln(t, "Type help for commands; Ctrl-C cancels a running search, Ctrl-D exits.")
+	for {
+		// Raw mode only while editing, so Ctrl-C interrupts a running command.
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			exitf(1, "shell error: %v", err)
+		}
+		if w, h, err := term.GetSize(fd); err == nil && w > 0 {
+			_ = t.SetSize(w, h)
+		}
+		line, err := t.ReadLine()
+		_ = term.Restore(fd, state)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				exitf(1, "shell error: %v", err)
+			}
+			fmt.Println()
+			return
+		}
+		if !execShell(sess, line, os.Stdout) {
+			return
+		}
+	}
+}
+
+// execShell runs one shell command, cancelable with Ctrl-C, and reports
+// whether the session continues.
+func execShell(sess *shell.Session, line string, w io.Writer) bool {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := sess.Exec(ctx, line, w)
+	switch {
+	case errors.Is(err, shell.ErrExit):
+		return false
+	case ctx.Err() != nil:
+		fmt.Fprintln(os.Stderr, "canceled")
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	return true
+}
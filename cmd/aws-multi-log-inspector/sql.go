@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/query"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// printQuery runs --sql over records and prints its result as a table, or
+// as a JSON array with --pretty. It reports whether there is a query;
+// without one, the caller prints the records.
+func printQuery(opts *cmd.Options, records []model.LogRecord) bool {
+	if opts.SQL == "" {
+		return false
+	}
+	q, err := query.Parse(opts.SQL)
+	if err != nil {
+		exitf(2, "error: --sql: %v", err)
+	}
+	res, err := q.Run(records, parserFormat(opts))
+	if err != nil {
+		exitf(1, "sql error: %v", err)
+	}
+	if opts.PrettyJSON {
+		encodeIndented(res)
+		return true
+	}
+	w := bufio.NewWriter(os.Stdout)
+	_ = res.WriteTable(w)
+	_ = w.Flush()
+	return true
+}
+
+// runInputQuery implements search --input: --sql over the records of saved
+// result files, without AWS access.
+func runInputQuery(opts *cmd.Options) {
+	var records []model.LogRecord
+	for _, path := range opts.Input {
+		rs, err := recordfile.ReadFile(path)
+		if err != nil {
+			exitf(1, "input error: %v", err)
+		}
+		records = append(records, rs...)
+	}
+	redactor.Records(records)
+	printQuery(opts, records)
+}
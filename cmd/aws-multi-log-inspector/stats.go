@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runStats implements the stats command: matching event counts per time
+// bucket and series key.
+func runStats(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+	retriever := searchRetriever(ctx, opts, cw)
+
+	interval := opts.Interval
+	if interval == 0 {
+		interval = stats.AutoInterval(start, end, stats.TargetBuckets)
+	}
+	o := stats.Options{
+		Start:    start,
+		End:      end,
+		Interval: interval,
+		By:       opts.By,
+		Format:   parserFormat(opts),
+		Top:      opts.Top,
+	}
+	// Refuse bad options before the search, which may take long
+	if err := o.Validate(); err != nil {
+		exitf(2, "stats error: %v", err)
+	}
+
+	records, err := newInspector(retriever, opts, groups, start, end).Search(ctx, opts.FilterPattern)
+	if err != nil {
+		exitf(1, "search error: %v", err)
+	}
+	// Series keys taken from messages are redacted like printed messages
+	redactor.Records(records)
+	res, err := stats.Aggregate(records, o)
+	if err != nil {
+		exitf(2, "stats error: %v", err)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if opts.Output == stats.OutputJSON {
+		enc := json.NewEncoder(w)
+		if opts.PrettyJSON {
+			enc.SetIndent("", "  ")
+		}
+		err = enc.Encode(res)
+	} else if res.Total == 0 {
+		fmt.Fprintf(w, "No logs found for the given pattern `%s` %s\n", opts.FilterPattern, windowDescription(opts, start, end))
+	} else {
+		switch opts.Output {
+		case stats.OutputSparkline:
+			err = res.WriteSparklines(w)
+		case stats.OutputHistogram:
+			err = res.WriteHistogram(w)
+		default:
+			err = res.WriteTable(w)
+		}
+	}
+	if err != nil {
+		exitf(1, "output error: %v", err)
+	}
+}
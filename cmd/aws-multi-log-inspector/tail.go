@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runTail implements the tail command: print matches from the last --since,
+// then keep printing new ones every --interval until interrupted.
+func runTail(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	lookback, err := cmd.ParseSince(opts.Since)
+	if err != nil {
+		exitf(2, "invalid --since: %v", err)
+	}
+	now := time.Now()
+	cw := newClient(ctx, opts)
+	setupExport(ctx, opts, cw)
+	insp := newInspector(cw, opts, groups, now.Add(-lookback), now)
+	serveMetrics(ctx, opts.MetricsAddr)
+
+	emit, flush := recordStream(os.Stdout, opts)
+	err = insp.Tail(ctx, opts.FilterPattern, opts.Interval, func(records []model.LogRecord) error {
+		if err := emit(records); err != nil {
+			return err
+		}
+		exportRecords(ctx, records)
+		flushExport(ctx)
+		return flush()
+	})
+	if err != nil {
+		exitf(1, "tail error: %v", err)
+	}
+}
+
+// recordStream returns a function writing records as they arrive, and one
+// flushing buffered output. Records are annotated by --parser and redacted
+// by --redact in place, before they are exported, and go to the
+// --output-file when there is one; JSON output
+// (--pretty or --parser) is one document per record so it can be streamed.
+func recordStream(out io.Writer, opts *cmd.Options) (emit func([]model.LogRecord) error, flush func() error) {
+	format := parserFormat(opts)
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	if opts.PrettyJSON {
+		enc.SetIndent("", "  ")
+	}
+	emit = func(records []model.LogRecord) error {
+		if opts.Parser != "" {
+			parser.Annotate(records, format)
+		}
+		redactor.Records(records)
+		if writeOutputFile(records) {
+			return nil
+		}
+		if opts.PrettyJSON || opts.Parser != "" {
+			for _, r := range records {
+				if err := enc.Encode(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		writeRecordLines(w, records)
+		return nil
+	}
+	return emit, w.Flush
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+)
+
+// runSummary is the --stats-json summary of a run.
+type runSummary struct {
+	path     string
+	Command  string
+	Started  time.Time
+	Seconds  float64
+	ExitCode int
+	metrics.Summary
+}
+
+// statsJSON is written when the command ends, with --stats-json.
+var statsJSON *runSummary
+
+// write writes the summary once; a nil summary does nothing.
+func (s *runSummary) write(code int) {
+	if s == nil || s.path == "" {
+		return
+	}
+	path := s.path
+	s.path = ""
+	s.Seconds = time.Since(s.Started).Seconds()
+	s.ExitCode = code
+	s.Summary = telemetry.Summary()
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		warnf("stats-json not written: %v", err)
+		return
+	}
+	b = append(b, '\n')
+	if path == "-" {
+		_, err = os.Stderr.Write(b)
+	} else {
+		err = os.WriteFile(path, b, 0o644)
+	}
+	if err != nil {
+		warnf("stats-json not written: %v", err)
+	}
+}
+
+// serveMetrics serves the search metrics at http://addr/metrics until ctx
+// ends, for --metrics-addr.
+func serveMetrics(ctx context.Context, addr string) {
+	if addr == "" {
+		return
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		exitf(1, "metrics error: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", telemetry.Registry())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			warnf("metrics server stopped: %v", err)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "metrics on http://%s/metrics\n", ln.Addr())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runTrace implements the trace command: a search for the ID across groups,
+// expanded with the related IDs found in the matches, shown as a timeline.
+func runTrace(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	format := parserFormat(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+	setupExport(ctx, opts, cw)
+	retriever := searchRetriever(ctx, opts, cw)
+
+	search := func(ctx context.Context, pattern string) ([]model.LogRecord, error) {
+		return newInspector(retriever, opts, groups, start, end).Search(ctx, pattern)
+	}
+	tracer, err := trace.New(search, opts.TraceConfig, format)
+	if err != nil {
+		exitf(2, "error: trace config: %v", err)
+	}
+	res, err := tracer.Trace(ctx, opts.Args[0])
+	if err != nil {
+		exitf(1, "search error: %v", err)
+	}
+	if len(res.Records) == 0 {
+		fmt.Printf("No logs found for the given ID `%s` %s\n", opts.Args[0], windowDescription(opts, start, end))
+		return
+	}
+	if opts.Parser != "" {
+		parser.Annotate(res.Records, format)
+	}
+	redactor.Records(res.Records)
+	exportRecords(ctx, res.Records)
+	for _, ids := range [][]trace.ID{res.IDs, res.Pending} {
+		for i := range ids {
+			ids[i].Value = redactor.String(ids[i].Value)
+		}
+	}
+	if printQuery(opts, res.Records) {
+		return
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	// With --output-file, the records go to the file and the summary to stdout
+	if writeOutputFile(res.Records) {
+		_ = res.WriteSummary(w)
+		return
+	}
+	tl := res.Timeline()
+	if opts.PrettyJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			*trace.Result
+			Timeline trace.Timeline
+		}{res, tl}); err != nil {
+			exitf(1, "encode error: %v", err)
+		}
+		return
+	}
+	_ = res.WriteSummary(w)
+	_ = tl.WriteText(w)
+}
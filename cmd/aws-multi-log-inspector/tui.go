@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/tui"
+
+	"golang.org/x/term"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runTUI implements search --tui: the results in the interactive view, where
+// next-filter searches reuse the groups and window of the command line.
+func runTUI(ctx context.Context, opts *cmd.Options) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		exitf(2, "error: --tui requires a terminal")
+	}
+	groups := requireGroups(opts)
+	format := parserFormat(opts)
+	start, end := resolveWindow(opts)
+	cw := newClient(ctx, opts)
+	retriever := searchRetriever(ctx, opts, cw)
+
+	annotate := func(records []model.LogRecord) {
+		if opts.Parser != "" {
+			parser.Annotate(records, format)
+		}
+	}
+	err := tui.Run(ctx, tui.Config{
+		Pattern: opts.FilterPattern,
+		Format:  format,
+		Search: func(ctx context.Context, pattern string) ([]model.LogRecord, error) {
+			records, err := newInspector(retriever, opts, groups, start, end).Search(ctx, pattern)
+			annotate(records)
+			return records, err
+		},
+		// Tailing reads fresh events, which the result cache would not keep.
+		Tail: func(ctx context.Context, pattern string, from time.Time, emit func([]model.LogRecord) error) error {
+			return newInspector(cw, opts, groups, from, time.Now()).Tail(ctx, pattern, tui.DefaultTailInterval, func(records []model.LogRecord) error {
+				annotate(records)
+				return emit(records)
+			})
+		},
+		Redactor: redactor,
+	}, os.Stdin, os.Stdout)
+	if err != nil {
+		exitf(1, "tui error: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/watch"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/cmd"
+)
+
+// runWatch implements the watch command: search the interval since the
+// previous poll every --every and alert when the matches reach --threshold.
+// Alerts go to --webhook, or to stdout without one; poll results are logged
+// to stderr. Searches failing with throttling or other transient errors are
+// retried by the next poll.
+func runWatch(ctx context.Context, opts *cmd.Options) {
+	groups := requireGroups(opts)
+	cw := newClient(ctx, opts)
+	serveMetrics(ctx, opts.MetricsAddr)
+	var notifier watch.Notifier = watch.Printer{W: os.Stdout}
+	if opts.Webhook != "" {
+		notifier = &watch.Webhook{URL: opts.Webhook, Format: opts.WebhookFormat}
+	}
+	w := watch.New(watch.Config{
+		Search: func(ctx context.Context, start, end time.Time) ([]model.LogRecord, error) {
+			// FilterLogEvents includes events at endTime, so the search stops
+			// short of it. Polls overlap anyway: the next one starts
+			// watch.DefaultLag before end, and the watcher skips the events
+			// it has already counted.
+			records, err := newInspector(cw, opts, groups, start, end.Add(-time.Millisecond)).Search(ctx, opts.FilterPattern)
+			redactor.Records(records)
+			return records, err
+		},
+		Pattern:          opts.FilterPattern,
+		Every:            opts.Every,
+		Threshold:        opts.Threshold,
+		Cooldown:         opts.Cooldown,
+		ClusterThreshold: opts.ClusterThreshold,
+		Notifier:         notifier,
+		Retryable:        client.Retryable,
+		Log:              os.Stderr,
+	})
+	if err := w.Run(ctx); err != nil {
+		exitf(1, "watch error: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cache"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cluster"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/diff"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/server"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/watch"
+)
+
+// ProgramName is the executable name used in usage and completion output.
+const ProgramName = "aws-multi-log-inspector"
+
+// DefaultCommand runs when no subcommand is given, keeping the original flat
+// `aws-multi-log-inspector --filter-pattern ...` form working.
+const DefaultCommand = "search"
+
+// Command describes a subcommand: its positional arguments, help text and the
+// flags it accepts.
+type Command struct {
+	Name    string
+	Args    string
+	Summary string
+	flags   func(fs *flag.FlagSet, o *Options)
+}
+
+// Commands lists every subcommand in the order shown by help.
+var Commands = []Command{
+	{Name: "search", Summary: "Search groups with a filter pattern; optionally extract a value and search again", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		windowFlags(fs, o)
+		cacheFlags(fs, o)
+		replayFlags(fs, o)
+		filterFlag(fs, o)
+		fs.StringVar(&o.Extract, "extract", "", "JMESPath extract in name=path form (single occurrence)")
+		fs.StringVar(&o.NextFilter, "next-filter", "", "JMESPath to build second filter; requires --extract")
+		fs.BoolVar(&o.LambdaInvocation, "lambda-invocation", false, "Show every line of each matched Lambda invocation with REPORT metrics")
+		fs.BoolVar(&o.Cluster, "cluster", false, "Group matches into message templates with counts, first/last seen and affected groups")
+		clusterThresholdFlag(fs, o, "Fraction of equal tokens needed to join a template")
+		fs.StringVar(&o.Checkpoint, "checkpoint", "", "Stream results page by page and record per-group progress in this file")
+		fs.StringVar(&o.Resume, "resume", "", "Continue the search recorded in this checkpoint file")
+		fs.BoolVar(&o.TUI, "tui", false, "Browse results interactively: filter, inspect, extract and next-filter, live tail")
+		outputFlags(fs, o)
+		exportFlags(fs, o)
+		outputFileFlags(fs, o)
+		sqlFlag(fs, o)
+		fs.Func("input", "Query the records of this --output-file result file instead of searching AWS; requires --sql (repeatable)", func(v string) error {
+			if _, err := recordfile.DetectFormat(v); err != nil {
+				return err
+			}
+			o.Input = append(o.Input, v)
+			return nil
+		})
+		unmaskFlag(fs, o)
+		statsJSONFlag(fs, o)
+	}},
+	{Name: "tail", Summary: "Follow new matching events across groups", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		filterFlag(fs, o)
+		fs.StringVar(&o.Since, "since", "1m", "Initial lookback before following, e.g. 30s, 10m")
+		fs.DurationVar(&o.Interval, "interval", defaultTailInterval, "Polling interval")
+		outputFlags(fs, o)
+		exportFlags(fs, o)
+		outputFileFlags(fs, o)
+		unmaskFlag(fs, o)
+		metricsAddrFlag(fs, o)
+	}},
+	{Name: "watch", Summary: "Search each new interval and alert a webhook when matches reach a threshold", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		filterFlag(fs, o)
+		fs.DurationVar(&o.Every, "every", watch.DefaultEvery, "Polling interval; each poll searches the time since the previous one")
+		fs.IntVar(&o.Threshold, "threshold", 1, "Matches in one interval that raise an alert")
+		fs.DurationVar(&o.Cooldown, "cooldown", watch.DefaultCooldown, "Do not alert the same message signature again within this duration")
+		fs.StringVar(&o.Webhook, "webhook", "", "POST alerts to this URL (default: print them to stdout as JSON lines)")
+		fs.StringVar(&o.WebhookFormat, "webhook-format", watch.FormatSlack, "Webhook body: slack, http (alert JSON) or sns (SNS HTTP notification)")
+		clusterThresholdFlag(fs, o, "Fraction of equal tokens needed to share a signature")
+		redactFlag(fs, o)
+		unmaskFlag(fs, o)
+		metricsAddrFlag(fs, o)
+	}},
+	{Name: "trace", Args: "<id>", Summary: "Follow a trace or request ID and its related IDs across groups and show a timeline", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		windowFlags(fs, o)
+		cacheFlags(fs, o)
+		replayFlags(fs, o)
+		fs.IntVar(&o.TraceConfig.Depth, "depth", trace.DefaultDepth, "Rounds of searching for IDs found in matched events (0 = the given ID only)")
+		fs.Func("extractor", "Extra JMESPath related-ID extractor in name=path form (repeatable; adds to config trace.extractors)", func(v string) error {
+			e, err := trace.ParseExtractor(v)
+			if err != nil {
+				return err
+			}
+			o.TraceConfig.Extractors = append(o.TraceConfig.Extractors, e)
+			return nil
+		})
+		outputFlags(fs, o)
+		exportFlags(fs, o)
+		outputFileFlags(fs, o)
+		sqlFlag(fs, o)
+		unmaskFlag(fs, o)
+		statsJSONFlag(fs, o)
+	}},
+	{Name: "groups", Summary: "List log groups (used by shell completion)", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		fs.StringVar(&o.Prefix, "prefix", "", "Only list groups whose name starts with this prefix")
+		fs.BoolVar(&o.Long, "long", false, "Show creation time, retention and stored bytes")
+		fs.BoolVar(&o.PrettyJSON, "pretty", false, "Output an indented JSON array")
+	}},
+	{Name: "streams", Summary: "List the most recently written log streams of each group", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		fs.StringVar(&o.Prefix, "prefix", "", "Only list streams whose name starts with this prefix (ordered by name)")
+		fs.IntVar(&o.Limit, "limit", 20, "Maximum streams per group (0 = all)")
+		fs.BoolVar(&o.PrettyJSON, "pretty", false, "Output an indented JSON array")
+	}},
+	{Name: "insights", Args: "<query>", Summary: "Run a CloudWatch Logs Insights query across groups", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		windowFlags(fs, o)
+		fs.IntVar(&o.Limit, "limit", 0, "Maximum rows to return (0 = service default)")
+		fs.BoolVar(&o.PrettyJSON, "pretty", false, "Output an indented JSON array")
+		redactFlag(fs, o)
+		unmaskFlag(fs, o)
+	}},
+	{Name: "stats", Summary: "Count matching events per time bucket, grouped by log group, stream or a message field", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		windowFlags(fs, o)
+		cacheFlags(fs, o)
+		replayFlags(fs, o)
+		filterFlag(fs, o)
+		fs.DurationVar(&o.Interval, "interval", 0, "Bucket size, e.g. 1m, 1h (default: automatic, at most 60 buckets)")
+		fs.StringVar(&o.By, "by", "group", "Series key: group, stream, none, or a JMESPath expression over the parsed message")
+		fs.IntVar(&o.Top, "top", 10, "Keep the N largest series and fold the rest into (other); 0 keeps all")
+		fs.StringVar(&o.Output, "output", "table", "Output format: table, json, sparkline, histogram")
+		outputFlags(fs, o)
+		unmaskFlag(fs, o)
+		statsJSONFlag(fs, o)
+	}},
+	{Name: "diff", Summary: "Compare message signatures per group against an earlier baseline window", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		windowFlags(fs, o)
+		cacheFlags(fs, o)
+		replayFlags(fs, o)
+		filterFlag(fs, o)
+		fs.StringVar(&o.Baseline, "baseline", "24h", "Offset of the baseline window before the comparison window, e.g. 24h, 7d")
+		fs.StringVar(&o.By, "by", diff.ByTemplate, "Signature: template (clustered messages), group, stream, or a JMESPath expression over the parsed message")
+		fs.Float64Var(&o.MinRatio, "min-ratio", diff.DefaultMinRatio, "Count ratio between windows reported as a spike or drop")
+		clusterThresholdFlag(fs, o, "Fraction of equal tokens needed to join a template")
+		outputFlags(fs, o)
+		unmaskFlag(fs, o)
+		statsJSONFlag(fs, o)
+	}},
+	{Name: "shell", Summary: "Interactive session keeping groups, window and the last result between commands", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		windowFlags(fs, o)
+		cacheFlags(fs, o)
+		replayFlags(fs, o)
+		fs.StringVar(&o.Parser, "parser", "", "Message parser for extract: auto, lambda, apigw, vpcflow, alb, logfmt, json")
+		redactFlag(fs, o)
+		unmaskFlag(fs, o)
+	}},
+	{Name: "serve", Summary: "Serve search, extract/next-filter and stats as an HTTP/JSON API", flags: func(fs *flag.FlagSet, o *Options) {
+		authFlags(fs, o)
+		groupFlags(fs, o)
+		concurrencyFlag(fs, o)
+		cacheFlags(fs, o)
+		fs.StringVar(&o.Addr, "addr", "127.0.0.1:8080", "Listen address")
+		fs.DurationVar(&o.RequestTimeout, "request-timeout", server.DefaultTimeout, "Maximum duration of one request, including its AWS calls")
+		fs.IntVar(&o.MaxConcurrent, "max-concurrent", server.DefaultMaxConcurrent, "Maximum requests served at once; more are refused with 429")
+		redactFlag(fs, o)
+		unmaskFlag(fs, o)
+	}},
+	{Name: "config", Args: "[path|show|searches]", Summary: "Show the config file location, contents or saved searches", flags: func(fs *flag.FlagSet, o *Options) {
+		configFlags(fs, o)
+	}},
+	{Name: "cache", Args: "[path|clear]", Summary: "Show the result cache location or remove every cached result", flags: func(fs *flag.FlagSet, o *Options) {}},
+	{Name: "completion", Args: "<bash|zsh|fish>", Summary: "Print a shell completion script", flags: func(fs *flag.FlagSet, o *Options) {}},
+	{Name: "help", Args: "[command]", Summary: "Show help for a command", flags: func(fs *flag.FlagSet, o *Options) {}},
+}
+
+// LookupCommand returns the named subcommand.
+func LookupCommand(name string) (Command, bool) {
+	for _, c := range Commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// FlagSet returns a flag set with the command's flags bound to o.
+func (c Command) FlagSet(o *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet(ProgramName+" "+c.Name, flag.ContinueOnError)
+	c.flags(fs, o)
+	fs.Usage = func() { c.PrintUsage(fs.Output()) }
+	return fs
+}
+
+// PrintUsage writes the command synopsis, summary and flags.
+func (c Command) PrintUsage(w io.Writer) {
+	synopsis := ProgramName + " " + c.Name
+	if c.Args != "" {
+		synopsis += " " + c.Args
+	}
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	c.flags(fs, &Options{})
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		synopsis += " [flags]"
+	}
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", synopsis, c.Summary)
+	if c.Name == DefaultCommand {
+		fmt.Fprintf(w, "\nThe command name may be omitted. `%s run <saved-search> [flags]` runs a saved search from the config file.\n", ProgramName)
+	}
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
+
+// PrintUsage writes the top-level help listing every command.
+func PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", ProgramName)
+	for _, c := range Commands {
+		fmt.Fprintf(w, "  %-11s %s\n", c.Name, c.Summary)
+	}
+	fmt.Fprintf(w, "  %-11s %s\n", "run", "Run a saved search from the config file: run <name> [flags]")
+	fmt.Fprintf(w, "\nWithout a command, flags are parsed as `%s`. Run `%s help <command>` for its flags.\n", DefaultCommand, ProgramName)
+	fmt.Fprintln(w, "Environment: LOG_GROUP_NAMES can provide comma-separated groups; AWS credentials from default sources.")
+	fmt.Fprintln(w, "Config: --config or $XDG_CONFIG_HOME/aws-multi-log-inspector/config.yaml (environments, group sets, saved searches).")
+}
+
+// authFlags registers AWS and config selection flags shared by every AWS command.
+func authFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.Region, "region", os.Getenv("AWS_REGION"), "AWS region (optional; falls back to AWS defaults)")
+	fs.StringVar(&o.Profile, "profile", "", "AWS shared config profile (optional; or set AWS_PROFILE)")
+	configFlags(fs, o)
+	logFlags(fs, o)
+}
+
+func configFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.ConfigPath, "config", "", "Config file (default $XDG_CONFIG_HOME/aws-multi-log-inspector/config.yaml)")
+	fs.StringVar(&o.Env, "env", "", "Config environment providing default region/profile/groups")
+}
+
+// logFlags registers the diagnostics flags; diagnostics go to stderr.
+func logFlags(fs *flag.FlagSet, o *Options) {
+	fs.BoolVar(&o.Verbose, "v", false, "Log search progress to stderr: pages, events and elapsed time per group")
+	fs.BoolVar(&o.Verbose, "verbose", false, "Same as -v")
+	fs.BoolVar(&o.Debug, "debug", false, "Log every page and the AWS SDK requests, responses and retries to stderr")
+	fs.StringVar(&o.LogFormat, "log-format", "text", "Diagnostics and error format on stderr: text or json")
+}
+
+func groupFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.GroupsCSV, "groups", os.Getenv("LOG_GROUP_NAMES"), "Comma-separated CloudWatch log group names (@name expands a configured group set)")
+}
+
+func concurrencyFlag(fs *flag.FlagSet, o *Options) {
+	fs.IntVar(&o.Concurrency, "concurrency", 4, "Number of concurrent log group searches")
+}
+
+// clusterThresholdFlag registers --cluster-threshold. 0 is rejected rather
+// than left to cluster.New, which would replace it with the default.
+func clusterThresholdFlag(fs *flag.FlagSet, o *Options, usage string) {
+	o.ClusterThreshold = cluster.DefaultThreshold
+	fs.Func("cluster-threshold", fmt.Sprintf("%s, above 0 and at most 1 (default %v)", usage, cluster.DefaultThreshold), func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		if f <= 0 || f > 1 {
+			return fmt.Errorf("must be above 0 and at most 1")
+		}
+		o.ClusterThreshold = f
+		return nil
+	})
+}
+
+func windowFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.StartRFC3339, "start", "", "Start time RFC3339 (e.g., 2025-08-30T15:04:05Z)")
+	fs.StringVar(&o.EndRFC3339, "end", "", "End time RFC3339 (e.g., 2025-08-31T15:04:05Z)")
+	fs.StringVar(&o.Since, "since", "", "Search the window ending now (or at --end) with this length, e.g. 90m, 1h, 2d")
+}
+
+func filterFlag(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.FilterPattern, "filter-pattern", "", "CloudWatch Logs filter pattern (required)")
+}
+
+func cacheFlags(fs *flag.FlagSet, o *Options) {
+	fs.BoolVar(&o.NoCache, "no-cache", false, "Always fetch from CloudWatch Logs; do not read or write the result cache")
+	fs.DurationVar(&o.CacheTTL, "cache-ttl", cache.DefaultTTL, "Refetch cached results older than this (0 = keep until cache clear)")
+}
+
+func replayFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.Record, "record", "", "Write every FilterLogEvents request and response to this file")
+	fs.StringVar(&o.Replay, "replay", "", "Serve FilterLogEvents from a --record file instead of AWS (offline)")
+}
+
+func outputFlags(fs *flag.FlagSet, o *Options) {
+	fs.BoolVar(&o.PrettyJSON, "pretty", false, "Pretty-print JSON output")
+	fs.StringVar(&o.Parser, "parser", "", "Message parser: auto, lambda, apigw, vpcflow, alb, logfmt, json (adds parsed fields to JSON output)")
+	redactFlag(fs, o)
+}
+
+// outputFileFlags registers the flags saving the records to a file.
+func outputFileFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.OutputFile, "output-file", "", "Write the records to this file instead of stdout: .parquet, .ndjson.gz or .ndjson.zst")
+	fs.BoolVar(&o.FlattenFields, "flatten-fields", false, "Add the fields of JSON and parsed messages as --output-file columns")
+}
+
+// sqlFlag registers the flag querying the records with SQL.
+func sqlFlag(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.SQL, "sql", "", `Run this query over the records (table "records") and print its result instead, e.g. "SELECT log_group, count(*) FROM records GROUP BY 1"`)
+}
+
+// exportFlags registers the flags sending printed records to a log backend.
+func exportFlags(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.Export, "export", "", "Also send the records to a log backend: "+strings.Join(export.Sinks, ", "))
+	fs.StringVar(&o.ExportEndpoint, "export-endpoint", "", "Export endpoint URL (default: OTEL_EXPORTER_OTLP_ENDPOINT for otlp, else the backend on localhost)")
+	fs.StringVar(&o.ExportProtocol, "export-protocol", "", "OTLP transport: "+strings.Join(export.OTLPProtocols, ", ")+" (default: OTEL_EXPORTER_OTLP_PROTOCOL or http/protobuf)")
+	fs.Func("export-header", `Header added to export requests in "Name: value" form (repeatable)`, func(v string) error {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf(`expected "Name: value"`)
+		}
+		if o.ExportHeaders == nil {
+			o.ExportHeaders = http.Header{}
+		}
+		o.ExportHeaders.Add(name, strings.TrimSpace(value))
+		return nil
+	})
+	fs.StringVar(&o.ExportIndex, "export-index", "", "Elasticsearch/OpenSearch index template (default "+export.DefaultIndex+"); placeholders: {{"+strings.Join(export.TemplateNames, "}}, {{")+"}}")
+	fs.Func("export-label", "Loki label in name=template form (repeatable; replaces the default group, stream and region labels)", func(v string) error {
+		name, tmpl, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("expected name=template")
+		}
+		if o.ExportLabels == nil {
+			o.ExportLabels = map[string]string{}
+		}
+		o.ExportLabels[strings.TrimSpace(name)] = tmpl
+		return nil
+	})
+	fs.IntVar(&o.ExportBatchSize, "export-batch-size", export.DefaultBatchSize, "Records per export request")
+}
+
+func unmaskFlag(fs *flag.FlagSet, o *Options) {
+	fs.BoolVar(&o.Unmask, "unmask", false, "Read events without data protection masking (needs logs:Unmask; results are not cached)")
+}
+
+func redactFlag(fs *flag.FlagSet, o *Options) {
+	fs.BoolVar(&o.Redact, "redact", false, "Replace emails, JWTs, AWS keys, card numbers, IPs and configured values with stable placeholders (default: config redact.enabled)")
+}
+
+// statsJSONFlag registers the flags of one-shot searches: --stats-json and
+// --no-progress.
+func statsJSONFlag(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.StatsJSON, "stats-json", "", "Write a JSON summary of API calls, pages, events, retries and durations per group to this file when done (- for stderr)")
+	fs.BoolVar(&o.NoProgress, "no-progress", false, "Do not show search progress on stderr (shown when stderr is a terminal)")
+}
+
+func metricsAddrFlag(fs *flag.FlagSet, o *Options) {
+	fs.StringVar(&o.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics at http://ADDR/metrics while running, e.g. 127.0.0.1:9102")
+}
+
+// commandNames returns the subcommand names, for completion.
+func commandNames() []string {
+	names := make([]string, 0, len(Commands)+1)
+	for _, c := range Commands {
+		names = append(names, c.Name)
+	}
+	return append(names, "run")
+}
+
+// flagNames returns the "--name" forms of a command's flags, for completion.
+func (c Command) flagNames() []string {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	c.flags(fs, &Options{})
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) { names = append(names, "--"+f.Name) })
+	return names
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+)
+
+func TestParseCommands(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("LOG_GROUP_NAMES", "")
+	tests := []struct {
+		name     string
+		args     []string
+		wantCmd  string
+		wantArgs []string
+		check    func(t *testing.T, o *Options)
+		wantErr  bool
+	}{
+		{name: "legacy flags default to search", args: []string{"--filter-pattern", "ERROR"}, wantCmd: "search",
+			check: func(t *testing.T, o *Options) {
+				if o.FilterPattern != "ERROR" || o.Concurrency != 4 {
+					t.Fatalf("options = %+v", o)
+				}
+			}},
+		{name: "explicit search", args: []string{"search", "--filter-pattern", "x", "--groups", "a,b"}, wantCmd: "search",
+			check: func(t *testing.T, o *Options) {
+				if o.GroupsCSV != "a,b" {
+					t.Fatalf("GroupsCSV = %q", o.GroupsCSV)
+				}
+			}},
+		{name: "trace positional id", args: []string{"trace", "--groups", "g", "1-abc-def"}, wantCmd: "trace", wantArgs: []string{"1-abc-def"}},
+		{name: "tail defaults", args: []string{"tail", "--filter-pattern", "x"}, wantCmd: "tail",
+			check: func(t *testing.T, o *Options) {
+				if o.Since != "1m" || o.Interval != defaultTailInterval {
+					t.Fatalf("since/interval = %q/%v", o.Since, o.Interval)
+				}
+			}},
+		{name: "insights query", args: []string{"insights", "fields @message | limit 5"}, wantCmd: "insights", wantArgs: []string{"fields @message | limit 5"}},
+		{name: "streams limit", args: []string{"streams", "--limit", "3"}, wantCmd: "streams",
+			check: func(t *testing.T, o *Options) {
+				if o.Limit != 3 {
+					t.Fatalf("Limit = %d", o.Limit)
+				}
+			}},
+		{name: "serve defaults", args: []string{"serve"}, wantCmd: "serve",
+			check: func(t *testing.T, o *Options) {
+				if o.Addr != "127.0.0.1:8080" || o.RequestTimeout != time.Minute || o.MaxConcurrent != 8 {
+					t.Fatalf("addr/timeout/max = %q/%v/%d", o.Addr, o.RequestTimeout, o.MaxConcurrent)
+				}
+			}},
+		{name: "watch flags", args: []string{"watch", "--filter-pattern", "ERROR", "--every", "30s", "--threshold", "5", "--webhook", "http://127.0.0.1:9000/hook"}, wantCmd: "watch",
+			check: func(t *testing.T, o *Options) {
+				if o.Every != 30*time.Second || o.Threshold != 5 || o.Cooldown != 15*time.Minute || o.WebhookFormat != "slack" || o.Webhook != "http://127.0.0.1:9000/hook" {
+					t.Fatalf("every/threshold/cooldown/format = %v/%d/%v/%q", o.Every, o.Threshold, o.Cooldown, o.WebhookFormat)
+				}
+			}},
+		{name: "telemetry flags", args: []string{"tail", "--filter-pattern", "x", "--metrics-addr", ":9102"}, wantCmd: "tail",
+			check: func(t *testing.T, o *Options) {
+				if o.MetricsAddr != ":9102" {
+					t.Fatalf("MetricsAddr = %q", o.MetricsAddr)
+				}
+			}},
+		{name: "verbose alias", args: []string{"groups", "--verbose", "--log-format", "json"}, wantCmd: "groups",
+			check: func(t *testing.T, o *Options) {
+				if !o.Verbose || o.LogFormat != "json" {
+					t.Fatalf("verbose/format = %v/%q", o.Verbose, o.LogFormat)
+				}
+			}},
+		{name: "no-progress", args: []string{"diff", "--filter-pattern", "x", "--no-progress"}, wantCmd: "diff",
+			check: func(t *testing.T, o *Options) {
+				if !o.NoProgress {
+					t.Fatal("NoProgress not set")
+				}
+			}},
+		{name: "export headers", args: []string{"tail", "--filter-pattern", "x", "--export", "otlp", "--export-header", "Authorization: Bearer t", "--export-header", "X-Scope-OrgID:ops"}, wantCmd: "tail",
+			check: func(t *testing.T, o *Options) {
+				if o.Export != "otlp" || o.ExportHeaders.Get("Authorization") != "Bearer t" || o.ExportHeaders.Get("X-Scope-OrgID") != "ops" {
+					t.Fatalf("export/headers = %q/%v", o.Export, o.ExportHeaders)
+				}
+			}},
+		{name: "export templates", args: []string{"search", "--filter-pattern", "x", "--export", "loki", "--export-label", "service={{service}}", "--export-label", "env=prod", "--export-batch-size", "100"}, wantCmd: "search",
+			check: func(t *testing.T, o *Options) {
+				if !reflect.DeepEqual(o.ExportLabels, map[string]string{"service": "{{service}}", "env": "prod"}) || o.ExportBatchSize != 100 {
+					t.Fatalf("labels/batch size = %v/%d", o.ExportLabels, o.ExportBatchSize)
+				}
+			}},
+		{name: "output file", args: []string{"trace", "--output-file", "out.ndjson.gz", "--flatten-fields", "req-1"}, wantCmd: "trace", wantArgs: []string{"req-1"},
+			check: func(t *testing.T, o *Options) {
+				if o.OutputFile != "out.ndjson.gz" || !o.FlattenFields {
+					t.Fatalf("output file/flatten = %q/%v", o.OutputFile, o.FlattenFields)
+				}
+			}},
+		{name: "sql over input files", args: []string{"--sql", "SELECT count(*) FROM records", "--input", "a.parquet", "--input", "b.ndjson.zst"}, wantCmd: "search",
+			check: func(t *testing.T, o *Options) {
+				if o.SQL != "SELECT count(*) FROM records" || !reflect.DeepEqual(o.Input, []string{"a.parquet", "b.ndjson.zst"}) {
+					t.Fatalf("sql/input = %q/%q", o.SQL, o.Input)
+				}
+			}},
+		{name: "input of unknown format", args: []string{"--sql", "SELECT * FROM records", "--input", "a.csv"}, wantErr: true},
+		{name: "cluster threshold of 0", args: []string{"--filter-pattern", "x", "--cluster", "--cluster-threshold", "0"}, wantErr: true},
+		{name: "cluster threshold", args: []string{"watch", "--filter-pattern", "x", "--cluster-threshold", "0.8"}, wantCmd: "watch",
+			check: func(t *testing.T, o *Options) {
+				if o.ClusterThreshold != 0.8 {
+					t.Fatalf("ClusterThreshold = %v", o.ClusterThreshold)
+				}
+			}},
+		{name: "malformed export header", args: []string{"search", "--filter-pattern", "x", "--export-header", "token"}, wantErr: true},
+		{name: "stats-json only on one-shot commands", args: []string{"tail", "--filter-pattern", "x", "--stats-json", "-"}, wantErr: true},
+		{name: "completion", args: []string{"completion", "zsh"}, wantCmd: "completion", wantArgs: []string{"zsh"}},
+		{name: "flag of another command rejected", args: []string{"groups", "--filter-pattern", "x"}, wantErr: true},
+		{name: "unknown command", args: []string{"bogus"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := Parse(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if o.Command != tt.wantCmd {
+				t.Fatalf("Command = %q, want %q", o.Command, tt.wantCmd)
+			}
+			if len(tt.wantArgs) > 0 && !reflect.DeepEqual(o.Args, tt.wantArgs) {
+				t.Fatalf("Args = %q, want %q", o.Args, tt.wantArgs)
+			}
+			if tt.check != nil {
+				tt.check(t, o)
+			}
+		})
+	}
+}
+
+func TestParseHelp(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Parse([]string{"stats", "-h"}, &buf)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("err = %v, want flag.ErrHelp", err)
+	}
+	if !strings.Contains(buf.String(), "Usage: aws-multi-log-inspector stats [flags]") || !strings.Contains(buf.String(), "-filter-pattern") {
+		t.Fatalf("help output = %q", buf.String())
+	}
+}
+
+func TestPrintUsageListsCommands(t *testing.T) {
+	var buf bytes.Buffer
+	PrintUsage(&buf)
+	for _, c := range Commands {
+		if !strings.Contains(buf.String(), "  "+c.Name+" ") {
+			t.Fatalf("usage missing %q:\n%s", c.Name, buf.String())
+		}
+	}
+}
+
+func TestValidateCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     *Options
+		wantCode int
+	}{
+		{"trace without id", &Options{Command: "trace"}, 2},
+		{"trace with id", &Options{Command: "trace", Args: []string{"id"}}, 0},
+		{"trace negative depth", &Options{Command: "trace", Args: []string{"id"}, TraceConfig: trace.Config{Depth: -1}}, 2},
+		{"trace bad extractor", &Options{Command: "trace", Args: []string{"id"}, TraceConfig: trace.Config{Extractors: []trace.Extractor{{Name: "x", Path: "a[["}}}}, 2},
+		{"insights without query", &Options{Command: "insights"}, 2},
+		{"completion bad shell", &Options{Command: "completion", Args: []string{"tcsh"}}, 2},
+		{"config bad action", &Options{Command: "config", Args: []string{"edit"}}, 2},
+		{"cache bad action", &Options{Command: "cache", Args: []string{"purge"}}, 2},
+		{"cache clear", &Options{Command: "cache", Args: []string{"clear"}}, 0},
+		{"groups needs nothing", &Options{Command: "groups"}, 0},
+		{"tail needs filter", &Options{Command: "tail"}, 2},
+		{"stats bad output", &Options{Command: "stats", FilterPattern: "x", Output: "csv"}, 2},
+		{"diff bad baseline", &Options{Command: "diff", FilterPattern: "x", Baseline: "yesterday", MinRatio: 2}, 2},
+		{"diff bad ratio", &Options{Command: "diff", FilterPattern: "x", Baseline: "24h", MinRatio: 0.5}, 2},
+		{"diff ok", &Options{Command: "diff", FilterPattern: "x", Baseline: "7d", MinRatio: 2}, 0},
+		{"serve bad timeout", &Options{Command: "serve", RequestTimeout: 0, MaxConcurrent: 1}, 2},
+		{"serve bad max-concurrent", &Options{Command: "serve", RequestTimeout: time.Second}, 2},
+		{"serve ok", &Options{Command: "serve", RequestTimeout: time.Second, MaxConcurrent: 8}, 0},
+		{"stats ok", &Options{Command: "stats", FilterPattern: "x", Output: "sparkline"}, 0},
+		{"bad log format", &Options{Command: "groups", LogFormat: "logfmt"}, 2},
+		{"tui with debug", &Options{Command: "search", FilterPattern: "x", TUI: true, Debug: true}, 2},
+		{"json logs", &Options{Command: "search", FilterPattern: "x", LogFormat: "json", Verbose: true}, 0},
+		{"watch needs filter", &Options{Command: "watch", Every: time.Minute, Threshold: 1, WebhookFormat: "slack"}, 2},
+		{"watch bad threshold", &Options{Command: "watch", FilterPattern: "x", Every: time.Minute, WebhookFormat: "slack"}, 2},
+		{"watch bad format", &Options{Command: "watch", FilterPattern: "x", Every: time.Minute, Threshold: 1, WebhookFormat: "teams"}, 2},
+		{"watch bad webhook", &Options{Command: "watch", FilterPattern: "x", Every: time.Minute, Threshold: 1, WebhookFormat: "sns", Webhook: "localhost:9000"}, 2},
+		{"watch ok", &Options{Command: "watch", FilterPattern: "x", Every: time.Minute, Threshold: 5, WebhookFormat: "sns", Webhook: "http://localhost:9000/sns"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, code := tt.opts.Validate(); code != tt.wantCode {
+				t.Fatalf("Validate code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
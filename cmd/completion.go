@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+)
+
+// completionShells lists the shells WriteCompletion supports.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// WriteCompletion writes a completion script for shell. Subcommands and flags
+// come from Commands; values of --groups are completed by calling the `groups`
+// subcommand (DescribeLogGroups) with the word typed so far as prefix, and
+// `run` completes saved search names from `config searches`.
+func WriteCompletion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return writeBash(w)
+	case "zsh":
+		return writeZsh(w)
+	case "fish":
+		return writeFish(w)
+	}
+	return fmt.Errorf("unsupported shell %q; expected one of %s", shell, strings.Join(completionShells, ", "))
+}
+
+func parserNames() string {
+	names := make([]string, len(parser.Formats))
+	for i, f := range parser.Formats {
+		names[i] = string(f)
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBash(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# bash completion for %s\n", ProgramName)
+	b.WriteString("_aws_multi_log_inspector() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("    local cmd=\"${COMP_WORDS[1]}\"\n")
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commandNames(), " "))
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    case \"$prev\" in\n")
+	b.WriteString("    --groups|-groups)\n")
+	b.WriteString("        local done=\"\" part=\"$cur\"\n")
+	b.WriteString("        if [[ $cur == *,* ]]; then done=\"${cur%,*},\"; part=\"${cur##*,}\"; fi\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(%s groups --prefix \"$part\" 2>/dev/null | sed \"s|^|$done|\"))\n", ProgramName)
+	b.WriteString("        return ;;\n")
+	b.WriteString("    --parser|-parser)\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", parserNames())
+	b.WriteString("        return ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cmd == run && $COMP_CWORD -eq 2 ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"$(%s config searches 2>/dev/null)\" -- \"$cur\"))\n", ProgramName)
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    local flags\n")
+	b.WriteString("    case \"$cmd\" in\n")
+	for _, c := range Commands {
+		pattern := c.Name
+		if c.Name == DefaultCommand {
+			pattern += "|run|-*"
+		}
+		fmt.Fprintf(&b, "    %s) flags=%q ;;\n", pattern, strings.Join(c.flagNames(), " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("    COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -o default -F _aws_multi_log_inspector %s\n", ProgramName)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeZsh(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#compdef %s\n", ProgramName)
+	b.WriteString("_aws_multi_log_inspector() {\n")
+	b.WriteString("    local -a cmds flags\n")
+	b.WriteString("    local cmd=${words[2]}\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ ${words[CURRENT]} != -* ]]; then\n")
+	b.WriteString("        cmds=(\n")
+	for _, c := range Commands {
+		fmt.Fprintf(&b, "            %s\n", zshQuote(c.Name+":"+c.Summary))
+	}
+	b.WriteString("            'run:Run a saved search from the config file'\n")
+	b.WriteString("        )\n")
+	b.WriteString("        _describe 'command' cmds\n")
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    case ${words[CURRENT-1]} in\n")
+	b.WriteString("    --groups|-groups)\n")
+	b.WriteString("        compset -P '*,'\n")
+	fmt.Fprintf(&b, "        compadd -S '' -- ${(f)\"$(%s groups --prefix \"$PREFIX\" 2>/dev/null)\"}\n", ProgramName)
+	b.WriteString("        return ;;\n")
+	b.WriteString("    --parser|-parser)\n")
+	fmt.Fprintf(&b, "        compadd -- %s\n", parserNames())
+	b.WriteString("        return ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cmd == run ]] && (( CURRENT == 3 )); then\n")
+	fmt.Fprintf(&b, "        compadd -- ${(f)\"$(%s config searches 2>/dev/null)\"}\n", ProgramName)
+	b.WriteString("        return\n    fi\n")
+	b.WriteString("    case $cmd in\n")
+	for _, c := range Commands {
+		pattern := c.Name
+		if c.Name == DefaultCommand {
+			pattern += "|run|-*"
+		}
+		fmt.Fprintf(&b, "    %s) flags=(%s) ;;\n", pattern, strings.Join(c.flagNames(), " "))
+	}
+	b.WriteString("    esac\n")
+	b.WriteString("    compadd -- $flags\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "compdef _aws_multi_log_inspector %s\n", ProgramName)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFish(w io.Writer) error {
+	var b strings.Builder
+	p := ProgramName
+	fmt.Fprintf(&b, "# fish completion for %s\n", p)
+	b.WriteString("function __aws_multi_log_inspector_groups\n")
+	b.WriteString("    set -l tok (commandline -ct)\n")
+	b.WriteString("    set -l done (string match -r '^.*,' -- $tok)\n")
+	b.WriteString("    set -l part (string replace -r '^.*,' '' -- $tok)\n")
+	fmt.Fprintf(&b, "    for g in (%s groups --prefix \"$part\" 2>/dev/null)\n", p)
+	b.WriteString("        echo $done$g\n")
+	b.WriteString("    end\n")
+	b.WriteString("end\n")
+	fmt.Fprintf(&b, "complete -c %s -f\n", p)
+	for _, c := range Commands {
+		fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", p, c.Name, fishQuote(c.Summary))
+	}
+	fmt.Fprintf(&b, "complete -c %s -n __fish_use_subcommand -a run -d %s\n", p, fishQuote("Run a saved search from the config file"))
+	fmt.Fprintf(&b, "complete -c %s -n '__fish_seen_subcommand_from run; and test (count (commandline -opc)) -eq 2' -a '(%s config searches 2>/dev/null)'\n", p, p)
+	for _, c := range Commands {
+		cond := "__fish_seen_subcommand_from " + c.Name
+		if c.Name == DefaultCommand {
+			cond = "__fish_use_subcommand; or __fish_seen_subcommand_from search run"
+		}
+		fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		c.flags(fs, &Options{})
+		fs.VisitAll(func(f *flag.Flag) {
+			line := fmt.Sprintf("complete -c %s -n '%s' -l %s", p, cond, f.Name)
+			if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !bf.IsBoolFlag() {
+				line += " -r"
+			}
+			switch f.Name {
+			case "groups":
+				line += " -a '(__aws_multi_log_inspector_groups)'"
+			case "parser":
+				line += " -a " + fishQuote(parserNames())
+			case "config":
+				line += " -F"
+			}
+			b.WriteString(line + " -d " + fishQuote(f.Usage) + "\n")
+		})
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCompletion(&buf, shell); err != nil {
+				t.Fatalf("WriteCompletion(%q) error: %v", shell, err)
+			}
+			out := buf.String()
+			for _, want := range []string{"insights", "filter-pattern", ProgramName + " groups --prefix", "config searches"} {
+				if !strings.Contains(out, want) {
+					t.Fatalf("%s script missing %q:\n%s", shell, want, out)
+				}
+			}
+		})
+	}
+	if err := WriteCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Fatal("expected error for unsupported shell")
+	}
+}
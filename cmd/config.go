@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the on-disk configuration file.
+//
+//	defaultEnvironment: prod
+//	environments:
+//	  prod: {region: ap-northeast-1, profile: prod-readonly}
+//	groupSets:
+//	  payments: [/aws/lambda/pay, /aws/ecs/pay]
+//	searches:
+//	  payments-5xx:
+//	    groups: ["@payments"]
+//	    filterPattern: '{ $.status >= 500 }'
+//	redact:
+//	  enabled: true
+//	  rules:
+//	    - {name: user, regex: 'userId=(\w+)'}
+//	trace:
+//	  extractors:
+//	    - {name: orderId, path: detail.orderId}
+type Config struct {
+	DefaultEnvironment string                 `yaml:"defaultEnvironment"`
+	Environments       map[string]Environment `yaml:"environments"`
+	GroupSets          map[string][]string    `yaml:"groupSets"`
+	Searches           map[string]SavedSearch `yaml:"searches"`
+	Redact             redact.Config          `yaml:"redact"`
+	Trace              trace.Config           `yaml:"trace"`
+}
+
+// Environment holds per-environment AWS defaults.
+type Environment struct {
+	Region  string   `yaml:"region"`
+	Profile string   `yaml:"profile"`
+	Groups  []string `yaml:"groups"`
+}
+
+// SavedSearch is a named set of search options run with `run <name>`.
+// Unset fields fall back to the environment and built-in defaults; flags and
+// environment variables given on the command line take precedence.
+type SavedSearch struct {
+	Description      string   `yaml:"description"`
+	Environment      string   `yaml:"environment"`
+	Groups           []string `yaml:"groups"`
+	FilterPattern    string   `yaml:"filterPattern"`
+	Extract          string   `yaml:"extract"`
+	NextFilter       string   `yaml:"nextFilter"`
+	Parser           string   `yaml:"parser"`
+	Since            string   `yaml:"since"`
+	Start            string   `yaml:"start"`
+	End              string   `yaml:"end"`
+	Pretty           bool     `yaml:"pretty"`
+	Concurrency      int      `yaml:"concurrency"`
+	LambdaInvocation bool     `yaml:"lambdaInvocation"`
+	Cluster          bool     `yaml:"cluster"`
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/aws-multi-log-inspector/config.yaml,
+// defaulting to ~/.config when XDG_CONFIG_HOME is unset.
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "aws-multi-log-inspector", "config.yaml")
+}
+
+// LoadConfig reads the config file at path. When path is empty the default
+// location is used and a missing file yields an empty Config; an explicitly
+// given path must exist.
+func LoadConfig(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigPath()
+		if path == "" {
+			return &Config{}, nil
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	// Reject unknown keys, so that a misspelt one is not silently ignored
+	var c Config
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Environment returns the named environment, or the default one when name is
+// empty. An unknown explicit name is an error.
+func (c *Config) Environment(name string) (Environment, error) {
+	if name == "" {
+		name = c.DefaultEnvironment
+		if name == "" {
+			return Environment{}, nil
+		}
+	}
+	env, ok := c.Environments[name]
+	if !ok {
+		return Environment{}, fmt.Errorf("unknown environment %q", name)
+	}
+	return env, nil
+}
+
+// Search returns the named saved search.
+func (c *Config) Search(name string) (SavedSearch, error) {
+	s, ok := c.Searches[name]
+	if !ok {
+		names := make([]string, 0, len(c.Searches))
+		for n := range c.Searches {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return SavedSearch{}, fmt.Errorf("unknown saved search %q (no searches configured)", name)
+		}
+		return SavedSearch{}, fmt.Errorf("unknown saved search %q; available: %s", name, strings.Join(names, ", "))
+	}
+	return s, nil
+}
+
+// ExpandGroups replaces "@name" entries with the members of the named group set,
+// dropping duplicates while preserving order.
+func (c *Config) ExpandGroups(groups []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, g := range groups {
+		members := []string{g}
+		if strings.HasPrefix(g, "@") {
+			set, ok := c.GroupSets[g[1:]]
+			if !ok {
+				return nil, fmt.Errorf("unknown group set %q", g[1:])
+			}
+			members = set
+		}
+		for _, m := range members {
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+)
+
+const testConfig = `
+defaultEnvironment: dev
+environments:
+  dev:
+    region: us-east-1
+    groups: [/dev/app]
+  prod:
+    region: ap-northeast-1
+    profile: prod-readonly
+groupSets:
+  payments: [/aws/lambda/pay, /aws/ecs/pay]
+searches:
+  payments-5xx:
+    environment: prod
+    groups: ["@payments", /aws/lambda/pay, /aws/lambda/other]
+    filterPattern: '{ $.status >= 500 }'
+    extract: userId=user.id
+    nextFilter: "userId={{userId}}"
+    since: 2h
+    pretty: true
+redact:
+  enabled: true
+  builtins: [email]
+  rules:
+    - {name: user, regex: 'userId=(\w+)'}
+trace:
+  maxIds: 10
+  extractors:
+    - {name: orderId, path: detail.orderId}
+`
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadConfigDefaultMissing(t *testing.T) {
+	withEnv("XDG_CONFIG_HOME", t.TempDir(), func() {
+		c, err := LoadConfig("")
+		if err != nil || c == nil {
+			t.Fatalf("LoadConfig(\"\") = %v, %v; want empty config", c, err)
+		}
+	})
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "nope.yaml")); err == nil {
+		t.Fatal("expected error for missing explicit config")
+	}
+}
+
+func TestLoadConfigUnknownKey(t *testing.T) {
+	for _, body := range []string{"environmets:\n  dev: {region: us-east-1}\n", "environments:\n  dev: {groupsets: [a]}\n"} {
+		_, err := LoadConfig(writeConfig(t, body))
+		if err == nil || !strings.Contains(err.Error(), "not found in type") {
+			t.Errorf("LoadConfig(%q) err = %v, want unknown field error", body, err)
+		}
+	}
+	if c, err := LoadConfig(writeConfig(t, "")); err != nil || c == nil {
+		t.Fatalf("empty config: %v, %v", c, err)
+	}
+}
+
+func TestExpandGroups(t *testing.T) {
+	c := &Config{GroupSets: map[string][]string{"s": {"a", "b"}}}
+	got, err := c.ExpandGroups([]string{"x", "@s", "a"})
+	if err != nil || !reflect.DeepEqual(got, []string{"x", "a", "b"}) {
+		t.Fatalf("ExpandGroups = %v, %v", got, err)
+	}
+	if _, err := c.ExpandGroups([]string{"@missing"}); err == nil {
+		t.Fatal("expected error for unknown group set")
+	}
+}
+
+func TestCollectOptionsConfig(t *testing.T) {
+	cfgPath := writeConfig(t, testConfig)
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(t *testing.T, o *Options)
+		wantErr bool
+	}{
+		{
+			name: "saved search with environment",
+			args: []string{"run", "payments-5xx", "--config", cfgPath},
+			check: func(t *testing.T, o *Options) {
+				if o.GroupsCSV != "/aws/lambda/pay,/aws/ecs/pay,/aws/lambda/other" {
+					t.Fatalf("GroupsCSV = %q", o.GroupsCSV)
+				}
+				if o.Region != "ap-northeast-1" || o.Profile != "prod-readonly" {
+					t.Fatalf("region/profile = %q/%q", o.Region, o.Profile)
+				}
+				if o.FilterPattern != "{ $.status >= 500 }" || o.Extract != "userId=user.id" || o.NextFilter != "userId={{userId}}" {
+					t.Fatalf("search fields = %+v", o)
+				}
+				if o.Since != "2h" || !o.PrettyJSON {
+					t.Fatalf("since/pretty = %q/%v", o.Since, o.PrettyJSON)
+				}
+			},
+		},
+		{
+			name: "flags override saved search",
+			args: []string{"run", "payments-5xx", "--config", cfgPath, "--since", "1h", "--filter-pattern", "ERROR", "--region", "eu-west-1"},
+			check: func(t *testing.T, o *Options) {
+				if o.Since != "1h" || o.FilterPattern != "ERROR" || o.Region != "eu-west-1" {
+					t.Fatalf("overrides not applied: %+v", o)
+				}
+			},
+		},
+		{
+			name: "env vars override config",
+			args: []string{"run", "payments-5xx", "--config", cfgPath},
+			env:  map[string]string{"AWS_PROFILE": "mine", "LOG_GROUP_NAMES": "@payments"},
+			check: func(t *testing.T, o *Options) {
+				if o.Profile != "" {
+					t.Fatalf("Profile = %q, want empty so AWS_PROFILE applies", o.Profile)
+				}
+				if o.GroupsCSV != "/aws/lambda/pay,/aws/ecs/pay" {
+					t.Fatalf("GroupsCSV = %q", o.GroupsCSV)
+				}
+			},
+		},
+		{
+			name: "default environment without run",
+			args: []string{"--config", cfgPath, "--filter-pattern", "x"},
+			check: func(t *testing.T, o *Options) {
+				if o.Region != "us-east-1" || o.GroupsCSV != "/dev/app" {
+					t.Fatalf("region/groups = %q/%q", o.Region, o.GroupsCSV)
+				}
+			},
+		},
+		{
+			name: "redact from config",
+			args: []string{"--config", cfgPath, "--filter-pattern", "x"},
+			check: func(t *testing.T, o *Options) {
+				if !o.Redact || len(o.RedactConfig.Rules) != 1 || o.RedactConfig.Rules[0].Regex != `userId=(\w+)` {
+					t.Fatalf("redact = %v %+v", o.Redact, o.RedactConfig)
+				}
+			},
+		},
+		{
+			name: "redact flag overrides config",
+			args: []string{"--config", cfgPath, "--filter-pattern", "x", "--redact=false"},
+			check: func(t *testing.T, o *Options) {
+				if o.Redact {
+					t.Fatal("--redact=false did not disable redaction")
+				}
+			},
+		},
+		{
+			name: "trace extractors from config and flags",
+			args: []string{"trace", "--config", cfgPath, "--extractor", "cart=cart.id", "--depth", "0", "abc"},
+			check: func(t *testing.T, o *Options) {
+				want := []trace.Extractor{{Name: "orderId", Path: "detail.orderId"}, {Name: "cart", Path: "cart.id"}}
+				if !reflect.DeepEqual(o.TraceConfig.Extractors, want) || o.TraceConfig.Depth != 0 || o.TraceConfig.MaxIDs != 10 {
+					t.Fatalf("TraceConfig = %+v", o.TraceConfig)
+				}
+			},
+		},
+		{name: "bad extractor flag", args: []string{"trace", "--config", cfgPath, "--extractor", "cart", "abc"}, wantErr: true},
+		{name: "unknown search", args: []string{"run", "nope", "--config", cfgPath}, wantErr: true},
+		{name: "run without name", args: []string{"run"}, wantErr: true},
+		{name: "unknown environment", args: []string{"--config", cfgPath, "--env", "qa"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range []string{"AWS_PROFILE", "AWS_REGION", "LOG_GROUP_NAMES"} {
+				t.Setenv(k, "") // restores the original value after the test
+				_ = os.Unsetenv(k)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			o, err := Parse(tt.args, io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				tt.check(t, o)
+			}
+		})
+	}
+}
+
+func TestResolveTimeWindowSince(t *testing.T) {
+	now := time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+	start, end, err := ResolveTimeWindowSince("", "", "90m", now)
+	if err != nil || !end.Equal(now) || !start.Equal(now.Add(-90*time.Minute)) {
+		t.Fatalf("since 90m = [%v,%v], %v", start, end, err)
+	}
+	start, end, err = ResolveTimeWindowSince("", "2025-08-30T00:00:00Z", "2d", now)
+	if err != nil || !start.Equal(time.Date(2025, 8, 28, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2025, 8, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("since 2d with end = [%v,%v], %v", start, end, err)
+	}
+	if _, _, err := ResolveTimeWindowSince("2025-08-30T00:00:00Z", "", "1h", now); err == nil {
+		t.Fatal("expected error combining --since and --start")
+	}
+	for _, bad := range []string{"abc", "-1h", "0s"} {
+		if _, err := ParseSince(bad); err == nil {
+			t.Fatalf("ParseSince(%q) expected error", bad)
+		}
+	}
+}
@@ -1,15 +1,35 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/checkpoint"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/query"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/watch"
 )
 
 // Options holds CLI options after parsing flags and env defaults.
 type Options struct {
+	// Command is the subcommand to run; Args are its positional arguments.
+	Command string
+	Args    []string
+
 	GroupsCSV     string
 	Region        string
 	Profile       string
@@ -19,14 +39,204 @@ type Options struct {
 	PrettyJSON    bool
 	StartRFC3339  string
 	EndRFC3339    string
+	Since         string
 	Concurrency   int
+	Parser        string
+	// LambdaInvocation groups matches into full Lambda invocations.
+	LambdaInvocation bool
+	// Cluster groups matches into message templates; ClusterThreshold is the
+	// token similarity needed to join a template.
+	Cluster          bool
+	ClusterThreshold float64
+	// TUI shows the results in the interactive terminal view.
+	TUI bool
+
+	ConfigPath string
+	Env        string
+	Interval   time.Duration
+	Prefix     string
+	Limit      int
+	Long       bool
+	By         string
+	Top        int
+	Output     string
+	// Baseline is how far before the comparison window the diff baseline
+	// window starts; MinRatio is the count ratio reported as a change.
+	Baseline string
+	MinRatio float64
+	// NoCache bypasses the on-disk result cache; CacheTTL is its entry lifetime.
+	NoCache  bool
+	CacheTTL time.Duration
+	// Checkpoint records search progress in this file; Resume continues the
+	// search saved in a checkpoint file.
+	Checkpoint string
+	Resume     string
+	// Record writes the FilterLogEvents traffic to this file; Replay serves
+	// it from a recording instead of AWS.
+	Record string
+	Replay string
+	// Addr is the serve listen address; RequestTimeout and MaxConcurrent
+	// bound each HTTP request and the requests served at once.
+	Addr           string
+	RequestTimeout time.Duration
+	MaxConcurrent  int
+	// Redact replaces sensitive values in printed messages with placeholders,
+	// using the detectors and rules of RedactConfig (the config file's redact
+	// section).
+	Redact       bool
+	RedactConfig redact.Config
+	// Unmask reads events without data protection masking (logs:Unmask).
+	Unmask bool
+	// Every is the watch polling interval; Threshold is the number of matches
+	// in one interval that alerts, and Cooldown keeps a signature that
+	// alerted quiet. Alerts go to Webhook in WebhookFormat.
+	Every         time.Duration
+	Threshold     int
+	Cooldown      time.Duration
+	Webhook       string
+	WebhookFormat string
+	// StatsJSON is the file receiving the run's search telemetry; MetricsAddr
+	// serves it as Prometheus metrics while a long-running command runs.
+	StatsJSON   string
+	MetricsAddr string
+	// Verbose and Debug raise the diagnostics level from warnings to info
+	// and debug; LogFormat is text or json.
+	Verbose   bool
+	Debug     bool
+	LogFormat string
+	// NoProgress hides the progress display of one-shot searches.
+	NoProgress bool
+	// TraceConfig holds the trace depth and related-ID extractors: the
+	// config file's trace section, with --depth and --extractor applied.
+	TraceConfig trace.Config
+	// Export sends the printed records to a sink (one of export.Sinks) at
+	// ExportEndpoint, over ExportProtocol, with ExportHeaders added to every
+	// request. ExportIndex and ExportLabels are the Elasticsearch index and
+	// Loki label templates.
+	Export          string
+	ExportEndpoint  string
+	ExportProtocol  string
+	ExportHeaders   http.Header
+	ExportIndex     string
+	ExportLabels    map[string]string
+	ExportBatchSize int
+	// OutputFile receives the records instead of stdout, in the format of
+	// its extension; FlattenFields adds the fields of structured messages
+	// as columns.
+	OutputFile    string
+	FlattenFields bool
+	// SQL is a query run over the records, printed instead of them; Input
+	// lists result files whose records are queried instead of searching.
+	SQL   string
+	Input []string
 }
 
-// Validate checks relationships and required flags.
+// LogFormats lists the --log-format values.
+var LogFormats = []string{"text", "json"}
+
+// defaultTailInterval is the polling interval of the tail command.
+const defaultTailInterval = 5 * time.Second
+
+// Validate checks relationships and required flags for the selected command.
 // Returns an error message and exit code; if the filter-pattern is missing,
 // it returns ("", 2) and the caller should invoke usage().
 func (o *Options) Validate() (string, int) {
-	if o.FilterPattern == "" {
+	if o.Redact {
+		if _, err := redact.New(o.RedactConfig); err != nil {
+			return "error: redact config: " + err.Error(), 2
+		}
+	}
+	if o.LogFormat != "" && !slices.Contains(LogFormats, o.LogFormat) {
+		return "error: --log-format must be one of: " + strings.Join(LogFormats, ", "), 2
+	}
+	if msg, code := o.validateExport(); code != 0 {
+		return msg, code
+	}
+	if msg, code := o.validateOutputFile(); code != 0 {
+		return msg, code
+	}
+	if msg, code := o.validateSQL(); code != 0 {
+		return msg, code
+	}
+	switch o.Command {
+	case "", "search", "tail":
+	case "stats":
+		if !slices.Contains(stats.Outputs, o.Output) {
+			return "error: --output must be one of: " + strings.Join(stats.Outputs, ", "), 2
+		}
+		if o.Interval < 0 {
+			return "error: --interval must be positive", 2
+		}
+	case "diff":
+		if _, err := ParseSince(o.Baseline); err != nil {
+			return "error: --baseline: " + err.Error(), 2
+		}
+		if o.MinRatio <= 1 {
+			return "error: --min-ratio must be greater than 1", 2
+		}
+	case "watch":
+		if o.Every <= 0 {
+			return "error: --every must be positive", 2
+		}
+		if o.Threshold <= 0 {
+			return "error: --threshold must be positive", 2
+		}
+		if o.Cooldown < 0 {
+			return "error: --cooldown must not be negative", 2
+		}
+		if !slices.Contains(watch.Formats, o.WebhookFormat) {
+			return "error: --webhook-format must be one of: " + strings.Join(watch.Formats, ", "), 2
+		}
+		if o.Webhook != "" {
+			if u, err := url.Parse(o.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "error: --webhook must be an http or https URL", 2
+			}
+		}
+	case "shell":
+		return o.validateParser()
+	case "serve":
+		if o.RequestTimeout <= 0 {
+			return "error: --request-timeout must be positive", 2
+		}
+		if o.MaxConcurrent <= 0 {
+			return "error: --max-concurrent must be positive", 2
+		}
+		return "", 0
+	case "trace":
+		if len(o.Args) != 1 {
+			return "error: trace requires exactly one ID argument", 2
+		}
+		if o.TraceConfig.Depth < 0 {
+			return "error: --depth must not be negative", 2
+		}
+		if _, err := trace.New(nil, o.TraceConfig, parser.FormatAuto); err != nil {
+			return "error: trace config: " + err.Error(), 2
+		}
+		return o.validateParser()
+	case "insights":
+		if len(o.Args) != 1 || strings.TrimSpace(o.Args[0]) == "" {
+			return "error: insights requires the query as a single argument", 2
+		}
+		return "", 0
+	case "completion":
+		if len(o.Args) != 1 || !slices.Contains(completionShells, o.Args[0]) {
+			return "error: completion requires one of: " + strings.Join(completionShells, ", "), 2
+		}
+		return "", 0
+	case "cache":
+		if len(o.Args) > 1 || len(o.Args) == 1 && !slices.Contains([]string{"path", "clear"}, o.Args[0]) {
+			return "error: cache accepts one of: path, clear", 2
+		}
+		return "", 0
+	case "config":
+		if len(o.Args) > 1 || len(o.Args) == 1 && !slices.Contains([]string{"path", "show", "searches"}, o.Args[0]) {
+			return "error: config accepts one of: path, show, searches", 2
+		}
+		return "", 0
+	default:
+		return "", 0
+	}
+	if o.FilterPattern == "" && len(o.Input) == 0 {
 		// Caller prints usage() which exits(2)
 		return "", 2
 	}
@@ -36,6 +246,117 @@ func (o *Options) Validate() (string, int) {
 	if CountFlagOccurrences("--extract") > 1 {
 		return "error: --extract specified multiple times", 2
 	}
+	if o.LambdaInvocation && o.Extract != "" {
+		return "error: --lambda-invocation cannot be combined with --extract", 2
+	}
+	if o.Cluster && (o.Extract != "" || o.LambdaInvocation) {
+		return "error: --cluster cannot be combined with --extract or --lambda-invocation", 2
+	}
+	if (o.Checkpoint != "" || o.Resume != "") && (o.Extract != "" || o.LambdaInvocation || o.Cluster) {
+		return "error: --checkpoint and --resume cannot be combined with --extract, --lambda-invocation or --cluster", 2
+	}
+	if o.TUI && (o.Extract != "" || o.LambdaInvocation || o.Cluster || o.Checkpoint != "" || o.Resume != "") {
+		return "error: --tui cannot be combined with --extract, --lambda-invocation, --cluster, --checkpoint or --resume", 2
+	}
+	if o.TUI && (o.Verbose || o.Debug) {
+		return "error: --tui cannot be combined with -v or --debug; diagnostics would draw over the view", 2
+	}
+	if o.Record != "" && o.Replay != "" {
+		return "error: --record and --replay cannot be combined", 2
+	}
+	if o.Checkpoint != "" && o.Resume != "" && o.Checkpoint != o.Resume {
+		return "error: --resume continues its own checkpoint file; omit --checkpoint", 2
+	}
+	if o.ClusterThreshold < 0 || o.ClusterThreshold > 1 {
+		return "error: --cluster-threshold must be between 0 and 1", 2
+	}
+	return o.validateParser()
+}
+
+func (o *Options) validateExport() (string, int) {
+	if o.Export == "" {
+		if o.ExportEndpoint != "" || o.ExportProtocol != "" || len(o.ExportHeaders) > 0 || o.ExportIndex != "" || len(o.ExportLabels) > 0 {
+			return "error: --export-endpoint, --export-protocol, --export-header, --export-index and --export-label require --export", 2
+		}
+		return "", 0
+	}
+	if !slices.Contains(export.Sinks, o.Export) {
+		return "error: --export must be one of: " + strings.Join(export.Sinks, ", "), 2
+	}
+	if o.ExportProtocol != "" && !slices.Contains(export.OTLPProtocols, o.ExportProtocol) {
+		return "error: --export-protocol must be one of: " + strings.Join(export.OTLPProtocols, ", "), 2
+	}
+	switch {
+	case o.ExportProtocol != "" && o.Export != export.SinkOTLP:
+		return "error: --export-protocol applies to --export otlp only", 2
+	case o.ExportIndex != "" && o.Export != export.SinkElasticsearch && o.Export != export.SinkOpenSearch:
+		return "error: --export-index applies to --export elasticsearch and opensearch only", 2
+	case len(o.ExportLabels) > 0 && o.Export != export.SinkLoki:
+		return "error: --export-label applies to --export loki only", 2
+	}
+	if o.ExportBatchSize <= 0 {
+		return "error: --export-batch-size must be positive", 2
+	}
+	if _, err := export.New(o.Export, o.ExportConfig()); err != nil {
+		return "error: --export: " + err.Error(), 2
+	}
+	if o.Cluster || o.TUI || o.Extract != "" && o.NextFilter == "" {
+		return "error: --export cannot be combined with --cluster, --tui or --extract without --next-filter", 2
+	}
+	return "", 0
+}
+
+func (o *Options) validateOutputFile() (string, int) {
+	if o.OutputFile == "" {
+		if o.FlattenFields {
+			return "error: --flatten-fields requires --output-file", 2
+		}
+		return "", 0
+	}
+	if _, err := recordfile.DetectFormat(o.OutputFile); err != nil {
+		return "error: --output-file: " + err.Error(), 2
+	}
+	if o.Cluster || o.TUI || o.Extract != "" && o.NextFilter == "" || o.Checkpoint != "" || o.Resume != "" {
+		return "error: --output-file cannot be combined with --cluster, --tui, --checkpoint, --resume or --extract without --next-filter", 2
+	}
+	return "", 0
+}
+
+func (o *Options) validateSQL() (string, int) {
+	if o.SQL == "" {
+		if len(o.Input) > 0 {
+			return "error: --input requires --sql", 2
+		}
+		return "", 0
+	}
+	if _, err := query.Parse(o.SQL); err != nil {
+		return "error: --sql: " + err.Error(), 2
+	}
+	if o.Cluster || o.TUI || o.Extract != "" && o.NextFilter == "" || o.Checkpoint != "" || o.Resume != "" || o.OutputFile != "" {
+		return "error: --sql cannot be combined with --cluster, --tui, --checkpoint, --resume, --output-file or --extract without --next-filter", 2
+	}
+	if len(o.Input) > 0 && (o.Extract != "" || o.LambdaInvocation || o.Export != "" || o.Record != "" || o.Replay != "") {
+		return "error: --input cannot be combined with --extract, --lambda-invocation, --export, --record or --replay", 2
+	}
+	return "", 0
+}
+
+// ExportConfig returns the sink configuration given by the --export flags.
+func (o *Options) ExportConfig() export.Config {
+	return export.Config{
+		Endpoint:  o.ExportEndpoint,
+		Protocol:  o.ExportProtocol,
+		Headers:   o.ExportHeaders,
+		Index:     o.ExportIndex,
+		Labels:    o.ExportLabels,
+		BatchSize: o.ExportBatchSize,
+	}
+}
+
+func (o *Options) validateParser() (string, int) {
+	if _, err := parser.ParseFormat(o.Parser); err != nil {
+		return "error: --parser: " + err.Error(), 2
+	}
 	return "", 0
 }
 
@@ -54,47 +375,157 @@ func (o *Options) ParseExtractSpec() (string, string, error) {
 	return name, path, nil
 }
 
-// CollectOptions parses flags with environment-backed defaults and returns Options.
+// CollectOptions parses os.Args with environment-backed defaults, merges them
+// with the config file, and returns Options. It prints help and exits with
+// status 0 for -h, and exits with status 2 on invalid input.
 func CollectOptions() *Options {
-	var groupsCSV string
-	var region string
-	var profileFlag string
-	var filterPattern string
-	var extractFlag string
-	var nextFilterFlag string
-	var prettyJSON bool
-	var startStr string
-	var endStr string
-	var concurrency int
-
-	if v := os.Getenv("LOG_GROUP_NAMES"); v != "" {
-		groupsCSV = v
-	}
-
-	flag.StringVar(&groupsCSV, "groups", groupsCSV, "Comma-separated CloudWatch log group names")
-	flag.StringVar(&region, "region", os.Getenv("AWS_REGION"), "AWS region (optional; falls back to AWS defaults)")
-	flag.StringVar(&profileFlag, "profile", "", "AWS shared config profile (optional; or set AWS_PROFILE)")
-	flag.StringVar(&filterPattern, "filter-pattern", "", "CloudWatch Logs filter pattern (required)")
-	flag.StringVar(&extractFlag, "extract", "", "JMESPath extract in name=path form (single occurrence)")
-	flag.StringVar(&nextFilterFlag, "next-filter", "", "JMESPath to build second filter; requires --extract")
-	flag.BoolVar(&prettyJSON, "pretty", false, "Pretty-print JSON output (applies to first and second search results)")
-	flag.StringVar(&startStr, "start", "", "Start time RFC3339 (e.g., 2025-08-30T15:04:05Z)")
-	flag.StringVar(&endStr, "end", "", "End time RFC3339 (e.g., 2025-08-31T15:04:05Z)")
-	flag.IntVar(&concurrency, "concurrency", 4, "Number of concurrent log group searches")
-	flag.Parse()
-
-	return &Options{
-		GroupsCSV:     groupsCSV,
-		Region:        region,
-		Profile:       profileFlag,
-		FilterPattern: filterPattern,
-		Extract:       extractFlag,
-		NextFilter:    nextFilterFlag,
-		PrettyJSON:    prettyJSON,
-		StartRFC3339:  startStr,
-		EndRFC3339:    endStr,
-		Concurrency:   concurrency,
+	o, err := Parse(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
 	}
+	return o
+}
+
+// Parse selects the subcommand from args, parses its flags, and merges the
+// result with the config file. Help and flag errors are written to output.
+// Precedence, highest first: flags, environment variables, the saved search
+// selected by `run <name>`, the selected config environment, built-in defaults.
+func Parse(args []string, output io.Writer) (*Options, error) {
+	name := DefaultCommand
+	var searchName string
+	switch {
+	case len(args) > 0 && args[0] == "run":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return nil, fmt.Errorf("run requires a saved search name")
+		}
+		searchName = args[1]
+		args = args[2:]
+	case len(args) > 0 && !strings.HasPrefix(args[0], "-"):
+		if _, ok := LookupCommand(args[0]); !ok {
+			return nil, fmt.Errorf("unknown command %q; run `%s help` for a list", args[0], ProgramName)
+		}
+		name = args[0]
+		args = args[1:]
+	}
+	command, _ := LookupCommand(name)
+
+	o := &Options{Command: name}
+	fs := command.FlagSet(o)
+	fs.SetOutput(output)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	o.Args = fs.Args()
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if name == "help" || name == "completion" {
+		return o, nil
+	}
+
+	cfg, err := LoadConfig(o.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	var search SavedSearch
+	if searchName != "" {
+		if search, err = cfg.Search(searchName); err != nil {
+			return nil, err
+		}
+	}
+	envName := o.Env
+	if envName == "" {
+		envName = search.Environment
+	}
+	env, err := cfg.Environment(envName)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.GroupsCSV == "" {
+		switch {
+		case len(search.Groups) > 0:
+			o.GroupsCSV = strings.Join(search.Groups, ",")
+		case len(env.Groups) > 0:
+			o.GroupsCSV = strings.Join(env.Groups, ",")
+		}
+	}
+	groups, err := cfg.ExpandGroups(ParseGroupsCSV(o.GroupsCSV))
+	if err != nil {
+		return nil, err
+	}
+	o.GroupsCSV = strings.Join(groups, ",")
+	if o.Region == "" {
+		o.Region = env.Region
+	}
+	if o.Profile == "" && os.Getenv("AWS_PROFILE") == "" {
+		o.Profile = env.Profile
+	}
+	o.RedactConfig = cfg.Redact
+	if name == "trace" {
+		if !set["depth"] && cfg.Trace.Depth > 0 {
+			o.TraceConfig.Depth = cfg.Trace.Depth
+		}
+		o.TraceConfig.MaxIDs = cfg.Trace.MaxIDs
+		o.TraceConfig.Extractors = append(cfg.Trace.Extractors, o.TraceConfig.Extractors...)
+	}
+	if !set["redact"] {
+		o.Redact = cfg.Redact.Enabled
+	}
+	if searchName == "" {
+		return o, o.applyResume()
+	}
+
+	pick := func(name string, dst *string, v string) {
+		if !set[name] && v != "" {
+			*dst = v
+		}
+	}
+	pick("filter-pattern", &o.FilterPattern, search.FilterPattern)
+	pick("extract", &o.Extract, search.Extract)
+	pick("next-filter", &o.NextFilter, search.NextFilter)
+	pick("parser", &o.Parser, search.Parser)
+	if !set["start"] && !set["end"] && !set["since"] {
+		o.StartRFC3339, o.EndRFC3339, o.Since = search.Start, search.End, search.Since
+	}
+	if !set["pretty"] && search.Pretty {
+		o.PrettyJSON = true
+	}
+	if !set["lambda-invocation"] && search.LambdaInvocation {
+		o.LambdaInvocation = true
+	}
+	if !set["cluster"] && search.Cluster {
+		o.Cluster = true
+	}
+	if !set["concurrency"] && search.Concurrency > 0 {
+		o.Concurrency = search.Concurrency
+	}
+	return o, o.applyResume()
+}
+
+// applyResume replaces the search definition with the one saved in the
+// --resume checkpoint, which then keeps recording progress.
+func (o *Options) applyResume() error {
+	if o.Resume == "" {
+		return nil
+	}
+	cp, err := checkpoint.Load(o.Resume)
+	if err != nil {
+		return err
+	}
+	o.FilterPattern = cp.FilterPattern
+	o.GroupsCSV = strings.Join(cp.Groups, ",")
+	o.StartRFC3339 = time.UnixMilli(cp.StartMs).UTC().Format(time.RFC3339Nano)
+	o.EndRFC3339 = time.UnixMilli(cp.EndMs).UTC().Format(time.RFC3339Nano)
+	o.Since = ""
+	if o.Region == "" {
+		o.Region = cp.Region
+	}
+	return nil
 }
 
 // ParseGroupsCSV turns a comma-separated groups string into slice, trimming empties.
@@ -156,6 +587,48 @@ func ResolveTimeWindow(startStr, endStr string, now time.Time) (time.Time, time.
 	return start, end, nil
 }
 
+// ResolveTimeWindowSince is ResolveTimeWindow with support for a --since
+// duration: when since is set the window is [end-since, end], where end is
+// endStr or now. since cannot be combined with startStr.
+func ResolveTimeWindowSince(startStr, endStr, since string, now time.Time) (time.Time, time.Time, error) {
+	if since == "" {
+		return ResolveTimeWindow(startStr, endStr, now)
+	}
+	if startStr != "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("--since cannot be combined with --start")
+	}
+	d, err := ParseSince(since)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end := now
+	if endStr != "" {
+		if end, err = time.Parse(time.RFC3339, endStr); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return end.Add(-d), end, nil
+}
+
+// ParseSince parses a positive duration, accepting a "d" (24h) suffix in
+// addition to the units understood by time.ParseDuration.
+func ParseSince(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n float64
+		if n, err = strconv.ParseFloat(days, 64); err == nil {
+			d = time.Duration(n * float64(24*time.Hour))
+		}
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q; expected e.g. 90m, 1h, 2d", s)
+	}
+	return d, nil
+}
+
 // ErrStartAfterEnd represents an invalid time window where start > end.
 var ErrStartAfterEnd = &timeRangeError{"start is after end"}
 
@@ -4,10 +4,14 @@ import (
 	"flag"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/checkpoint"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
 )
 
 // helper to temporarily set env var
@@ -155,6 +159,32 @@ func TestValidate(t *testing.T) {
 		{"missing-filter", &Options{}, []string{"cmd"}, "", 2},
 		{"next-without-extract", &Options{FilterPattern: "x", NextFilter: "nf"}, []string{"cmd"}, "error: --next-filter requires --extract", 2},
 		{"ok", &Options{FilterPattern: "x"}, []string{"cmd"}, "", 0},
+		{"bad-parser", &Options{FilterPattern: "x", Parser: "syslog"}, []string{"cmd"}, "error: --parser: unknown parser \"syslog\"; expected one of auto, lambda, apigw, vpcflow, alb, logfmt, json", 2},
+		{"invocation-with-extract", &Options{FilterPattern: "x", Extract: "a=b", LambdaInvocation: true}, []string{"cmd"}, "error: --lambda-invocation cannot be combined with --extract", 2},
+		{"cluster-with-extract", &Options{FilterPattern: "x", Extract: "a=b", Cluster: true}, []string{"cmd"}, "error: --cluster cannot be combined with --extract or --lambda-invocation", 2},
+		{"cluster-threshold", &Options{FilterPattern: "x", Cluster: true, ClusterThreshold: 1.5}, []string{"cmd"}, "error: --cluster-threshold must be between 0 and 1", 2},
+		{"checkpoint-with-cluster", &Options{FilterPattern: "x", Checkpoint: "cp.json", Cluster: true}, []string{"cmd"}, "error: --checkpoint and --resume cannot be combined with --extract, --lambda-invocation or --cluster", 2},
+		{"record-and-replay", &Options{FilterPattern: "x", Record: "a.jsonl", Replay: "b.jsonl"}, []string{"cmd"}, "error: --record and --replay cannot be combined", 2},
+		{"tui-with-extract", &Options{FilterPattern: "x", Extract: "a=b", TUI: true}, []string{"cmd"}, "error: --tui cannot be combined with --extract, --lambda-invocation, --cluster, --checkpoint or --resume", 2},
+		{"redact-rule", &Options{FilterPattern: "x", Redact: true, RedactConfig: redact.Config{Rules: []redact.Rule{{Name: "x", Regex: "("}}}}, []string{"cmd"}, "error: redact config: rule 1 (x): error parsing regexp: missing closing ): `(`", 2},
+		{"export-sink", &Options{FilterPattern: "x", Export: "kafka", ExportBatchSize: 512}, []string{"cmd"}, "error: --export must be one of: otlp, loki, elasticsearch, opensearch", 2},
+		{"export-protocol", &Options{FilterPattern: "x", Export: "otlp", ExportProtocol: "http", ExportBatchSize: 512}, []string{"cmd"}, "error: --export-protocol must be one of: http/protobuf, http/json, grpc", 2},
+		{"export-endpoint-alone", &Options{FilterPattern: "x", ExportEndpoint: "http://localhost:4318"}, []string{"cmd"}, "error: --export-endpoint, --export-protocol, --export-header, --export-index and --export-label require --export", 2},
+		{"export-with-extract", &Options{FilterPattern: "x", Export: "otlp", Extract: "a=b", ExportBatchSize: 512}, []string{"cmd"}, "error: --export cannot be combined with --cluster, --tui or --extract without --next-filter", 2},
+		{"export-next-filter", &Options{FilterPattern: "x", Export: "otlp", Extract: "a=b", NextFilter: "nf", ExportBatchSize: 512}, []string{"cmd"}, "", 0},
+		{"export-index-for-loki", &Options{FilterPattern: "x", Export: "loki", ExportIndex: "logs", ExportBatchSize: 512}, []string{"cmd"}, "error: --export-index applies to --export elasticsearch and opensearch only", 2},
+		{"export-label-template", &Options{FilterPattern: "x", Export: "loki", ExportLabels: map[string]string{"env": "{{stage}}"}, ExportBatchSize: 512}, []string{"cmd"}, "error: --export: Loki label env: unknown placeholder {{stage}}; expected one of group, stream, service, account, region, date, month", 2},
+		{"export-batch-size", &Options{FilterPattern: "x", Export: "opensearch"}, []string{"cmd"}, "error: --export-batch-size must be positive", 2},
+		{"output-file", &Options{FilterPattern: "x", OutputFile: "out.parquet", FlattenFields: true}, []string{"cmd"}, "", 0},
+		{"output-file-format", &Options{FilterPattern: "x", OutputFile: "out.json"}, []string{"cmd"}, `error: --output-file: unknown file format of "out.json"; expected a name ending in .parquet, .ndjson.gz, .ndjson.zst`, 2},
+		{"output-file-with-tui", &Options{FilterPattern: "x", OutputFile: "out.ndjson.zst", TUI: true}, []string{"cmd"}, "error: --output-file cannot be combined with --cluster, --tui, --checkpoint, --resume or --extract without --next-filter", 2},
+		{"flatten-fields-alone", &Options{FilterPattern: "x", FlattenFields: true}, []string{"cmd"}, "error: --flatten-fields requires --output-file", 2},
+		{"sql", &Options{FilterPattern: "x", SQL: "SELECT count(*) FROM records"}, []string{"cmd"}, "", 0},
+		{"sql-input-without-pattern", &Options{SQL: "SELECT * FROM records", Input: []string{"a.parquet"}}, []string{"cmd"}, "", 0},
+		{"sql-syntax", &Options{FilterPattern: "x", SQL: "SELECT FROM records"}, []string{"cmd"}, `error: --sql: expected an expression near "FROM" at position 8`, 2},
+		{"sql-with-cluster", &Options{FilterPattern: "x", SQL: "SELECT * FROM records", Cluster: true}, []string{"cmd"}, "error: --sql cannot be combined with --cluster, --tui, --checkpoint, --resume, --output-file or --extract without --next-filter", 2},
+		{"input-alone", &Options{Input: []string{"a.parquet"}}, []string{"cmd"}, "error: --input requires --sql", 2},
+		{"input-with-replay", &Options{SQL: "SELECT * FROM records", Input: []string{"a.parquet"}, Replay: "r.jsonl"}, []string{"cmd"}, "error: --input cannot be combined with --extract, --lambda-invocation, --export, --record or --replay", 2},
 		{"multi-extract", &Options{FilterPattern: "x", Extract: "a=b"}, []string{"cmd", "--extract", "a=b", "--extract=c=d"}, "error: --extract specified multiple times", 2},
 	}
 	for _, tt := range tests {
@@ -171,6 +201,8 @@ func TestValidate(t *testing.T) {
 }
 
 func TestCollectOptions_Basic(t *testing.T) {
+	// ignore any real config file
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 	withoutEnv("AWS_REGION", func() { // ensure region comes from flag
 		withEnv("LOG_GROUP_NAMES", "g1,g2", func() {
 			withFlagSet([]string{
@@ -235,3 +267,27 @@ func TestParseExtractSpec(t *testing.T) {
 		})
 	}
 }
+
+func TestParseResume(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("LOG_GROUP_NAMES", "")
+	path := filepath.Join(t.TempDir(), "cp.json")
+	start := time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := checkpoint.Create(path, "eu-west-1", "ERROR", []string{"/a", "/b"}, start.UnixMilli(), start.Add(72*time.Hour).UnixMilli()); err != nil {
+		t.Fatal(err)
+	}
+	o, err := Parse([]string{"--resume", path, "--since", "1h"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.FilterPattern != "ERROR" || o.GroupsCSV != "/a,/b" || o.Region != "eu-west-1" || o.Since != "" {
+		t.Fatalf("resumed options = %+v", o)
+	}
+	gotStart, gotEnd, err := ResolveTimeWindowSince(o.StartRFC3339, o.EndRFC3339, o.Since, time.Now())
+	if err != nil || !gotStart.Equal(start) || !gotEnd.Equal(start.Add(72*time.Hour)) {
+		t.Fatalf("window = %v..%v, %v", gotStart, gotEnd, err)
+	}
+	if _, err := Parse([]string{"--resume", filepath.Join(t.TempDir(), "missing.json")}, io.Discard); err == nil {
+		t.Fatal("expected error for missing checkpoint")
+	}
+}
@@ -0,0 +1,195 @@
+// Package cache stores SearchGroup results on disk so that repeated searches
+// over the same historical window do not page through CloudWatch Logs again.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// DefaultTTL is how long an entry is reused after it was first fetched.
+const DefaultTTL = 24 * time.Hour
+
+// SettleDelay is how far behind the fetch time results are treated as final;
+// CloudWatch Logs may still ingest events for the last few minutes, so newer
+// events are always fetched again.
+const SettleDelay = 5 * time.Minute
+
+// DefaultDir returns the per-user cache directory of the tool.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aws-multi-log-inspector"), nil
+}
+
+// Cache is a directory of result entries, one file per
+// (account, region, group, filter pattern).
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// New returns a cache in dir. Entries older than ttl are refetched; ttl <= 0
+// keeps them until cleared.
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string { return c.dir }
+
+// Clear removes every cached entry.
+func (c *Cache) Clear() error {
+	return os.RemoveAll(c.dir)
+}
+
+// entry is the time range [StartMs, EndMs] (inclusive, like FilterLogEvents)
+// known to be complete, and the records in it.
+type entry struct {
+	Account       string
+	Region        string
+	Group         string
+	FilterPattern string
+	StartMs       int64
+	EndMs         int64
+	Created       time.Time
+	Records       []model.LogRecord
+}
+
+func (c *Cache) path(account, region, group, filterPattern string) string {
+	h := sha256.New()
+	for _, s := range []string{account, region, group, filterPattern} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// load returns the entry at path, or nil when it is missing, expired or unreadable.
+func (c *Cache) load(path string, now time.Time) *entry {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var e entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil
+	}
+	if c.ttl > 0 && now.Sub(e.Created) > c.ttl {
+		return nil
+	}
+	return &e
+}
+
+// store writes the entry atomically so concurrent runs never read a partial file.
+func (c *Cache) store(path string, e *entry) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Retriever serves SearchGroup from the cache and fetches only what is missing.
+type Retriever struct {
+	next    inspector.CloudWatchLogsRetriever
+	cache   *Cache
+	account string
+	region  string
+}
+
+// Wrap returns a retriever caching next's results under the given account and region.
+func (c *Cache) Wrap(next inspector.CloudWatchLogsRetriever, account, region string) *Retriever {
+	return &Retriever{next: next, cache: c, account: account, region: region}
+}
+
+// SearchGroup returns cached records when the cached range covers the window.
+// When the window starts inside the cached range but ends after it (typically
+// a window ending now), only the tail is fetched and appended to the entry.
+// Any other window is fetched in full and replaces the entry. Cache write
+// errors are ignored; the cache is only an optimisation.
+func (r *Retriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	now := time.Now()
+	path := r.cache.path(r.account, r.region, group, filterPattern)
+
+	var records []model.LogRecord
+	from := startMs
+	e := r.cache.load(path, now)
+	if e != nil && e.StartMs <= startMs && startMs <= e.EndMs+1 {
+		for _, rec := range e.Records {
+			if ms := rec.Timestamp.UnixMilli(); ms >= startMs && ms <= endMs {
+				records = append(records, rec)
+			}
+		}
+		if endMs <= e.EndMs {
+			return records, nil
+		}
+		from = e.EndMs + 1
+	} else {
+		e = &entry{Account: r.account, Region: r.region, Group: group, FilterPattern: filterPattern, StartMs: startMs, EndMs: startMs - 1, Created: now}
+	}
+
+	fetched, err := r.next.SearchGroup(ctx, group, filterPattern, from, endMs)
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, fetched...)
+
+	settled := min(endMs, now.Add(-SettleDelay).UnixMilli())
+	if settled > e.EndMs {
+		for _, rec := range fetched {
+			if rec.Timestamp.UnixMilli() <= settled {
+				e.Records = append(e.Records, rec)
+			}
+		}
+		e.EndMs = settled
+		_ = r.cache.store(path, e)
+	}
+	return records, nil
+}
+
+// Entries returns the number of cached entries, zero when the directory does not exist.
+func (c *Cache) Entries() (int, error) {
+	files, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".json" {
+			n++
+		}
+	}
+	return n, nil
+}
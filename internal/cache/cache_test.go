@@ -0,0 +1,114 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cache"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+type call struct{ startMs, endMs int64 }
+
+// fakeRetriever returns one record per minute in the requested window.
+type fakeRetriever struct {
+	calls []call
+}
+
+func (f *fakeRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	f.calls = append(f.calls, call{startMs, endMs})
+	var out []model.LogRecord
+	for ms := (startMs + 59999) / 60000 * 60000; ms <= endMs; ms += 60000 {
+		out = append(out, model.LogRecord{Timestamp: time.UnixMilli(ms), LogGroup: group, Message: "m"})
+	}
+	return out, nil
+}
+
+func TestHistoricalWindowIsServedFromCache(t *testing.T) {
+	f := &fakeRetriever{}
+	c := cache.New(t.TempDir(), time.Hour)
+	r := c.Wrap(f, "123", "us-east-1")
+	ctx := context.Background()
+	start := time.Date(2025, 8, 31, 0, 0, 0, 0, time.UTC).UnixMilli()
+	end := start + int64(time.Hour/time.Millisecond)
+
+	first, err := r.SearchGroup(ctx, "/a", "ERROR", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A narrower window inside the cached range needs no call either.
+	second, err := r.SearchGroup(ctx, "/a", "ERROR", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := r.SearchGroup(ctx, "/a", "ERROR", start+30*60000, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 1 || len(first) != 61 || len(second) != 61 || len(inner) != 31 {
+		t.Fatalf("calls=%d first=%d second=%d inner=%d", len(f.calls), len(first), len(second), len(inner))
+	}
+
+	// Other patterns, accounts and earlier starts are separate fetches.
+	_, _ = r.SearchGroup(ctx, "/a", "WARN", start, end)
+	_, _ = c.Wrap(f, "456", "us-east-1").SearchGroup(ctx, "/a", "ERROR", start, end)
+	_, _ = r.SearchGroup(ctx, "/a", "ERROR", start-60000, end)
+	if len(f.calls) != 4 {
+		t.Fatalf("calls = %d, want 4", len(f.calls))
+	}
+	if n, err := c.Entries(); err != nil || n != 3 {
+		t.Fatalf("Entries() = %d, %v", n, err)
+	}
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.Entries(); n != 0 {
+		t.Fatalf("Entries() after Clear = %d", n)
+	}
+}
+
+func TestWindowEndingNowFetchesOnlyTail(t *testing.T) {
+	f := &fakeRetriever{}
+	r := cache.New(t.TempDir(), time.Hour).Wrap(f, "123", "us-east-1")
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	start := now - int64(time.Hour/time.Millisecond)
+
+	if _, err := r.SearchGroup(ctx, "/a", "ERROR", start, now); err != nil {
+		t.Fatal(err)
+	}
+	later := now + 1000
+	got, err := r.SearchGroup(ctx, "/a", "ERROR", start, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(f.calls))
+	}
+	tail := f.calls[1]
+	settled := now - int64(cache.SettleDelay/time.Millisecond)
+	if tail.startMs <= start || tail.startMs > settled+1 || tail.startMs < settled-1000 || tail.endMs != later {
+		t.Fatalf("tail call = %+v, want start just after %d", tail, settled)
+	}
+	for i := 1; i < len(got); i++ {
+		if !got[i].Timestamp.After(got[i-1].Timestamp) {
+			t.Fatalf("duplicate or unordered records at %d: %v", i, got[i].Timestamp)
+		}
+	}
+}
+
+func TestExpiredEntryIsRefetched(t *testing.T) {
+	f := &fakeRetriever{}
+	r := cache.New(t.TempDir(), time.Nanosecond).Wrap(f, "123", "us-east-1")
+	start := time.Date(2025, 8, 31, 0, 0, 0, 0, time.UTC).UnixMilli()
+	for i := 0; i < 2; i++ {
+		if _, err := r.SearchGroup(context.Background(), "/a", "ERROR", start, start+60000); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(f.calls) != 2 {
+		t.Fatalf("calls = %d, want 2", len(f.calls))
+	}
+}
@@ -0,0 +1,249 @@
+// Package checkpoint runs a multi-group search page by page while recording
+// per-group progress in a file, so an interrupted search can be resumed
+// without repeating output.
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// Pager pages through the matching events of one log group.
+type Pager interface {
+	SearchGroupPages(ctx context.Context, group, filterPattern string, startMs, endMs int64, token string, fn func(records []model.LogRecord, nextToken string) error) error
+}
+
+// Progress is how far the search of one group got.
+type Progress struct {
+	// NextToken continues the group's pagination; empty before the first page
+	// and once the group is done.
+	NextToken string `json:",omitempty"`
+	// LastTimestampMs is the latest event time written, and LastEventIDs the
+	// events written at that time. They are used to restart the group when the
+	// token is rejected (FilterLogEvents tokens expire).
+	LastTimestampMs int64    `json:",omitempty"`
+	LastEventIDs    []string `json:",omitempty"`
+	Written         int
+	Done            bool
+}
+
+// Checkpoint is the search definition and the progress of each group.
+type Checkpoint struct {
+	Region        string `json:",omitempty"`
+	FilterPattern string
+	Groups        []string
+	StartMs       int64
+	EndMs         int64
+	Progress      map[string]*Progress
+	Updated       time.Time
+
+	path string
+	mu   sync.Mutex
+}
+
+// ErrExists is returned by Create when the checkpoint file already exists.
+var ErrExists = errors.New("checkpoint already exists; use --resume to continue it")
+
+// Create saves a new checkpoint, refusing to overwrite an existing file.
+func Create(path, region, filterPattern string, groups []string, startMs, endMs int64) (*Checkpoint, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s: %w", path, ErrExists)
+	}
+	c := &Checkpoint{
+		Region:        region,
+		FilterPattern: filterPattern,
+		Groups:        groups,
+		StartMs:       startMs,
+		EndMs:         endMs,
+		Progress:      map[string]*Progress{},
+		path:          path,
+	}
+	if err := c.Save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads the checkpoint at path.
+func Load(path string) (*Checkpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if c.FilterPattern == "" || len(c.Groups) == 0 {
+		return nil, fmt.Errorf("invalid checkpoint %s: missing filter pattern or groups", path)
+	}
+	if c.Progress == nil {
+		c.Progress = map[string]*Progress{}
+	}
+	c.path = path
+	return c, nil
+}
+
+// Save writes the checkpoint atomically.
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Checkpoint) save() error {
+	c.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+// Written returns the number of records written across groups.
+func (c *Checkpoint) Written() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, p := range c.Progress {
+		n += p.Written
+	}
+	return n
+}
+
+// Done reports whether every group has been searched to the end.
+func (c *Checkpoint) Done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, g := range c.Groups {
+		if p := c.Progress[g]; p == nil || !p.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// Run searches the unfinished groups with up to workers in parallel. Each page
+// is passed to emit and then recorded in the checkpoint file, one page at a
+// time, so the file never claims output that was not written. Records are in
+// page order per group, not globally sorted.
+func (c *Checkpoint) Run(ctx context.Context, p Pager, workers int, emit func([]model.LogRecord) error) error {
+	var pending []string
+	c.mu.Lock()
+	for _, g := range c.Groups {
+		if c.Progress[g] == nil {
+			c.Progress[g] = &Progress{}
+		}
+		if !c.Progress[g].Done {
+			pending = append(pending, g)
+		}
+	}
+	c.mu.Unlock()
+	workers = max(1, min(workers, len(pending)))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	groups := make(chan string, len(pending))
+	for _, g := range pending {
+		groups <- g
+	}
+	close(groups)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range groups {
+				if err := c.runGroup(ctx, p, g, emit); err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("%s: %w", g, err)
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// runGroup continues one group from its token, or from its last written
+// timestamp when there is no usable token.
+func (c *Checkpoint) runGroup(ctx context.Context, p Pager, group string, emit func([]model.LogRecord) error) error {
+	c.mu.Lock()
+	prog := c.Progress[group]
+	token := prog.NextToken
+	c.mu.Unlock()
+
+	pages := 0
+	fromTimestamp := false
+	page := func(records []model.LogRecord, next string) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		pages++
+		if fromTimestamp {
+			records = slices.DeleteFunc(slices.Clone(records), func(r model.LogRecord) bool {
+				return r.Timestamp.UnixMilli() == prog.LastTimestampMs && slices.Contains(prog.LastEventIDs, r.EventID)
+			})
+		}
+		if err := emit(records); err != nil {
+			return err
+		}
+		prog.advance(records, next)
+		return c.save()
+	}
+
+	if token != "" || prog.Written == 0 {
+		err := p.SearchGroupPages(ctx, group, c.FilterPattern, c.StartMs, c.EndMs, token, page)
+		// A rejected token fails before the first page; anything else is final.
+		if err == nil || token == "" || pages > 0 || ctx.Err() != nil {
+			return err
+		}
+	}
+	fromTimestamp = true
+	start := max(c.StartMs, prog.LastTimestampMs)
+	return p.SearchGroupPages(ctx, group, c.FilterPattern, start, c.EndMs, "", page)
+}
+
+// advance records a written page.
+func (p *Progress) advance(records []model.LogRecord, next string) {
+	for _, r := range records {
+		ms := r.Timestamp.UnixMilli()
+		switch {
+		case ms > p.LastTimestampMs:
+			p.LastTimestampMs = ms
+			p.LastEventIDs = []string{r.EventID}
+		case ms == p.LastTimestampMs:
+			p.LastEventIDs = append(p.LastEventIDs, r.EventID)
+		}
+	}
+	p.Written += len(records)
+	p.NextToken = next
+	p.Done = next == ""
+}
@@ -0,0 +1,139 @@
+package checkpoint_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/checkpoint"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+var errExpired = errors.New("ExpiredToken")
+
+// fakePager serves pages of two records per group. Page i has token "p<i>";
+// it fails once the total page budget is spent, and rejects tokens listed
+// in badTokens.
+type fakePager struct {
+	pages     map[string][][]model.LogRecord
+	budget    int
+	badTokens map[string]bool
+	starts    []int64
+}
+
+func (f *fakePager) SearchGroupPages(ctx context.Context, group, filterPattern string, startMs, endMs int64, token string, fn func([]model.LogRecord, string) error) error {
+	f.starts = append(f.starts, startMs)
+	if f.badTokens[token] {
+		return errors.New("invalid token")
+	}
+	pages := f.pages[group]
+	i := 0
+	if token != "" {
+		fmt.Sscanf(token, "p%d", &i)
+	} else {
+		// restart from a timestamp: skip pages entirely before it
+		for i < len(pages)-1 && pages[i][len(pages[i])-1].Timestamp.UnixMilli() < startMs {
+			i++
+		}
+	}
+	for ; i < len(pages); i++ {
+		if f.budget == 0 {
+			return errExpired
+		}
+		f.budget--
+		next := ""
+		if i+1 < len(pages) {
+			next = fmt.Sprintf("p%d", i+1)
+		}
+		if err := fn(pages[i], next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func records(group string, n int) [][]model.LogRecord {
+	t0 := time.Date(2025, 8, 31, 0, 0, 0, 0, time.UTC)
+	var pages [][]model.LogRecord
+	for i := 0; i < n; i += 2 {
+		var page []model.LogRecord
+		for j := i; j < i+2 && j < n; j++ {
+			// two events share each timestamp to exercise duplicate skipping
+			page = append(page, model.LogRecord{Timestamp: t0.Add(time.Duration(j/2) * time.Second), LogGroup: group, EventID: fmt.Sprintf("%s-%d", group, j)})
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+func collect(out *[]string) func([]model.LogRecord) error {
+	return func(rs []model.LogRecord) error {
+		for _, r := range rs {
+			*out = append(*out, r.EventID)
+		}
+		return nil
+	}
+}
+
+func TestResumeAfterFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp.json")
+	f := &fakePager{pages: map[string][][]model.LogRecord{"/a": records("/a", 6), "/b": records("/b", 4)}, budget: 3}
+	cp, err := checkpoint.Create(path, "us-east-1", "ERROR", []string{"/a", "/b"}, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	if err := cp.Run(context.Background(), f, 1, collect(&out)); !errors.Is(err, errExpired) {
+		t.Fatalf("err = %v, want expired", err)
+	}
+	if _, err := checkpoint.Create(path, "", "ERROR", []string{"/a"}, 0, 1); !errors.Is(err, checkpoint.ErrExists) {
+		t.Fatalf("Create over existing = %v", err)
+	}
+
+	cp, err = checkpoint.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Written() != 6 || cp.Done() || cp.Region != "us-east-1" {
+		t.Fatalf("loaded written=%d done=%v region=%q", cp.Written(), cp.Done(), cp.Region)
+	}
+	f.budget = -1
+	if err := cp.Run(context.Background(), f, 2, collect(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if !cp.Done() || cp.Written() != 10 || len(out) != 10 {
+		t.Fatalf("done=%v written=%d out=%v", cp.Done(), cp.Written(), out)
+	}
+	seen := map[string]bool{}
+	for _, id := range out {
+		if seen[id] {
+			t.Fatalf("duplicate output %s in %v", id, out)
+		}
+		seen[id] = true
+	}
+}
+
+func TestResumeWithRejectedToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp.json")
+	f := &fakePager{pages: map[string][][]model.LogRecord{"/a": records("/a", 6)}, budget: 1}
+	cp, _ := checkpoint.Create(path, "", "ERROR", []string{"/a"}, 0, 1)
+	var out []string
+	_ = cp.Run(context.Background(), f, 1, collect(&out))
+
+	// The saved token has expired: the group restarts from its last timestamp.
+	f.budget, f.badTokens = -1, map[string]bool{"p1": true}
+	cp, _ = checkpoint.Load(path)
+	if err := cp.Run(context.Background(), f, 1, collect(&out)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(out, ",") != "/a-0,/a-1,/a-2,/a-3,/a-4,/a-5" {
+		t.Fatalf("out = %v", out)
+	}
+	if last := f.starts[len(f.starts)-1]; last == 0 {
+		t.Fatalf("restart start = %d, want last written timestamp", last)
+	}
+}
@@ -2,16 +2,24 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"time"
 
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/logging"
 )
 
 // LogsAPI is the subset of CloudWatch Logs API we use.
@@ -28,7 +36,19 @@ type AuthOptions struct {
 }
 
 type CloudWatchClient struct {
-	client LogsAPI
+	client   LogsAPI
+	describe DescribeAPI
+	insights InsightsAPI
+	identity IdentityAPI
+	region   string
+	// unmask requests events unmasked by data protection policies.
+	unmask bool
+	// metrics counts requests, pages, events and retries; nil records nothing.
+	metrics *metrics.Search
+	// log receives per-page (debug) and per-group (info) diagnostics.
+	log *slog.Logger
+	// progress is called after each FilterLogEvents page.
+	progress func(PageProgress)
 }
 
 type CloudWatchOption func(*cloudWatchCfg)
@@ -37,6 +57,12 @@ type cloudWatchCfg struct {
 	region      string
 	profile     string
 	staticCreds *credentials.StaticCredentialsProvider
+	record      io.Writer
+	recordNow   time.Time
+	unmask      bool
+	metrics     *metrics.Search
+	log         *slog.Logger
+	progress    func(PageProgress)
 }
 
 // WithRegion sets an explicit AWS region.
@@ -55,6 +81,46 @@ func WithStaticCredentials(accessKey, secretKey, sessionToken string) CloudWatch
 	return func(c *cloudWatchCfg) { c.staticCreds = &prov }
 }
 
+// WithRecording writes every FilterLogEvents request and response to w (see
+// Recorder); now is the reference time of the run, stored for replays.
+func WithRecording(w io.Writer, now time.Time) CloudWatchOption {
+	return func(c *cloudWatchCfg) { c.record, c.recordNow = w, now }
+}
+
+// WithUnmask requests log events without the masking applied by data
+// protection policies, in searches and in Insights queries (see
+// UnmaskQuery). It needs the logs:Unmask permission on the groups.
+func WithUnmask() CloudWatchOption {
+	return func(c *cloudWatchCfg) { c.unmask = true }
+}
+
+// WithMetrics records the client's searches in m: group searches and their
+// duration, and FilterLogEvents pages, events, retries, throttles and errors.
+func WithMetrics(m *metrics.Search) CloudWatchOption {
+	return func(c *cloudWatchCfg) { c.metrics = m }
+}
+
+// WithLogger writes diagnostics to l: each FilterLogEvents page at debug
+// level and each finished group search at info level. When l enables debug,
+// the AWS SDK's request, response and retry logging goes to l as well.
+func WithLogger(l *slog.Logger) CloudWatchOption {
+	return func(c *cloudWatchCfg) { c.log = l }
+}
+
+// PageProgress describes a FilterLogEvents page that was fetched.
+type PageProgress struct {
+	Group  string
+	Events int
+	// Newest is the time of the page's newest event; zero for an empty page.
+	Newest time.Time
+}
+
+// WithProgress calls fn after each FilterLogEvents page, from the goroutine
+// that requested it.
+func WithProgress(fn func(PageProgress)) CloudWatchOption {
+	return func(c *cloudWatchCfg) { c.progress = fn }
+}
+
 // NewCloudWatchClient builds a CloudWatch Logs client using functional options.
 // Precedence:
 //   - If profile is set via WithProfile, use it with optional WithRegion.
@@ -80,44 +146,233 @@ func NewCloudWatchClient(ctx context.Context, opts ...CloudWatchOption) (*CloudW
 	default:
 		// default chain only, region already appended if provided
 	}
+	if cfgState.log != nil && cfgState.log.Enabled(ctx, slog.LevelDebug) {
+		loadOpts = append(loadOpts,
+			config.WithLogger(sdkLogger{cfgState.log}),
+			config.WithClientLogMode(aws.LogRequest|aws.LogResponse|aws.LogRetries))
+	}
 
 	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
-	return &CloudWatchClient{client: cloudwatchlogs.NewFromConfig(cfg)}, nil
+	api := cloudwatchlogs.NewFromConfig(cfg)
+	cwc := &CloudWatchClient{client: api, describe: api, insights: api, identity: sts.NewFromConfig(cfg), region: cfg.Region, unmask: cfgState.unmask, metrics: cfgState.metrics, log: cfgState.log, progress: cfgState.progress}
+	if cfgState.record != nil {
+		rec, err := NewRecorder(api, cfgState.record, cfgState.recordNow)
+		if err != nil {
+			return nil, err
+		}
+		cwc.client = rec
+	}
+	return cwc, nil
+}
+
+// NewCloudWatchClientFromAPI returns a client whose searches go to api, such as
+// a Replayer. It has no AWS configuration, so only the search methods work
+// and of opts only WithUnmask, WithMetrics, WithLogger and WithProgress apply.
+func NewCloudWatchClientFromAPI(api LogsAPI, opts ...CloudWatchOption) *CloudWatchClient {
+	cfgState := &cloudWatchCfg{}
+	for _, o := range opts {
+		o(cfgState)
+	}
+	return &CloudWatchClient{client: api, unmask: cfgState.unmask, metrics: cfgState.metrics, log: cfgState.log, progress: cfgState.progress}
 }
 
 // SearchGroup searches logs in a single log group
 func (cwc *CloudWatchClient) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	began := time.Now()
+	pages := 0
+	var records []model.LogRecord
+	err := cwc.pages(ctx, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(group),
+		FilterPattern: aws.String(filterPattern),
+		StartTime:     aws.Int64(startMs),
+		EndTime:       aws.Int64(endMs),
+	}, func(page []model.LogRecord, _ string) error {
+		pages++
+		records = append(records, page...)
+		return nil
+	})
+	elapsed := time.Since(began)
+	cwc.metrics.GroupSearch(group, elapsed)
+	if err != nil {
+		cwc.logger().LogAttrs(ctx, slog.LevelInfo, "group search failed", slog.String("group", group), slog.Int("pages", pages), slog.Duration("elapsed", elapsed), slog.Any("error", err))
+		return nil, err
+	}
+	cwc.logger().LogAttrs(ctx, slog.LevelInfo, "group searched", slog.String("group", group), slog.Int("pages", pages), slog.Int("events", len(records)), slog.Duration("elapsed", elapsed))
+	return records, nil
+}
+
+// SearchStream searches logs in a single log stream of a group.
+func (cwc *CloudWatchClient) SearchStream(ctx context.Context, group, stream, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	return cwc.search(ctx, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:   aws.String(group),
+		LogStreamNames: []string{stream},
+		FilterPattern:  aws.String(filterPattern),
+		StartTime:      aws.Int64(startMs),
+		EndTime:        aws.Int64(endMs),
+	})
+}
+
+// SearchGroupPages pages through the events of a group like SearchGroup,
+// starting at token (empty for the first page). fn receives each page and the
+// token of the following page, which is empty after the last page.
+func (cwc *CloudWatchClient) SearchGroupPages(ctx context.Context, group, filterPattern string, startMs, endMs int64, token string, fn func(records []model.LogRecord, nextToken string) error) error {
+	in := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(group),
+		FilterPattern: aws.String(filterPattern),
+		StartTime:     aws.Int64(startMs),
+		EndTime:       aws.Int64(endMs),
+	}
+	if token != "" {
+		in.NextToken = aws.String(token)
+	}
+	return cwc.pages(ctx, in, fn)
+}
+
+// search pages through FilterLogEvents for the given input.
+func (cwc *CloudWatchClient) search(ctx context.Context, in *cloudwatchlogs.FilterLogEventsInput) ([]model.LogRecord, error) {
 	var records []model.LogRecord
-	var next *string
+	err := cwc.pages(ctx, in, func(page []model.LogRecord, _ string) error {
+		records = append(records, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// pages calls FilterLogEvents from in.NextToken until the last page.
+func (cwc *CloudWatchClient) pages(ctx context.Context, in *cloudwatchlogs.FilterLogEventsInput, fn func([]model.LogRecord, string) error) error {
+	group := aws.ToString(in.LogGroupName)
+	next := in.NextToken
 	for {
-		out, err := cwc.client.FilterLogEvents(ctx, &cloudwatchlogs.FilterLogEventsInput{
-			LogGroupName:  aws.String(group),
-			FilterPattern: aws.String(filterPattern),
-			StartTime:     aws.Int64(startMs),
-			EndTime:       aws.Int64(endMs),
-			NextToken:     next,
-		})
+		page := *in
+		page.NextToken = next
+		page.Unmask = cwc.unmask
+		out, err := cwc.client.FilterLogEvents(ctx, &page)
+		retries, throttles := attempts(out, err)
 		if err != nil {
-			return nil, err
+			cwc.metrics.Request(group, 0, retries, throttles, true)
+			cwc.logger().LogAttrs(ctx, slog.LevelDebug, "page failed", slog.String("group", group), slog.Int("retries", retries), slog.Int("throttles", throttles), slog.Any("error", err))
+			return cwc.unmaskError(err)
 		}
+		cwc.metrics.Request(group, len(out.Events), retries, throttles, false)
+		cwc.logger().LogAttrs(ctx, slog.LevelDebug, "page fetched", slog.String("group", group), slog.Int("events", len(out.Events)),
+			slog.Bool("more", out.NextToken != nil), slog.Int("retries", retries), slog.Int("throttles", throttles))
+		records := make([]model.LogRecord, 0, len(out.Events))
+		var newest time.Time
 		for _, e := range out.Events {
 			ts := time.Unix(0, aws.ToInt64(e.Timestamp)*int64(time.Millisecond))
+			if ts.After(newest) {
+				newest = ts
+			}
 			records = append(records, model.LogRecord{
 				Timestamp: ts,
 				LogGroup:  group,
 				LogStream: aws.ToString(e.LogStreamName),
 				Message:   aws.ToString(e.Message),
+				EventID:   aws.ToString(e.EventId),
 			})
 		}
+		if cwc.progress != nil {
+			cwc.progress(PageProgress{Group: group, Events: len(records), Newest: newest})
+		}
 		if out.NextToken == nil || (next != nil && aws.ToString(out.NextToken) == aws.ToString(next)) {
-			break
+			return fn(records, "")
 		}
 		next = out.NextToken
+		if err := fn(records, aws.ToString(next)); err != nil {
+			return err
+		}
 	}
-	return records, nil
+}
+
+// discard is the logger of clients without WithLogger.
+var discard = slog.New(slog.DiscardHandler)
+
+func (cwc *CloudWatchClient) logger() *slog.Logger {
+	if cwc.log == nil {
+		return discard
+	}
+	return cwc.log
+}
+
+// sdkLogger passes the AWS SDK's log output to a slog.Logger.
+type sdkLogger struct{ log *slog.Logger }
+
+func (l sdkLogger) Logf(c logging.Classification, format string, v ...any) {
+	level := slog.LevelDebug
+	if c == logging.Warn {
+		level = slog.LevelWarn
+	}
+	l.log.Log(context.Background(), level, fmt.Sprintf(format, v...), "source", "aws-sdk")
+}
+
+// throttle classifies the errors the SDK treats as throttling.
+var throttle = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+// retryable classifies the errors the SDK retries, throttling aside.
+var retryable = retry.IsErrorRetryables(retry.DefaultRetryables)
+
+// Retryable reports whether err is one the SDK would retry, such as
+// throttling or a connection reset, so that a later request may succeed.
+// Cancellation is not retryable.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return throttle.IsErrorThrottle(err) == aws.TrueTernary || retryable.IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// attempts returns how often the SDK retried a FilterLogEvents request and
+// how many of its attempts were throttled. Successful requests carry their
+// attempt results in the response metadata; failed ones only report the
+// number of attempts and the last error, so at most one throttle is counted.
+func attempts(out *cloudwatchlogs.FilterLogEventsOutput, err error) (retries, throttles int) {
+	if err != nil {
+		var max *retry.MaxAttemptsError
+		if errors.As(err, &max) {
+			retries = max.Attempt - 1
+		}
+		if throttle.IsErrorThrottle(err) == aws.TrueTernary {
+			throttles = 1
+		}
+		return retries, throttles
+	}
+	if out == nil {
+		return 0, 0
+	}
+	results, ok := retry.GetAttemptResults(out.ResultMetadata)
+	if !ok {
+		return 0, 0
+	}
+	for _, r := range results.Results {
+		if r.Retried {
+			retries++
+		}
+		if r.Err != nil && throttle.IsErrorThrottle(r.Err) == aws.TrueTernary {
+			throttles++
+		}
+	}
+	return retries, throttles
+}
+
+// ErrUnmaskDenied is wrapped by the errors of unmasked requests that were
+// refused, typically for lack of the logs:Unmask permission.
+var ErrUnmaskDenied = errors.New("reading unmasked events requires the logs:Unmask permission")
+
+// unmaskError marks access errors of unmasked requests with ErrUnmaskDenied,
+// since the logs:FilterLogEvents or logs:StartQuery permission alone then
+// gives a generic AccessDeniedException.
+func (cwc *CloudWatchClient) unmaskError(err error) error {
+	var ae smithy.APIError
+	if cwc.unmask && errors.As(err, &ae) && ae.ErrorCode() == "AccessDeniedException" {
+		return fmt.Errorf("%w: %w", ErrUnmaskDenied, err)
+	}
+	return err
 }
 
 // NewCloudWatchOptions creates a slice of CloudWatchOption from AuthOptions and environment variables.
@@ -3,18 +3,23 @@ package client_test
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"unsafe"
 
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
 )
 
 // mockLogsAPI implements client.LogsAPI for testing.
@@ -42,7 +47,12 @@ func (m *mockLogsAPI) FilterLogEvents(ctx context.Context, params *cloudwatchlog
 
 // setPrivateClient sets the unexported client field on CloudWatchClient via unsafe.
 func setPrivateClient(cwc *client.CloudWatchClient, api client.LogsAPI) {
-	v := reflect.ValueOf(cwc).Elem().FieldByName("client")
+	setPrivateField(cwc, "client", api)
+}
+
+// setPrivateField sets an unexported API field on CloudWatchClient via unsafe.
+func setPrivateField(cwc *client.CloudWatchClient, name string, api any) {
+	v := reflect.ValueOf(cwc).Elem().FieldByName(name)
 	// Create a writable reflect.Value for the unexported field
 	rv := reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
 	rv.Set(reflect.ValueOf(api))
@@ -175,6 +185,30 @@ func TestSearchGroup(t *testing.T) {
 	}
 }
 
+func TestSearchStream(t *testing.T) {
+	ts := int64(1700000000123)
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{{Timestamp: aws.Int64(ts), LogStreamName: aws.String("s1"), Message: aws.String("END RequestId: r1"), EventId: aws.String("e1")}}},
+	}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateClient(cwc, mock)
+
+	got, err := cwc.SearchStream(context.Background(), "/aws/lambda/fn", "s1", `"r1"`, 10, 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].LogGroup != "/aws/lambda/fn" || got[0].LogStream != "s1" || got[0].EventID != "e1" {
+		t.Fatalf("records = %+v", got)
+	}
+	in := mock.inputs[0]
+	if !reflect.DeepEqual(in.LogStreamNames, []string{"s1"}) || aws.ToString(in.FilterPattern) != `"r1"` {
+		t.Fatalf("input streams=%v pattern=%q", in.LogStreamNames, aws.ToString(in.FilterPattern))
+	}
+	if aws.ToInt64(in.StartTime) != 10 || aws.ToInt64(in.EndTime) != 20 {
+		t.Fatalf("Start/End = (%d,%d), want (10,20)", aws.ToInt64(in.StartTime), aws.ToInt64(in.EndTime))
+	}
+}
+
 // helper to temporarily set env var
 func withEnv(key, val string, fn func()) {
 	old, had := os.LookupEnv(key)
@@ -189,6 +223,144 @@ func withEnv(key, val string, fn func()) {
 	fn()
 }
 
+func TestSearchGroupPages(t *testing.T) {
+	ev := func(id string) types.FilteredLogEvent {
+		return types.FilteredLogEvent{Timestamp: aws.Int64(1700000000000), Message: aws.String(id), EventId: aws.String(id)}
+	}
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{ev("e1")}, NextToken: aws.String("t2")},
+		{Events: []types.FilteredLogEvent{ev("e2")}},
+	}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateClient(cwc, mock)
+
+	var ids, tokens []string
+	err := cwc.SearchGroupPages(context.Background(), "/g", "ERROR", 10, 20, "t1", func(records []model.LogRecord, next string) error {
+		for _, r := range records {
+			ids = append(ids, r.EventID)
+		}
+		tokens = append(tokens, next)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"e1", "e2"}) || !reflect.DeepEqual(tokens, []string{"t2", ""}) {
+		t.Fatalf("ids=%v tokens=%q", ids, tokens)
+	}
+	if aws.ToString(mock.inputs[0].NextToken) != "t1" || aws.ToString(mock.inputs[1].NextToken) != "t2" {
+		t.Fatalf("request tokens = %q, %q", aws.ToString(mock.inputs[0].NextToken), aws.ToString(mock.inputs[1].NextToken))
+	}
+
+	stop := errors.New("stop")
+	mock = &mockLogsAPI{responses: mock.responses}
+	setPrivateClient(cwc, mock)
+	err = cwc.SearchGroupPages(context.Background(), "/g", "ERROR", 10, 20, "", func([]model.LogRecord, string) error { return stop })
+	if !errors.Is(err, stop) || len(mock.inputs) != 1 {
+		t.Fatalf("err=%v calls=%d, want callback error after one call", err, len(mock.inputs))
+	}
+}
+
+func TestUnmask(t *testing.T) {
+	mock := &mockLogsAPI{}
+	cwc := &client.CloudWatchClient{}
+	setPrivateClient(cwc, mock)
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); err != nil || mock.inputs[0].Unmask {
+		t.Fatalf("err=%v unmask=%v, want a masked request by default", err, mock.inputs[0].Unmask)
+	}
+
+	setPrivateField(cwc, "unmask", true)
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); err != nil || !mock.inputs[1].Unmask {
+		t.Fatalf("err=%v unmask=%v, want an unmasked request", err, mock.inputs[1].Unmask)
+	}
+
+	mock.err = &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform: logs:Unmask"}
+	_, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1)
+	if !errors.Is(err, client.ErrUnmaskDenied) || !strings.Contains(err.Error(), "logs:Unmask") {
+		t.Fatalf("err = %v, want ErrUnmaskDenied", err)
+	}
+	mock.err = &smithy.GenericAPIError{Code: "ThrottlingException"}
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); errors.Is(err, client.ErrUnmaskDenied) {
+		t.Fatalf("throttling reported as %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{{Message: aws.String("a")}, {Message: aws.String("b")}}, NextToken: aws.String("t1")},
+		{Events: []types.FilteredLogEvent{{Message: aws.String("c")}}},
+	}}
+	m := metrics.NewSearch(metrics.NewRegistry())
+	cwc := client.NewCloudWatchClientFromAPI(mock, client.WithMetrics(m))
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	mock.err = &retry.MaxAttemptsError{Attempt: 3, Err: &smithy.GenericAPIError{Code: "ThrottlingException"}}
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); err == nil {
+		t.Fatal("want the throttling error")
+	}
+
+	got := m.Summary().Groups
+	want := metrics.GroupSummary{Group: "/g", Searches: 2, Pages: 2, Events: 3, Retries: 2, Throttles: 1, Errors: 1}
+	if len(got) != 1 || got[0].Seconds < 0 {
+		t.Fatalf("groups = %+v", got)
+	}
+	got[0].Seconds = 0
+	if got[0] != want {
+		t.Fatalf("group = %+v, want %+v", got[0], want)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttling", &retry.MaxAttemptsError{Attempt: 3, Err: &smithy.GenericAPIError{Code: "ThrottlingException"}}, true},
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDeniedException"}, false},
+		{"canceled", context.Canceled, false},
+		{"nil", nil, false},
+	} {
+		if got := client.Retryable(tc.err); got != tc.want {
+			t.Errorf("%s: Retryable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{{Message: aws.String("a")}}, NextToken: aws.String("t1")},
+		{Events: []types.FilteredLogEvent{{Message: aws.String("b")}, {Message: aws.String("c")}}},
+	}}
+	var buf strings.Builder
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cwc := client.NewCloudWatchClientFromAPI(mock, client.WithLogger(log))
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Count(out, `msg="page fetched" group=/g`) != 2 || !strings.Contains(out, `msg="group searched" group=/g pages=2 events=3 elapsed=`) {
+		t.Fatalf("log:\n%s", out)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{{Timestamp: aws.Int64(3000)}, {Timestamp: aws.Int64(2000)}}, NextToken: aws.String("t1")},
+		{},
+	}}
+	var got []client.PageProgress
+	cwc := client.NewCloudWatchClientFromAPI(mock, client.WithProgress(func(p client.PageProgress) { got = append(got, p) }))
+	if _, err := cwc.SearchGroup(context.Background(), "/g", "x", 0, 5000); err != nil {
+		t.Fatal(err)
+	}
+	want := []client.PageProgress{{Group: "/g", Events: 2, Newest: time.UnixMilli(3000)}, {Group: "/g"}}
+	if len(got) != 2 || got[0].Group != want[0].Group || got[0].Events != 2 || !got[0].Newest.Equal(want[0].Newest) || got[1] != want[1] {
+		t.Fatalf("progress = %+v, want %+v", got, want)
+	}
+}
+
 func TestNewCloudWatchOptions(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// DescribeAPI is the subset of CloudWatch Logs API used to list groups and streams.
+type DescribeAPI interface {
+	DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error)
+	DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error)
+}
+
+// ListGroups returns all log groups whose name starts with prefix (all groups if empty).
+func (cwc *CloudWatchClient) ListGroups(ctx context.Context, prefix string) ([]model.LogGroup, error) {
+	var groups []model.LogGroup
+	var next *string
+	for {
+		in := &cloudwatchlogs.DescribeLogGroupsInput{NextToken: next}
+		if prefix != "" {
+			in.LogGroupNamePrefix = aws.String(prefix)
+		}
+		out, err := cwc.describe.DescribeLogGroups(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range out.LogGroups {
+			groups = append(groups, model.LogGroup{
+				Name:          aws.ToString(g.LogGroupName),
+				CreationTime:  msToTime(g.CreationTime),
+				RetentionDays: aws.ToInt32(g.RetentionInDays),
+				StoredBytes:   aws.ToInt64(g.StoredBytes),
+			})
+		}
+		if out.NextToken == nil || (next != nil && aws.ToString(out.NextToken) == aws.ToString(next)) {
+			break
+		}
+		next = out.NextToken
+	}
+	return groups, nil
+}
+
+// ListStreams returns up to limit streams of a group. Without a prefix the most
+// recently written streams come first; with a prefix streams are ordered by name.
+// A limit <= 0 returns every stream.
+func (cwc *CloudWatchClient) ListStreams(ctx context.Context, group, prefix string, limit int) ([]model.LogStream, error) {
+	var streams []model.LogStream
+	var next *string
+	for {
+		in := &cloudwatchlogs.DescribeLogStreamsInput{LogGroupName: aws.String(group), NextToken: next}
+		if prefix != "" {
+			in.LogStreamNamePrefix = aws.String(prefix)
+			in.OrderBy = types.OrderByLogStreamName
+		} else {
+			in.OrderBy = types.OrderByLastEventTime
+			in.Descending = aws.Bool(true)
+		}
+		out, err := cwc.describe.DescribeLogStreams(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range out.LogStreams {
+			streams = append(streams, model.LogStream{
+				LogGroup:       group,
+				Name:           aws.ToString(s.LogStreamName),
+				FirstEventTime: msToTime(s.FirstEventTimestamp),
+				LastEventTime:  msToTime(s.LastEventTimestamp),
+			})
+			if limit > 0 && len(streams) >= limit {
+				return streams, nil
+			}
+		}
+		if out.NextToken == nil || (next != nil && aws.ToString(out.NextToken) == aws.ToString(next)) {
+			break
+		}
+		next = out.NextToken
+	}
+	return streams, nil
+}
+
+// msToTime converts an optional epoch-milliseconds value; nil yields the zero time.
+func msToTime(ms *int64) time.Time {
+	if ms == nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(*ms)
+}
@@ -0,0 +1,89 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// mockDescribeAPI implements client.DescribeAPI for testing.
+type mockDescribeAPI struct {
+	groupPages  []*cloudwatchlogs.DescribeLogGroupsOutput
+	streamPages []*cloudwatchlogs.DescribeLogStreamsOutput
+	groupIn     []*cloudwatchlogs.DescribeLogGroupsInput
+	streamIn    []*cloudwatchlogs.DescribeLogStreamsInput
+}
+
+func (m *mockDescribeAPI) DescribeLogGroups(ctx context.Context, params *cloudwatchlogs.DescribeLogGroupsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogGroupsOutput, error) {
+	m.groupIn = append(m.groupIn, params)
+	if len(m.groupIn) <= len(m.groupPages) {
+		return m.groupPages[len(m.groupIn)-1], nil
+	}
+	return &cloudwatchlogs.DescribeLogGroupsOutput{}, nil
+}
+
+func (m *mockDescribeAPI) DescribeLogStreams(ctx context.Context, params *cloudwatchlogs.DescribeLogStreamsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.DescribeLogStreamsOutput, error) {
+	m.streamIn = append(m.streamIn, params)
+	if len(m.streamIn) <= len(m.streamPages) {
+		return m.streamPages[len(m.streamIn)-1], nil
+	}
+	return &cloudwatchlogs.DescribeLogStreamsOutput{}, nil
+}
+
+func TestListGroups(t *testing.T) {
+	m := &mockDescribeAPI{groupPages: []*cloudwatchlogs.DescribeLogGroupsOutput{
+		{LogGroups: []types.LogGroup{{LogGroupName: aws.String("/aws/lambda/a"), RetentionInDays: aws.Int32(7)}}, NextToken: aws.String("t")},
+		{LogGroups: []types.LogGroup{{LogGroupName: aws.String("/aws/lambda/b"), StoredBytes: aws.Int64(42)}}},
+	}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "describe", client.DescribeAPI(m))
+
+	got, err := cwc.ListGroups(context.Background(), "/aws/lambda/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "/aws/lambda/a" || got[0].RetentionDays != 7 || got[1].StoredBytes != 42 {
+		t.Fatalf("groups = %+v", got)
+	}
+	if aws.ToString(m.groupIn[0].LogGroupNamePrefix) != "/aws/lambda/" || aws.ToString(m.groupIn[1].NextToken) != "t" {
+		t.Fatalf("inputs = %+v", m.groupIn)
+	}
+}
+
+func TestListStreams(t *testing.T) {
+	page := &cloudwatchlogs.DescribeLogStreamsOutput{
+		LogStreams: []types.LogStream{
+			{LogStreamName: aws.String("s1"), LastEventTimestamp: aws.Int64(2000)},
+			{LogStreamName: aws.String("s2"), LastEventTimestamp: aws.Int64(1000)},
+		},
+		NextToken: aws.String("more"),
+	}
+
+	m := &mockDescribeAPI{streamPages: []*cloudwatchlogs.DescribeLogStreamsOutput{page}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "describe", client.DescribeAPI(m))
+	got, err := cwc.ListStreams(context.Background(), "g", "", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "s1" || got[0].LogGroup != "g" || got[0].LastEventTime.UnixMilli() != 2000 {
+		t.Fatalf("streams = %+v", got)
+	}
+	if in := m.streamIn[0]; in.OrderBy != types.OrderByLastEventTime || !aws.ToBool(in.Descending) || len(m.streamIn) != 1 {
+		t.Fatalf("input = %+v (calls=%d)", in, len(m.streamIn))
+	}
+
+	m = &mockDescribeAPI{streamPages: []*cloudwatchlogs.DescribeLogStreamsOutput{page}}
+	setPrivateField(cwc, "describe", client.DescribeAPI(m))
+	if _, err := cwc.ListStreams(context.Background(), "g", "s", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if in := m.streamIn[0]; in.OrderBy != types.OrderByLogStreamName || aws.ToString(in.LogStreamNamePrefix) != "s" || len(m.streamIn) != 2 {
+		t.Fatalf("prefix input = %+v (calls=%d)", in, len(m.streamIn))
+	}
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// IdentityAPI is the subset of the STS API used to resolve the caller's account.
+type IdentityAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// Identity returns the AWS account ID of the credentials and the resolved region.
+func (cwc *CloudWatchClient) Identity(ctx context.Context) (account, region string, err error) {
+	out, err := cwc.identity.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve AWS account: %w", err)
+	}
+	return aws.ToString(out.Account), cwc.region, nil
+}
@@ -0,0 +1,41 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// mockIdentityAPI implements client.IdentityAPI for testing.
+type mockIdentityAPI struct {
+	account string
+	err     error
+}
+
+func (m *mockIdentityAPI) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String(m.account)}, nil
+}
+
+func TestIdentity(t *testing.T) {
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "identity", client.IdentityAPI(&mockIdentityAPI{account: "123456789012"}))
+	setPrivateField(cwc, "region", "ap-northeast-1")
+
+	account, region, err := cwc.Identity(context.Background())
+	if err != nil || account != "123456789012" || region != "ap-northeast-1" {
+		t.Fatalf("Identity() = (%q, %q, %v)", account, region, err)
+	}
+
+	setPrivateField(cwc, "identity", client.IdentityAPI(&mockIdentityAPI{err: errors.New("expired token")}))
+	if _, _, err := cwc.Identity(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+}
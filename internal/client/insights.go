@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// InsightsAPI is the subset of CloudWatch Logs API used to run Logs Insights queries.
+type InsightsAPI interface {
+	StartQuery(ctx context.Context, params *cloudwatchlogs.StartQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StartQueryOutput, error)
+	GetQueryResults(ctx context.Context, params *cloudwatchlogs.GetQueryResultsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetQueryResultsOutput, error)
+	StopQuery(ctx context.Context, params *cloudwatchlogs.StopQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StopQueryOutput, error)
+}
+
+// InsightsPollInterval is how often RunInsightsQuery checks for query completion.
+var InsightsPollInterval = time.Second
+
+// RunInsightsQuery runs a Logs Insights query over the groups and waits for it
+// to finish. Each result row maps field names to values; the internal @ptr
+// field is omitted. A limit <= 0 uses the service default. If ctx is canceled
+// the query is stopped. With WithUnmask the query is rewritten by UnmaskQuery.
+func (cwc *CloudWatchClient) RunInsightsQuery(ctx context.Context, groups []string, query string, startMs, endMs int64, limit int) ([]map[string]string, error) {
+	if cwc.unmask {
+		query = UnmaskQuery(query)
+	}
+	in := &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: groups,
+		QueryString:   aws.String(query),
+		StartTime:     aws.Int64(startMs / 1000),
+		EndTime:       aws.Int64(endMs / 1000),
+	}
+	if limit > 0 {
+		in.Limit = aws.Int32(int32(limit))
+	}
+	started, err := cwc.insights.StartQuery(ctx, in)
+	if err != nil {
+		return nil, cwc.unmaskError(err)
+	}
+	id := started.QueryId
+	for {
+		out, err := cwc.insights.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: id})
+		if err != nil {
+			return nil, cwc.unmaskError(err)
+		}
+		switch out.Status {
+		case types.QueryStatusComplete:
+			return insightsRows(out.Results), nil
+		case types.QueryStatusFailed, types.QueryStatusCancelled, types.QueryStatusTimeout:
+			return nil, fmt.Errorf("insights query %s: %s", aws.ToString(id), out.Status)
+		}
+		select {
+		case <-ctx.Done():
+			// Use a fresh context: the caller's one is already done.
+			_, _ = cwc.insights.StopQuery(context.Background(), &cloudwatchlogs.StopQueryInput{QueryId: id})
+			return nil, ctx.Err()
+		case <-time.After(InsightsPollInterval):
+		}
+	}
+}
+
+func insightsRows(results [][]types.ResultField) []map[string]string {
+	rows := make([]map[string]string, 0, len(results))
+	for _, fields := range results {
+		row := make(map[string]string, len(fields))
+		for _, f := range fields {
+			name := aws.ToString(f.Field)
+			if name == "@ptr" {
+				continue
+			}
+			if name == unmaskedMessage {
+				name = "@message"
+			}
+			row[name] = aws.ToString(f.Value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// unmaskedMessage is the unmasked message expression of Insights queries.
+const unmaskedMessage = "unmask(@message)"
+
+// unmaskCommands are the Insights commands whose expressions may call
+// functions; @message is left alone in the others, such as parse and display.
+var unmaskCommands = map[string]bool{"fields": true, "filter": true, "stats": true}
+
+// UnmaskQuery returns query with @message replaced by unmask(@message), the
+// Insights function reading a message without data protection masking, in
+// the fields, filter and stats commands. String and regular expression
+// literals are kept as they are. Insights has no request option for this,
+// unlike FilterLogEvents. Result columns named unmask(@message) are returned
+// as @message.
+func UnmaskQuery(query string) string {
+	var b strings.Builder
+	var (
+		command string // the current command; empty until its name is read
+		prev    byte   // the last byte outside literals and spaces
+		word    string // the last word, when it is the last thing read
+	)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '|':
+			command, prev, word = "", 0, ""
+			b.WriteByte(c)
+			i++
+		case c == '\'' || c == '"' || c == '`' || c == '/' && regexpStart(command, prev, word):
+			j := literalEnd(query, i)
+			b.WriteString(query[i:j])
+			prev, word, i = c, "", j
+		case isFieldByte(c):
+			j := i + 1
+			for j < len(query) && isFieldByte(query[j]) {
+				j++
+			}
+			w := query[i:j]
+			if command == "" {
+				command = strings.ToLower(w)
+			} else if w == "@message" && unmaskCommands[command] && !strings.HasSuffix(strings.ToLower(strings.TrimRight(b.String(), " ")), "unmask(") {
+				w = unmaskedMessage
+			}
+			b.WriteString(w)
+			prev, word, i = query[j-1], strings.ToLower(w), j
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				prev, word = c, ""
+			}
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// regexpStart reports whether a / starts a regular expression rather than
+// dividing: always in parse, and otherwise after like or anything but an
+// operand.
+func regexpStart(command string, prev byte, word string) bool {
+	if command == "parse" || word == "like" {
+		return true
+	}
+	return !isFieldByte(prev) && prev != ')' && prev != ']'
+}
+
+// literalEnd returns the end of the quoted or /regexp/ literal at i.
+func literalEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case s[i]:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+func isFieldByte(c byte) bool {
+	return c == '@' || c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,139 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
+)
+
+// mockInsightsAPI implements client.InsightsAPI for testing.
+type mockInsightsAPI struct {
+	started  *cloudwatchlogs.StartQueryInput
+	statuses []types.QueryStatus
+	polls    int
+	stopped  bool
+}
+
+func (m *mockInsightsAPI) StartQuery(ctx context.Context, params *cloudwatchlogs.StartQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StartQueryOutput, error) {
+	m.started = params
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String("q1")}, nil
+}
+
+func (m *mockInsightsAPI) GetQueryResults(ctx context.Context, params *cloudwatchlogs.GetQueryResultsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	st := m.statuses[m.polls]
+	m.polls++
+	out := &cloudwatchlogs.GetQueryResultsOutput{Status: st}
+	if st == types.QueryStatusComplete {
+		out.Results = [][]types.ResultField{{
+			{Field: aws.String("@timestamp"), Value: aws.String("2025-01-01 00:00:00.000")},
+			{Field: aws.String("@message"), Value: aws.String("boom")},
+			{Field: aws.String("@ptr"), Value: aws.String("xyz")},
+		}}
+	}
+	return out, nil
+}
+
+func (m *mockInsightsAPI) StopQuery(ctx context.Context, params *cloudwatchlogs.StopQueryInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.StopQueryOutput, error) {
+	m.stopped = true
+	return &cloudwatchlogs.StopQueryOutput{}, nil
+}
+
+func TestRunInsightsQuery(t *testing.T) {
+	old := client.InsightsPollInterval
+	client.InsightsPollInterval = time.Millisecond
+	defer func() { client.InsightsPollInterval = old }()
+
+	m := &mockInsightsAPI{statuses: []types.QueryStatus{types.QueryStatusScheduled, types.QueryStatusRunning, types.QueryStatusComplete}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "insights", client.InsightsAPI(m))
+
+	rows, err := cwc.RunInsightsQuery(context.Background(), []string{"g1", "g2"}, "fields @message", 10_000, 20_999, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["@message"] != "boom" || len(rows[0]) != 2 {
+		t.Fatalf("rows = %v", rows)
+	}
+	if m.polls != 3 {
+		t.Fatalf("polls = %d, want 3", m.polls)
+	}
+	in := m.started
+	if aws.ToInt64(in.StartTime) != 10 || aws.ToInt64(in.EndTime) != 20 || aws.ToInt32(in.Limit) != 5 || len(in.LogGroupNames) != 2 {
+		t.Fatalf("StartQuery input = %+v", in)
+	}
+
+	m = &mockInsightsAPI{statuses: []types.QueryStatus{types.QueryStatusFailed}}
+	setPrivateField(cwc, "insights", client.InsightsAPI(m))
+	if _, err := cwc.RunInsightsQuery(context.Background(), []string{"g"}, "q", 0, 1000, 0); err == nil {
+		t.Fatal("expected error for failed query")
+	}
+}
+
+func TestRunInsightsQueryUnmaskDenied(t *testing.T) {
+	m := &deniedResultsAPI{mockInsightsAPI{statuses: []types.QueryStatus{types.QueryStatusRunning}}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "insights", client.InsightsAPI(m))
+	setPrivateField(cwc, "unmask", true)
+	if _, err := cwc.RunInsightsQuery(context.Background(), []string{"g"}, "fields @message", 0, 1000, 0); !errors.Is(err, client.ErrUnmaskDenied) {
+		t.Fatalf("err = %v, want ErrUnmaskDenied", err)
+	}
+}
+
+// deniedResultsAPI refuses GetQueryResults for lack of logs:Unmask.
+type deniedResultsAPI struct {
+	mockInsightsAPI
+}
+
+func (m *deniedResultsAPI) GetQueryResults(ctx context.Context, params *cloudwatchlogs.GetQueryResultsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized to perform: logs:Unmask"}
+}
+
+func TestRunInsightsQueryCanceled(t *testing.T) {
+	m := &mockInsightsAPI{statuses: []types.QueryStatus{types.QueryStatusRunning}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "insights", client.InsightsAPI(m))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cwc.RunInsightsQuery(ctx, []string{"g"}, "q", 0, 1000, 0); err == nil || !m.stopped {
+		t.Fatalf("err = %v stopped = %v; want cancellation and StopQuery", err, m.stopped)
+	}
+}
+
+func TestUnmaskQuery(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"fields @timestamp, @message | filter @message like /ERROR/", "fields @timestamp, unmask(@message) | filter unmask(@message) like /ERROR/"},
+		{"fields unmask(@message) | stats count(*) by @logStream", "fields unmask(@message) | stats count(*) by @logStream"},
+		{"stats count(@message) by @messageType", "stats count(unmask(@message)) by @messageType"},
+		// parse and display take fields, not expressions
+		{`parse @message "user=*," as user | display @timestamp, @message, user`, `parse @message "user=*," as user | display @timestamp, @message, user`},
+		{"parse @message /(?<level>INFO|ERROR) @message/ | filter level = 'ERROR'", "parse @message /(?<level>INFO|ERROR) @message/ | filter level = 'ERROR'"},
+		// Literals are kept, including a | inside one
+		{`filter @message like "@message | x" or @message like /@message|y/`, `filter unmask(@message) like "@message | x" or unmask(@message) like /@message|y/`},
+		{`filter @message = 'it\'s @message' | fields @message`, `filter unmask(@message) = 'it\'s @message' | fields unmask(@message)`},
+		{"fields strlen(@message) / 2 as half, @message", "fields strlen(unmask(@message)) / 2 as half, unmask(@message)"},
+		{"FILTER @message LIKE /x/ | SORT @message desc", "FILTER unmask(@message) LIKE /x/ | SORT @message desc"},
+	} {
+		if got := client.UnmaskQuery(tc.in); got != tc.want {
+			t.Errorf("UnmaskQuery(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	m := &mockInsightsAPI{statuses: []types.QueryStatus{types.QueryStatusComplete}}
+	cwc := &client.CloudWatchClient{}
+	setPrivateField(cwc, "insights", client.InsightsAPI(m))
+	setPrivateField(cwc, "unmask", true)
+	if _, err := cwc.RunInsightsQuery(context.Background(), []string{"g"}, "fields @message", 0, 1000, 0); err != nil {
+		t.Fatal(err)
+	}
+	if q := aws.ToString(m.started.QueryString); q != "fields unmask(@message)" {
+		t.Fatalf("query = %q", q)
+	}
+}
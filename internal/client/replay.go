@@ -0,0 +1,190 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// replayVersion is the format version written in the recording header.
+const replayVersion = 1
+
+// A recording is JSON lines: a header, then one interaction per
+// FilterLogEvents call in the order the calls completed.
+type replayHeader struct {
+	Version int
+	// Now is the time the recorded run used for relative windows such as
+	// --since, so a replay resolves the same window.
+	Now time.Time
+}
+
+type replayRequest struct {
+	LogGroupName   string
+	LogStreamNames []string `json:",omitempty"`
+	FilterPattern  string
+	StartTime      int64
+	EndTime        int64
+	NextToken      string `json:",omitempty"`
+}
+
+type replayEvent struct {
+	Timestamp     int64
+	LogStreamName string
+	Message       string
+	EventID       string `json:",omitempty"`
+}
+
+type replayResponse struct {
+	Events    []replayEvent
+	NextToken string `json:",omitempty"`
+}
+
+type replayInteraction struct {
+	Request  replayRequest
+	Response *replayResponse `json:",omitempty"`
+	Error    string          `json:",omitempty"`
+}
+
+func toReplayRequest(in *cloudwatchlogs.FilterLogEventsInput) replayRequest {
+	return replayRequest{
+		LogGroupName:   aws.ToString(in.LogGroupName),
+		LogStreamNames: in.LogStreamNames,
+		FilterPattern:  aws.ToString(in.FilterPattern),
+		StartTime:      aws.ToInt64(in.StartTime),
+		EndTime:        aws.ToInt64(in.EndTime),
+		NextToken:      aws.ToString(in.NextToken),
+	}
+}
+
+// key identifies a request independently of call order, which varies with
+// concurrent group searches.
+func (r replayRequest) key() string {
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%s", r.LogGroupName, strings.Join(r.LogStreamNames, ","), r.FilterPattern, r.StartTime, r.EndTime, r.NextToken)
+}
+
+// Recorder is a LogsAPI that forwards calls and writes each request and its
+// response (or error) to a recording.
+type Recorder struct {
+	api LogsAPI
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder writes the recording header to w and returns a recorder
+// forwarding to api. now is the reference time of the recorded run.
+func NewRecorder(api LogsAPI, w io.Writer, now time.Time) (*Recorder, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(replayHeader{Version: replayVersion, Now: now}); err != nil {
+		return nil, fmt.Errorf("failed to write recording: %w", err)
+	}
+	return &Recorder{api: api, enc: enc}, nil
+}
+
+// FilterLogEvents calls the wrapped API and records the interaction.
+func (r *Recorder) FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	out, err := r.api.FilterLogEvents(ctx, params, optFns...)
+	it := replayInteraction{Request: toReplayRequest(params)}
+	if err != nil {
+		it.Error = err.Error()
+	} else {
+		resp := &replayResponse{NextToken: aws.ToString(out.NextToken)}
+		for _, e := range out.Events {
+			resp.Events = append(resp.Events, replayEvent{
+				Timestamp:     aws.ToInt64(e.Timestamp),
+				LogStreamName: aws.ToString(e.LogStreamName),
+				Message:       aws.ToString(e.Message),
+				EventID:       aws.ToString(e.EventId),
+			})
+		}
+		it.Response = resp
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if werr := r.enc.Encode(it); werr != nil && err == nil {
+		return nil, fmt.Errorf("failed to write recording: %w", werr)
+	}
+	return out, err
+}
+
+// Replayer is a LogsAPI serving the responses of a recording. Identical
+// requests are answered in recorded order; unrecorded requests fail.
+type Replayer struct {
+	now time.Time
+	mu  sync.Mutex
+	// queue holds the remaining interactions per request key.
+	queue map[string][]replayInteraction
+}
+
+// LoadReplay reads a recording written by Recorder.
+func LoadReplay(r io.Reader) (*Replayer, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h replayHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("invalid recording: %w", err)
+	}
+	if h.Version != replayVersion {
+		return nil, fmt.Errorf("unsupported recording version %d", h.Version)
+	}
+	rp := &Replayer{now: h.Now, queue: map[string][]replayInteraction{}}
+	for {
+		var it replayInteraction
+		err := dec.Decode(&it)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording: %w", err)
+		}
+		k := it.Request.key()
+		rp.queue[k] = append(rp.queue[k], it)
+	}
+	return rp, nil
+}
+
+// Now returns the reference time of the recorded run.
+func (rp *Replayer) Now() time.Time { return rp.now }
+
+// FilterLogEvents returns the next recorded response for an identical request.
+func (rp *Replayer) FilterLogEvents(ctx context.Context, params *cloudwatchlogs.FilterLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	req := toReplayRequest(params)
+	k := req.key()
+	rp.mu.Lock()
+	q := rp.queue[k]
+	if len(q) == 0 {
+		rp.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded response for FilterLogEvents %+v", req)
+	}
+	it := q[0]
+	rp.queue[k] = q[1:]
+	rp.mu.Unlock()
+
+	if it.Response == nil {
+		return nil, errors.New(it.Error)
+	}
+	out := &cloudwatchlogs.FilterLogEventsOutput{}
+	if it.Response.NextToken != "" {
+		out.NextToken = aws.String(it.Response.NextToken)
+	}
+	for _, e := range it.Response.Events {
+		out.Events = append(out.Events, types.FilteredLogEvent{
+			Timestamp:     aws.Int64(e.Timestamp),
+			LogStreamName: aws.String(e.LogStreamName),
+			Message:       aws.String(e.Message),
+			EventId:       aws.String(e.EventID),
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	now := time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+	mock := &mockLogsAPI{responses: []*cloudwatchlogs.FilterLogEventsOutput{
+		{Events: []types.FilteredLogEvent{{Timestamp: aws.Int64(1000), LogStreamName: aws.String("s1"), Message: aws.String("a"), EventId: aws.String("e1")}}, NextToken: aws.String("t")},
+		{Events: []types.FilteredLogEvent{{Timestamp: aws.Int64(2000), LogStreamName: aws.String("s2"), Message: aws.String("b"), EventId: aws.String("e2")}}},
+	}}
+	var buf bytes.Buffer
+	rec, err := client.NewRecorder(mock, &buf, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := client.NewCloudWatchClientFromAPI(rec).SearchGroup(context.Background(), "/g", "ERROR", 0, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, err := client.LoadReplay(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rp.Now().Equal(now) {
+		t.Fatalf("Now() = %v, want %v", rp.Now(), now)
+	}
+	got, err := client.NewCloudWatchClientFromAPI(rp).SearchGroup(context.Background(), "/g", "ERROR", 0, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) || len(got) != 2 {
+		t.Fatalf("replayed %+v, want %+v", got, want)
+	}
+	// Every recorded response has been consumed; other requests are not recorded.
+	if _, err := client.NewCloudWatchClientFromAPI(rp).SearchGroup(context.Background(), "/g", "ERROR", 0, 5000); err == nil {
+		t.Fatal("expected error for exhausted recording")
+	}
+}
+
+func TestReplayRecordedError(t *testing.T) {
+	var buf bytes.Buffer
+	rec, _ := client.NewRecorder(&mockLogsAPI{err: errors.New("AccessDeniedException: denied")}, &buf, time.Now())
+	if _, err := client.NewCloudWatchClientFromAPI(rec).SearchGroup(context.Background(), "/g", "x", 1, 2); err == nil {
+		t.Fatal("expected recorded call to fail")
+	}
+	rp, err := client.LoadReplay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.NewCloudWatchClientFromAPI(rp).SearchGroup(context.Background(), "/g", "x", 1, 2)
+	if err == nil || err.Error() != "AccessDeniedException: denied" {
+		t.Fatalf("replayed error = %v", err)
+	}
+	if _, err := client.LoadReplay(strings.NewReader(`{"Version":99}`)); err == nil {
+		t.Fatal("expected version error")
+	}
+}
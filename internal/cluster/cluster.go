@@ -0,0 +1,199 @@
+// Package cluster groups log messages into templates using a Drain-style
+// fixed-depth prefix tree, so that recurring error signatures can be counted
+// regardless of the IDs, numbers and timestamps embedded in them.
+package cluster
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// Defaults used by New when the corresponding option is zero.
+const (
+	DefaultThreshold   = 0.5
+	DefaultDepth       = 2
+	DefaultMaxChildren = 100
+)
+
+// Options tunes the clusterer.
+type Options struct {
+	// Threshold is the minimum fraction of equal tokens (0..1] for a message to
+	// join an existing template.
+	Threshold float64
+	// Depth is the number of leading tokens used to route messages in the tree.
+	Depth int
+	// MaxChildren bounds the fan-out of each tree node; further distinct tokens
+	// share a wildcard branch.
+	MaxChildren int
+}
+
+// Cluster is one message template and the records that matched it.
+type Cluster struct {
+	Template  string
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Groups lists the affected log groups in name order.
+	Groups []string
+	// Example is the earliest record that matched the template.
+	Example model.LogRecord
+
+	tokens []string
+	groups map[string]struct{}
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+// Clusterer assigns messages to templates incrementally.
+type Clusterer struct {
+	opts Options
+	// root is keyed by token count, as in Drain.
+	root     map[int]*node
+	clusters []*Cluster
+}
+
+// New returns an empty Clusterer.
+func New(opts Options) *Clusterer {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = DefaultDepth
+	}
+	if opts.MaxChildren <= 0 {
+		opts.MaxChildren = DefaultMaxChildren
+	}
+	return &Clusterer{opts: opts, root: map[int]*node{}}
+}
+
+// Build clusters records and returns the templates ordered by Clusters.
+func Build(records []model.LogRecord, opts Options) []*Cluster {
+	c := New(opts)
+	for _, r := range records {
+		c.Add(r)
+	}
+	return c.Clusters()
+}
+
+// Add assigns a record to the best matching template, creating or
+// generalising one as needed, and returns it.
+func (c *Clusterer) Add(r model.LogRecord) *Cluster {
+	tokens := Tokenize(r.Message)
+	leaf := c.leaf(tokens)
+
+	var best *Cluster
+	bestSim, bestParams := -1.0, -1
+	for _, cl := range leaf.clusters {
+		sim, params := similarity(cl.tokens, tokens)
+		if sim > bestSim || (sim == bestSim && params > bestParams) {
+			best, bestSim, bestParams = cl, sim, params
+		}
+	}
+	if best == nil || bestSim < c.opts.Threshold {
+		best = &Cluster{
+			tokens:    tokens,
+			groups:    map[string]struct{}{},
+			FirstSeen: r.Timestamp,
+			LastSeen:  r.Timestamp,
+			Example:   r,
+		}
+		leaf.clusters = append(leaf.clusters, best)
+		c.clusters = append(c.clusters, best)
+	} else {
+		for i, t := range tokens {
+			if best.tokens[i] != t {
+				best.tokens[i] = Wildcard
+			}
+		}
+	}
+
+	best.Count++
+	if r.Timestamp.Before(best.FirstSeen) {
+		best.FirstSeen = r.Timestamp
+		best.Example = r
+	}
+	if r.Timestamp.After(best.LastSeen) {
+		best.LastSeen = r.Timestamp
+	}
+	best.groups[r.LogGroup] = struct{}{}
+	return best
+}
+
+// leaf walks (and grows) the prefix tree for a token sequence.
+func (c *Clusterer) leaf(tokens []string) *node {
+	n, ok := c.root[len(tokens)]
+	if !ok {
+		n = &node{children: map[string]*node{}}
+		c.root[len(tokens)] = n
+	}
+	for i := 0; i < c.opts.Depth && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) || strings.HasPrefix(key, "<") {
+			key = Wildcard
+		}
+		child, ok := n.children[key]
+		if !ok {
+			if len(n.children) >= c.opts.MaxChildren {
+				key = Wildcard
+				child = n.children[key]
+			}
+			if child == nil {
+				child = &node{children: map[string]*node{}}
+				n.children[key] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// Clusters returns every template ordered by descending count, then by first
+// appearance.
+func (c *Clusterer) Clusters() []*Cluster {
+	out := make([]*Cluster, len(c.clusters))
+	copy(out, c.clusters)
+	for _, cl := range out {
+		cl.Template = strings.Join(cl.tokens, " ")
+		cl.Groups = cl.Groups[:0]
+		for g := range cl.groups {
+			cl.Groups = append(cl.Groups, g)
+		}
+		sort.Strings(cl.Groups)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].FirstSeen.Before(out[j].FirstSeen)
+	})
+	return out
+}
+
+// similarity returns the fraction of positions where template and tokens
+// agree (wildcards never agree) and the number of wildcard positions.
+func similarity(template, tokens []string) (float64, int) {
+	if len(template) == 0 {
+		return 1, 0
+	}
+	same, params := 0, 0
+	for i, t := range template {
+		if t == Wildcard {
+			params++
+			continue
+		}
+		if t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template)), params
+}
+
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
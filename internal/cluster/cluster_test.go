@@ -0,0 +1,75 @@
+package cluster_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cluster"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"3f2b8c1e-9a4d-4e5f-8a7b-1c2d3e4f5a6b", "<UUID>"},
+		{"2025-08-31T12:00:00.123Z", "<TS>"},
+		{"12:00:00", "<TS>"},
+		{"10.0.0.1:443", "<IP>"},
+		{"fe80::1", "<IP>"},
+		{"0x7ffd", "<HEX>"},
+		{"deadbeef42", "<HEX>"},
+		{"(1234)", "(<NUM>)"},
+		{"12.5ms,", "<NUM>,"},
+		{"user_id=42", "user_id=<NUM>"},
+		{"ERROR", "ERROR"},
+		{"failed:", "failed:"},
+	}
+	for _, tt := range tests {
+		if got := cluster.Mask(tt.in); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	records := []model.LogRecord{
+		{Timestamp: t0.Add(2 * time.Minute), LogGroup: "/b", Message: "ERROR payment 123 failed for user alice"},
+		{Timestamp: t0, LogGroup: "/a", Message: "ERROR payment 456 failed for user bob"},
+		{Timestamp: t0.Add(time.Minute), LogGroup: "/a", Message: "ERROR payment 789 failed for user carol"},
+		{Timestamp: t0.Add(time.Minute), LogGroup: "/a", Message: "connection reset by peer 10.0.0.1"},
+	}
+	got := cluster.Build(records, cluster.Options{})
+	if len(got) != 2 {
+		t.Fatalf("got %d clusters, want 2", len(got))
+	}
+	c := got[0]
+	if c.Template != "ERROR payment <NUM> failed for user <*>" {
+		t.Fatalf("template = %q", c.Template)
+	}
+	if c.Count != 3 || !c.FirstSeen.Equal(t0) || !c.LastSeen.Equal(t0.Add(2*time.Minute)) {
+		t.Fatalf("count=%d first=%v last=%v", c.Count, c.FirstSeen, c.LastSeen)
+	}
+	if strings.Join(c.Groups, ",") != "/a,/b" || !strings.Contains(c.Example.Message, "bob") {
+		t.Fatalf("groups=%v example=%q", c.Groups, c.Example.Message)
+	}
+	if got[1].Template != "connection reset by peer <IP>" || got[1].Count != 1 {
+		t.Fatalf("second cluster = %q (%d)", got[1].Template, got[1].Count)
+	}
+}
+
+func TestBuildThreshold(t *testing.T) {
+	records := []model.LogRecord{
+		{Timestamp: t0, Message: "cache miss for key alpha"},
+		{Timestamp: t0, Message: "cache miss on key beta"},
+	}
+	if got := cluster.Build(records, cluster.Options{Threshold: 0.5}); len(got) != 1 || got[0].Template != "cache miss <*> key <*>" {
+		t.Fatalf("loose threshold: %+v", got)
+	}
+	if got := cluster.Build(records, cluster.Options{Threshold: 0.9}); len(got) != 2 {
+		t.Fatalf("strict threshold: got %d clusters, want 2", len(got))
+	}
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for variable tokens by Mask.
+const (
+	MaskUUID      = "<UUID>"
+	MaskTimestamp = "<TS>"
+	MaskIP        = "<IP>"
+	MaskHex       = "<HEX>"
+	MaskNumber    = "<NUM>"
+	// Wildcard marks template positions whose tokens differ between records.
+	Wildcard = "<*>"
+)
+
+var (
+	uuidRe      = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	dateTimeRe  = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}([.,]\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?$`)
+	timeRe      = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}([.,]\d+)?(Z|[+-]\d{2}:?\d{2})?$`)
+	ipv4Re      = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+|/\d{1,2})?$`)
+	ipv6Re      = regexp.MustCompile(`^[0-9a-fA-F]{0,4}(:[0-9a-fA-F]{0,4}){2,7}$`)
+	hexPrefixRe = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	hexRe       = regexp.MustCompile(`^[0-9a-fA-F]{8,}$`)
+	numberRe    = regexp.MustCompile(`^[-+]?\d+([.,]\d+)*[a-zA-Z%]{0,3}$`)
+)
+
+// tokenPunct is stripped from both ends of a token before matching.
+const tokenPunct = `()[]{}<>,;:"'`
+
+// Tokenize splits a message into whitespace-separated tokens with variable
+// parts replaced by placeholders.
+func Tokenize(message string) []string {
+	fields := strings.Fields(message)
+	for i, f := range fields {
+		fields[i] = Mask(f)
+	}
+	return fields
+}
+
+// Mask replaces the variable part of a single token (UUIDs, timestamps, IPs,
+// hex strings and numbers) with a placeholder, keeping surrounding punctuation.
+// The value of a key=value token is masked on its own.
+func Mask(token string) string {
+	if i := strings.IndexByte(token, '='); i > 0 && i < len(token)-1 {
+		return token[:i+1] + Mask(token[i+1:])
+	}
+	core := strings.TrimLeft(token, tokenPunct)
+	lead := token[:len(token)-len(core)]
+	core = strings.TrimRight(core, tokenPunct)
+	trail := token[len(lead)+len(core):]
+	if core == "" {
+		return token
+	}
+	if m := maskCore(core); m != "" {
+		return lead + m + trail
+	}
+	return token
+}
+
+func maskCore(s string) string {
+	switch {
+	case uuidRe.MatchString(s):
+		return MaskUUID
+	case dateTimeRe.MatchString(s), timeRe.MatchString(s):
+		return MaskTimestamp
+	case ipv4Re.MatchString(s):
+		return MaskIP
+	case strings.Count(s, ":") >= 2 && ipv6Re.MatchString(s):
+		return MaskIP
+	case hexPrefixRe.MatchString(s):
+		return MaskHex
+	case numberRe.MatchString(s):
+		return MaskNumber
+	case hexRe.MatchString(s) && strings.ContainsAny(s, "0123456789"):
+		return MaskHex
+	}
+	return ""
+}
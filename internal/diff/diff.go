@@ -0,0 +1,166 @@
+// Package diff compares the message signatures of two search windows per log
+// group to surface new, disappeared, spiking and dropping errors.
+package diff
+
+import (
+	"sort"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cluster"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+)
+
+// ByTemplate keys messages by their cluster template; any other --by value is
+// handled by stats.KeyFunc.
+const ByTemplate = "template"
+
+// DefaultMinRatio is the count ratio at which a signature counts as changed.
+const DefaultMinRatio = 2.0
+
+// Change statuses, in report order.
+const (
+	StatusNew  = "new"
+	StatusUp   = "up"
+	StatusDown = "down"
+	StatusGone = "gone"
+	StatusSame = "same"
+)
+
+var statusOrder = map[string]int{StatusNew: 0, StatusUp: 1, StatusDown: 2, StatusGone: 3, StatusSame: 4}
+
+// Options configures Compare.
+type Options struct {
+	// By selects the signature: ByTemplate (default) or a stats --by value.
+	By string
+	// Format structures messages for JMESPath keys.
+	Format parser.Format
+	// Threshold is the cluster similarity threshold for ByTemplate.
+	Threshold float64
+	// MinRatio is the comparison/baseline ratio (or its inverse) at which a
+	// signature is reported as up or down. Values <= 1 use DefaultMinRatio.
+	MinRatio float64
+}
+
+// Change is how one signature in one group moved between the windows.
+type Change struct {
+	Status     string
+	Group      string
+	Signature  string
+	Baseline   int
+	Comparison int
+	// Ratio is Comparison/Baseline; zero when either side is zero.
+	Ratio float64 `json:",omitempty"`
+	// Example is the earliest comparison record, or the earliest baseline
+	// record for disappeared signatures.
+	Example model.LogRecord
+}
+
+type counts struct {
+	baseline, comparison int
+	baseEx, cmpEx        *model.LogRecord
+}
+
+type key struct {
+	group, signature string
+}
+
+// Compare keys both windows with the same signatures and reports every
+// (group, signature) pair ordered by status, then by the larger count.
+func Compare(baseline, comparison []model.LogRecord, o Options) ([]Change, error) {
+	all := make([]model.LogRecord, 0, len(baseline)+len(comparison))
+	all = append(append(all, baseline...), comparison...)
+	sigs, err := signatures(all, o)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[key]*counts{}
+	for i := range all {
+		r := &all[i]
+		k := key{r.LogGroup, sigs[i]}
+		c, ok := byKey[k]
+		if !ok {
+			c = &counts{}
+			byKey[k] = c
+		}
+		if i < len(baseline) {
+			c.baseline++
+			if c.baseEx == nil || r.Timestamp.Before(c.baseEx.Timestamp) {
+				c.baseEx = r
+			}
+		} else {
+			c.comparison++
+			if c.cmpEx == nil || r.Timestamp.Before(c.cmpEx.Timestamp) {
+				c.cmpEx = r
+			}
+		}
+	}
+
+	minRatio := o.MinRatio
+	if minRatio <= 1 {
+		minRatio = DefaultMinRatio
+	}
+	out := make([]Change, 0, len(byKey))
+	for k, c := range byKey {
+		ch := Change{Group: k.group, Signature: k.signature, Baseline: c.baseline, Comparison: c.comparison}
+		switch {
+		case c.baseline == 0:
+			ch.Status, ch.Example = StatusNew, *c.cmpEx
+		case c.comparison == 0:
+			ch.Status, ch.Example = StatusGone, *c.baseEx
+		default:
+			ch.Ratio = float64(c.comparison) / float64(c.baseline)
+			ch.Example = *c.cmpEx
+			switch {
+			case ch.Ratio >= minRatio:
+				ch.Status = StatusUp
+			case ch.Ratio <= 1/minRatio:
+				ch.Status = StatusDown
+			default:
+				ch.Status = StatusSame
+			}
+		}
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Status != b.Status {
+			return statusOrder[a.Status] < statusOrder[b.Status]
+		}
+		if ma, mb := max(a.Baseline, a.Comparison), max(b.Baseline, b.Comparison); ma != mb {
+			return ma > mb
+		}
+		if a.Group != b.Group {
+			return a.Group < b.Group
+		}
+		return a.Signature < b.Signature
+	})
+	return out, nil
+}
+
+// signatures returns the signature of each record. Templates are built over
+// both windows at once so the same message shape gets the same template.
+func signatures(records []model.LogRecord, o Options) ([]string, error) {
+	out := make([]string, len(records))
+	if o.By == "" || o.By == ByTemplate {
+		c := cluster.New(cluster.Options{Threshold: o.Threshold})
+		assigned := make([]*cluster.Cluster, len(records))
+		for i, r := range records {
+			assigned[i] = c.Add(r)
+		}
+		c.Clusters() // finalises templates
+		for i, cl := range assigned {
+			out[i] = cl.Template
+		}
+		return out, nil
+	}
+	keyOf, err := stats.KeyFunc(o.By, o.Format)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range records {
+		out[i] = keyOf(r)
+	}
+	return out, nil
+}
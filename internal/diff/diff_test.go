@@ -0,0 +1,74 @@
+package diff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/diff"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+func rec(group, msg string) model.LogRecord {
+	return model.LogRecord{Timestamp: t0, LogGroup: group, Message: msg}
+}
+
+func repeat(n int, r model.LogRecord) []model.LogRecord {
+	out := make([]model.LogRecord, n)
+	for i := range out {
+		out[i] = r
+	}
+	return out
+}
+
+func TestCompareTemplates(t *testing.T) {
+	var baseline, comparison []model.LogRecord
+	baseline = append(baseline, repeat(2, rec("/a", "timeout after 30s calling billing"))...)
+	baseline = append(baseline, repeat(4, rec("/a", "disk 91% full"))...)
+	baseline = append(baseline, rec("/b", "retrying request 17"))
+	comparison = append(comparison, repeat(6, rec("/a", "timeout after 45s calling billing"))...)
+	comparison = append(comparison, repeat(3, rec("/a", "disk 95% full"))...)
+	comparison = append(comparison, rec("/b", "panic: nil map"))
+
+	got, err := diff.Compare(baseline, comparison, diff.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		status, group, sig string
+		base, cmp          int
+	}{
+		{diff.StatusNew, "/b", "panic: nil map", 0, 1},
+		{diff.StatusUp, "/a", "timeout after <NUM> calling billing", 2, 6},
+		{diff.StatusGone, "/b", "retrying request <NUM>", 1, 0},
+		{diff.StatusSame, "/a", "disk <NUM> full", 4, 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d changes: %+v", len(got), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Status != w.status || g.Group != w.group || g.Signature != w.sig || g.Baseline != w.base || g.Comparison != w.cmp {
+			t.Fatalf("change %d = %+v, want %+v", i, g, w)
+		}
+	}
+	if got[1].Ratio != 3 || got[2].Example.Message != "retrying request 17" {
+		t.Fatalf("ratio=%v gone example=%q", got[1].Ratio, got[2].Example.Message)
+	}
+}
+
+func TestCompareByExpression(t *testing.T) {
+	baseline := repeat(4, rec("/a", `{"code":"E1"}`))
+	comparison := repeat(1, rec("/a", `{"code":"E1"}`))
+	got, err := diff.Compare(baseline, comparison, diff.Options{By: "code", MinRatio: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Status != diff.StatusDown || got[0].Signature != "E1" {
+		t.Fatalf("got %+v", got)
+	}
+	if _, err := diff.Compare(nil, nil, diff.Options{By: "a.["}); err == nil {
+		t.Fatal("expected error for invalid expression")
+	}
+}
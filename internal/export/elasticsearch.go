@@ -0,0 +1,207 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// DefaultIndex is the Elasticsearch index of exported records.
+const DefaultIndex = "aws-logs-{{date}}"
+
+// Elasticsearch writes records to an Elasticsearch or OpenSearch index with
+// the _bulk API. Each record is a document with ECS-style fields:
+// @timestamp, message, event.id, service.name, cloud.* and
+// aws.cloudwatch.log_group/log_stream, plus the fields of a structured
+// message under "fields". Documents of records with an event ID get an ID
+// derived from it, so exporting a record again does not duplicate it.
+type Elasticsearch struct {
+	cfg     Config
+	url     string
+	index   Template
+	batcher batcher
+}
+
+// NewElasticsearch returns an Elasticsearch sink. Without cfg.Endpoint it
+// sends to a local cluster (port 9200); /_bulk is appended to the
+// endpoint's path.
+func NewElasticsearch(cfg Config) (*Elasticsearch, error) {
+	cfg = cfg.withDefaults()
+	u, err := endpointURL(cfg.Endpoint, "http://localhost:9200", "/")
+	if err != nil {
+		return nil, fmt.Errorf("Elasticsearch: %w", err)
+	}
+	if !strings.HasSuffix(u.Path, "/_bulk") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/_bulk"
+	}
+	index := cfg.Index
+	if index == "" {
+		index = DefaultIndex
+	}
+	e := &Elasticsearch{cfg: cfg, url: u.String()}
+	if e.index, err = ParseTemplate(index); err != nil {
+		return nil, fmt.Errorf("Elasticsearch index: %w", err)
+	}
+	e.batcher = batcher{size: cfg.BatchSize, send: e.send}
+	return e, nil
+}
+
+// URL returns the _bulk URL, without credentials.
+func (e *Elasticsearch) URL() string {
+	return redactURL(e.url)
+}
+
+// Write queues records, sending every full batch.
+func (e *Elasticsearch) Write(ctx context.Context, records []model.LogRecord) error {
+	return e.batcher.write(ctx, records)
+}
+
+// Flush sends the records still queued.
+func (e *Elasticsearch) Flush(ctx context.Context) error {
+	return e.batcher.flush(ctx)
+}
+
+// indexName expands the index template for a record into a valid index
+// name: lower case, with the characters Elasticsearch forbids replaced by
+// '-'.
+func (e *Elasticsearch) indexName(r model.LogRecord) string {
+	name := strings.Map(func(c rune) rune {
+		if strings.ContainsRune(`\/*?"<>| ,#:`, c) {
+			return '-'
+		}
+		return c
+	}, strings.ToLower(e.index.Expand(r, e.cfg.Resource)))
+	return strings.TrimLeft(name, "-_+")
+}
+
+type bulkAction struct {
+	Create struct {
+		Index string `json:"_index"`
+		ID    string `json:"_id,omitempty"`
+	} `json:"create"`
+}
+
+// document is the indexed form of a record.
+func (e *Elasticsearch) document(r model.LogRecord) map[string]any {
+	cloud := map[string]any{"provider": "aws"}
+	if e.cfg.Resource.Account != "" {
+		cloud["account"] = map[string]any{"id": e.cfg.Resource.Account}
+	}
+	if e.cfg.Resource.Region != "" {
+		cloud["region"] = e.cfg.Resource.Region
+	}
+	doc := map[string]any{
+		"@timestamp": r.Timestamp.UTC().Format(time.RFC3339Nano),
+		"message":    message(r),
+		"service":    map[string]any{"name": serviceName(r.LogGroup)},
+		"cloud":      cloud,
+		"aws":        map[string]any{"cloudwatch": map[string]any{"log_group": r.LogGroup, "log_stream": r.LogStream}},
+	}
+	if r.EventID != "" {
+		doc["event"] = map[string]any{"id": r.EventID}
+	}
+	if obj := structured(r, e.cfg.Format); obj != nil {
+		doc["fields"] = obj
+	}
+	return doc
+}
+
+// documentID identifies a record's document: event IDs are unique within a
+// log group only.
+func documentID(r model.LogRecord) string {
+	if r.EventID == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(r.LogGroup + "\x00" + r.EventID))
+	return hex.EncodeToString(sum[:])
+}
+
+// bulkResponse is the part of a _bulk response read back: one item per
+// action, keyed by the action name.
+type bulkResponse struct {
+	Errors bool
+	Items  []map[string]struct {
+		Status int
+		Error  struct {
+			Type   string
+			Reason string
+		}
+	}
+}
+
+func (e *Elasticsearch) send(ctx context.Context, batch []model.LogRecord) error {
+	// actions[i] is the action and document lines of batch[i]
+	actions := make([][]byte, len(batch))
+	for i, r := range batch {
+		var a bulkAction
+		a.Create.Index, a.Create.ID = e.indexName(r), documentID(r)
+		line, _ := json.Marshal(a)
+		doc, err := json.Marshal(e.document(r))
+		if err != nil {
+			return err
+		}
+		actions[i] = append(append(append(line, '\n'), doc...), '\n')
+	}
+	pending := make([]int, len(batch))
+	for i := range pending {
+		pending[i] = i
+	}
+	start := time.Now()
+	var duplicates, failed int
+	var reason string
+	err := retry(ctx, e.cfg, func() error {
+		var body bytes.Buffer
+		for _, i := range pending {
+			body.Write(actions[i])
+		}
+		b, err := post(ctx, e.cfg, e.url, "application/x-ndjson", body.Bytes())
+		if err != nil {
+			return err
+		}
+		var resp bulkResponse
+		if err := json.Unmarshal(b, &resp); err != nil || len(resp.Items) != len(pending) {
+			return &StatusError{Status: "unexpected _bulk response", Body: string(b)}
+		}
+		if !resp.Errors {
+			return nil
+		}
+		// Retry the documents refused by a busy cluster
+		var again []int
+		for j, item := range resp.Items {
+			for _, res := range item {
+				switch {
+				case res.Status == 409:
+					duplicates++
+				case res.Status == 429 || res.Status >= 500:
+					again = append(again, pending[j])
+				case res.Status >= 300:
+					failed++
+					reason = res.Error.Type + ": " + res.Error.Reason
+				}
+			}
+		}
+		pending = again
+		if len(pending) > 0 {
+			return &StatusError{Status: fmt.Sprintf("%d of %d documents refused", len(pending), len(resp.Items)), Retryable: true}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Elasticsearch bulk request to %s: %w", e.URL(), err)
+	}
+	if duplicates > 0 {
+		e.cfg.Logger.Debug("documents already indexed", "documents", duplicates)
+	}
+	if failed > 0 {
+		e.cfg.Logger.Warn("Elasticsearch rejected documents", "documents", failed, "reason", reason)
+	}
+	e.cfg.Logger.Debug("export batch sent", "sink", SinkElasticsearch, "records", len(batch), "elapsed", time.Since(start))
+	return nil
+}
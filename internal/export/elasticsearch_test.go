@@ -0,0 +1,145 @@
+package export_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+)
+
+// bulk answers a _bulk request with the given item statuses.
+func bulk(statuses ...int) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		var resp struct {
+			Errors bool             `json:"errors"`
+			Items  []map[string]any `json:"items"`
+		}
+		for _, s := range statuses {
+			item := map[string]any{"status": s}
+			if s >= 300 {
+				resp.Errors = true
+				item["error"] = map[string]string{"type": "mapper_parsing_exception", "reason": "failed to parse field [fields.attempt]"}
+			}
+			resp.Items = append(resp.Items, map[string]any{"create": item})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// bulkLines splits a _bulk body into its action and document lines.
+func bulkLines(t *testing.T, body []byte) (actions, docs []map[string]any) {
+	t.Helper()
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	for i := 0; sc.Scan(); i++ {
+		var m map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("line %d: %v", i, err)
+		}
+		if i%2 == 0 {
+			actions = append(actions, m["create"].(map[string]any))
+		} else {
+			docs = append(docs, m)
+		}
+	}
+	return actions, docs
+}
+
+func TestElasticsearch(t *testing.T) {
+	c := newCollector(t)
+	c.reply = []func(http.ResponseWriter){bulk(201, 201)}
+	sink, err := export.New(export.SinkOpenSearch, export.Config{Endpoint: "http://user:secret@" + strings.TrimPrefix(c.URL, "http://"), Resource: export.Resource{Account: "123456789012", Region: "us-east-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sink.URL(), "secret") || !strings.HasSuffix(sink.URL(), "/_bulk") {
+		t.Errorf("URL = %s", sink.URL())
+	}
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.received()
+	if len(got) != 1 || got[0].contentType != "application/x-ndjson" || got[0].header.Get("Authorization") == "" {
+		t.Fatalf("requests = %+v", got)
+	}
+	actions, docs := bulkLines(t, got[0].body)
+	if len(actions) != 2 || actions[0]["_index"] != "aws-logs-2025.08.31" || len(actions[0]["_id"].(string)) != 40 || actions[1]["_id"] != nil {
+		t.Fatalf("actions = %v", actions)
+	}
+	doc, _ := json.Marshal(docs[0])
+	want := `{"@timestamp":"2025-08-31T11:00:00Z","aws":{"cloudwatch":{"log_group":"/aws/lambda/api","log_stream":"2025/08/31/[$LATEST]abc"}},"cloud":{"account":{"id":"123456789012"},"provider":"aws","region":"us-east-1"},"event":{"id":"e1"},` +
+		`"fields":{"attempt":3,"level":"error","msg":"payment failed","ok":false,"spanId":"00f067aa0ba902b7","traceId":"4bf92f3577b34da6a3ce929d0e0e4736"},"message":"{\"level\":\"error\",\"msg\":\"payment failed\",\"traceId\":\"4bf92f3577b34da6a3ce929d0e0e4736\",\"spanId\":\"00f067aa0ba902b7\",\"attempt\":3,\"ok\":false}","service":{"name":"api"}}`
+	if string(doc) != want {
+		t.Errorf("document:\n%s\nwant:\n%s", doc, want)
+	}
+	if _, ok := docs[1]["fields"]; ok {
+		t.Errorf("unstructured document = %v", docs[1])
+	}
+}
+
+func TestElasticsearchIndex(t *testing.T) {
+	c := newCollector(t)
+	c.reply = []func(http.ResponseWriter){bulk(201, 201)}
+	sink, err := export.New(export.SinkElasticsearch, export.Config{Endpoint: c.URL + "/es/", Index: "Incident-42-{{group}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.URL() != c.URL+"/es/_bulk" {
+		t.Errorf("URL = %s", sink.URL())
+	}
+	sink.Write(context.Background(), records)
+	sink.Flush(context.Background())
+	actions, _ := bulkLines(t, c.received()[0].body)
+	if actions[0]["_index"] != "incident-42--aws-lambda-api" || actions[1]["_index"] != "incident-42--aws-ecs-billing" {
+		t.Errorf("actions = %v", actions)
+	}
+	if _, err := export.New(export.SinkElasticsearch, export.Config{Index: "logs-{{day}}"}); err == nil {
+		t.Error("unknown placeholder accepted")
+	}
+}
+
+func TestElasticsearchItemRetries(t *testing.T) {
+	c := newCollector(t)
+	// The second document is throttled, then indexed; the first is a
+	// duplicate of an earlier export.
+	c.reply = []func(http.ResponseWriter){bulk(409, 429), bulk(201)}
+	sink, _ := export.New(export.SinkElasticsearch, export.Config{Endpoint: c.URL, Backoff: time.Millisecond})
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.received()
+	if len(got) != 2 {
+		t.Fatalf("%d requests", len(got))
+	}
+	if actions, docs := bulkLines(t, got[1].body); len(actions) != 1 || docs[0]["aws"].(map[string]any)["cloudwatch"].(map[string]any)["log_group"] != "/aws/ecs/billing" {
+		t.Errorf("retried %v", docs)
+	}
+
+	// Rejected documents are reported, not retried.
+	var logs bytes.Buffer
+	c.reply = []func(http.ResponseWriter){bulk(201, 400)}
+	sink, _ = export.New(export.SinkElasticsearch, export.Config{Endpoint: c.URL, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err != nil || len(c.received()) != 3 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+	if !strings.Contains(logs.String(), `msg="Elasticsearch rejected documents" documents=1 reason="mapper_parsing_exception: failed to parse field [fields.attempt]"`) {
+		t.Errorf("logs = %s", logs.String())
+	}
+
+	// A response that is not a _bulk response fails.
+	c.reply = []func(http.ResponseWriter){func(w http.ResponseWriter) { io.WriteString(w, "<html>proxy</html>") }}
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "unexpected _bulk response") || len(c.received()) != 4 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+}
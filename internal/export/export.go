@@ -0,0 +1,282 @@
+// Package export sends search results to log backends. A Sink receives the
+// records a command prints, already annotated and redacted, buffers them
+// into batches and delivers each batch with retries.
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+)
+
+// Sink names accepted by New. OpenSearch is served by the Elasticsearch
+// sink.
+const (
+	SinkOTLP          = "otlp"
+	SinkLoki          = "loki"
+	SinkElasticsearch = "elasticsearch"
+	SinkOpenSearch    = "opensearch"
+)
+
+// Sinks lists the --export values.
+var Sinks = []string{SinkOTLP, SinkLoki, SinkElasticsearch, SinkOpenSearch}
+
+// Defaults of Config.
+const (
+	DefaultBatchSize = 512
+	DefaultRetries   = 4
+	DefaultBackoff   = 500 * time.Millisecond
+)
+
+// Sink receives search results.
+type Sink interface {
+	// Write queues records, sending every full batch.
+	Write(ctx context.Context, records []model.LogRecord) error
+	// Flush sends the records still queued.
+	Flush(ctx context.Context) error
+	// URL returns where records are sent.
+	URL() string
+}
+
+// Resource identifies where the records were read from, beyond their group
+// and stream. Empty fields are unknown.
+type Resource struct {
+	Account string
+	Region  string
+}
+
+// Config configures a sink.
+type Config struct {
+	// Endpoint is the URL records are sent to; empty means the sink's
+	// default.
+	Endpoint string
+	// Protocol selects the OTLP transport: one of OTLPProtocols.
+	Protocol string
+	// Index is the Elasticsearch index template (empty means DefaultIndex)
+	// and Labels maps Loki label names to templates (empty means
+	// DefaultLabels). See Template.
+	Index  string
+	Labels map[string]string
+	// Headers are added to every request, e.g. for authentication.
+	Headers  http.Header
+	Resource Resource
+	// Format parses messages whose Fields are unset, for the structured
+	// attributes of the exported records.
+	Format parser.Format
+	// BatchSize is the number of records per request (0 means
+	// DefaultBatchSize). A request refused with a retryable status is
+	// retried up to Retries times (0 means DefaultRetries, negative none),
+	// waiting Backoff, then twice as long, and so on.
+	BatchSize int
+	Retries   int
+	Backoff   time.Duration
+	Client    *http.Client
+	Logger    *slog.Logger
+}
+
+func (c Config) withDefaults() Config {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+	if c.Retries < 0 {
+		c.Retries = 0
+	} else if c.Retries == 0 {
+		c.Retries = DefaultRetries
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultBackoff
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	if c.Logger == nil {
+		c.Logger = slog.New(slog.DiscardHandler)
+	}
+	if c.Format == "" {
+		c.Format = parser.FormatAuto
+	}
+	return c
+}
+
+// New returns the named sink.
+func New(name string, cfg Config) (Sink, error) {
+	switch name {
+	case SinkOTLP:
+		return NewOTLP(cfg)
+	case SinkLoki:
+		return NewLoki(cfg)
+	case SinkElasticsearch, SinkOpenSearch:
+		return NewElasticsearch(cfg)
+	}
+	return nil, fmt.Errorf("unknown sink %q; expected one of %s", name, strings.Join(Sinks, ", "))
+}
+
+// batcher queues records and passes them to send in batches of size.
+type batcher struct {
+	size  int
+	queue []model.LogRecord
+	send  func(ctx context.Context, batch []model.LogRecord) error
+}
+
+func (b *batcher) write(ctx context.Context, records []model.LogRecord) error {
+	b.queue = append(b.queue, records...)
+	for len(b.queue) >= b.size {
+		if err := b.send(ctx, b.queue[:b.size]); err != nil {
+			return err
+		}
+		b.queue = slices.Delete(b.queue, 0, b.size)
+	}
+	return nil
+}
+
+func (b *batcher) flush(ctx context.Context) error {
+	if len(b.queue) == 0 {
+		return nil
+	}
+	err := b.send(ctx, b.queue)
+	if ctx.Err() == nil {
+		// A canceled batch stays queued for a later flush
+		b.queue = nil
+	}
+	return err
+}
+
+// StatusError is a request refused by the backend.
+type StatusError struct {
+	// Code is the HTTP status code, or 0 when the refusal is not an HTTP
+	// status.
+	Code   int
+	Status string
+	Body   string
+	// Retryable reports a refusal that may succeed later, such as
+	// throttling or an unavailable backend.
+	Retryable bool
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Body
+}
+
+// retry calls fn until it succeeds, is refused with a StatusError that is
+// not retryable, or has been retried cfg.Retries times. Connection errors
+// are retried.
+func retry(ctx context.Context, cfg Config, fn func() error) error {
+	wait := cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		se, refused := err.(*StatusError)
+		if err == nil || refused && !se.Retryable || attempt == cfg.Retries || ctx.Err() != nil {
+			return err
+		}
+		cfg.Logger.Debug("export retry", "error", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post sends body to url and returns the response body of a 2xx response.
+// 429 and 502-504 responses are retryable StatusErrors; other non-2xx
+// responses fail.
+func post(ctx context.Context, cfg Config, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range cfg.Headers {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, &StatusError{
+			Code:      resp.StatusCode,
+			Status:    resp.Status,
+			Body:      strings.TrimSpace(string(b)),
+			Retryable: slices.Contains([]int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}, resp.StatusCode),
+		}
+	}
+	return b, nil
+}
+
+// endpointURL resolves an HTTP endpoint: def when empty, http:// when it
+// has no scheme, and path when it has none.
+func endpointURL(endpoint, def, path string) (*url.URL, error) {
+	if endpoint == "" {
+		endpoint = def
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = path
+	}
+	return u, nil
+}
+
+// redactURL hides the password of a URL with credentials.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+// serviceName is the last path element of a log group name.
+func serviceName(group string) string {
+	g := strings.TrimRight(group, "/")
+	return g[strings.LastIndex(g, "/")+1:]
+}
+
+// message is a record's message without its trailing newline.
+func message(r model.LogRecord) string {
+	return strings.TrimRight(r.Message, "\r\n")
+}
+
+// structured returns the fields of a structured message, or nil for an
+// unstructured one, which parses to {"message": <the message>}.
+func structured(r model.LogRecord, format parser.Format) map[string]any {
+	obj, _ := fields(r, format).(map[string]any)
+	if len(obj) == 1 && obj["message"] == r.Message {
+		return nil
+	}
+	return obj
+}
+
+// fields returns the parsed form of r's message: its Fields when a parser
+// set them, else the message parsed in format.
+func fields(r model.LogRecord, format parser.Format) any {
+	if r.Fields != nil {
+		return r.Fields
+	}
+	return parser.Parse(format, r.Message)
+}
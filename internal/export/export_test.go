@@ -0,0 +1,83 @@
+package export_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+func TestNewUnknownSink(t *testing.T) {
+	if _, err := export.New("kafka", export.Config{}); err == nil || !strings.Contains(err.Error(), "otlp") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	c := newCollector(t)
+	sink, err := export.New(export.SinkOTLP, export.Config{Endpoint: c.URL, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	five := make([]model.LogRecord, 5)
+	for i := range five {
+		five[i] = records[0]
+	}
+	if err := sink.Write(context.Background(), five[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), five[3:]); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.received()); n != 2 {
+		t.Fatalf("%d requests before Flush, want 2", n)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.received()); n != 3 {
+		t.Fatalf("%d requests, want 3", n)
+	}
+}
+
+func status(code int, body string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	c := newCollector(t)
+	c.reply = []func(http.ResponseWriter){status(http.StatusServiceUnavailable, "busy"), status(http.StatusTooManyRequests, "slow down")}
+	sink, _ := export.New(export.SinkOTLP, export.Config{Endpoint: c.URL, Backoff: time.Millisecond})
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err != nil || len(c.received()) != 3 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+
+	// Not retryable.
+	c.reply = []func(http.ResponseWriter){status(http.StatusBadRequest, "bad payload")}
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "400 Bad Request: bad payload") || len(c.received()) != 4 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+
+	// Retries run out.
+	c.reply = []func(http.ResponseWriter){status(502, ""), status(502, ""), status(502, "")}
+	sink, _ = export.New(export.SinkOTLP, export.Config{Endpoint: c.URL, Backoff: time.Millisecond, Retries: 2})
+	sink.Write(context.Background(), records)
+	var se *export.StatusError
+	if err := sink.Flush(context.Background()); !errors.As(err, &se) || !se.Retryable || len(c.received()) != 7 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// DefaultLabels are the Loki labels of exported records.
+var DefaultLabels = map[string]string{"group": "{{group}}", "stream": "{{stream}}", "region": "{{region}}"}
+
+// labelNameRe matches the label names Loki accepts.
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Loki sends records to the Grafana Loki push API. Each record is a log
+// line of the stream identified by its expanded label templates; labels
+// that expand to nothing, e.g. {{region}} when the region is unknown, are
+// left out.
+type Loki struct {
+	cfg     Config
+	url     string
+	labels  map[string]Template
+	batcher batcher
+}
+
+// NewLoki returns a Loki sink. Without cfg.Endpoint it sends to a local Loki
+// (port 3100); an endpoint without a path gets /loki/api/v1/push.
+func NewLoki(cfg Config) (*Loki, error) {
+	cfg = cfg.withDefaults()
+	u, err := endpointURL(cfg.Endpoint, "http://localhost:3100", "/loki/api/v1/push")
+	if err != nil {
+		return nil, fmt.Errorf("Loki: %w", err)
+	}
+	l := &Loki{cfg: cfg, url: u.String(), labels: map[string]Template{}}
+	labels := cfg.Labels
+	if len(labels) == 0 {
+		labels = DefaultLabels
+	}
+	for name, s := range labels {
+		if !labelNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid Loki label name %q", name)
+		}
+		if l.labels[name], err = ParseTemplate(s); err != nil {
+			return nil, fmt.Errorf("Loki label %s: %w", name, err)
+		}
+	}
+	l.batcher = batcher{size: cfg.BatchSize, send: l.send}
+	return l, nil
+}
+
+// URL returns the push URL, without credentials.
+func (l *Loki) URL() string {
+	return redactURL(l.url)
+}
+
+// Write queues records, sending every full batch.
+func (l *Loki) Write(ctx context.Context, records []model.LogRecord) error {
+	return l.batcher.write(ctx, records)
+}
+
+// Flush sends the records still queued.
+func (l *Loki) Flush(ctx context.Context) error {
+	return l.batcher.flush(ctx)
+}
+
+// lokiPush is the JSON body of the push API.
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are [<unix epoch in nanoseconds>, <log line>] pairs.
+	Values [][2]string `json:"values"`
+}
+
+// push converts a batch, one stream per label set in order of first
+// appearance, each in time order.
+func (l *Loki) push(batch []model.LogRecord) lokiPush {
+	var p lokiPush
+	index := map[string]int{}
+	batch = slices.Clone(batch)
+	slices.SortStableFunc(batch, func(a, b model.LogRecord) int { return a.Timestamp.Compare(b.Timestamp) })
+	for _, r := range batch {
+		labels := map[string]string{}
+		for name, t := range l.labels {
+			if v := t.Expand(r, l.cfg.Resource); v != "" {
+				labels[name] = v
+			}
+		}
+		key, _ := json.Marshal(labels)
+		i, ok := index[string(key)]
+		if !ok {
+			i = len(p.Streams)
+			index[string(key)] = i
+			p.Streams = append(p.Streams, lokiStream{Stream: labels})
+		}
+		p.Streams[i].Values = append(p.Streams[i].Values, [2]string{strconv.FormatInt(r.Timestamp.UnixNano(), 10), message(r)})
+	}
+	return p
+}
+
+func (l *Loki) send(ctx context.Context, batch []model.LogRecord) error {
+	body, err := json.Marshal(l.push(batch))
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = retry(ctx, l.cfg, func() error {
+		_, err := post(ctx, l.cfg, l.url, "application/json", body)
+		return err
+	})
+	// Loki stores the valid lines of a push and answers 400 for the others,
+	// e.g. lines older than its reject_old_samples_max_age.
+	var se *StatusError
+	if errors.As(err, &se) && se.Code == http.StatusBadRequest {
+		l.cfg.Logger.Warn("Loki rejected log lines", "batch", len(batch), "message", se.Body)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Loki push to %s: %w", l.URL(), err)
+	}
+	l.cfg.Logger.Debug("export batch sent", "sink", SinkLoki, "records", len(batch), "elapsed", time.Since(start))
+	return nil
+}
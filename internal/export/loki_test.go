@@ -0,0 +1,102 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string
+		Values [][2]string
+	}
+}
+
+func TestLoki(t *testing.T) {
+	c := newCollector(t)
+	sink, err := export.New(export.SinkLoki, export.Config{Endpoint: c.URL, Resource: export.Resource{Region: "us-east-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.URL() != c.URL+"/loki/api/v1/push" {
+		t.Errorf("URL = %s", sink.URL())
+	}
+	batch := append([]model.LogRecord{{Timestamp: t0.Add(-time.Second), LogGroup: records[0].LogGroup, LogStream: records[0].LogStream, Message: "START"}}, records...)
+	batch[0], batch[1] = batch[1], batch[0]
+	sink.Write(context.Background(), batch)
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.received()
+	if len(got) != 1 || got[0].contentType != "application/json" {
+		t.Fatalf("requests = %+v", got)
+	}
+	var p lokiPush
+	if err := json.Unmarshal(got[0].body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Streams) != 2 {
+		t.Fatalf("streams = %+v", p.Streams)
+	}
+	api, billing := p.Streams[0], p.Streams[1]
+	if !reflect.DeepEqual(api.Stream, map[string]string{"group": "/aws/lambda/api", "stream": "2025/08/31/[$LATEST]abc", "region": "us-east-1"}) ||
+		!reflect.DeepEqual(billing.Stream, map[string]string{"group": "/aws/ecs/billing", "stream": "billing/1", "region": "us-east-1"}) {
+		t.Errorf("labels = %v, %v", api.Stream, billing.Stream)
+	}
+	// In time order, without the trailing newline
+	if len(api.Values) != 2 || api.Values[0] != [2]string{"1756637999000000000", "START"} || !strings.HasSuffix(api.Values[1][1], `"ok":false}`) {
+		t.Errorf("values = %q", api.Values)
+	}
+}
+
+func TestLokiLabels(t *testing.T) {
+	c := newCollector(t)
+	sink, err := export.New(export.SinkLoki, export.Config{Endpoint: c.URL + "/custom/push", Labels: map[string]string{"service_name": "{{service}}", "region": "{{region}}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(context.Background(), records[:1])
+	sink.Flush(context.Background())
+	var p lokiPush
+	json.Unmarshal(c.received()[0].body, &p)
+	// An unknown region leaves its label out
+	if !reflect.DeepEqual(p.Streams[0].Stream, map[string]string{"service_name": "api"}) {
+		t.Errorf("labels = %v", p.Streams[0].Stream)
+	}
+
+	for _, labels := range []map[string]string{{"service-name": "{{service}}"}, {"host": "{{host}}"}} {
+		if _, err := export.New(export.SinkLoki, export.Config{Labels: labels}); err == nil {
+			t.Errorf("labels %v accepted", labels)
+		}
+	}
+}
+
+func TestLokiRejectedLines(t *testing.T) {
+	c := newCollector(t)
+	c.reply = []func(http.ResponseWriter){status(http.StatusBadRequest, "entry for stream '{group=\"/aws/lambda/api\"}' has timestamp too old")}
+	var logs bytes.Buffer
+	sink, _ := export.New(export.SinkLoki, export.Config{Endpoint: c.URL, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err != nil || len(c.received()) != 1 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+	if !strings.Contains(logs.String(), "Loki rejected log lines") || !strings.Contains(logs.String(), "too old") {
+		t.Errorf("logs = %s", logs.String())
+	}
+
+	c.reply = []func(http.ResponseWriter){status(http.StatusUnauthorized, "no org id")}
+	sink.Write(context.Background(), records)
+	if err := sink.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "401 Unauthorized: no org id") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,619 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// OTLP transports, named as in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolHTTPJSON     = "http/json"
+	ProtocolGRPC         = "grpc"
+)
+
+// OTLPProtocols lists the OTLP transports; the first is the default.
+var OTLPProtocols = []string{ProtocolHTTPProtobuf, ProtocolHTTPJSON, ProtocolGRPC}
+
+// ScopeName is the instrumentation scope of the exported records.
+const ScopeName = "github.com/Nao-Mk2/aws-multi-log-inspector"
+
+// grpcPath is the gRPC method exporting logs.
+const grpcPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// OTLP sends records to an OpenTelemetry collector as OTLP log records. Each
+// log stream becomes a resource with the cloud.* and aws.log.* attributes
+// of its group, stream, account and region; message fields become record
+// attributes, and trace and span IDs found in a message set the record's
+// trace context.
+type OTLP struct {
+	cfg      Config
+	url      string
+	protocol string
+	batcher  batcher
+	// now stamps the observed time of records.
+	now func() time.Time
+}
+
+// NewOTLP returns an OTLP sink. Without cfg.Endpoint it sends to
+// OTEL_EXPORTER_OTLP_LOGS_ENDPOINT, OTEL_EXPORTER_OTLP_ENDPOINT or the local
+// collector (port 4318, or 4317 for gRPC); OTEL_EXPORTER_OTLP_HEADERS adds
+// headers, under those of cfg.
+func NewOTLP(cfg Config) (*OTLP, error) {
+	cfg = cfg.withDefaults()
+	o := &OTLP{cfg: cfg, protocol: cfg.Protocol, now: time.Now}
+	if o.protocol == "" {
+		o.protocol = envOr("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL", ProtocolHTTPProtobuf)
+	}
+	var err error
+	if o.url, err = otlpURL(cfg.Endpoint, o.protocol); err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(envOr("OTEL_EXPORTER_OTLP_LOGS_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS", ""))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range cfg.Headers {
+		headers[k] = vs
+	}
+	o.cfg.Headers = headers
+	if o.protocol == ProtocolGRPC && cfg.Client == http.DefaultClient {
+		var p http.Protocols
+		p.SetHTTP2(true)
+		p.SetUnencryptedHTTP2(true)
+		o.cfg.Client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, Protocols: &p}}
+	}
+	o.batcher = batcher{size: cfg.BatchSize, send: o.send}
+	return o, nil
+}
+
+// URL returns the URL records are sent to.
+func (o *OTLP) URL() string {
+	return o.url
+}
+
+func envOr(specific, general, def string) string {
+	if v := os.Getenv(specific); v != "" {
+		return v
+	}
+	if v := os.Getenv(general); v != "" {
+		return v
+	}
+	return def
+}
+
+// otlpURL resolves the request URL of endpoint. An HTTP endpoint without a
+// path gets /v1/logs; a gRPC endpoint may be host:port and gets the method
+// path.
+func otlpURL(endpoint, protocol string) (string, error) {
+	var port, path string
+	switch protocol {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON:
+		port, path = "4318", "/v1/logs"
+		if endpoint == "" {
+			if v := os.Getenv("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"); v != "" {
+				return v, nil
+			}
+		}
+	case ProtocolGRPC:
+		port, path = "4317", grpcPath
+	default:
+		return "", fmt.Errorf("unknown OTLP protocol %q; expected one of %s", protocol, strings.Join(OTLPProtocols, ", "))
+	}
+	if endpoint == "" {
+		endpoint = envOr("", "OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:"+port)
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if protocol == ProtocolGRPC || u.Path == "" || u.Path == "/" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + path
+	}
+	return u.String(), nil
+}
+
+// parseHeaders parses the key=value,... list of OTEL_EXPORTER_OTLP_HEADERS,
+// whose values are percent-encoded.
+func parseHeaders(s string) (http.Header, error) {
+	h := http.Header{}
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid OTLP header %q; expected key=value", kv)
+		}
+		if u, err := url.PathUnescape(strings.TrimSpace(v)); err == nil {
+			v = u
+		}
+		h.Set(strings.TrimSpace(k), v)
+	}
+	return h, nil
+}
+
+// Write queues records, sending every full batch.
+func (o *OTLP) Write(ctx context.Context, records []model.LogRecord) error {
+	return o.batcher.write(ctx, records)
+}
+
+// Flush sends the records still queued.
+func (o *OTLP) Flush(ctx context.Context) error {
+	return o.batcher.flush(ctx)
+}
+
+func (o *OTLP) send(ctx context.Context, batch []model.LogRecord) error {
+	req := o.request(batch)
+	start := time.Now()
+	err := retry(ctx, o.cfg, func() error {
+		var rejected int64
+		var msg string
+		var err error
+		switch o.protocol {
+		case ProtocolHTTPJSON:
+			body, _ := json.Marshal(req)
+			var resp []byte
+			if resp, err = post(ctx, o.cfg, o.url, "application/json", body); err == nil && len(resp) > 0 {
+				var r struct {
+					PartialSuccess struct {
+						RejectedLogRecords json.Number
+						ErrorMessage       string
+					}
+				}
+				_ = json.Unmarshal(resp, &r)
+				rejected, _ = r.PartialSuccess.RejectedLogRecords.Int64()
+				msg = r.PartialSuccess.ErrorMessage
+			}
+		case ProtocolGRPC:
+			var resp []byte
+			if resp, err = o.grpc(ctx, req.marshal()); err == nil {
+				rejected, msg = partialSuccess(resp)
+			}
+		default:
+			var resp []byte
+			if resp, err = post(ctx, o.cfg, o.url, "application/x-protobuf", req.marshal()); err == nil {
+				rejected, msg = partialSuccess(resp)
+			}
+		}
+		if rejected > 0 || msg != "" {
+			o.cfg.Logger.Warn("OTLP export partially rejected", "rejected", rejected, "message", msg)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("OTLP export to %s: %w", o.url, err)
+	}
+	o.cfg.Logger.Debug("export batch sent", "sink", SinkOTLP, "records", len(batch), "elapsed", time.Since(start))
+	return nil
+}
+
+// grpc calls LogsService/Export with a marshaled request and returns the
+// marshaled response.
+func (o *OTLP) grpc(ctx context.Context, msg []byte) ([]byte, error) {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range o.cfg.Headers {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := o.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+	// A trailers-only response carries the status in the headers.
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		code, _ := strconv.Atoi(status)
+		message, _ = url.PathUnescape(message)
+		return nil, &StatusError{Status: "grpc status " + status, Body: message, Retryable: retryableGRPC[code]}
+	}
+	if len(body) < 5 {
+		return nil, nil
+	}
+	return body[5:], nil
+}
+
+// retryableGRPC are the gRPC status codes OTLP exporters retry:
+// CANCELLED, DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, OUT_OF_RANGE,
+// UNAVAILABLE and DATA_LOSS.
+var retryableGRPC = map[int]bool{1: true, 4: true, 8: true, 10: true, 11: true, 14: true, 15: true}
+
+// otlpRequest is an ExportLogsServiceRequest, with the JSON names of the
+// OTLP/JSON encoding.
+type otlpRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int32      `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	// TraceID and SpanID are hex, as in OTLP/JSON.
+	TraceID string `json:"traceId,omitempty"`
+	SpanID  string `json:"spanId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string      `json:"stringValue,omitempty"`
+	BoolValue   *bool        `json:"boolValue,omitempty"`
+	IntValue    *int64       `json:"intValue,omitempty,string"`
+	DoubleValue *float64     `json:"doubleValue,omitempty"`
+	ArrayValue  *arrayValue  `json:"arrayValue,omitempty"`
+	KvlistValue *kvlistValue `json:"kvlistValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type kvlistValue struct {
+	Values []keyValue `json:"values"`
+}
+
+func stringValue(s string) anyValue {
+	return anyValue{StringValue: &s}
+}
+
+// value converts a decoded JSON value.
+func value(v any) anyValue {
+	switch v := v.(type) {
+	case string:
+		return stringValue(v)
+	case bool:
+		return anyValue{BoolValue: &v}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			i := int64(v)
+			return anyValue{IntValue: &i}
+		}
+		return anyValue{DoubleValue: &v}
+	case []any:
+		a := &arrayValue{Values: []anyValue{}}
+		for _, e := range v {
+			a.Values = append(a.Values, value(e))
+		}
+		return anyValue{ArrayValue: a}
+	case map[string]any:
+		return anyValue{KvlistValue: &kvlistValue{Values: attributes(v)}}
+	case nil:
+		return anyValue{}
+	}
+	return stringValue(fmt.Sprint(v))
+}
+
+// attributes converts an object, ordered by key.
+func attributes(m map[string]any) []keyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := []keyValue{}
+	for _, k := range keys {
+		kvs = append(kvs, keyValue{Key: k, Value: value(m[k])})
+	}
+	return kvs
+}
+
+// request converts a batch, one resource per log stream in order of first
+// appearance.
+func (o *OTLP) request(batch []model.LogRecord) otlpRequest {
+	var req otlpRequest
+	index := map[[2]string]int{}
+	observed := uint64(o.now().UnixNano())
+	for _, r := range batch {
+		key := [2]string{r.LogGroup, r.LogStream}
+		i, ok := index[key]
+		if !ok {
+			i = len(req.ResourceLogs)
+			index[key] = i
+			req.ResourceLogs = append(req.ResourceLogs, resourceLogs{
+				Resource:  resource{Attributes: o.resourceAttributes(r.LogGroup, r.LogStream)},
+				ScopeLogs: []scopeLogs{{Scope: scope{Name: ScopeName}}},
+			})
+		}
+		sl := &req.ResourceLogs[i].ScopeLogs[0]
+		sl.LogRecords = append(sl.LogRecords, o.logRecord(r, observed))
+	}
+	return req
+}
+
+func (o *OTLP) resourceAttributes(group, stream string) []keyValue {
+	kvs := []keyValue{
+		{Key: "service.name", Value: stringValue(serviceName(group))},
+		{Key: "cloud.provider", Value: stringValue("aws")},
+	}
+	if o.cfg.Resource.Account != "" {
+		kvs = append(kvs, keyValue{Key: "cloud.account.id", Value: stringValue(o.cfg.Resource.Account)})
+	}
+	if o.cfg.Resource.Region != "" {
+		kvs = append(kvs, keyValue{Key: "cloud.region", Value: stringValue(o.cfg.Resource.Region)})
+	}
+	return append(kvs,
+		keyValue{Key: "aws.log.group.names", Value: anyValue{ArrayValue: &arrayValue{Values: []anyValue{stringValue(group)}}}},
+		keyValue{Key: "aws.log.stream.names", Value: anyValue{ArrayValue: &arrayValue{Values: []anyValue{stringValue(stream)}}}},
+	)
+}
+
+func (o *OTLP) logRecord(r model.LogRecord, observed uint64) logRecord {
+	msg := message(r)
+	lr := logRecord{
+		TimeUnixNano:         uint64(r.Timestamp.UnixNano()),
+		ObservedTimeUnixNano: observed,
+		Body:                 stringValue(msg),
+	}
+	obj, _ := fields(r, o.cfg.Format).(map[string]any)
+	for _, kv := range attributes(obj) {
+		// Unstructured messages parse to {"message": <the message>}.
+		if kv.Key == "message" && kv.Value.StringValue != nil && *kv.Value.StringValue == r.Message {
+			continue
+		}
+		lr.Attributes = append(lr.Attributes, kv)
+	}
+	if r.EventID != "" {
+		lr.Attributes = append(lr.Attributes, keyValue{Key: "log.record.uid", Value: stringValue(r.EventID)})
+	}
+	lr.SeverityText, lr.SeverityNumber = severity(obj)
+	lr.TraceID, lr.SpanID = traceContext(obj, msg)
+	return lr
+}
+
+// severityNumbers maps level names to OTel severity numbers.
+var severityNumbers = map[string]int32{
+	"TRACE": 1, "DEBUG": 5, "INFO": 9, "NOTICE": 10, "WARN": 13, "WARNING": 13,
+	"ERROR": 17, "CRITICAL": 21, "FATAL": 21, "PANIC": 21,
+}
+
+// severity reads the level of a structured message.
+func severity(obj map[string]any) (string, int32) {
+	for _, k := range []string{"level", "severity", "log.level", "levelname", "lvl"} {
+		if s, ok := obj[k].(string); ok && s != "" {
+			return s, severityNumbers[strings.ToUpper(s)]
+		}
+	}
+	return "", 0
+}
+
+var (
+	traceparentRe = regexp.MustCompile(`\b[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}\b`)
+	xrayRe        = regexp.MustCompile(`\b1-([0-9a-f]{8})-([0-9a-f]{24})\b(?:;Parent=([0-9a-f]{16}))?`)
+	hex32Re       = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	hex16Re       = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// traceContext finds the hex trace and span IDs of a message: in its
+// traceId/spanId fields, a W3C traceparent, or an X-Ray trace ID (whose
+// OTel form drops the version and dashes).
+func traceContext(obj map[string]any, msg string) (traceID, spanID string) {
+	for _, k := range []string{"traceId", "trace_id", "traceID"} {
+		if s, ok := obj[k].(string); ok && hex32Re.MatchString(strings.ToLower(s)) {
+			traceID = strings.ToLower(s)
+			break
+		}
+	}
+	for _, k := range []string{"spanId", "span_id", "spanID"} {
+		if s, ok := obj[k].(string); ok && hex16Re.MatchString(strings.ToLower(s)) {
+			spanID = strings.ToLower(s)
+			break
+		}
+	}
+	if traceID == "" {
+		if m := traceparentRe.FindStringSubmatch(msg); m != nil {
+			traceID, spanID = m[1], m[2]
+		} else if m := xrayRe.FindStringSubmatch(msg); m != nil {
+			traceID = m[1] + m[2]
+			if spanID == "" {
+				spanID = m[3]
+			}
+		}
+	}
+	if strings.Trim(traceID, "0") == "" {
+		return "", ""
+	}
+	if strings.Trim(spanID, "0") == "" {
+		spanID = ""
+	}
+	return traceID, spanID
+}
+
+// Protobuf field numbers of the OTLP messages.
+const (
+	fieldResourceLogs = 1 // ExportLogsServiceRequest.resource_logs
+
+	fieldResource  = 1 // ResourceLogs.resource
+	fieldScopeLogs = 2 // ResourceLogs.scope_logs
+
+	fieldAttributes = 1 // Resource.attributes
+
+	fieldScope      = 1 // ScopeLogs.scope
+	fieldLogRecords = 2 // ScopeLogs.log_records
+
+	fieldScopeName = 1 // InstrumentationScope.name
+
+	fieldTimeUnixNano         = 1  // LogRecord.time_unix_nano
+	fieldSeverityNumber       = 2  // LogRecord.severity_number
+	fieldSeverityText         = 3  // LogRecord.severity_text
+	fieldBody                 = 5  // LogRecord.body
+	fieldRecordAttributes     = 6  // LogRecord.attributes
+	fieldTraceID              = 9  // LogRecord.trace_id
+	fieldSpanID               = 10 // LogRecord.span_id
+	fieldObservedTimeUnixNano = 11 // LogRecord.observed_time_unix_nano
+
+	fieldKey   = 1 // KeyValue.key
+	fieldValue = 2 // KeyValue.value
+
+	fieldStringValue = 1 // AnyValue.string_value
+	fieldBoolValue   = 2 // AnyValue.bool_value
+	fieldIntValue    = 3 // AnyValue.int_value
+	fieldDoubleValue = 4 // AnyValue.double_value
+	fieldArrayValue  = 5 // AnyValue.array_value
+	fieldKvlistValue = 6 // AnyValue.kvlist_value
+
+	fieldValues = 1 // ArrayValue.values, KeyValueList.values
+
+	fieldPartialSuccess     = 1 // ExportLogsServiceResponse.partial_success
+	fieldRejectedLogRecords = 1 // ExportLogsPartialSuccess.rejected_log_records
+	fieldErrorMessage       = 2 // ExportLogsPartialSuccess.error_message
+)
+
+func (r otlpRequest) marshal() []byte {
+	var b pbuf
+	for _, rl := range r.ResourceLogs {
+		b.message(fieldResourceLogs, func(b *pbuf) {
+			b.message(fieldResource, func(b *pbuf) {
+				for _, kv := range rl.Resource.Attributes {
+					b.message(fieldAttributes, kv.marshal)
+				}
+			})
+			for _, sl := range rl.ScopeLogs {
+				b.message(fieldScopeLogs, func(b *pbuf) {
+					b.message(fieldScope, func(b *pbuf) { b.string(fieldScopeName, sl.Scope.Name) })
+					for _, lr := range sl.LogRecords {
+						b.message(fieldLogRecords, lr.marshal)
+					}
+				})
+			}
+		})
+	}
+	return b
+}
+
+func (lr logRecord) marshal(b *pbuf) {
+	b.fixed64(fieldTimeUnixNano, lr.TimeUnixNano)
+	if lr.SeverityNumber != 0 {
+		b.varint(fieldSeverityNumber, uint64(lr.SeverityNumber))
+	}
+	if lr.SeverityText != "" {
+		b.string(fieldSeverityText, lr.SeverityText)
+	}
+	b.message(fieldBody, lr.Body.marshal)
+	for _, kv := range lr.Attributes {
+		b.message(fieldRecordAttributes, kv.marshal)
+	}
+	if id, err := hex.DecodeString(lr.TraceID); err == nil && len(id) > 0 {
+		b.bytes(fieldTraceID, id)
+	}
+	if id, err := hex.DecodeString(lr.SpanID); err == nil && len(id) > 0 {
+		b.bytes(fieldSpanID, id)
+	}
+	b.fixed64(fieldObservedTimeUnixNano, lr.ObservedTimeUnixNano)
+}
+
+func (kv keyValue) marshal(b *pbuf) {
+	b.string(fieldKey, kv.Key)
+	b.message(fieldValue, kv.Value.marshal)
+}
+
+func (v anyValue) marshal(b *pbuf) {
+	switch {
+	case v.StringValue != nil:
+		b.string(fieldStringValue, *v.StringValue)
+	case v.BoolValue != nil:
+		n := uint64(0)
+		if *v.BoolValue {
+			n = 1
+		}
+		b.varint(fieldBoolValue, n)
+	case v.IntValue != nil:
+		b.varint(fieldIntValue, uint64(*v.IntValue))
+	case v.DoubleValue != nil:
+		b.fixed64(fieldDoubleValue, math.Float64bits(*v.DoubleValue))
+	case v.ArrayValue != nil:
+		b.message(fieldArrayValue, func(b *pbuf) {
+			for _, e := range v.ArrayValue.Values {
+				b.message(fieldValues, e.marshal)
+			}
+		})
+	case v.KvlistValue != nil:
+		b.message(fieldKvlistValue, func(b *pbuf) {
+			for _, kv := range v.KvlistValue.Values {
+				b.message(fieldValues, kv.marshal)
+			}
+		})
+	}
+}
+
+// partialSuccess reads the partial_success of a marshaled
+// ExportLogsServiceResponse.
+func partialSuccess(resp []byte) (rejected int64, msg string) {
+	for field, v := range pbFields(resp) {
+		if field != fieldPartialSuccess {
+			continue
+		}
+		b, _ := v.([]byte)
+		for f, pv := range pbFields(b) {
+			switch f {
+			case fieldRejectedLogRecords:
+				n, _ := pv.(uint64)
+				rejected = int64(n)
+			case fieldErrorMessage:
+				s, _ := pv.([]byte)
+				msg = string(s)
+			}
+		}
+	}
+	return rejected, msg
+}
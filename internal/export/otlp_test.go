@@ -0,0 +1,366 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+var t0 = time.Date(2025, 8, 31, 11, 0, 0, 0, time.UTC)
+
+var records = []model.LogRecord{
+	{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "2025/08/31/[$LATEST]abc", EventID: "e1",
+		Message: `{"level":"error","msg":"payment failed","traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","attempt":3,"ok":false}` + "\n"},
+	{Timestamp: t0.Add(time.Second), LogGroup: "/aws/ecs/billing", LogStream: "billing/1",
+		Message: "handled X-Amzn-Trace-Id: Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"},
+}
+
+// collector is a local stand-in for an OpenTelemetry collector, receiving
+// OTLP over HTTP and gRPC.
+type collector struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []received
+	// reply, when set, answers the next requests in turn.
+	reply []func(w http.ResponseWriter)
+}
+
+type received struct {
+	contentType string
+	header      http.Header
+	body        []byte
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewUnstartedServer(http.HandlerFunc(c.serve))
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetUnencryptedHTTP2(true)
+	c.Config.Protocols = &p
+	c.Start()
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) serve(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	grpc := r.Header.Get("Content-Type") == "application/grpc"
+	if grpc {
+		if r.ProtoMajor != 2 || r.URL.Path != "/opentelemetry.proto.collector.logs.v1.LogsService/Export" || len(b) < 5 || int(binary.BigEndian.Uint32(b[1:5])) != len(b)-5 {
+			http.Error(w, "bad gRPC request", http.StatusBadRequest)
+			return
+		}
+		b = b[5:]
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, received{r.Header.Get("Content-Type"), r.Header, b})
+	var reply func(http.ResponseWriter)
+	if len(c.reply) > 0 {
+		reply, c.reply = c.reply[0], c.reply[1:]
+	}
+	c.mu.Unlock()
+	if reply != nil {
+		reply(w)
+		return
+	}
+	if grpc {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(make([]byte, 5))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (c *collector) received() []received {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]received(nil), c.requests...)
+}
+
+// pb is a decoded protobuf message: the values of each field number, a
+// uint64 for varint and fixed fields and a []byte for the others.
+type pb map[int][]any
+
+func decode(t *testing.T, b []byte) pb {
+	t.Helper()
+	m := pb{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatal("bad tag")
+		}
+		b = b[n:]
+		var v any
+		switch key & 7 {
+		case 0:
+			x, n := binary.Uvarint(b)
+			v, b = x, b[n:]
+		case 1:
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			v, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		m[int(key>>3)] = append(m[int(key>>3)], v)
+	}
+	return m
+}
+
+func (m pb) msg(t *testing.T, field, i int) pb {
+	t.Helper()
+	return decode(t, m[field][i].([]byte))
+}
+
+func (m pb) str(field int) string {
+	b, _ := m[field][0].([]byte)
+	return string(b)
+}
+
+// attrs decodes the KeyValues of field into key: value, with values as
+// strings, numbers, bools or the string "array"/"kvlist".
+func (m pb) attrs(t *testing.T, field int) map[string]any {
+	t.Helper()
+	out := map[string]any{}
+	for i := range m[field] {
+		kv := m.msg(t, field, i)
+		v := kv.msg(t, 2, 0)
+		switch {
+		case v[1] != nil:
+			out[kv.str(1)] = v.str(1)
+		case v[2] != nil:
+			out[kv.str(1)] = v[2][0].(uint64) == 1
+		case v[3] != nil:
+			out[kv.str(1)] = int64(v[3][0].(uint64))
+		case v[4] != nil:
+			out[kv.str(1)] = math.Float64frombits(v[4][0].(uint64))
+		case v[5] != nil:
+			out[kv.str(1)] = v.msg(t, 5, 0).msg(t, 1, 0).str(1)
+		case v[6] != nil:
+			out[kv.str(1)] = "kvlist"
+		}
+	}
+	return out
+}
+
+func TestOTLPHTTPProtobuf(t *testing.T) {
+	c := newCollector(t)
+	sink, err := export.NewOTLP(export.Config{
+		Endpoint: c.URL,
+		Headers:  http.Header{"Authorization": {"Bearer t"}},
+		Resource: export.Resource{Account: "123456789012", Region: "ap-northeast-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.URL() != c.URL+"/v1/logs" {
+		t.Fatalf("URL = %s", sink.URL())
+	}
+	if err := sink.Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.received()) != 0 {
+		t.Fatal("sent before the batch was full")
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.received()
+	if len(got) != 1 || got[0].contentType != "application/x-protobuf" || got[0].header.Get("Authorization") != "Bearer t" {
+		t.Fatalf("requests = %+v", got)
+	}
+
+	req := decode(t, got[0].body)
+	if len(req[1]) != 2 {
+		t.Fatalf("%d resources, want one per stream", len(req[1]))
+	}
+	rl := req.msg(t, 1, 0)
+	res := rl.msg(t, 1, 0).attrs(t, 1)
+	want := map[string]any{
+		"service.name": "api", "cloud.provider": "aws", "cloud.account.id": "123456789012", "cloud.region": "ap-northeast-1",
+		"aws.log.group.names": "/aws/lambda/api", "aws.log.stream.names": "2025/08/31/[$LATEST]abc",
+	}
+	for k, v := range want {
+		if res[k] != v {
+			t.Errorf("resource %s = %v, want %v", k, res[k], v)
+		}
+	}
+	sl := rl.msg(t, 2, 0)
+	if sl.msg(t, 1, 0).str(1) != export.ScopeName {
+		t.Errorf("scope = %q", sl.msg(t, 1, 0).str(1))
+	}
+	lr := sl.msg(t, 2, 0)
+	if lr[1][0].(uint64) != uint64(t0.UnixNano()) || lr[11][0].(uint64) == 0 {
+		t.Errorf("times = %v, %v", lr[1], lr[11])
+	}
+	if lr[2][0].(uint64) != 17 || lr.str(3) != "error" {
+		t.Errorf("severity = %v %q", lr[2], lr.str(3))
+	}
+	if body := lr.msg(t, 5, 0).str(1); !strings.HasPrefix(body, `{"level":"error"`) || strings.HasSuffix(body, "\n") {
+		t.Errorf("body = %q", body)
+	}
+	attrs := lr.attrs(t, 6)
+	if attrs["msg"] != "payment failed" || attrs["attempt"] != int64(3) || attrs["ok"] != false || attrs["log.record.uid"] != "e1" {
+		t.Errorf("attributes = %v", attrs)
+	}
+	if hex.EncodeToString(lr[9][0].([]byte)) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(lr[10][0].([]byte)) != "00f067aa0ba902b7" {
+		t.Errorf("trace context = %x %x", lr[9], lr[10])
+	}
+
+	// The X-Ray trace ID of an unstructured message, without version and dashes.
+	lr = req.msg(t, 1, 1).msg(t, 2, 0).msg(t, 2, 0)
+	if hex.EncodeToString(lr[9][0].([]byte)) != "5759e988bd862e3fe1be46a994272793" || hex.EncodeToString(lr[10][0].([]byte)) != "53995c3f42cd8ad8" {
+		t.Errorf("X-Ray trace context = %x %x", lr[9], lr[10])
+	}
+	if attrs := lr.attrs(t, 6); len(attrs) != 0 {
+		t.Errorf("unstructured message attributes = %v", attrs)
+	}
+}
+
+func TestOTLPHTTPJSON(t *testing.T) {
+	c := newCollector(t)
+	c.reply = []func(http.ResponseWriter){func(w http.ResponseWriter) {
+		io.WriteString(w, `{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"too old"}}`)
+	}}
+	var logs bytes.Buffer
+	sink, err := export.NewOTLP(export.Config{Endpoint: c.URL + "/custom/path", Protocol: export.ProtocolHTTPJSON, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), records[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `msg="OTLP export partially rejected" rejected=1 message="too old"`) {
+		t.Errorf("logs = %s", logs.String())
+	}
+	got := c.received()
+	if len(got) != 1 || got[0].contentType != "application/json" {
+		t.Fatalf("requests = %+v", got)
+	}
+	var req struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano string
+					TraceID      string
+					Body         struct{ StringValue string }
+					Attributes   []struct {
+						Key   string
+						Value map[string]any
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(got[0].body, &req); err != nil {
+		t.Fatal(err)
+	}
+	lr := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if lr.TimeUnixNano != "1756638000000000000" || lr.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || !strings.Contains(lr.Body.StringValue, "payment failed") {
+		t.Fatalf("log record = %+v", lr)
+	}
+	if a := lr.Attributes[0]; a.Key != "attempt" || a.Value["intValue"] != "3" {
+		t.Fatalf("attribute = %+v", a)
+	}
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	c := newCollector(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=team%20a")
+	c.reply = []func(http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			// Trailers-only UNAVAILABLE: retried.
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "14")
+			w.Header().Set("Grpc-Message", "collector%20starting")
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+	sink, err := export.NewOTLP(export.Config{Endpoint: strings.TrimPrefix(c.URL, "http://"), Protocol: export.ProtocolGRPC, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.received()
+	if len(got) != 2 || got[1].header.Get("X-Tenant") != "team a" {
+		t.Fatalf("requests = %+v", got)
+	}
+	if req := decode(t, got[1].body); len(req[1]) != 2 {
+		t.Fatalf("%d resources", len(req[1]))
+	}
+
+	c.reply = []func(http.ResponseWriter){func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "3")
+		w.Header().Set("Grpc-Message", "bad%20record")
+		w.WriteHeader(http.StatusOK)
+	}}
+	sink.Write(context.Background(), records)
+	err = sink.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "grpc status 3: bad record") || len(c.received()) != 3 {
+		t.Fatalf("err = %v after %d requests", err, len(c.received()))
+	}
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	for _, k := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL"} {
+		t.Setenv(k, "")
+	}
+	tests := []struct {
+		endpoint, protocol string
+		env                map[string]string
+		want               string
+	}{
+		{want: "http://localhost:4318/v1/logs"},
+		{protocol: export.ProtocolGRPC, want: "http://localhost:4317/opentelemetry.proto.collector.logs.v1.LogsService/Export"},
+		{endpoint: "https://otel.example.com:4318/", want: "https://otel.example.com:4318/v1/logs"},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, want: "http://collector:4318/v1/logs"},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_LOGS_ENDPOINT": "http://collector:4318/logs"}, want: "http://collector:4318/logs"},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc", "OTEL_EXPORTER_OTLP_ENDPOINT": "collector:4317"}, want: "http://collector:4317/opentelemetry.proto.collector.logs.v1.LogsService/Export"},
+	}
+	for _, tt := range tests {
+		for k, v := range tt.env {
+			t.Setenv(k, v)
+		}
+		sink, err := export.NewOTLP(export.Config{Endpoint: tt.endpoint, Protocol: tt.protocol})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sink.URL() != tt.want {
+			t.Errorf("URL(%q, %q, %v) = %s, want %s", tt.endpoint, tt.protocol, tt.env, sink.URL(), tt.want)
+		}
+		for k := range tt.env {
+			t.Setenv(k, "")
+		}
+	}
+	for _, cfg := range []export.Config{{Protocol: "thrift"}, {Endpoint: "ftp://collector"}} {
+		if _, err := export.NewOTLP(cfg); err == nil {
+			t.Errorf("NewOTLP(%+v) succeeded", cfg)
+		}
+	}
+}
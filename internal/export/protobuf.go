@@ -0,0 +1,94 @@
+package export
+
+import (
+	"encoding/binary"
+	"iter"
+)
+
+// pbuf is a protobuf encoder covering the wire types of the OTLP messages.
+type pbuf []byte
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func (b *pbuf) tag(field, wire int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wire))
+}
+
+func (b *pbuf) varint(field int, v uint64) {
+	b.tag(field, wireVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *pbuf) fixed64(field int, v uint64) {
+	b.tag(field, wireFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, v)
+}
+
+func (b *pbuf) bytes(field int, v []byte) {
+	b.tag(field, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *pbuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+// message writes the embedded message encoded by fn.
+func (b *pbuf) message(field int, fn func(*pbuf)) {
+	var m pbuf
+	fn(&m)
+	b.bytes(field, m)
+}
+
+// pbFields yields the fields of a marshaled message: a uint64 for varint
+// and fixed fields, a []byte for length-delimited ones. It stops at the
+// first malformed field.
+func pbFields(b []byte) iter.Seq2[int, any] {
+	return func(yield func(int, any) bool) {
+		for len(b) > 0 {
+			key, n := binary.Uvarint(b)
+			if n <= 0 {
+				return
+			}
+			b = b[n:]
+			field := int(key >> 3)
+			var v any
+			switch key & 7 {
+			case wireVarint:
+				x, n := binary.Uvarint(b)
+				if n <= 0 {
+					return
+				}
+				v, b = x, b[n:]
+			case wireFixed64:
+				if len(b) < 8 {
+					return
+				}
+				v, b = binary.LittleEndian.Uint64(b), b[8:]
+			case wireFixed32:
+				if len(b) < 4 {
+					return
+				}
+				v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+			case wireBytes:
+				l, n := binary.Uvarint(b)
+				if n <= 0 || uint64(len(b)-n) < l {
+					return
+				}
+				v, b = b[n:n+int(l)], b[n+int(l):]
+			default:
+				return
+			}
+			if !yield(field, v) {
+				return
+			}
+		}
+	}
+}
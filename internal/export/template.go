@@ -0,0 +1,72 @@
+package export
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// TemplateNames lists the placeholders of a Template.
+var TemplateNames = []string{"group", "stream", "service", "account", "region", "date", "month"}
+
+// Template is an index name or label value with {{name}} placeholders
+// replaced per record: the log group and stream, the service (the last path
+// element of the group), the account and region of the Resource, and the
+// record's UTC date (2006.01.02) or month (2006.01).
+type Template struct {
+	// parts alternates literal text and placeholder names, starting with
+	// text.
+	parts []string
+}
+
+// ParseTemplate parses a template, rejecting unknown placeholders.
+func ParseTemplate(s string) (Template, error) {
+	var t Template
+	for {
+		i := strings.Index(s, "{{")
+		if i < 0 {
+			t.parts = append(t.parts, s)
+			return t, nil
+		}
+		j := strings.Index(s[i:], "}}")
+		if j < 0 {
+			return Template{}, fmt.Errorf("unclosed {{ in template %q", s)
+		}
+		name := strings.TrimSpace(s[i+2 : i+j])
+		if !slices.Contains(TemplateNames, name) {
+			return Template{}, fmt.Errorf("unknown placeholder {{%s}}; expected one of %s", name, strings.Join(TemplateNames, ", "))
+		}
+		t.parts = append(t.parts, s[:i], name)
+		s = s[i+j+2:]
+	}
+}
+
+// Expand returns the template for a record.
+func (t Template) Expand(r model.LogRecord, res Resource) string {
+	var b strings.Builder
+	for i, p := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(p)
+			continue
+		}
+		switch p {
+		case "group":
+			b.WriteString(r.LogGroup)
+		case "stream":
+			b.WriteString(r.LogStream)
+		case "service":
+			b.WriteString(serviceName(r.LogGroup))
+		case "account":
+			b.WriteString(res.Account)
+		case "region":
+			b.WriteString(res.Region)
+		case "date":
+			b.WriteString(r.Timestamp.UTC().Format("2006.01.02"))
+		case "month":
+			b.WriteString(r.Timestamp.UTC().Format("2006.01"))
+		}
+	}
+	return b.String()
+}
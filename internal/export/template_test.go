@@ -0,0 +1,35 @@
+package export_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/export"
+)
+
+func TestTemplate(t *testing.T) {
+	res := export.Resource{Account: "123456789012", Region: "ap-northeast-1"}
+	for _, tt := range []struct{ template, want string }{
+		{"", ""},
+		{"static", "static"},
+		{"{{group}}|{{stream}}", "/aws/lambda/api|2025/08/31/[$LATEST]abc"},
+		{"logs-{{ service }}-{{account}}-{{region}}-{{date}}", "logs-api-123456789012-ap-northeast-1-2025.08.31"},
+		{"{{month}}", "2025.08"},
+	} {
+		tmpl, err := export.ParseTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.template, err)
+		}
+		if got := tmpl.Expand(records[0], res); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"{{host}}", "logs-{{date"} {
+		if _, err := export.ParseTemplate(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+	if _, err := export.ParseTemplate("{{host}}"); !strings.Contains(err.Error(), "group, stream") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -3,10 +3,12 @@ package inspector
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
 )
 
@@ -21,11 +23,22 @@ type Inspector struct {
 	startTime time.Time
 	endTime   time.Time
 	workers   int
+	metrics   *metrics.Search
+	log       *slog.Logger
+	progress  Progress
+}
+
+// Progress receives the events of a search; nil functions are skipped.
+// GroupDone is called from the goroutine that searched the group.
+type Progress struct {
+	SearchStarted func(groups []string, start, end time.Time)
+	GroupDone     func(group string, records int, err error)
+	SearchDone    func(records int, err error)
 }
 
 // New creates an Inspector.
 func New(client CloudWatchLogsRetriever, groups []string, startTime, endTime time.Time) *Inspector {
-	return &Inspector{client: client, groups: groups, startTime: startTime, endTime: endTime, workers: 4}
+	return &Inspector{client: client, groups: groups, startTime: startTime, endTime: endTime, workers: 4, log: discard}
 }
 
 // SetWorkers sets the concurrency level for searching groups. Values <= 0 are ignored.
@@ -35,6 +48,28 @@ func (in *Inspector) SetWorkers(n int) {
 	}
 }
 
+// SetMetrics records each Search, its duration and the records it returns in m.
+func (in *Inspector) SetMetrics(m *metrics.Search) {
+	in.metrics = m
+}
+
+// SetLogger writes diagnostics to l: each search at info level and each
+// group at debug level. A nil l discards them.
+func (in *Inspector) SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = discard
+	}
+	in.log = l
+}
+
+// SetProgress reports the progress of each Search to p.
+func (in *Inspector) SetProgress(p Progress) {
+	in.progress = p
+}
+
+// discard is the logger of inspectors without SetLogger.
+var discard = slog.New(slog.DiscardHandler)
+
 // Search finds logs matching the given filter pattern across configured groups.
 func (in *Inspector) Search(ctx context.Context, filterPattern string) ([]model.LogRecord, error) {
 	if len(in.groups) == 0 {
@@ -43,7 +78,27 @@ func (in *Inspector) Search(ctx context.Context, filterPattern string) ([]model.
 	if filterPattern == "" {
 		return nil, errors.New("empty filter pattern")
 	}
+	began := time.Now()
+	in.log.LogAttrs(ctx, slog.LevelDebug, "search started", slog.String("filter", filterPattern), slog.Int("groups", len(in.groups)),
+		slog.Time("start", in.startTime), slog.Time("end", in.endTime))
+	if in.progress.SearchStarted != nil {
+		in.progress.SearchStarted(in.groups, in.startTime, in.endTime)
+	}
+	records, err := in.search(ctx, filterPattern)
+	elapsed := time.Since(began)
+	in.metrics.MultiSearch(len(records), elapsed)
+	if in.progress.SearchDone != nil {
+		in.progress.SearchDone(len(records), err)
+	}
+	if err != nil {
+		in.log.LogAttrs(ctx, slog.LevelInfo, "search failed", slog.Duration("elapsed", elapsed), slog.Any("error", err))
+		return nil, err
+	}
+	in.log.LogAttrs(ctx, slog.LevelInfo, "search finished", slog.Int("groups", len(in.groups)), slog.Int("records", len(records)), slog.Duration("elapsed", elapsed))
+	return records, nil
+}
 
+func (in *Inspector) search(ctx context.Context, filterPattern string) ([]model.LogRecord, error) {
 	startMs := in.startTime.UnixMilli()
 	endMs := in.endTime.UnixMilli()
 
@@ -72,7 +127,13 @@ func (in *Inspector) Search(ctx context.Context, filterPattern string) ([]model.
 		go func() {
 			defer wg.Done()
 			for group := range groupChan {
+				began := time.Now()
 				records, err := in.client.SearchGroup(ctx, group, filterPattern, startMs, endMs)
+				in.log.LogAttrs(ctx, slog.LevelDebug, "group done", slog.String("group", group), slog.Int("records", len(records)),
+					slog.Duration("elapsed", time.Since(began)), slog.Any("error", err))
+				if in.progress.GroupDone != nil {
+					in.progress.GroupDone(group, len(records), err)
+				}
 				if err != nil {
 					// Signal cancellation and report error
 					select {
@@ -134,3 +195,112 @@ done:
 	})
 	return allRecords, nil
 }
+
+// Pager is implemented by retrievers that hand over each page of a group's
+// events as it is fetched, such as the CloudWatch client.
+type Pager interface {
+	SearchGroupPages(ctx context.Context, group, filterPattern string, startMs, endMs int64, token string, fn func(records []model.LogRecord, nextToken string) error) error
+}
+
+// SearchPages is Search without collecting the records: fn receives each
+// page as it arrives, one call at a time, in page order within a group but
+// not sorted across groups. A retriever that is not a Pager yields each
+// group's records as one page. It stops at the first group error or error
+// from fn.
+func (in *Inspector) SearchPages(ctx context.Context, filterPattern string, fn func([]model.LogRecord) error) error {
+	if len(in.groups) == 0 {
+		return errors.New("no log groups configured")
+	}
+	if filterPattern == "" {
+		return errors.New("empty filter pattern")
+	}
+	began := time.Now()
+	in.log.LogAttrs(ctx, slog.LevelDebug, "search started", slog.String("filter", filterPattern), slog.Int("groups", len(in.groups)),
+		slog.Time("start", in.startTime), slog.Time("end", in.endTime))
+	if in.progress.SearchStarted != nil {
+		in.progress.SearchStarted(in.groups, in.startTime, in.endTime)
+	}
+	n, err := in.searchPages(ctx, filterPattern, fn)
+	elapsed := time.Since(began)
+	in.metrics.MultiSearch(n, elapsed)
+	if in.progress.SearchDone != nil {
+		in.progress.SearchDone(n, err)
+	}
+	if err != nil {
+		in.log.LogAttrs(ctx, slog.LevelInfo, "search failed", slog.Duration("elapsed", elapsed), slog.Any("error", err))
+		return err
+	}
+	in.log.LogAttrs(ctx, slog.LevelInfo, "search finished", slog.Int("groups", len(in.groups)), slog.Int("records", n), slog.Duration("elapsed", elapsed))
+	return nil
+}
+
+func (in *Inspector) searchPages(ctx context.Context, filterPattern string, fn func([]model.LogRecord) error) (int, error) {
+	startMs := in.startTime.UnixMilli()
+	endMs := in.endTime.UnixMilli()
+	pager, paged := in.client.(Pager)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	groupChan := make(chan string, len(in.groups))
+	for _, g := range in.groups {
+		groupChan <- g
+	}
+	close(groupChan)
+
+	var (
+		mu       sync.Mutex // serializes fn and guards total
+		total    int
+		firstErr error
+		once     sync.Once
+		wg       sync.WaitGroup
+	)
+	emit := func(records []model.LogRecord) error {
+		if len(records) == 0 {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		total += len(records)
+		return fn(records)
+	}
+	for i := 0; i < min(in.workers, len(in.groups)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range groupChan {
+				began := time.Now()
+				count := 0
+				var err error
+				if paged {
+					err = pager.SearchGroupPages(ctx, group, filterPattern, startMs, endMs, "", func(records []model.LogRecord, _ string) error {
+						count += len(records)
+						return emit(records)
+					})
+				} else {
+					var records []model.LogRecord
+					if records, err = in.client.SearchGroup(ctx, group, filterPattern, startMs, endMs); err == nil {
+						count = len(records)
+						err = emit(records)
+					}
+				}
+				in.log.LogAttrs(ctx, slog.LevelDebug, "group done", slog.String("group", group), slog.Int("records", count),
+					slog.Duration("elapsed", time.Since(began)), slog.Any("error", err))
+				if in.progress.GroupDone != nil {
+					in.progress.GroupDone(group, count, err)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return total, firstErr
+}
@@ -3,11 +3,17 @@ package inspector_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
 )
 
@@ -162,3 +168,129 @@ func TestInspectorSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestInspectorSearchMetrics(t *testing.T) {
+	m := metrics.NewSearch(metrics.NewRegistry())
+	r := &mockRetriever{results: map[string][]model.LogRecord{"/g1": {{Message: "a"}}, "/g2": {{Message: "b"}, {Message: "c"}}}}
+	in := inspector.New(r, []string{"/g1", "/g2"}, time.UnixMilli(0), time.UnixMilli(1))
+	in.SetMetrics(m)
+	if _, err := in.Search(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	if s := m.Summary(); s.Searches != 1 || s.Records != 3 {
+		t.Fatalf("summary = %+v", s)
+	}
+}
+
+func TestInspectorSearchLogger(t *testing.T) {
+	var buf strings.Builder
+	r := &mockRetriever{results: map[string][]model.LogRecord{"/g1": {{Message: "a"}}}}
+	in := inspector.New(r, []string{"/g1", "/g2"}, time.UnixMilli(0), time.UnixMilli(1))
+	in.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	if _, err := in.Search(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, `msg="search finished" groups=2 records=1`) || strings.Contains(out, "group done") {
+		t.Fatalf("info log:\n%s", out)
+	}
+}
+
+func TestInspectorSearchProgress(t *testing.T) {
+	r := &mockRetriever{
+		results: map[string][]model.LogRecord{"/g1": {{Message: "a"}, {Message: "b"}}},
+		errFor:  map[string]error{"/g2": errors.New("boom")},
+	}
+	in := inspector.New(r, []string{"/g1", "/g2"}, time.UnixMilli(0), time.UnixMilli(1))
+	in.SetWorkers(1)
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	in.SetProgress(inspector.Progress{
+		SearchStarted: func(groups []string, start, end time.Time) { record(strings.Join(groups, ",")) },
+		GroupDone: func(group string, records int, err error) {
+			record(group + " " + strconv.Itoa(records) + " " + fmt.Sprint(err))
+		},
+		SearchDone: func(records int, err error) { record("done " + fmt.Sprint(err)) },
+	})
+	if _, err := in.Search(context.Background(), "x"); err == nil {
+		t.Fatal("want the group error")
+	}
+	want := []string{"/g1,/g2", "/g1 2 <nil>", "/g2 0 boom", "done boom"}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+}
+
+// pagedRetriever serves each group's records one per page.
+type pagedRetriever struct {
+	mockRetriever
+}
+
+func (p *pagedRetriever) SearchGroupPages(ctx context.Context, group, filterPattern string, startMs, endMs int64, token string, fn func([]model.LogRecord, string) error) error {
+	records, err := p.SearchGroup(ctx, group, filterPattern, startMs, endMs)
+	if err != nil {
+		return err
+	}
+	for i, r := range records {
+		next := ""
+		if i < len(records)-1 {
+			next = strconv.Itoa(i + 1)
+		}
+		if err := fn([]model.LogRecord{r}, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestInspectorSearchPages(t *testing.T) {
+	results := map[string][]model.LogRecord{
+		"/g1": {{LogGroup: "/g1", Message: "a"}, {LogGroup: "/g1", Message: "b"}},
+		"/g2": {{LogGroup: "/g2", Message: "c"}},
+	}
+	for _, r := range []inspector.CloudWatchLogsRetriever{
+		&pagedRetriever{mockRetriever{results: results}},
+		&mockRetriever{results: results},
+	} {
+		in := inspector.New(r, []string{"/g1", "/g2"}, time.UnixMilli(0), time.UnixMilli(1000))
+		var pages []string
+		err := in.SearchPages(context.Background(), "x", func(records []model.LogRecord) error {
+			var msgs []string
+			for _, rec := range records {
+				msgs = append(msgs, rec.Message)
+			}
+			pages = append(pages, strings.Join(msgs, ""))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "[a b c]"
+		if _, paged := r.(*pagedRetriever); !paged {
+			want = "[ab c]" // one page per group
+		}
+		slices.Sort(pages)
+		if got := fmt.Sprint(pages); got != want {
+			t.Errorf("%T pages = %s, want %s", r, got, want)
+		}
+	}
+
+	boom := errors.New("boom")
+	in := inspector.New(&pagedRetriever{mockRetriever{results: results, errFor: map[string]error{"/g2": boom}}}, []string{"/g1", "/g2"}, time.UnixMilli(0), time.UnixMilli(1000))
+	if err := in.SearchPages(context.Background(), "x", func([]model.LogRecord) error { return nil }); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	in = inspector.New(&pagedRetriever{mockRetriever{results: results}}, []string{"/g1"}, time.UnixMilli(0), time.UnixMilli(1000))
+	calls := 0
+	err := in.SearchPages(context.Background(), "x", func([]model.LogRecord) error {
+		calls++
+		return boom
+	})
+	if !errors.Is(err, boom) || calls != 1 {
+		t.Fatalf("err = %v after %d calls; want %v after 1", err, calls, boom)
+	}
+}
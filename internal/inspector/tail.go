@@ -0,0 +1,83 @@
+package inspector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// TailOverlap is how far each tail poll reaches back before the end of the
+// previous one, so that events ingested late are still picked up.
+const TailOverlap = time.Minute
+
+// Tail searches from the configured start time to now, then keeps polling
+// every interval for newer records until ctx is canceled. emit receives each
+// batch of records not delivered before, in chronological order. Returning an
+// error from emit stops tailing with that error.
+func (in *Inspector) Tail(ctx context.Context, filterPattern string, interval time.Duration, emit func([]model.LogRecord) error) error {
+	if interval <= 0 {
+		return errors.New("tail interval must be positive")
+	}
+	from := in.startTime
+	seen := map[recordKey]time.Time{}
+	for {
+		end := time.Now()
+		window := *in
+		window.startTime = from
+		window.endTime = end
+		records, err := window.Search(ctx, filterPattern)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var fresh []model.LogRecord
+		for _, r := range records {
+			k := keyOf(r)
+			if _, ok := seen[k]; ok || r.Timestamp.Before(from) {
+				continue
+			}
+			seen[k] = r.Timestamp
+			fresh = append(fresh, r)
+		}
+		if len(fresh) > 0 {
+			if err := emit(fresh); err != nil {
+				return err
+			}
+		}
+
+		// Next poll overlaps the end of this one, whether or not it found
+		// anything; forget records that fall out of it.
+		if next := end.Add(-TailOverlap); next.After(from) {
+			from = next
+		}
+		for k, ts := range seen {
+			if ts.Before(from) {
+				delete(seen, k)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// recordKey identifies a record across overlapping polls.
+type recordKey struct {
+	group, stream, eventID, message string
+	ts                              int64
+}
+
+func keyOf(r model.LogRecord) recordKey {
+	if r.EventID != "" {
+		return recordKey{group: r.LogGroup, eventID: r.EventID}
+	}
+	return recordKey{group: r.LogGroup, stream: r.LogStream, message: r.Message, ts: r.Timestamp.UnixMilli()}
+}
@@ -0,0 +1,107 @@
+package inspector_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// pollRetriever returns the next scripted page on each call.
+type pollRetriever struct {
+	mu    sync.Mutex
+	pages [][]model.LogRecord
+	calls []searchCall
+}
+
+func (p *pollRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, searchCall{group: group, filter: filterPattern, startMs: startMs, endMs: endMs})
+	if len(p.calls) > len(p.pages) {
+		return nil, nil
+	}
+	return p.pages[len(p.calls)-1], nil
+}
+
+func TestTail(t *testing.T) {
+	base := time.Now().Add(-10 * time.Minute)
+	r1 := model.LogRecord{Timestamp: base, LogGroup: "/g", LogStream: "s", Message: "one", EventID: "1"}
+	// Later polls reach back TailOverlap before the previous end
+	r2 := model.LogRecord{Timestamp: time.Now(), LogGroup: "/g", LogStream: "s", Message: "two", EventID: "2"}
+	r3 := model.LogRecord{Timestamp: r2.Timestamp, LogGroup: "/g", LogStream: "s", Message: "three"}
+	p := &pollRetriever{pages: [][]model.LogRecord{{r1}, {r1, r2}, {r2, r3}}}
+	in := inspector.New(p, []string{"/g"}, base.Add(-time.Minute), base)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []string
+	err := in.Tail(ctx, "x", time.Millisecond, func(recs []model.LogRecord) error {
+		for _, r := range recs {
+			got = append(got, r.Message)
+		}
+		if len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 3 || got[0] != "one" || got[1] != "two" || got[2] != "three" {
+		t.Fatalf("emitted = %v", got)
+	}
+	if p.calls[0].startMs != base.Add(-time.Minute).UnixMilli() {
+		t.Fatalf("first poll start = %d", p.calls[0].startMs)
+	}
+	if want := p.calls[1].endMs - inspector.TailOverlap.Milliseconds(); p.calls[2].startMs != want {
+		t.Fatalf("third poll start = %d, want %d", p.calls[2].startMs, want)
+	}
+}
+
+// emptyRetriever finds nothing and cancels the tail after stop calls.
+type emptyRetriever struct {
+	pollRetriever
+	stop   int
+	cancel context.CancelFunc
+}
+
+func (e *emptyRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	e.pollRetriever.SearchGroup(ctx, group, filterPattern, startMs, endMs)
+	if len(e.calls) == e.stop {
+		e.cancel()
+	}
+	return nil, nil
+}
+
+func TestTailEmptyPollsAdvance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := &emptyRetriever{stop: 3, cancel: cancel}
+	start := time.Now().Add(-time.Hour)
+	in := inspector.New(e, []string{"/g"}, start, time.Now())
+	if err := in.Tail(ctx, "rare", time.Millisecond, func([]model.LogRecord) error { return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(e.calls) != 3 || e.calls[0].startMs != start.UnixMilli() {
+		t.Fatalf("calls = %+v", e.calls)
+	}
+	for i := 1; i < len(e.calls); i++ {
+		if want := e.calls[i-1].endMs - inspector.TailOverlap.Milliseconds(); e.calls[i].startMs != want {
+			t.Fatalf("poll %d start = %d, want %d (the previous end less the overlap)", i, e.calls[i].startMs, want)
+		}
+	}
+}
+
+func TestTailEmitError(t *testing.T) {
+	p := &pollRetriever{pages: [][]model.LogRecord{{{Timestamp: time.Now(), LogGroup: "/g", Message: "m"}}}}
+	in := inspector.New(p, []string{"/g"}, time.Now().Add(-time.Minute), time.Now())
+	want := errors.New("stop")
+	if err := in.Tail(context.Background(), "x", time.Millisecond, func([]model.LogRecord) error { return want }); !errors.Is(err, want) {
+		t.Fatalf("err = %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,152 @@
+package invocation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+)
+
+// LambdaGroupPrefix is the log group prefix used by AWS Lambda functions.
+const LambdaGroupPrefix = "/aws/lambda/"
+
+// MaxDuration is the longest a Lambda invocation can run; stream searches for a
+// request ID are limited to this distance around the matched record.
+const MaxDuration = 15 * time.Minute
+
+// StreamRetriever searches a single log stream.
+type StreamRetriever interface {
+	SearchStream(ctx context.Context, group, stream, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error)
+}
+
+// Report holds the metrics of a Lambda REPORT line.
+type Report struct {
+	DurationMs       float64
+	BilledDurationMs float64
+	MemorySizeMB     float64
+	MaxMemoryUsedMB  float64
+	InitDurationMs   float64 `json:",omitempty"`
+}
+
+// Invocation is every log line written by one Lambda request.
+type Invocation struct {
+	RequestID string
+	LogGroup  string
+	LogStream string
+	Start     time.Time
+	End       time.Time
+	// ColdStart is true when the REPORT line carries an Init Duration.
+	ColdStart bool
+	Report    *Report `json:",omitempty"`
+	Records   []model.LogRecord
+}
+
+var requestIDRe = regexp.MustCompile(`(?i)request ?id:? ?"?([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})`)
+
+// RequestID returns the Lambda request ID mentioned by a log message, if any.
+// Platform and runtime lines are recognized through the lambda parser; JSON
+// messages may carry "requestId" or "aws_request_id".
+func RequestID(message string) (string, bool) {
+	if m, ok := parser.Parse(parser.FormatLambda, message).(map[string]any); ok {
+		if id, ok := m["requestId"].(string); ok && id != "" {
+			return id, true
+		}
+	}
+	if m, ok := parser.Parse(parser.FormatJSON, message).(map[string]any); ok {
+		for _, k := range []string{"requestId", "aws_request_id", "AWSRequestId"} {
+			if id, ok := m[k].(string); ok && id != "" {
+				return id, true
+			}
+		}
+	}
+	if m := requestIDRe.FindStringSubmatch(message); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// Reconstruct gathers the full invocation for every record in a Lambda log
+// group whose request ID can be determined. Records sharing a request ID are
+// reconstructed once. The result is ordered by invocation start time.
+func Reconstruct(ctx context.Context, r StreamRetriever, records []model.LogRecord) ([]Invocation, error) {
+	type key struct{ group, stream, id string }
+	seen := map[key]bool{}
+	var out []Invocation
+	for _, rec := range records {
+		if !strings.HasPrefix(rec.LogGroup, LambdaGroupPrefix) {
+			continue
+		}
+		id, ok := RequestID(rec.Message)
+		if !ok {
+			continue
+		}
+		k := key{rec.LogGroup, rec.LogStream, id}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		startMs := rec.Timestamp.Add(-MaxDuration).UnixMilli()
+		endMs := rec.Timestamp.Add(MaxDuration).UnixMilli()
+		lines, err := r.SearchStream(ctx, rec.LogGroup, rec.LogStream, fmt.Sprintf("%q", id), startMs, endMs)
+		if err != nil {
+			return nil, fmt.Errorf("request %s: %w", id, err)
+		}
+		if len(lines) == 0 {
+			lines = []model.LogRecord{rec}
+		}
+		out = append(out, Build(id, lines))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, nil
+}
+
+// Build assembles an Invocation from the log lines of a single request.
+func Build(id string, lines []model.LogRecord) Invocation {
+	sorted := append([]model.LogRecord(nil), lines...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+	inv := Invocation{
+		RequestID: id,
+		LogGroup:  sorted[0].LogGroup,
+		LogStream: sorted[0].LogStream,
+		Start:     sorted[0].Timestamp,
+		End:       sorted[len(sorted)-1].Timestamp,
+		Records:   sorted,
+	}
+	for _, l := range sorted {
+		if !strings.HasPrefix(l.Message, "REPORT RequestId:") {
+			continue
+		}
+		m := parser.ParseLambdaReport(l.Message)
+		rep := &Report{}
+		rep.DurationMs, _ = m["durationMs"].(float64)
+		rep.BilledDurationMs, _ = m["billedDurationMs"].(float64)
+		rep.MemorySizeMB, _ = m["memorySizeMB"].(float64)
+		rep.MaxMemoryUsedMB, _ = m["maxMemoryUsedMB"].(float64)
+		rep.InitDurationMs, _ = m["initDurationMs"].(float64)
+		_, inv.ColdStart = m["initDurationMs"]
+		inv.Report = rep
+	}
+	return inv
+}
+
+// Summary renders the header line of the grouped invocation view.
+func (inv Invocation) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "== %s/%s RequestId: %s", inv.LogGroup, inv.LogStream, inv.RequestID)
+	if inv.Report == nil {
+		b.WriteString(" (no REPORT line)")
+		return b.String()
+	}
+	fmt.Fprintf(&b, " duration=%.2fms billed=%.0fms memory=%.0f/%.0fMB",
+		inv.Report.DurationMs, inv.Report.BilledDurationMs, inv.Report.MaxMemoryUsedMB, inv.Report.MemorySizeMB)
+	if inv.ColdStart {
+		fmt.Fprintf(&b, " cold-start init=%.2fms", inv.Report.InitDurationMs)
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package invocation_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/invocation"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+const reqID = "8f5c3b1a-1234-4cde-9abc-0123456789ab"
+
+type streamCall struct {
+	group, stream, filter string
+	startMs, endMs        int64
+}
+
+type mockStreams struct {
+	lines []model.LogRecord
+	err   error
+	calls []streamCall
+}
+
+func (m *mockStreams) SearchStream(ctx context.Context, group, stream, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	m.calls = append(m.calls, streamCall{group, stream, filterPattern, startMs, endMs})
+	return m.lines, m.err
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    string
+		want   string
+		wantOK bool
+	}{
+		{"runtime line", "2024-01-01T00:00:00.000Z\t" + reqID + "\tERROR\tboom", reqID, true},
+		{"platform line", "END RequestId: " + reqID, reqID, true},
+		{"json log", `{"level":"ERROR","requestId":"` + reqID + `"}`, reqID, true},
+		{"free text", "Task timed out; RequestId: " + reqID, reqID, true},
+		{"none", "plain error", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := invocation.RequestID(tt.msg)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("RequestID = (%q,%v), want (%q,%v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+	g := "/aws/lambda/fn"
+	base := time.UnixMilli(1700000000000)
+	lines := []model.LogRecord{
+		{Timestamp: base.Add(300 * time.Millisecond), LogGroup: g, LogStream: "s", Message: "REPORT RequestId: " + reqID + "\tDuration: 250.00 ms\tBilled Duration: 251 ms\tMemory Size: 256 MB\tMax Memory Used: 90 MB\tInit Duration: 410.12 ms"},
+		{Timestamp: base, LogGroup: g, LogStream: "s", Message: "START RequestId: " + reqID + " Version: $LATEST"},
+		{Timestamp: base.Add(100 * time.Millisecond), LogGroup: g, LogStream: "s", Message: "2024-01-01T00:00:00.000Z\t" + reqID + "\tERROR\tboom"},
+		{Timestamp: base.Add(300 * time.Millisecond), LogGroup: g, LogStream: "s", Message: "END RequestId: " + reqID},
+	}
+	matched := []model.LogRecord{
+		lines[2],
+		lines[2], // duplicate request ID is reconstructed once
+		{Timestamp: base, LogGroup: "/aws/ecs/svc", LogStream: "x", Message: "2024-01-01T00:00:00.000Z\t" + reqID + "\tERROR\tboom"},
+	}
+	m := &mockStreams{lines: lines}
+
+	invs, err := invocation.Reconstruct(context.Background(), m, matched)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m.calls) != 1 {
+		t.Fatalf("SearchStream calls = %d, want 1", len(m.calls))
+	}
+	c := m.calls[0]
+	if c.group != g || c.stream != "s" || c.filter != `"`+reqID+`"` {
+		t.Fatalf("call = %+v", c)
+	}
+	wantStart := lines[2].Timestamp.Add(-invocation.MaxDuration).UnixMilli()
+	if c.startMs != wantStart || c.endMs != lines[2].Timestamp.Add(invocation.MaxDuration).UnixMilli() {
+		t.Fatalf("window = (%d,%d)", c.startMs, c.endMs)
+	}
+	if len(invs) != 1 {
+		t.Fatalf("invocations = %d, want 1", len(invs))
+	}
+	inv := invs[0]
+	if !strings.HasPrefix(inv.Records[0].Message, "START") || len(inv.Records) != 4 {
+		t.Fatalf("records not ordered: %+v", inv.Records)
+	}
+	if inv.Report == nil || inv.Report.DurationMs != 250 || inv.Report.BilledDurationMs != 251 || inv.Report.MaxMemoryUsedMB != 90 {
+		t.Fatalf("report = %+v", inv.Report)
+	}
+	if !inv.ColdStart || inv.Report.InitDurationMs != 410.12 {
+		t.Fatalf("cold start not detected: %+v", inv)
+	}
+	if !strings.Contains(inv.Summary(), "cold-start init=410.12ms") {
+		t.Fatalf("summary = %q", inv.Summary())
+	}
+}
+
+func TestReconstructPropagatesError(t *testing.T) {
+	m := &mockStreams{err: errors.New("boom")}
+	recs := []model.LogRecord{{LogGroup: "/aws/lambda/fn", LogStream: "s", Message: "END RequestId: " + reqID}}
+	if _, err := invocation.Reconstruct(context.Background(), m, recs); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBuildWarmStart(t *testing.T) {
+	inv := invocation.Build(reqID, []model.LogRecord{{Message: "REPORT RequestId: " + reqID + "\tDuration: 1.00 ms\tBilled Duration: 1 ms\tMemory Size: 128 MB\tMax Memory Used: 60 MB"}})
+	if inv.ColdStart || inv.Report == nil {
+		t.Fatalf("invocation = %+v", inv)
+	}
+}
@@ -0,0 +1,223 @@
+// Package metrics keeps counters and histograms and writes them in the
+// Prometheus text exposition format, without depending on a Prometheus
+// client. Metric methods are safe for concurrent use and do nothing on a nil
+// metric, so code can be instrumented unconditionally.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds, used for
+// request and search durations.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Registry holds metrics in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric struct {
+	name, help, kind string
+	labels           []string
+	buckets          []float64
+	series           map[string]*series
+}
+
+// series is one label combination: value for a counter; counts (per bucket,
+// not cumulative), sum and count for a histogram.
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func (r *Registry) register(m *metric) *metric {
+	m.series = map[string]*series{}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the series of labelValues, creating it; r.mu must be held.
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing value per label combination.
+type Counter struct {
+	r *Registry
+	m *metric
+}
+
+// Counter registers a counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r: r, m: r.register(&metric{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// Add adds v to the series of labelValues.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.m.get(labelValues).value += v
+}
+
+// Inc adds 1 to the series of labelValues.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the value of the series of labelValues.
+func (c *Counter) Value(labelValues ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	return c.m.get(labelValues).value
+}
+
+// Histogram counts observations into buckets per label combination.
+type Histogram struct {
+	r *Registry
+	m *metric
+}
+
+// Histogram registers a histogram with the given bucket upper bounds
+// (ascending; +Inf is implied) and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r: r, m: r.register(&metric{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// Observe records v in the series of labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.m.get(labelValues)
+	if i := sort.SearchFloat64s(h.m.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Sum returns the sum and number of the observations of labelValues.
+func (h *Histogram) Sum(labelValues ...string) (float64, uint64) {
+	if h == nil {
+		return 0, 0
+	}
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.m.get(labelValues)
+	return s.sum, s.count
+}
+
+// WriteText writes every metric in the Prometheus text format (version
+// 0.0.4). Series are ordered by label values; a metric without labels is
+// written even before its first update.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	for _, m := range r.metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, escapeHelp(m.help), m.name, m.kind)
+		if len(m.labels) == 0 {
+			m.get(nil)
+		}
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := m.series[k]
+			if m.kind == "counter" {
+				fmt.Fprintf(&b, "%s%s %s\n", m.name, labelText(m.labels, s.labelValues, ""), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, le := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, labelText(m.labels, s.labelValues, formatFloat(le)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, labelText(m.labels, s.labelValues, "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", m.name, labelText(m.labels, s.labelValues, ""), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", m.name, labelText(m.labels, s.labelValues, ""), s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics for Prometheus scrapes.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// labelText formats {name="value",...}, adding le when set.
+func labelText(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, n := range names {
+		pairs = append(pairs, n+`="`+escapeLabel(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,90 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("requests_total", "Requests.", "group")
+	h := r.Histogram("duration_seconds", "Request\nduration.", []float64{0.1, 1}, "group")
+	r.Counter("runs_total", "Runs.")
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Inc(`/aws/lambda/"a"`)
+		}()
+	}
+	wg.Wait()
+	c.Add(2, "/b")
+	h.Observe(0.05, "/b")
+	h.Observe(0.1, "/b")
+	h.Observe(3, "/b")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{group="/aws/lambda/\"a\""} 10
+requests_total{group="/b"} 2
+# HELP duration_seconds Request\nduration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{group="/b",le="0.1"} 2
+duration_seconds_bucket{group="/b",le="1"} 2
+duration_seconds_bucket{group="/b",le="+Inf"} 3
+duration_seconds_sum{group="/b"} 3.15
+duration_seconds_count{group="/b"} 3
+# HELP runs_total Runs.
+# TYPE runs_total counter
+runs_total 0
+`
+	if b.String() != want {
+		t.Fatalf("text =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") || !strings.Contains(rec.Body.String(), "runs_total 0") {
+		t.Fatalf("content type %q body %q", ct, rec.Body.String())
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var c *metrics.Counter
+	var h *metrics.Histogram
+	var s *metrics.Search
+	c.Inc("x")
+	h.Observe(1)
+	s.Request("/g", 1, 0, 0, false)
+	s.GroupSearch("/g", time.Second)
+	if sum := s.Summary(); sum.Searches != 0 || len(sum.Groups) != 0 {
+		t.Fatalf("nil summary = %+v", sum)
+	}
+}
+
+func TestSearchSummary(t *testing.T) {
+	s := metrics.NewSearch(metrics.NewRegistry())
+	s.Request("/b", 5, 1, 1, false)
+	s.Request("/a", 2, 0, 0, false)
+	s.Request("/a", 0, 2, 1, true)
+	s.GroupSearch("/a", 2*time.Second)
+	s.MultiSearch(7, 3*time.Second)
+	sum := s.Summary()
+	if sum.Searches != 1 || sum.SearchSeconds != 3 || sum.Records != 7 || len(sum.Groups) != 2 || sum.Groups[0].Group != "/a" {
+		t.Fatalf("summary = %+v", sum)
+	}
+	want := metrics.GroupSummary{Searches: 1, Seconds: 2, Pages: 2, Events: 7, Retries: 3, Throttles: 2, Errors: 1}
+	if sum.Total != want {
+		t.Fatalf("total = %+v, want %+v", sum.Total, want)
+	}
+}
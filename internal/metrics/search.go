@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Namespace prefixes the metric names of this program.
+const Namespace = "aws_multi_log_inspector"
+
+// Search holds the metrics of CloudWatch Logs searches: FilterLogEvents
+// requests and group searches by log group, and multi-group searches.
+type Search struct {
+	GroupSearches  *Counter
+	GroupDuration  *Histogram
+	Pages          *Counter
+	Events         *Counter
+	Retries        *Counter
+	Throttles      *Counter
+	Errors         *Counter
+	Searches       *Counter
+	SearchDuration *Histogram
+	SearchRecords  *Counter
+
+	registry *Registry
+	mu       sync.Mutex
+	// groups holds the groups seen, for Summary.
+	groups map[string]bool
+}
+
+// NewSearch registers the search metrics in r.
+func NewSearch(r *Registry) *Search {
+	return &Search{
+		registry:       r,
+		GroupSearches:  r.Counter(Namespace+"_group_searches_total", "Searches of a single log group (CloudWatchClient.SearchGroup).", "group"),
+		GroupDuration:  r.Histogram(Namespace+"_group_search_duration_seconds", "Duration of single log group searches, including every page.", DefaultBuckets, "group"),
+		Pages:          r.Counter(Namespace+"_pages_total", "FilterLogEvents responses.", "group"),
+		Events:         r.Counter(Namespace+"_events_total", "Events returned by FilterLogEvents.", "group"),
+		Retries:        r.Counter(Namespace+"_retries_total", "FilterLogEvents requests retried by the AWS SDK.", "group"),
+		Throttles:      r.Counter(Namespace+"_throttles_total", "FilterLogEvents attempts refused by throttling.", "group"),
+		Errors:         r.Counter(Namespace+"_errors_total", "FilterLogEvents requests that failed after any retries.", "group"),
+		Searches:       r.Counter(Namespace+"_searches_total", "Multi-group searches (Inspector.Search)."),
+		SearchDuration: r.Histogram(Namespace+"_search_duration_seconds", "Duration of multi-group searches.", DefaultBuckets),
+		SearchRecords:  r.Counter(Namespace+"_search_records_total", "Records returned by multi-group searches."),
+		groups:         map[string]bool{},
+	}
+}
+
+// Registry returns the registry holding the metrics.
+func (s *Search) Registry() *Registry {
+	return s.registry
+}
+
+// Request records one FilterLogEvents request of group: the events returned,
+// the attempts retried and throttled, and whether it failed.
+func (s *Search) Request(group string, events, retries, throttles int, failed bool) {
+	if s == nil {
+		return
+	}
+	s.seen(group)
+	if failed {
+		s.Errors.Inc(group)
+	} else {
+		s.Pages.Inc(group)
+		s.Events.Add(float64(events), group)
+	}
+	s.Retries.Add(float64(retries), group)
+	s.Throttles.Add(float64(throttles), group)
+}
+
+// GroupSearch records a search of group that took d.
+func (s *Search) GroupSearch(group string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.seen(group)
+	s.GroupSearches.Inc(group)
+	s.GroupDuration.Observe(d.Seconds(), group)
+}
+
+// MultiSearch records a multi-group search returning records that took d.
+func (s *Search) MultiSearch(records int, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.Searches.Inc()
+	s.SearchDuration.Observe(d.Seconds())
+	s.SearchRecords.Add(float64(records))
+}
+
+func (s *Search) seen(group string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups[group] = true
+}
+
+// Summary is a run's search telemetry, for one-shot commands.
+type Summary struct {
+	Searches      int
+	SearchSeconds float64
+	Records       int
+	// Total sums Groups.
+	Total  GroupSummary
+	Groups []GroupSummary
+}
+
+// GroupSummary is the telemetry of one log group.
+type GroupSummary struct {
+	Group     string `json:",omitempty"`
+	Searches  int
+	Seconds   float64
+	Pages     int
+	Events    int
+	Retries   int
+	Throttles int
+	Errors    int
+}
+
+// Summary returns the totals so far, groups ordered by name.
+func (s *Search) Summary() Summary {
+	var sum Summary
+	if s == nil {
+		return sum
+	}
+	seconds, count := s.SearchDuration.Sum()
+	sum.Searches, sum.SearchSeconds, sum.Records = int(count), seconds, int(s.SearchRecords.Value())
+
+	s.mu.Lock()
+	groups := make([]string, 0, len(s.groups))
+	for g := range s.groups {
+		groups = append(groups, g)
+	}
+	s.mu.Unlock()
+	sort.Strings(groups)
+
+	for _, g := range groups {
+		gs := GroupSummary{
+			Group:     g,
+			Searches:  int(s.GroupSearches.Value(g)),
+			Pages:     int(s.Pages.Value(g)),
+			Events:    int(s.Events.Value(g)),
+			Retries:   int(s.Retries.Value(g)),
+			Throttles: int(s.Throttles.Value(g)),
+			Errors:    int(s.Errors.Value(g)),
+		}
+		gs.Seconds, _ = s.GroupDuration.Sum(g)
+		sum.Groups = append(sum.Groups, gs)
+		t := &sum.Total
+		t.Searches += gs.Searches
+		t.Seconds += gs.Seconds
+		t.Pages += gs.Pages
+		t.Events += gs.Events
+		t.Retries += gs.Retries
+		t.Throttles += gs.Throttles
+		t.Errors += gs.Errors
+	}
+	return sum
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// LogGroup describes a CloudWatch Logs log group.
+type LogGroup struct {
+	Name          string
+	CreationTime  time.Time
+	RetentionDays int32 `json:",omitempty"`
+	StoredBytes   int64
+}
+
+// LogStream describes a log stream within a group.
+type LogStream struct {
+	LogGroup       string
+	Name           string
+	FirstEventTime time.Time
+	LastEventTime  time.Time
+}
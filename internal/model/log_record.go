@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // LogRecord represents a single log entry matched across groups.
 type LogRecord struct {
@@ -8,4 +11,18 @@ type LogRecord struct {
 	LogGroup  string
 	LogStream string
 	Message   string
+	// EventID is the CloudWatch event ID, unique within the group.
+	EventID string `json:",omitempty"`
+	// Fields holds the structured form of Message when a parser was applied.
+	Fields any `json:",omitempty"`
+}
+
+// maskRun is the shortest run of asterisks taken as masking. CloudWatch Logs
+// data protection replaces each matched value with asterisks.
+const maskRun = "****"
+
+// Masked reports whether Message looks masked by a data protection policy,
+// so values extracted from it may be asterisks rather than data.
+func (r LogRecord) Masked() bool {
+	return strings.Contains(r.Message, maskRun)
 }
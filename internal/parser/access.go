@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// apigwCLFRe matches the Common Log Format suggested by the API Gateway console:
+// $context.identity.sourceIp $context.identity.caller $context.identity.user
+// [$context.requestTime] "$context.httpMethod $context.resourcePath $context.protocol"
+// $context.status $context.responseLength $context.requestId
+var apigwCLFRe = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "(\S+) (\S+) ([^"]+)" (\d{3}|-) (\d+|-) (\S+)`)
+
+// apigwExecRe matches API Gateway execution log lines: "(requestId) text".
+var apigwExecRe = regexp.MustCompile(`^\(([0-9a-fA-F-]{36})\) (.*)$`)
+
+// parseAPIGW handles API Gateway access logs in CLF and execution log lines.
+// JSON access logs are handled by the JSON parser.
+func parseAPIGW(raw string) (any, bool) {
+	line := strings.TrimSpace(raw)
+	if m := apigwCLFRe.FindStringSubmatch(line); m != nil {
+		return map[string]any{
+			"sourceIp":       m[1],
+			"caller":         m[2],
+			"user":           m[3],
+			"requestTime":    m[4],
+			"httpMethod":     m[5],
+			"resourcePath":   m[6],
+			"protocol":       m[7],
+			"status":         number(m[8]),
+			"responseLength": number(m[9]),
+			"requestId":      m[10],
+			"message":        raw,
+		}, true
+	}
+	if m := apigwExecRe.FindStringSubmatch(line); m != nil {
+		return map[string]any{"requestId": m[1], "body": m[2], "message": raw}, true
+	}
+	return nil, false
+}
+
+// vpcFlowFields are the fields of the default (version 2) VPC Flow Logs format.
+var vpcFlowFields = []string{
+	"version", "accountId", "interfaceId", "srcaddr", "dstaddr", "srcport", "dstport",
+	"protocol", "packets", "bytes", "start", "end", "action", "logStatus",
+}
+
+// parseVPCFlow handles VPC Flow Logs records in the default format.
+func parseVPCFlow(raw string) (any, bool) {
+	parts := strings.Fields(raw)
+	if len(parts) != len(vpcFlowFields) || parts[0] != "2" {
+		return nil, false
+	}
+	switch parts[12] {
+	case "ACCEPT", "REJECT", "-":
+	default:
+		return nil, false
+	}
+	out := map[string]any{"message": raw}
+	for i, name := range vpcFlowFields {
+		switch name {
+		case "accountId", "interfaceId", "srcaddr", "dstaddr", "action", "logStatus":
+			out[name] = parts[i]
+		default:
+			out[name] = number(parts[i])
+		}
+	}
+	return out, true
+}
+
+// albFields are the documented fields of ALB access log entries, in order.
+var albFields = []string{
+	"type", "time", "elb", "client", "target", "requestProcessingTime", "targetProcessingTime",
+	"responseProcessingTime", "elbStatusCode", "targetStatusCode", "receivedBytes", "sentBytes",
+	"request", "userAgent", "sslCipher", "sslProtocol", "targetGroupArn", "traceId", "domainName",
+	"chosenCertArn", "matchedRulePriority", "requestCreationTime", "actionsExecuted", "redirectUrl",
+	"errorReason", "targetPortList", "targetStatusCodeList", "classification", "classificationReason",
+	"connTraceId",
+}
+
+var albNumeric = map[string]bool{
+	"requestProcessingTime": true, "targetProcessingTime": true, "responseProcessingTime": true,
+	"elbStatusCode": true, "targetStatusCode": true, "receivedBytes": true, "sentBytes": true,
+}
+
+var albTypes = map[string]bool{"http": true, "https": true, "h2": true, "grpcs": true, "ws": true, "wss": true}
+
+// parseALB handles Application Load Balancer access log entries.
+func parseALB(raw string) (any, bool) {
+	parts := splitQuoted(raw)
+	if len(parts) < 13 || !albTypes[parts[0]] || !strings.Contains(parts[1], "T") {
+		return nil, false
+	}
+	out := map[string]any{"message": raw}
+	for i, p := range parts {
+		if i >= len(albFields) {
+			break
+		}
+		name := albFields[i]
+		if albNumeric[name] {
+			out[name] = number(p)
+		} else {
+			out[name] = p
+		}
+	}
+	if req := strings.Fields(parts[12]); len(req) == 3 {
+		out["method"], out["url"], out["protocol"] = req[0], req[1], req[2]
+	}
+	return out, true
+}
+
+// parseLogfmt handles key=value lines. Every token must be a pair (or a bare
+// key, which is set to true) and at least one token must contain '='.
+func parseLogfmt(raw string) (any, bool) {
+	return logfmt(raw, 1)
+}
+
+// detectLogfmt is parseLogfmt for auto-detection, which takes two pairs so
+// that plain text with a single '=' is left alone.
+func detectLogfmt(raw string) (any, bool) {
+	return logfmt(raw, 2)
+}
+
+// logfmt parses a key=value line with at least minPairs pairs. "message" is
+// the raw line; a message key is kept in "body".
+func logfmt(raw string, minPairs int) (any, bool) {
+	tokens := splitQuoted(raw)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	out := map[string]any{}
+	pairs := 0
+	for _, t := range tokens {
+		i := strings.IndexByte(t, '=')
+		switch {
+		case i == 0:
+			return nil, false
+		case i < 0:
+			if !isIdent(t) {
+				return nil, false
+			}
+			out[t] = true
+		default:
+			if !isIdent(t[:i]) {
+				return nil, false
+			}
+			out[t[:i]] = t[i+1:]
+			pairs++
+		}
+	}
+	if pairs < minPairs {
+		return nil, false
+	}
+	if v, exists := out["message"]; exists {
+		if _, taken := out["body"]; !taken {
+			out["body"] = v
+		}
+	}
+	out["message"] = raw
+	return out, true
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// number converts s to float64 (matching encoding/json) or returns s unchanged.
+func number(s string) any {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return f
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	lambdaPlatformRe  = regexp.MustCompile(`^(START|END|REPORT) RequestId: ([0-9a-fA-F-]+)`)
+	lambdaRequestIDRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	lambdaLevels      = map[string]bool{"TRACE": true, "DEBUG": true, "INFO": true, "WARN": true, "WARNING": true, "ERROR": true, "FATAL": true, "CRITICAL": true}
+)
+
+// parseLambda understands the Lambda platform lines (START/END/REPORT) and the
+// tab-separated runtime format used by the Node.js and Python runtimes:
+//
+//	2024-01-01T00:00:00.000Z\t<requestId>\tERROR\t<body>
+//	[ERROR]\t2024-01-01T00:00:00.000Z\t<requestId>\t<body>
+//
+// The body is kept in "body" and a JSON body is decoded into "data"; "message"
+// is the raw line, as for unparsed messages.
+func parseLambda(raw string) (any, bool) {
+	line := strings.TrimRight(raw, "\r\n")
+	if m := lambdaPlatformRe.FindStringSubmatch(line); m != nil {
+		out := map[string]any{
+			"type":      strings.ToLower(m[1]),
+			"requestId": m[2],
+			"message":   raw,
+		}
+		if m[1] == "REPORT" {
+			for k, v := range ParseLambdaReport(line) {
+				out[k] = v
+			}
+		}
+		return out, true
+	}
+
+	parts := strings.SplitN(line, "\t", 4)
+	if len(parts) < 4 {
+		return nil, false
+	}
+	var ts, reqID, level, body string
+	switch {
+	case strings.HasPrefix(parts[0], "[") && strings.HasSuffix(parts[0], "]"):
+		level, ts, reqID, body = strings.Trim(parts[0], "[]"), parts[1], parts[2], parts[3]
+	default:
+		ts, reqID, level, body = parts[0], parts[1], parts[2], parts[3]
+	}
+	if !lambdaRequestIDRe.MatchString(reqID) || !lambdaLevels[strings.ToUpper(level)] {
+		return nil, false
+	}
+	out := map[string]any{
+		"type":      "log",
+		"timestamp": ts,
+		"requestId": reqID,
+		"level":     strings.ToUpper(level),
+		"body":      body,
+		"message":   raw,
+	}
+	if v, ok := decodeJSON(body); ok {
+		out["data"] = v
+	}
+	return out, true
+}
+
+// lambdaReportKeys maps REPORT line labels to output field names.
+var lambdaReportKeys = map[string]string{
+	"Duration":         "durationMs",
+	"Billed Duration":  "billedDurationMs",
+	"Memory Size":      "memorySizeMB",
+	"Max Memory Used":  "maxMemoryUsedMB",
+	"Init Duration":    "initDurationMs",
+	"Restore Duration": "restoreDurationMs",
+}
+
+// ParseLambdaReport extracts the numeric metrics of a Lambda REPORT line, e.g.
+// "Duration: 12.34 ms" becomes {"durationMs": 12.34}. The X-Ray trace ID, when
+// present, is returned as "xrayTraceId". Unknown labels are ignored.
+func ParseLambdaReport(line string) map[string]any {
+	out := map[string]any{}
+	for _, seg := range strings.Split(line, "\t") {
+		seg = strings.TrimSpace(seg)
+		i := strings.Index(seg, ": ")
+		if i <= 0 {
+			continue
+		}
+		label, value := seg[:i], strings.TrimSpace(seg[i+2:])
+		if label == "XRAY TraceId" {
+			out["xrayTraceId"] = value
+			continue
+		}
+		key, ok := lambdaReportKeys[label]
+		if !ok {
+			continue
+		}
+		num := strings.Fields(value)
+		if len(num) == 0 {
+			continue
+		}
+		f, err := strconv.ParseFloat(num[0], 64)
+		if err != nil {
+			continue
+		}
+		out[key] = f
+	}
+	return out
+}
@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// Format names a log message format understood by Parse.
+type Format string
+
+const (
+	FormatAuto    Format = "auto"
+	FormatLambda  Format = "lambda"
+	FormatAPIGW   Format = "apigw"
+	FormatVPCFlow Format = "vpcflow"
+	FormatALB     Format = "alb"
+	FormatLogfmt  Format = "logfmt"
+	FormatJSON    Format = "json"
+)
+
+// Formats lists every supported format in the order they are documented.
+var Formats = []Format{FormatAuto, FormatLambda, FormatAPIGW, FormatVPCFlow, FormatALB, FormatLogfmt, FormatJSON}
+
+// ParseFormat converts a --parser value to a Format. Empty input means auto-detect.
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return FormatAuto, nil
+	}
+	for _, f := range Formats {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, f := range Formats {
+		names[i] = string(f)
+	}
+	return "", fmt.Errorf("unknown parser %q; expected one of %s", s, strings.Join(names, ", "))
+}
+
+// Parse turns a raw log message into a value suitable for JMESPath evaluation.
+// JSON documents are returned as decoded. Every other format yields a map that
+// always carries the original text under "message", so expressions such as
+// `message` select the same value whichever parser matched.
+// Messages that do not match the requested format fall back to {"message": raw}.
+func Parse(f Format, raw string) any {
+	var (
+		v  any
+		ok bool
+	)
+	switch f {
+	case FormatJSON:
+		v, ok = parseJSON(raw)
+	case FormatLambda:
+		v, ok = parseLambda(raw)
+	case FormatAPIGW:
+		v, ok = parseAPIGW(raw)
+	case FormatVPCFlow:
+		v, ok = parseVPCFlow(raw)
+	case FormatALB:
+		v, ok = parseALB(raw)
+	case FormatLogfmt:
+		v, ok = parseLogfmt(raw)
+	default:
+		v, ok = detect(raw)
+	}
+	if !ok {
+		return map[string]any{"message": raw}
+	}
+	return v
+}
+
+// Annotate sets Fields on each record to the parsed form of its Message.
+func Annotate(records []model.LogRecord, f Format) {
+	for i := range records {
+		records[i].Fields = Parse(f, records[i].Message)
+	}
+}
+
+// detect tries each format from the most to the least specific.
+func detect(raw string) (any, bool) {
+	if v, ok := decodeJSON(raw); ok {
+		return v, true
+	}
+	for _, p := range []func(string) (any, bool){parseLambda, parseVPCFlow, parseALB, parseAPIGW, parseJSON, detectLogfmt} {
+		if v, ok := p(raw); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// decodeJSON decodes raw when the whole message is a JSON document.
+func decodeJSON(raw string) (any, bool) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return nil, false
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// parseJSON decodes a JSON message, also accepting a JSON object behind a text
+// prefix (as written by ECS/Fargate loggers). The prefix is kept under "prefix"
+// unless the object already defines that key.
+func parseJSON(raw string) (any, bool) {
+	if v, ok := decodeJSON(raw); ok {
+		return v, true
+	}
+	i := strings.IndexByte(raw, '{')
+	if i <= 0 {
+		return nil, false
+	}
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw[i:])), &obj); err != nil {
+		return nil, false
+	}
+	if _, exists := obj["prefix"]; !exists {
+		obj["prefix"] = strings.TrimSpace(raw[:i])
+	}
+	return obj, true
+}
+
+// splitQuoted splits s on spaces while keeping "double quoted" and [bracketed]
+// sections together. Quotes and brackets are removed from the returned tokens.
+func splitQuoted(s string) []string {
+	var (
+		out    []string
+		cur    strings.Builder
+		inTok  bool
+		closer byte
+	)
+	flush := func() {
+		if inTok {
+			out = append(out, cur.String())
+			cur.Reset()
+			inTok = false
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case closer != 0:
+			if c == '\\' && closer == '"' && i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+				continue
+			}
+			if c == closer {
+				closer = 0
+				continue
+			}
+			cur.WriteByte(c)
+		case c == '"':
+			closer = '"'
+			inTok = true
+		case c == '[' && !inTok:
+			closer = ']'
+			inTok = true
+		case c == ' ' || c == '\t':
+			flush()
+		default:
+			inTok = true
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return out
+}
@@ -0,0 +1,193 @@
+package parser_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    parser.Format
+		wantErr bool
+	}{
+		{"", parser.FormatAuto, false},
+		{"auto", parser.FormatAuto, false},
+		{" Lambda ", parser.FormatLambda, false},
+		{"vpcflow", parser.FormatVPCFlow, false},
+		{"syslog", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parser.ParseFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseFormat(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	const reqID = "8f5c3b1a-1234-4cde-9abc-0123456789ab"
+	tests := []struct {
+		name   string
+		format parser.Format
+		raw    string
+		want   map[string]any // subset of keys expected in the result
+	}{
+		{
+			name:   "auto json object",
+			format: parser.FormatAuto,
+			raw:    `{"user":{"id":"u1"}}`,
+			want:   map[string]any{"user": map[string]any{"id": "u1"}},
+		},
+		{
+			name:   "auto plain text",
+			format: parser.FormatAuto,
+			raw:    "WARN: something",
+			want:   map[string]any{"message": "WARN: something"},
+		},
+		{
+			name:   "auto lambda report",
+			format: parser.FormatAuto,
+			raw:    "REPORT RequestId: " + reqID + "\tDuration: 12.50 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\tMax Memory Used: 70 MB\tInit Duration: 150.25 ms\t",
+			want: map[string]any{
+				"type": "report", "requestId": reqID, "durationMs": 12.5, "billedDurationMs": 13.0,
+				"memorySizeMB": 128.0, "maxMemoryUsedMB": 70.0, "initDurationMs": 150.25,
+			},
+		},
+		{
+			name:   "lambda node runtime line with json body",
+			format: parser.FormatLambda,
+			raw:    "2024-01-01T00:00:00.000Z\t" + reqID + "\tERROR\t{\"code\":42}",
+			want: map[string]any{
+				"type": "log", "requestId": reqID, "level": "ERROR",
+				"timestamp": "2024-01-01T00:00:00.000Z", "data": map[string]any{"code": 42.0},
+			},
+		},
+		{
+			name:   "lambda python runtime line",
+			format: parser.FormatLambda,
+			raw:    "[WARNING]\t2024-01-01T00:00:00.000Z\t" + reqID + "\tslow call",
+			want: map[string]any{
+				"level": "WARNING", "requestId": reqID, "body": "slow call",
+				"message": "[WARNING]\t2024-01-01T00:00:00.000Z\t" + reqID + "\tslow call",
+			},
+		},
+		{
+			name:   "lambda format on unrelated text falls back",
+			format: parser.FormatLambda,
+			raw:    "hello",
+			want:   map[string]any{"message": "hello"},
+		},
+		{
+			name:   "apigw common log format",
+			format: parser.FormatAPIGW,
+			raw:    `203.0.113.7 - - [01/Jan/2024:00:00:00 +0000] "GET /pets HTTP/1.1" 502 36 ` + reqID,
+			want: map[string]any{
+				"sourceIp": "203.0.113.7", "httpMethod": "GET", "resourcePath": "/pets",
+				"status": 502.0, "responseLength": 36.0, "requestId": reqID,
+			},
+		},
+		{
+			name:   "apigw execution log",
+			format: parser.FormatAPIGW,
+			raw:    "(" + reqID + ") Method completed with status: 502",
+			want: map[string]any{
+				"requestId": reqID, "body": "Method completed with status: 502",
+				"message": "(" + reqID + ") Method completed with status: 502",
+			},
+		},
+		{
+			name:   "auto vpc flow log",
+			format: parser.FormatAuto,
+			raw:    "2 123456789012 eni-0a1b2c3d 10.0.0.1 10.0.0.2 443 49152 6 10 840 1700000000 1700000060 REJECT OK",
+			want: map[string]any{
+				"accountId": "123456789012", "srcaddr": "10.0.0.1", "dstport": 49152.0,
+				"protocol": 6.0, "action": "REJECT", "logStatus": "OK",
+			},
+		},
+		{
+			name:   "auto alb access log",
+			format: parser.FormatAuto,
+			raw:    `https 2024-01-01T00:00:00.000000Z app/my-lb/50dc6c495c0c9188 192.0.2.1:4321 10.0.0.5:80 0.001 0.050 0.000 504 - 34 366 "GET https://example.com:443/api HTTP/1.1" "curl/8.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:tg "Root=1-abc" "example.com" "-" 0`,
+			want: map[string]any{
+				"type": "https", "elbStatusCode": 504.0, "targetStatusCode": "-", "method": "GET",
+				"url": "https://example.com:443/api", "userAgent": "curl/8.0", "traceId": "Root=1-abc",
+			},
+		},
+		{
+			name:   "auto logfmt",
+			format: parser.FormatAuto,
+			raw:    `level=error msg="db timeout" retry`,
+			want:   map[string]any{"level": "error", "msg": "db timeout", "retry": true},
+		},
+		{
+			name:   "logfmt message key keeps the raw line",
+			format: parser.FormatLogfmt,
+			raw:    `message="db down" level=error`,
+			want:   map[string]any{"body": "db down", "level": "error", "message": `message="db down" level=error`},
+		},
+		{
+			name:   "explicit logfmt with one pair",
+			format: parser.FormatLogfmt,
+			raw:    "retries=3",
+			want:   map[string]any{"retries": "3", "message": "retries=3"},
+		},
+		{
+			name:   "auto text with one pair is not logfmt",
+			format: parser.FormatAuto,
+			raw:    "retrying with backoff=2s",
+			want:   map[string]any{"message": "retrying with backoff=2s", "backoff": nil},
+		},
+		{
+			name:   "json behind prefix",
+			format: parser.FormatJSON,
+			raw:    `2024-01-01 12:00:00 app[1]: {"userId":"u9"}`,
+			want:   map[string]any{"userId": "u9", "prefix": "2024-01-01 12:00:00 app[1]:"},
+		},
+		{
+			name:   "json format on invalid input falls back",
+			format: parser.FormatJSON,
+			raw:    "not json",
+			want:   map[string]any{"message": "not json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parser.Parse(tt.format, tt.raw).(map[string]any)
+			if !ok {
+				t.Fatalf("Parse returned %T, want map", parser.Parse(tt.format, tt.raw))
+			}
+			for k, want := range tt.want {
+				if !reflect.DeepEqual(got[k], want) {
+					t.Fatalf("field %q = %#v, want %#v (all=%v)", k, got[k], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAutoKeepsNonObjectJSON(t *testing.T) {
+	got := parser.Parse(parser.FormatAuto, `["a","b"]`)
+	if !reflect.DeepEqual(got, []any{"a", "b"}) {
+		t.Fatalf("Parse array = %#v", got)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	recs := []model.LogRecord{{Message: `{"a":1}`}, {Message: "plain"}}
+	parser.Annotate(recs, parser.FormatAuto)
+	if !reflect.DeepEqual(recs[0].Fields, map[string]any{"a": 1.0}) {
+		t.Fatalf("recs[0].Fields = %#v", recs[0].Fields)
+	}
+	if !reflect.DeepEqual(recs[1].Fields, map[string]any{"message": "plain"}) {
+		t.Fatalf("recs[1].Fields = %#v", recs[1].Fields)
+	}
+}
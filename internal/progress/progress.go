@@ -0,0 +1,232 @@
+// Package progress draws a one-line progress display of a multi-group
+// search on a terminal: groups completed, pages fetched, events found, how
+// far each running group has read into the search window, and an ETA
+// estimated from that position.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultInterval is how often Run redraws the line.
+const DefaultInterval = 200 * time.Millisecond
+
+// barWidth is the number of cells of the bar itself.
+const barWidth = 20
+
+// Bar is the progress display. Its methods are safe for concurrent use; the
+// search feeds it with Start, Page, GroupDone and Done while Run draws it.
+type Bar struct {
+	w io.Writer
+	// Width returns the terminal width; nil or a value <= 0 means 80.
+	Width func() int
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	active     bool
+	drawn      bool
+	began      time.Time
+	start, end time.Time
+	total      int
+	pages      int
+	events     int
+	groups     map[string]*group
+}
+
+// group is the progress of one log group.
+type group struct {
+	// position is the newest event time read so far.
+	position time.Time
+	done     bool
+}
+
+// New returns a bar drawing on w.
+func New(w io.Writer) *Bar {
+	return &Bar{w: w}
+}
+
+func (b *Bar) now() time.Time {
+	if b.Now == nil {
+		return time.Now()
+	}
+	return b.Now()
+}
+
+// Start begins a search of groups over [start, end], replacing the
+// progress of any previous search.
+func (b *Bar) Start(groups []string, start, end time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active, b.began, b.start, b.end = true, b.now(), start, end
+	b.total, b.pages, b.events = len(groups), 0, 0
+	b.groups = make(map[string]*group, len(groups))
+}
+
+// Page records a page of events from group whose newest event is at newest
+// (zero when the page is empty).
+func (b *Bar) Page(name string, events int, newest time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.active {
+		return
+	}
+	g := b.group(name)
+	b.pages++
+	b.events += events
+	if newest.After(g.position) {
+		g.position = newest
+	}
+}
+
+// GroupDone marks group as searched.
+func (b *Bar) GroupDone(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.active {
+		b.group(name).done = true
+	}
+}
+
+func (b *Bar) group(name string) *group {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &group{}
+		b.groups[name] = g
+	}
+	return g
+}
+
+// Done ends the search and clears the line, so that what is written next
+// starts on a clean line.
+func (b *Bar) Done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active = false
+	b.clear()
+}
+
+func (b *Bar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.w, "\r\x1b[K")
+		b.drawn = false
+	}
+}
+
+// Run redraws the line every interval while a search is active, until ctx
+// ends; it then clears the line.
+func (b *Bar) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.Done()
+			return
+		case <-t.C:
+			b.draw()
+		}
+	}
+}
+
+func (b *Bar) draw() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.active {
+		return
+	}
+	fmt.Fprint(b.w, "\r"+b.line()+"\x1b[K")
+	b.drawn = true
+}
+
+// Line returns the progress line; it is empty when no search is active.
+func (b *Bar) Line() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.active {
+		return ""
+	}
+	return b.line()
+}
+
+func (b *Bar) line() string {
+	done := 0
+	var covered float64
+	var running []string
+	for name, g := range b.groups {
+		if g.done {
+			done++
+			covered++
+			continue
+		}
+		covered += b.fraction(g.position)
+		running = append(running, name)
+	}
+	var f float64
+	if b.total > 0 {
+		f = covered / float64(b.total)
+	}
+	filled := int(f * barWidth)
+	eta := "--"
+	if elapsed := b.now().Sub(b.began); f >= 0.01 && elapsed > 0 {
+		eta = time.Duration(float64(elapsed) * (1 - f) / f).Round(time.Second).String()
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d groups, %d pages, %d events, ETA %s",
+		strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), done, b.total, b.pages, b.events, eta)
+
+	sort.Strings(running)
+	layout := "15:04"
+	if b.end.Sub(b.start) > 24*time.Hour {
+		layout = "01-02 15:04"
+	}
+	for _, name := range running {
+		g := b.groups[name]
+		if g.position.IsZero() {
+			continue
+		}
+		line += fmt.Sprintf("  %s@%s %d%%", shortName(name), g.position.Local().Format(layout), int(b.fraction(g.position)*100))
+	}
+	return truncate(line, b.width()-1)
+}
+
+// fraction is how far t is into the search window, between 0 and 1.
+func (b *Bar) fraction(t time.Time) float64 {
+	span := b.end.Sub(b.start)
+	if t.IsZero() || span <= 0 {
+		return 0
+	}
+	return min(max(float64(t.Sub(b.start))/float64(span), 0), 1)
+}
+
+func (b *Bar) width() int {
+	if b.Width != nil {
+		if w := b.Width(); w > 0 {
+			return w
+		}
+	}
+	return 80
+}
+
+// shortName is the last path element of a log group name.
+func shortName(group string) string {
+	if i := strings.LastIndex(strings.TrimRight(group, "/"), "/"); i >= 0 {
+		return strings.TrimRight(group, "/")[i+1:]
+	}
+	return group
+}
+
+// truncate cuts s to n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,93 @@
+package progress_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/progress"
+)
+
+var t0 = time.Date(2025, 8, 31, 10, 0, 0, 0, time.Local)
+
+func TestLine(t *testing.T) {
+	now := t0
+	b := progress.New(&bytes.Buffer{})
+	b.Now = func() time.Time { return now }
+	b.Width = func() int { return 200 }
+	if b.Line() != "" {
+		t.Fatal("line before Start")
+	}
+
+	b.Start([]string{"/aws/lambda/api", "/aws/lambda/worker"}, t0, t0.Add(4*time.Hour))
+	if got := b.Line(); got != "[--------------------] 0/2 groups, 0 pages, 0 events, ETA --" {
+		t.Fatalf("line = %q", got)
+	}
+
+	// api is done; worker has read a quarter of the window: 5/8 covered.
+	b.Page("/aws/lambda/api", 10, t0.Add(4*time.Hour))
+	b.GroupDone("/aws/lambda/api")
+	b.Page("/aws/lambda/worker", 5, t0.Add(time.Hour))
+	b.Page("/aws/lambda/worker", 0, time.Time{})
+	now = t0.Add(50 * time.Second)
+	want := "[############--------] 1/2 groups, 3 pages, 15 events, ETA 30s  worker@11:00 25%"
+	if got := b.Line(); got != want {
+		t.Fatalf("line = %q, want %q", got, want)
+	}
+
+	b.Width = func() int { return 30 }
+	if got := b.Line(); len([]rune(got)) != 29 || !strings.HasSuffix(got, "…") {
+		t.Fatalf("truncated line = %q", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the drawing goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestRun(t *testing.T) {
+	var out syncBuffer
+	b := progress.New(&out)
+	b.Done()
+	if out.String() != "" {
+		t.Fatalf("Done without drawing wrote %q", out.String())
+	}
+
+	b.Start([]string{"/a"}, t0, t0.Add(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		b.Run(ctx, time.Millisecond)
+	}()
+	for !strings.Contains(out.String(), "\r[") {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+	if got := out.String(); !strings.HasSuffix(got, "\r\x1b[K") || !strings.Contains(got, "0/1 groups") {
+		t.Fatalf("output = %q", got)
+	}
+
+	b.Page("/a", 1, t0)
+	if b.Line() != "" {
+		t.Fatal("pages recorded after the search ended")
+	}
+}
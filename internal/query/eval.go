@@ -0,0 +1,449 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+)
+
+// Values are nil (NULL), float64, string, bool or time.Time.
+
+// timeLayouts are the formats of text compared with timestamps.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04", "2006-01-02"}
+
+// parseTime reads a timestamp from text, in UTC unless it has an offset.
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// text returns the text form of a non-NULL value.
+func text(v any) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(recordfile.TimeLayout)
+	}
+	return ""
+}
+
+// number converts a value to a number: timestamps are milliseconds since
+// the Unix epoch, booleans 1 or 0. Text that is not a number converts to
+// nothing.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		return float64(v.UnixMilli()), true
+	}
+	return 0, false
+}
+
+// numericPrefix matches the leading number of a text.
+var numericPrefix = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+// operand converts a value that is not NULL to a number for arithmetic and
+// numeric functions: as number does, and text that is not a number by its
+// leading number, or 0 without one, as SQLite does.
+func operand(v any) float64 {
+	if f, ok := number(v); ok {
+		return f
+	}
+	f, _ := strconv.ParseFloat(numericPrefix.FindString(strings.TrimSpace(text(v))), 64)
+	return f
+}
+
+// truth is the truth value of a condition: NULL and text that is not a
+// non-zero number are false.
+func truth(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case time.Time:
+		return true
+	}
+	f, ok := number(v)
+	return ok && f != 0
+}
+
+// rank orders values of different kinds: NULL first, then numbers and
+// booleans, timestamps and text.
+func rank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case float64, bool:
+		return 1
+	case time.Time:
+		return 2
+	}
+	return 3
+}
+
+// order compares two values for sorting, MIN and MAX.
+func order(a, b any) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb || ra == 0 {
+		return ra - rb
+	}
+	switch ra {
+	case 1:
+		x, _ := number(a)
+		y, _ := number(b)
+		return compareFloats(x, y)
+	case 2:
+		return a.(time.Time).Compare(b.(time.Time))
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compare compares two non-NULL values for the comparison operators,
+// converting text compared with a number or timestamp when it can be read
+// as one. Other text is greater than numbers; other kinds compare by their
+// text forms.
+func compare(a, b any) int {
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := asTime(b); ok {
+			return x.Compare(y)
+		}
+	case float64, bool:
+		if _, ok := b.(time.Time); ok {
+			return -compare(b, a)
+		}
+		if y, ok := number(b); ok {
+			f, _ := number(a)
+			return compareFloats(f, y)
+		}
+		if _, ok := b.(string); ok {
+			return -1
+		}
+	case string:
+		switch b.(type) {
+		case float64, bool, time.Time:
+			return -compare(b, a)
+		}
+	}
+	return strings.Compare(text(a), text(b))
+}
+
+// asTime converts a value compared with a timestamp: text in one of
+// timeLayouts or milliseconds since the Unix epoch.
+func asTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		return parseTime(v)
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// key identifies a value for GROUP BY, DISTINCT and IN.
+func key(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "n"
+	case float64:
+		return "f" + text(v)
+	case bool:
+		return "b" + text(v)
+	case time.Time:
+		return "t" + strconv.FormatInt(v.UnixNano(), 10)
+	}
+	return "s" + v.(string)
+}
+
+// env is what an expression is evaluated against: a row and, in a grouped
+// query, the values of the aggregates over its group.
+type env struct {
+	row  map[string]any
+	t    *table
+	aggs map[*call]any
+	// re caches the compiled REGEXP patterns.
+	re map[string]*regexp.Regexp
+}
+
+func (e *env) column(name string) any {
+	if v, ok := e.row[name]; ok {
+		return v
+	}
+	c, _ := e.t.resolve(name)
+	return e.row[c]
+}
+
+func (e *env) eval(x expr) (any, error) {
+	switch x := x.(type) {
+	case literal:
+		return x.v, nil
+	case column:
+		return e.column(x.name), nil
+	case unary:
+		v, err := e.eval(x.x)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if x.op == "NOT" {
+			return !truth(v), nil
+		}
+		return -operand(v), nil
+	case binary:
+		return e.binary(x)
+	case inList:
+		v, err := e.eval(x.x)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		sawNull := false
+		for _, item := range x.list {
+			w, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if w == nil {
+				sawNull = true
+			} else if compare(v, w) == 0 {
+				return !x.not, nil
+			}
+		}
+		if sawNull {
+			return nil, nil
+		}
+		return x.not, nil
+	case between:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := e.eval(x.lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := e.eval(x.hi)
+		if err != nil || v == nil || lo == nil || hi == nil {
+			return nil, err
+		}
+		in := compare(v, lo) >= 0 && compare(v, hi) <= 0
+		return in != x.not, nil
+	case caseExpr:
+		var operand any
+		if x.operand != nil {
+			var err error
+			if operand, err = e.eval(x.operand); err != nil {
+				return nil, err
+			}
+		}
+		for _, w := range x.whens {
+			c, err := e.eval(w.cond)
+			if err != nil {
+				return nil, err
+			}
+			if x.operand == nil && truth(c) || x.operand != nil && operand != nil && c != nil && compare(operand, c) == 0 {
+				return e.eval(w.then)
+			}
+		}
+		if x.els == nil {
+			return nil, nil
+		}
+		return e.eval(x.els)
+	case castExpr:
+		v, err := e.eval(x.x)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		return cast(v, x.typ), nil
+	case *call:
+		if v, ok := e.aggs[x]; ok {
+			return v, nil
+		}
+		return e.call(x)
+	}
+	return nil, fmt.Errorf("unknown expression %T", x)
+}
+
+// cast converts a value to a CAST type, or NULL when it cannot.
+func cast(v any, typ string) any {
+	switch typ {
+	case "text":
+		return text(v)
+	case "real", "integer":
+		f, ok := number(v)
+		if !ok {
+			return nil
+		}
+		if typ == "integer" {
+			f = math.Trunc(f)
+		}
+		return f
+	case "boolean":
+		if s, ok := v.(string); ok {
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+		return truth(v)
+	case "timestamp":
+		if t, ok := asTime(v); ok {
+			return t
+		}
+		return nil
+	}
+	return v
+}
+
+func (e *env) binary(x binary) (any, error) {
+	l, err := e.eval(x.l)
+	if err != nil {
+		return nil, err
+	}
+	// AND and OR are three-valued: a NULL operand decides nothing alone
+	switch x.op {
+	case "AND":
+		if l != nil && !truth(l) {
+			return false, nil
+		}
+	case "OR":
+		if l != nil && truth(l) {
+			return true, nil
+		}
+	}
+	r, err := e.eval(x.r)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "AND", "OR":
+		if r != nil && truth(r) == (x.op == "OR") {
+			return x.op == "OR", nil
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		return x.op == "AND", nil
+	case "IS", "IS NOT":
+		equal := l == nil && r == nil || l != nil && r != nil && compare(l, r) == 0
+		return equal == (x.op == "IS"), nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch x.op {
+	case "=":
+		return compare(l, r) == 0, nil
+	case "!=":
+		return compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	case "||":
+		return text(l) + text(r), nil
+	case "LIKE":
+		return like(text(r), text(l)), nil
+	case "REGEXP":
+		re, err := e.regexp(text(r))
+		if err != nil {
+			return nil, fmt.Errorf("REGEXP: %w", err)
+		}
+		return re.MatchString(text(l)), nil
+	}
+	a, b := operand(l), operand(r)
+	switch x.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, nil
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", x.op)
+}
+
+func (e *env) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := e.re[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	e.re[pattern] = re
+	return re, nil
+}
+
+// like matches s against a LIKE pattern: % matches any text, _ any one
+// character, and letters match either case.
+func like(pattern, s string) bool {
+	p, t := []rune(strings.ToLower(pattern)), []rune(strings.ToLower(s))
+	// Backtrack to the last % on a mismatch
+	pi, ti, star, mark := 0, 0, -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '_' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '%':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '%' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,373 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// aggregates lists the aggregate functions with their numbers of arguments.
+var aggregates = map[string][2]int{
+	"count": {1, 1}, "sum": {1, 1}, "avg": {1, 1}, "min": {1, 1}, "max": {1, 1}, "group_concat": {1, 2},
+}
+
+// function is a scalar function.
+type function struct {
+	min, max int // numbers of arguments; max -1 for any
+	// nulls is set for functions given NULL arguments; the others return
+	// NULL for any NULL argument.
+	nulls bool
+	fn    func(e *env, args []any) (any, error)
+}
+
+// functions lists the scalar functions.
+var functions = map[string]function{
+	"lower":          {1, 1, false, func(_ *env, a []any) (any, error) { return strings.ToLower(text(a[0])), nil }},
+	"upper":          {1, 1, false, func(_ *env, a []any) (any, error) { return strings.ToUpper(text(a[0])), nil }},
+	"length":         {1, 1, false, func(_ *env, a []any) (any, error) { return float64(utf8.RuneCountInString(text(a[0]))), nil }},
+	"substr":         {2, 3, false, substr},
+	"substring":      {2, 3, false, substr},
+	"trim":           {1, 2, false, trim(strings.Trim)},
+	"ltrim":          {1, 2, false, trim(strings.TrimLeft)},
+	"rtrim":          {1, 2, false, trim(strings.TrimRight)},
+	"replace":        {3, 3, false, func(_ *env, a []any) (any, error) { return strings.ReplaceAll(text(a[0]), text(a[1]), text(a[2])), nil }},
+	"instr":          {2, 2, false, instr},
+	"coalesce":       {1, -1, true, coalesce},
+	"ifnull":         {2, 2, true, coalesce},
+	"nullif":         {2, 2, true, nullif},
+	"abs":            {1, 1, false, numeric(math.Abs)},
+	"round":          {1, 2, false, round},
+	"typeof":         {1, 1, true, typeOf},
+	"strftime":       {2, 2, false, strftime},
+	"date_trunc":     {2, 2, false, dateTrunc},
+	"json_extract":   {2, 2, false, jsonExtract},
+	"regexp_extract": {2, 3, false, regexpExtract},
+}
+
+// isAggregate reports whether c calls an aggregate function.
+func isAggregate(c *call) bool {
+	_, ok := aggregates[c.name]
+	return ok
+}
+
+// checkCall checks that a function exists and takes the arguments given.
+func checkCall(c *call) error {
+	n, ok := aggregates[c.name]
+	if !ok {
+		f, ok := functions[c.name]
+		if !ok {
+			return fmt.Errorf("no such function: %s", c.name)
+		}
+		if c.distinct {
+			return fmt.Errorf("DISTINCT applies to aggregate functions only, not %s()", c.name)
+		}
+		n = [2]int{f.min, f.max}
+	}
+	if c.star {
+		return nil
+	}
+	if len(c.args) < n[0] || n[1] >= 0 && len(c.args) > n[1] {
+		return fmt.Errorf("wrong number of arguments to function %s()", c.name)
+	}
+	return nil
+}
+
+func (e *env) call(c *call) (any, error) {
+	if isAggregate(c) {
+		return nil, fmt.Errorf("misuse of aggregate function %s()", c.name)
+	}
+	f := functions[c.name]
+	args := make([]any, len(c.args))
+	for i, x := range c.args {
+		v, err := e.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && !f.nulls {
+			return nil, nil
+		}
+		args[i] = v
+	}
+	v, err := f.fn(e, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", c.name, err)
+	}
+	return v, nil
+}
+
+// substr returns the characters of a[0] from the 1-based position a[1]
+// (counted from the end when negative), a[2] of them or all the rest; a
+// negative a[2] takes that many characters before the position instead.
+// Positions before the start count as characters, as in SQLite.
+func substr(_ *env, a []any) (any, error) {
+	s := []rune(text(a[0]))
+	size := int64(len(s))
+	i, n := position(a[1]), int64(1<<53)
+	if len(a) == 3 {
+		n = position(a[2])
+	}
+	before := n < 0
+	if before {
+		n = -n
+	}
+	switch {
+	case i < 0:
+		if i += size; i < 0 {
+			n, i = max(n+i, 0), 0
+		}
+	case i > 0:
+		i--
+	case len(a) == 3 && n > 0:
+		n--
+	}
+	if before {
+		if i -= n; i < 0 {
+			n, i = max(n+i, 0), 0
+		}
+	}
+	i = min(i, size)
+	return string(s[i:min(i+n, size)]), nil
+}
+
+// position converts a substr argument to an integer, clamped far beyond
+// any length so that substr's arithmetic cannot overflow.
+func position(v any) int64 {
+	f := math.Trunc(operand(v))
+	if math.IsNaN(f) {
+		return 0
+	}
+	return int64(min(max(f, -1<<53), 1<<53))
+}
+
+func trim(fn func(string, string) string) func(*env, []any) (any, error) {
+	return func(_ *env, a []any) (any, error) {
+		cutset := " "
+		if len(a) == 2 {
+			cutset = text(a[1])
+		}
+		return fn(text(a[0]), cutset), nil
+	}
+}
+
+// instr returns the 1-based character position of a[1] in a[0], or 0.
+func instr(_ *env, a []any) (any, error) {
+	s := text(a[0])
+	i := strings.Index(s, text(a[1]))
+	if i < 0 {
+		return 0.0, nil
+	}
+	return float64(utf8.RuneCountInString(s[:i]) + 1), nil
+}
+
+func coalesce(_ *env, a []any) (any, error) {
+	for _, v := range a {
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func nullif(_ *env, a []any) (any, error) {
+	if a[0] != nil && a[1] != nil && compare(a[0], a[1]) == 0 {
+		return nil, nil
+	}
+	return a[0], nil
+}
+
+func numeric(fn func(float64) float64) func(*env, []any) (any, error) {
+	return func(_ *env, a []any) (any, error) {
+		return fn(operand(a[0])), nil
+	}
+}
+
+// round rounds a[0] to a[1] decimal places: 0 by default and when
+// negative, at most 30, as in SQLite.
+func round(_ *env, a []any) (any, error) {
+	digits := 0.0
+	if len(a) == 2 {
+		digits = min(max(math.Trunc(operand(a[1])), 0), 30)
+	}
+	p := math.Pow(10, digits)
+	return math.Round(operand(a[0])*p) / p, nil
+}
+
+func typeOf(_ *env, a []any) (any, error) {
+	switch a[0].(type) {
+	case nil:
+		return "null", nil
+	case float64:
+		return "real", nil
+	case bool:
+		return "boolean", nil
+	case time.Time:
+		return "timestamp", nil
+	}
+	return "text", nil
+}
+
+// strftime formats the timestamp a[1] with the SQLite conversions %Y, %m,
+// %d, %H, %M, %S, %f (seconds with milliseconds), %j, %w, %s (Unix seconds)
+// and %%.
+func strftime(_ *env, a []any) (any, error) {
+	t, ok := asTime(a[1])
+	if !ok {
+		return nil, nil
+	}
+	t = t.UTC()
+	format := text(a[0])
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'f':
+			fmt.Fprintf(&b, "%02d.%03d", t.Second(), t.Nanosecond()/1e6)
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'w':
+			fmt.Fprintf(&b, "%d", int(t.Weekday()))
+		case 's':
+			fmt.Fprintf(&b, "%d", t.Unix())
+		case '%':
+			b.WriteByte('%')
+		default:
+			return nil, fmt.Errorf("unknown conversion %%%c", format[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// dateTrunc truncates the timestamp a[1] to the unit a[0]: second, minute,
+// hour, day, week (starting on Monday), month or year, or a duration such
+// as 5m.
+func dateTrunc(_ *env, a []any) (any, error) {
+	t, ok := asTime(a[1])
+	if !ok {
+		return nil, nil
+	}
+	t = t.UTC()
+	unit := strings.ToLower(text(a[0]))
+	switch unit {
+	case "second":
+		return t.Truncate(time.Second), nil
+	case "minute":
+		return t.Truncate(time.Minute), nil
+	case "hour":
+		return t.Truncate(time.Hour), nil
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	case "week":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7), nil
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+	d, err := time.ParseDuration(unit)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("unknown unit %q; expected second, minute, hour, day, week, month, year or a duration such as 5m", unit)
+	}
+	return t.Truncate(d), nil
+}
+
+// jsonExtract returns the value at the path a[1] of the JSON text a[0]:
+// $ followed by .name, ."name" and [index] steps. Objects and arrays are
+// returned as JSON text.
+func jsonExtract(_ *env, a []any) (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(text(a[0])), &v); err != nil {
+		return nil, nil
+	}
+	path := text(a[1])
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("path %q does not start with $", path)
+	}
+	for p := path[1:]; p != ""; {
+		switch {
+		case p[0] == '.':
+			p = p[1:]
+			var name string
+			if strings.HasPrefix(p, `"`) {
+				end := strings.IndexByte(p[1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("invalid path %q", path)
+				}
+				name, p = p[1:end+1], p[end+2:]
+			} else {
+				end := strings.IndexAny(p, ".[")
+				if end < 0 {
+					end = len(p)
+				}
+				name, p = p[:end], p[end:]
+			}
+			obj, _ := v.(map[string]any)
+			v = obj[name]
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			i, err := strconv.Atoi(p[1:max(end, 1)])
+			if end < 0 || err != nil {
+				return nil, fmt.Errorf("invalid path %q", path)
+			}
+			p = p[end+1:]
+			arr, _ := v.([]any)
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, nil
+			}
+			v = arr[i]
+		default:
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b), nil
+	}
+	return v, nil
+}
+
+// regexpExtract returns the first match of the regular expression a[1] in
+// a[0], or its group a[2] (the first group when there is one).
+func regexpExtract(e *env, a []any) (any, error) {
+	re, err := e.regexp(text(a[1]))
+	if err != nil {
+		return nil, err
+	}
+	group := min(re.NumSubexp(), 1)
+	if len(a) == 3 {
+		n, ok := number(a[2])
+		if !ok || int(n) < 0 || int(n) > re.NumSubexp() {
+			return nil, fmt.Errorf("no group %s in %q", text(a[2]), re)
+		}
+		group = int(n)
+	}
+	m := re.FindStringSubmatchIndex(text(a[0]))
+	if m == nil || m[2*group] < 0 {
+		return nil, nil
+	}
+	return text(a[0])[m[2*group]:m[2*group+1]], nil
+}
@@ -0,0 +1,699 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Token kinds.
+const (
+	tokEOF = iota
+	tokIdent
+	tokQuoted // "identifier" or `identifier`
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// keywords cannot be used as column names unless quoted.
+var keywords = map[string]bool{
+	"ALL": true, "AND": true, "AS": true, "ASC": true, "BETWEEN": true, "BY": true, "CASE": true, "CAST": true,
+	"DESC": true, "DISTINCT": true, "ELSE": true, "END": true, "FALSE": true, "FROM": true, "GROUP": true,
+	"HAVING": true, "IN": true, "IS": true, "LIKE": true, "LIMIT": true, "NOT": true, "NULL": true, "OFFSET": true,
+	"OR": true, "ORDER": true, "REGEXP": true, "SELECT": true, "THEN": true, "TRUE": true, "WHEN": true, "WHERE": true,
+}
+
+// lex splits a statement into tokens.
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '\'' || c == '"' || c == '`':
+			kind := tokQuoted
+			if c == '\'' {
+				kind = tokString
+			}
+			var b strings.Builder
+			j := i + 1
+			for {
+				if j >= len(s) {
+					return nil, fmt.Errorf("unterminated %c at position %d", c, i+1)
+				}
+				if s[j] == c {
+					// A doubled quote stands for itself
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j += 2
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+				j++
+			}
+			toks = append(toks, token{kind, b.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			if j < len(s) && (s[j] == 'e' || s[j] == 'E') {
+				k := j + 1
+				if k < len(s) && (s[k] == '+' || s[k] == '-') {
+					k++
+				}
+				if k < len(s) && s[k] >= '0' && s[k] <= '9' {
+					for j = k; j < len(s) && s[j] >= '0' && s[j] <= '9'; j++ {
+					}
+				}
+			}
+			if _, err := strconv.ParseFloat(s[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", s[i:j], i+1)
+			}
+			toks = append(toks, token{tokNumber, s[i:j], i})
+			i = j
+		case identByte(c) && (c < '0' || c > '9'):
+			j := i
+			for j < len(s) && identByte(s[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"<=", ">=", "<>", "!=", "==", "||", "=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ";"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at position %d", c, i+1)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+// identByte reports whether c may be part of an unquoted identifier.
+func identByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// Expressions.
+type (
+	expr any
+
+	literal struct{ v any }
+	column  struct{ name string }
+	unary   struct {
+		op string // "-" or "NOT"
+		x  expr
+	}
+	binary struct {
+		op   string // an operator, AND, OR, IS, IS NOT, LIKE or REGEXP
+		l, r expr
+	}
+	inList struct {
+		x    expr
+		list []expr
+		not  bool
+	}
+	between struct {
+		x, lo, hi expr
+		not       bool
+	}
+	caseExpr struct {
+		operand expr // nil in a searched CASE
+		whens   []when
+		els     expr
+	}
+	when     struct{ cond, then expr }
+	castExpr struct {
+		x   expr
+		typ string
+	}
+	call struct {
+		name     string // lower case
+		args     []expr
+		star     bool // count(*)
+		distinct bool
+	}
+)
+
+// selectItem is an output column: * or an expression, named by its alias
+// or its text.
+type selectItem struct {
+	star bool
+	x    expr
+	name string
+}
+
+type orderTerm struct {
+	x    expr
+	desc bool
+}
+
+// sqlParser is a recursive descent parser of SELECT statements.
+type sqlParser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *sqlParser) peek() token { return p.toks[p.i] }
+
+func (p *sqlParser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// keyword reports whether the next token is one of the keywords, consuming
+// it if so.
+func (p *sqlParser) keyword(words ...string) bool {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			p.i++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *sqlParser) op(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, o := range ops {
+		if t.text == o {
+			p.i++
+			return o, true
+		}
+	}
+	return "", false
+}
+
+// errorf returns an error at the next token.
+func (p *sqlParser) errorf(format string, args ...any) error {
+	t := p.peek()
+	near := "end of statement"
+	if t.kind != tokEOF {
+		near = fmt.Sprintf("%q at position %d", strings.TrimSpace(p.src[t.pos:p.toks[p.i+1].pos]), t.pos+1)
+	}
+	return fmt.Errorf("%s near %s", fmt.Sprintf(format, args...), near)
+}
+
+func (p *sqlParser) expectKeyword(w string) error {
+	if !p.keyword(w) {
+		return p.errorf("expected %s", w)
+	}
+	return nil
+}
+
+func (p *sqlParser) expectOp(o string) error {
+	if _, ok := p.op(o); !ok {
+		return p.errorf("expected %q", o)
+	}
+	return nil
+}
+
+// statement parses
+//
+//	SELECT [DISTINCT] items FROM records [WHERE x] [GROUP BY x, ...]
+//	[HAVING x] [ORDER BY x [ASC|DESC], ...] [LIMIT n [OFFSET m]]
+func (p *sqlParser) statement(q *Query) error {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return err
+	}
+	if p.keyword("DISTINCT") {
+		q.distinct = true
+	} else {
+		p.keyword("ALL")
+	}
+	for {
+		item, err := p.selectItem()
+		if err != nil {
+			return err
+		}
+		q.items = append(q.items, item)
+		if _, ok := p.op(","); !ok {
+			break
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return err
+	}
+	if t := p.peek(); t.kind != tokIdent && t.kind != tokQuoted || !strings.EqualFold(t.text, Table) {
+		return p.errorf("expected table %s", Table)
+	}
+	p.i++
+	var err error
+	if p.keyword("WHERE") {
+		if q.where, err = p.expr(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		if q.groupBy, err = p.exprList(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("HAVING") {
+		if q.having, err = p.expr(); err != nil {
+			return err
+		}
+	}
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return err
+			}
+			term := orderTerm{x: x}
+			if p.keyword("DESC") {
+				term.desc = true
+			} else {
+				p.keyword("ASC")
+			}
+			q.orderBy = append(q.orderBy, term)
+			if _, ok := p.op(","); !ok {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if q.limit, err = p.count("LIMIT"); err != nil {
+			return err
+		}
+		if p.keyword("OFFSET") {
+			if q.offset, err = p.count("OFFSET"); err != nil {
+				return err
+			}
+		}
+	}
+	p.op(";")
+	if p.peek().kind != tokEOF {
+		return p.errorf("unexpected input")
+	}
+	return nil
+}
+
+// count parses the non-negative integer of LIMIT or OFFSET.
+func (p *sqlParser) count(clause string) (int, error) {
+	t := p.peek()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokNumber || err != nil || n < 0 {
+		return 0, p.errorf("%s must be a non-negative integer", clause)
+	}
+	p.i++
+	return n, nil
+}
+
+func (p *sqlParser) selectItem() (selectItem, error) {
+	if _, ok := p.op("*"); ok {
+		return selectItem{star: true}, nil
+	}
+	start := p.peek().pos
+	x, err := p.expr()
+	if err != nil {
+		return selectItem{}, err
+	}
+	item := selectItem{x: x, name: strings.TrimSpace(p.src[start:p.toks[p.i].pos])}
+	if c, ok := x.(column); ok {
+		item.name = c.name
+	}
+	explicit := p.keyword("AS")
+	if t := p.peek(); t.kind == tokQuoted || t.kind == tokIdent && !keywords[strings.ToUpper(t.text)] {
+		item.name = p.next().text
+	} else if explicit {
+		return selectItem{}, p.errorf("expected a column alias")
+	}
+	return item, nil
+}
+
+func (p *sqlParser) exprList() ([]expr, error) {
+	var list []expr
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if _, ok := p.op(","); !ok {
+			return list, nil
+		}
+	}
+}
+
+func (p *sqlParser) expr() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{"OR", l, r}
+	}
+	return l, nil
+}
+
+func (p *sqlParser) and() (expr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{"AND", l, r}
+	}
+	return l, nil
+}
+
+func (p *sqlParser) not() (expr, error) {
+	if p.keyword("NOT") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return unary{"NOT", x}, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses an operand with an optional comparison: an operator,
+// IS [NOT], [NOT] LIKE, REGEXP, IN or BETWEEN.
+func (p *sqlParser) comparison() (expr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.op("=", "==", "!=", "<>", "<", "<=", ">", ">="); ok {
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "==":
+			op = "="
+		case "<>":
+			op = "!="
+		}
+		return binary{op, l, r}, nil
+	}
+	if p.keyword("IS") {
+		op := "IS"
+		if p.keyword("NOT") {
+			op = "IS NOT"
+		}
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return binary{op, l, r}, nil
+	}
+	negate := p.keyword("NOT")
+	switch {
+	case p.keyword("LIKE", "REGEXP"):
+		op := strings.ToUpper(p.toks[p.i-1].text)
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		var x expr = binary{op, l, r}
+		if negate {
+			x = unary{"NOT", x}
+		}
+		return x, nil
+	case p.keyword("IN"):
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return inList{l, list, negate}, nil
+	case p.keyword("BETWEEN"):
+		lo, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		hi, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return between{l, lo, hi, negate}, nil
+	}
+	if negate {
+		return nil, p.errorf("expected LIKE, REGEXP, IN or BETWEEN")
+	}
+	return l, nil
+}
+
+func (p *sqlParser) additive() (expr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.op("+", "-")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op, l, r}
+	}
+}
+
+func (p *sqlParser) multiplicative() (expr, error) {
+	l, err := p.concat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.op("*", "/", "%")
+		if !ok {
+			return l, nil
+		}
+		r, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{op, l, r}
+	}
+}
+
+func (p *sqlParser) concat() (expr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.op("||"); !ok {
+			return l, nil
+		}
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = binary{"||", l, r}
+	}
+}
+
+func (p *sqlParser) unary() (expr, error) {
+	if op, ok := p.op("-", "+"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return x, nil
+		}
+		return unary{"-", x}, nil
+	}
+	return p.primary()
+}
+
+func (p *sqlParser) primary() (expr, error) {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return nil, p.errorf("expected an expression")
+	}
+	p.i++
+	switch t.kind {
+	case tokNumber:
+		v, _ := strconv.ParseFloat(t.text, 64)
+		return literal{v}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokQuoted:
+		return column{t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expectOp(")")
+		}
+	case tokIdent:
+		switch strings.ToUpper(t.text) {
+		case "NULL":
+			return literal{nil}, nil
+		case "TRUE":
+			return literal{true}, nil
+		case "FALSE":
+			return literal{false}, nil
+		case "CASE":
+			return p.caseExpr()
+		case "CAST":
+			return p.cast()
+		}
+		if keywords[strings.ToUpper(t.text)] {
+			break
+		}
+		if _, ok := p.op("("); ok {
+			return p.call(strings.ToLower(t.text))
+		}
+		return column{t.text}, nil
+	}
+	p.i--
+	return nil, p.errorf("expected an expression")
+}
+
+func (p *sqlParser) call(name string) (expr, error) {
+	c := &call{name: name}
+	if _, ok := p.op("*"); ok {
+		if name != "count" {
+			p.i--
+			return nil, p.errorf("%s(*) is not a function; only count(*) is", name)
+		}
+		c.star = true
+		return c, p.expectOp(")")
+	}
+	if p.keyword("DISTINCT") {
+		c.distinct = true
+	}
+	if _, ok := p.op(")"); !ok {
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		c.args = args
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkCall(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *sqlParser) caseExpr() (expr, error) {
+	var c caseExpr
+	var err error
+	if !p.keyword("WHEN") {
+		if c.operand, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("WHEN"); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		var w when
+		if w.cond, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if w.then, err = p.expr(); err != nil {
+			return nil, err
+		}
+		c.whens = append(c.whens, w)
+		if !p.keyword("WHEN") {
+			break
+		}
+	}
+	if p.keyword("ELSE") {
+		if c.els, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, p.expectKeyword("END")
+}
+
+// castTypes maps the type names of CAST to the kinds of values.
+var castTypes = map[string]string{
+	"TEXT": "text", "VARCHAR": "text", "STRING": "text",
+	"REAL": "real", "DOUBLE": "real", "FLOAT": "real", "NUMERIC": "real", "INTEGER": "integer", "INT": "integer", "BIGINT": "integer",
+	"BOOLEAN": "boolean", "TIMESTAMP": "timestamp",
+}
+
+func (p *sqlParser) cast() (expr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	typ, ok := castTypes[strings.ToUpper(t.text)]
+	if t.kind != tokIdent || !ok {
+		return nil, p.errorf("expected a type: TEXT, REAL, INTEGER, BOOLEAN or TIMESTAMP")
+	}
+	p.i++
+	return castExpr{x, typ}, p.expectOp(")")
+}
@@ -0,0 +1,681 @@
+// Package query runs SQL SELECT statements over log records in memory. The
+// records are the rows of the table "records", with the columns of result
+// files (timestamp, log_group, log_stream, event_id, message) followed by
+// the flattened fields of structured messages, named as recordfile.Flatten
+// names them.
+//
+// The dialect is a subset of SQLite's: SELECT [DISTINCT] with WHERE, GROUP
+// BY, HAVING, ORDER BY, LIMIT and OFFSET, the usual operators, LIKE, REGEXP,
+// IN, BETWEEN, CASE and CAST, the aggregates count, sum, avg, min, max and
+// group_concat, and the scalar functions listed in functions. Values are
+// NULL, numbers (float64), text, booleans and timestamps. As in SQLite,
+// arithmetic and numeric functions read text by its leading number (0
+// without one). Unlike SQLite, numbers have no integer type, so 7 / 2 is 3.5
+// and % keeps fractions.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+)
+
+// Table is the name of the table of records.
+const Table = "records"
+
+// Query is a parsed SELECT statement.
+type Query struct {
+	distinct bool
+	items    []selectItem
+	where    expr
+	groupBy  []expr
+	having   expr
+	orderBy  []orderTerm
+	// limit is -1 without LIMIT.
+	limit, offset int
+}
+
+// Parse parses a SELECT statement.
+func Parse(sql string) (*Query, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	q := &Query{limit: -1}
+	p := &sqlParser{src: sql, toks: toks}
+	if err := p.statement(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// table holds the rows of records.
+type table struct {
+	rows []map[string]any
+	// columns are the columns of the records, then the field columns by
+	// name.
+	columns []string
+	// names maps the column names, then their lower-cased forms, to the
+	// columns.
+	names map[string]string
+}
+
+func newTable(records []model.LogRecord, format parser.Format) *table {
+	t := &table{rows: make([]map[string]any, len(records)), names: map[string]string{}}
+	fields := map[string]bool{}
+	for i, r := range records {
+		row := recordfile.Flatten(r, format)
+		if row == nil {
+			row = map[string]any{}
+		}
+		for k := range row {
+			fields[k] = true
+		}
+		row[recordfile.ColumnTimestamp] = r.Timestamp.UTC()
+		row[recordfile.ColumnGroup] = r.LogGroup
+		row[recordfile.ColumnStream] = r.LogStream
+		if r.EventID != "" {
+			row[recordfile.ColumnEventID] = r.EventID
+		}
+		row[recordfile.ColumnMessage] = strings.TrimRight(r.Message, "\r\n")
+		t.rows[i] = row
+	}
+	t.columns = slices.Clone(recordfile.Columns)
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	t.columns = append(t.columns, names...)
+	for _, c := range t.columns {
+		t.names[c] = c
+	}
+	for _, c := range t.columns {
+		if _, ok := t.names[strings.ToLower(c)]; !ok {
+			t.names[strings.ToLower(c)] = c
+		}
+	}
+	return t
+}
+
+// resolve returns the column a name refers to: identifiers are not case
+// sensitive, but a column of the exact name is preferred.
+func (t *table) resolve(name string) (string, bool) {
+	if c, ok := t.names[name]; ok {
+		return c, true
+	}
+	c, ok := t.names[strings.ToLower(name)]
+	return c, ok
+}
+
+// known reports whether a column exists; with no rows every field column
+// might.
+func (t *table) known(name string) bool {
+	_, ok := t.resolve(name)
+	return ok || len(t.rows) == 0
+}
+
+// Result is the result of a query.
+type Result struct {
+	Columns []string
+	// Rows hold nil, float64, string, bool and time.Time values.
+	Rows [][]any
+}
+
+// plan is a query resolved against a table.
+type plan struct {
+	items   []selectItem
+	groupBy []expr
+	having  expr
+	orderBy []orderTerm
+	aggs    []*call
+	grouped bool
+}
+
+// Run runs the query over records. Messages whose Fields are unset are
+// parsed with format to find their fields.
+func (q *Query) Run(records []model.LogRecord, format parser.Format) (*Result, error) {
+	t := newTable(records, format)
+	p, err := q.plan(t)
+	if err != nil {
+		return nil, err
+	}
+	e := &env{t: t, re: map[string]*regexp.Regexp{}}
+
+	var rows []map[string]any
+	for _, row := range t.rows {
+		if q.where != nil {
+			e.row = row
+			v, err := e.eval(q.where)
+			if err != nil {
+				return nil, err
+			}
+			if !truth(v) {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	// out holds the output rows, each followed by its sort keys
+	var out [][]any
+	emit := func() error {
+		if p.having != nil {
+			v, err := e.eval(p.having)
+			if err != nil || !truth(v) {
+				return err
+			}
+		}
+		values := make([]any, 0, len(p.items)+len(p.orderBy))
+		for _, item := range p.items {
+			v, err := e.eval(item.x)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		for _, o := range p.orderBy {
+			v, err := e.eval(o.x)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		out = append(out, values)
+		return nil
+	}
+	if p.grouped {
+		groups, err := p.group(e, rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			e.row, e.aggs = g.row, g.values()
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		}
+		e.aggs = nil
+	} else {
+		for _, row := range rows {
+			e.row = row
+			if err := emit(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	n := len(p.items)
+	if q.distinct {
+		seen := map[string]bool{}
+		out = slices.DeleteFunc(out, func(values []any) bool {
+			var k strings.Builder
+			for _, v := range values[:n] {
+				k.WriteString(key(v))
+				k.WriteByte(0)
+			}
+			dup := seen[k.String()]
+			seen[k.String()] = true
+			return dup
+		})
+	}
+	if len(p.orderBy) > 0 {
+		slices.SortStableFunc(out, func(a, b []any) int {
+			for i, o := range p.orderBy {
+				if c := order(a[n+i], b[n+i]); c != 0 {
+					if o.desc {
+						return -c
+					}
+					return c
+				}
+			}
+			return 0
+		})
+	}
+	out = out[min(q.offset, len(out)):]
+	if q.limit >= 0 && q.limit < len(out) {
+		out = out[:q.limit]
+	}
+
+	res := &Result{Columns: make([]string, n), Rows: make([][]any, len(out))}
+	for i, item := range p.items {
+		res.Columns[i] = item.name
+	}
+	for i, values := range out {
+		res.Rows[i] = values[:n:n]
+	}
+	return res, nil
+}
+
+// plan expands * and resolves the aliases and positions in GROUP BY,
+// HAVING and ORDER BY to the select items, and finds the aggregates.
+func (q *Query) plan(t *table) (*plan, error) {
+	p := &plan{}
+	for _, item := range q.items {
+		if !item.star {
+			p.items = append(p.items, item)
+			continue
+		}
+		for _, c := range t.columns {
+			p.items = append(p.items, selectItem{x: column{c}, name: c})
+		}
+	}
+	aliases := map[string]expr{}
+	for _, item := range q.items {
+		if !item.star {
+			if _, ok := aliases[strings.ToLower(item.name)]; !ok {
+				aliases[strings.ToLower(item.name)] = item.x
+			}
+		}
+	}
+	// term resolves a GROUP BY or ORDER BY term: a position or an alias
+	term := func(x expr, clause string) (expr, error) {
+		if l, ok := x.(literal); ok {
+			if f, ok := l.v.(float64); ok {
+				if f != float64(int(f)) || f < 1 || int(f) > len(p.items) {
+					return nil, fmt.Errorf("%s term out of range: %s", clause, text(f))
+				}
+				return p.items[int(f)-1].x, nil
+			}
+		}
+		return substitute(x, aliases), nil
+	}
+	for _, x := range q.groupBy {
+		x, err := term(x, "GROUP BY")
+		if err != nil {
+			return nil, err
+		}
+		p.groupBy = append(p.groupBy, x)
+	}
+	if q.having != nil {
+		p.having = substitute(q.having, aliases)
+	}
+	for _, o := range q.orderBy {
+		x, err := term(o.x, "ORDER BY")
+		if err != nil {
+			return nil, err
+		}
+		p.orderBy = append(p.orderBy, orderTerm{x, o.desc})
+	}
+
+	for _, x := range append([]expr{q.where}, p.groupBy...) {
+		if c := findAggregate(x); c != nil {
+			return nil, fmt.Errorf("misuse of aggregate function %s() in WHERE or GROUP BY", c.name)
+		}
+	}
+	var all []expr
+	for _, item := range p.items {
+		all = append(all, item.x)
+	}
+	all = append(all, p.having)
+	for _, o := range p.orderBy {
+		all = append(all, o.x)
+	}
+	for _, x := range all {
+		var err error
+		walk(x, func(x expr) bool {
+			c, ok := x.(*call)
+			if !ok || !isAggregate(c) {
+				return true
+			}
+			for _, arg := range c.args {
+				if inner := findAggregate(arg); inner != nil && err == nil {
+					err = fmt.Errorf("misuse of aggregate function %s() inside %s()", inner.name, c.name)
+				}
+			}
+			if !slices.Contains(p.aggs, c) {
+				p.aggs = append(p.aggs, c)
+			}
+			return false
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.grouped = len(p.groupBy) > 0 || len(p.aggs) > 0
+	if p.having != nil && !p.grouped {
+		return nil, fmt.Errorf("HAVING requires GROUP BY or an aggregate")
+	}
+
+	for _, x := range append(all, q.where) {
+		var err error
+		walk(x, func(x expr) bool {
+			if c, ok := x.(column); ok && !t.known(c.name) && err == nil {
+				err = fmt.Errorf("no such column: %s", c.name)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// walk calls fn for x and, while fn returns true, its subexpressions.
+func walk(x expr, fn func(expr) bool) {
+	if x == nil || !fn(x) {
+		return
+	}
+	switch x := x.(type) {
+	case unary:
+		walk(x.x, fn)
+	case binary:
+		walk(x.l, fn)
+		walk(x.r, fn)
+	case inList:
+		walk(x.x, fn)
+		for _, y := range x.list {
+			walk(y, fn)
+		}
+	case between:
+		walk(x.x, fn)
+		walk(x.lo, fn)
+		walk(x.hi, fn)
+	case caseExpr:
+		walk(x.operand, fn)
+		for _, w := range x.whens {
+			walk(w.cond, fn)
+			walk(w.then, fn)
+		}
+		walk(x.els, fn)
+	case castExpr:
+		walk(x.x, fn)
+	case *call:
+		for _, y := range x.args {
+			walk(y, fn)
+		}
+	}
+}
+
+// findAggregate returns an aggregate call in x, or nil.
+func findAggregate(x expr) *call {
+	var found *call
+	walk(x, func(x expr) bool {
+		if c, ok := x.(*call); ok && isAggregate(c) && found == nil {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// substitute replaces the column references of x naming an alias with the
+// aliased expression.
+func substitute(x expr, aliases map[string]expr) expr {
+	sub := func(x expr) expr { return substitute(x, aliases) }
+	switch x := x.(type) {
+	case column:
+		if a, ok := aliases[strings.ToLower(x.name)]; ok {
+			return a
+		}
+	case unary:
+		return unary{x.op, sub(x.x)}
+	case binary:
+		return binary{x.op, sub(x.l), sub(x.r)}
+	case inList:
+		list := make([]expr, len(x.list))
+		for i, y := range x.list {
+			list[i] = sub(y)
+		}
+		return inList{sub(x.x), list, x.not}
+	case between:
+		return between{sub(x.x), sub(x.lo), sub(x.hi), x.not}
+	case caseExpr:
+		c := caseExpr{operand: x.operand, els: x.els}
+		if c.operand != nil {
+			c.operand = sub(c.operand)
+		}
+		if c.els != nil {
+			c.els = sub(c.els)
+		}
+		for _, w := range x.whens {
+			c.whens = append(c.whens, when{sub(w.cond), sub(w.then)})
+		}
+		return c
+	case castExpr:
+		return castExpr{sub(x.x), x.typ}
+	case *call:
+		// Aggregates keep their identity, as they are collected by pointer
+		if isAggregate(x) {
+			return x
+		}
+		c := *x
+		c.args = make([]expr, len(x.args))
+		for i, y := range x.args {
+			c.args[i] = sub(y)
+		}
+		return &c
+	}
+	return x
+}
+
+// group is a group of rows of a grouped query.
+type group struct {
+	// row is the first row of the group, giving the values of columns
+	// outside aggregates.
+	row   map[string]any
+	aggs  []*call
+	state []aggState
+}
+
+func (g *group) values() map[*call]any {
+	m := make(map[*call]any, len(g.aggs))
+	for i, c := range g.aggs {
+		m[c] = g.state[i].result(c.name)
+	}
+	return m
+}
+
+// group splits rows into groups in order of first appearance, computing
+// the aggregates of each. Without GROUP BY, all rows are one group, even
+// when there are none.
+func (p *plan) group(e *env, rows []map[string]any) ([]*group, error) {
+	var groups []*group
+	index := map[string]*group{}
+	newGroup := func(row map[string]any) *group {
+		g := &group{row: row, aggs: p.aggs, state: make([]aggState, len(p.aggs))}
+		groups = append(groups, g)
+		return g
+	}
+	if len(p.groupBy) == 0 {
+		newGroup(map[string]any{})
+	}
+	for _, row := range rows {
+		e.row = row
+		var g *group
+		if len(p.groupBy) == 0 {
+			g = groups[0]
+			if len(g.row) == 0 {
+				g.row = row
+			}
+		} else {
+			var k strings.Builder
+			for _, x := range p.groupBy {
+				v, err := e.eval(x)
+				if err != nil {
+					return nil, err
+				}
+				k.WriteString(key(v))
+				k.WriteByte(0)
+			}
+			if g = index[k.String()]; g == nil {
+				g = newGroup(row)
+				index[k.String()] = g
+			}
+		}
+		for i, c := range p.aggs {
+			if err := g.state[i].add(e, c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return groups, nil
+}
+
+// aggState accumulates an aggregate over a group.
+type aggState struct {
+	count  int
+	sum    float64
+	sums   int // values summed
+	value  any // min or max
+	parts  []string
+	sep    string
+	seen   map[string]bool
+	hasSep bool
+}
+
+func (s *aggState) add(e *env, c *call) error {
+	if c.star {
+		s.count++
+		return nil
+	}
+	v, err := e.eval(c.args[0])
+	if err != nil || v == nil {
+		return err
+	}
+	if c.distinct {
+		if s.seen == nil {
+			s.seen = map[string]bool{}
+		}
+		if s.seen[key(v)] {
+			return nil
+		}
+		s.seen[key(v)] = true
+	}
+	s.count++
+	switch c.name {
+	case "sum", "avg":
+		if f, ok := number(v); ok {
+			s.sum += f
+			s.sums++
+		}
+	case "min":
+		if s.value == nil || order(v, s.value) < 0 {
+			s.value = v
+		}
+	case "max":
+		if s.value == nil || order(v, s.value) > 0 {
+			s.value = v
+		}
+	case "group_concat":
+		if !s.hasSep {
+			s.sep, s.hasSep = ",", true
+			if len(c.args) == 2 {
+				sep, err := e.eval(c.args[1])
+				if err != nil {
+					return err
+				}
+				s.sep = text(sep)
+			}
+		}
+		s.parts = append(s.parts, text(v))
+	}
+	return nil
+}
+
+func (s *aggState) result(name string) any {
+	switch name {
+	case "count":
+		return float64(s.count)
+	case "sum":
+		if s.sums == 0 {
+			return nil
+		}
+		return s.sum
+	case "avg":
+		if s.sums == 0 {
+			return nil
+		}
+		return s.sum / float64(s.sums)
+	case "min", "max":
+		return s.value
+	case "group_concat":
+		if len(s.parts) == 0 {
+			return nil
+		}
+		return strings.Join(s.parts, s.sep)
+	}
+	return nil
+}
+
+// cell is the text of a value in a table: NULL, or its text with line
+// breaks and tabs escaped.
+func cell(v any) string {
+	if v == nil {
+		return "NULL"
+	}
+	return cellEscaper.Replace(text(v))
+}
+
+var cellEscaper = strings.NewReplacer("\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// WriteTable writes the result as aligned columns under a header.
+func (r *Result) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(mapSlice(r.Columns, cellEscaper.Replace), "\t"))
+	for _, row := range r.Rows {
+		fmt.Fprintln(tw, strings.Join(mapSlice(row, cell), "\t"))
+	}
+	return tw.Flush()
+}
+
+func mapSlice[T any](s []T, fn func(T) string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = fn(v)
+	}
+	return out
+}
+
+// MarshalJSON encodes the result as an array of objects with the columns in
+// order; timestamps are formatted like recordfile.TimeLayout. A column
+// named like an earlier one gets a suffix such as "_2".
+func (r *Result) MarshalJSON() ([]byte, error) {
+	names := make([]string, len(r.Columns))
+	used := map[string]bool{}
+	for i, c := range r.Columns {
+		name := c
+		for n := 2; used[name]; n++ {
+			name = c + "_" + strconv.Itoa(n)
+		}
+		used[name] = true
+		b, _ := json.Marshal(name)
+		names[i] = string(b)
+	}
+	var b []byte
+	b = append(b, '[')
+	for i, row := range r.Rows {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, '{')
+		for j, v := range row {
+			if j > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, names[j]...)
+			b = append(b, ':')
+			if t, ok := v.(time.Time); ok {
+				v = text(t)
+			}
+			vb, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, vb...)
+		}
+		b = append(b, '}')
+	}
+	return append(b, ']'), nil
+}
@@ -0,0 +1,179 @@
+package query_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/query"
+)
+
+var t0 = time.Date(2025, 8, 31, 11, 0, 0, 0, time.UTC)
+
+var records = []model.LogRecord{
+	{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "e1", Message: `{"level":"ERROR","status":502,"latency":120.5,"http":{"path":"/pay"},"user":"ann"}` + "\n"},
+	{Timestamp: t0.Add(90 * time.Second), LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "e2", Message: `{"level":"INFO","status":200,"latency":20,"http":{"path":"/health"}}`},
+	{Timestamp: t0.Add(2 * time.Minute), LogGroup: "/aws/ecs/billing", LogStream: "b/1", Message: "timeout talking to db\tretrying"},
+	{Timestamp: t0.Add(3 * time.Minute), LogGroup: "/aws/lambda/api", LogStream: "s2", EventID: "e4", Message: `{"level":"ERROR","status":500,"latency":300,"http":{"path":"/pay"},"user":"bob"}`},
+	{Timestamp: t0.Add(65 * time.Minute), LogGroup: "/aws/ecs/billing", LogStream: "b/2", Message: `{"level":"error","status":"n/a","message":"db down"}`},
+}
+
+// run runs sql over records and returns the result as JSON.
+func run(t *testing.T, sql string) string {
+	t.Helper()
+	q, err := query.Parse(sql)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	res, err := q.Run(records, parser.FormatAuto)
+	if err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct{ sql, want string }{
+		{"SELECT log_group, count(*) AS n FROM records GROUP BY log_group ORDER BY n DESC",
+			`[{"log_group":"/aws/lambda/api","n":3},{"log_group":"/aws/ecs/billing","n":2}]`},
+		{"select timestamp, event_id, http_path from records where level = 'ERROR' order by timestamp desc limit 1",
+			`[{"timestamp":"2025-08-31T11:03:00.000Z","event_id":"e4","http_path":"/pay"}]`},
+		// Identifiers are not case sensitive; fields missing from a row are NULL
+		{"SELECT Level, User FROM records ORDER BY 1, 2", `[{"Level":null,"User":null},{"Level":"ERROR","User":"ann"},{"Level":"ERROR","User":"bob"},{"Level":"INFO","User":null},{"Level":"error","User":null}]`},
+		{"SELECT upper(level) AS lvl, count(*), avg(latency), max(status), min(timestamp) FROM records WHERE level IS NOT NULL GROUP BY lvl ORDER BY 2 DESC",
+			`[{"lvl":"ERROR","count(*)":3,"avg(latency)":210.25,"max(status)":"n/a","min(timestamp)":"2025-08-31T11:00:00.000Z"},{"lvl":"INFO","count(*)":1,"avg(latency)":20,"max(status)":200,"min(timestamp)":"2025-08-31T11:01:30.000Z"}]`},
+		{"SELECT count(*), count(user), count(DISTINCT log_stream), sum(status), group_concat(DISTINCT user, '|') FROM records",
+			`[{"count(*)":5,"count(user)":2,"count(DISTINCT log_stream)":4,"sum(status)":1202,"group_concat(DISTINCT user, '|')":"ann|bob"}]`},
+		{"SELECT count(*) FROM records WHERE level = 'none'", `[{"count(*)":0}]`},
+		{"SELECT date_trunc('hour', timestamp) AS hour, count(*) n FROM records GROUP BY hour HAVING count(*) > 1",
+			`[{"hour":"2025-08-31T11:00:00.000Z","n":4}]`},
+		{"SELECT strftime('%Y-%m-%d %H:%M', timestamp) t FROM records WHERE timestamp >= '2025-08-31 12:00'",
+			`[{"t":"2025-08-31 12:05"}]`},
+		{"SELECT DISTINCT log_group FROM records ORDER BY log_group", `[{"log_group":"/aws/ecs/billing"},{"log_group":"/aws/lambda/api"}]`},
+		{"SELECT event_id FROM records WHERE message LIKE '%TIMEOUT%' OR fields_message REGEXP '^db' ORDER BY timestamp", `[{"event_id":null},{"event_id":null}]`},
+		{"SELECT count(*) n FROM records WHERE message LIKE 'timeout%retry_ng' AND message NOT LIKE 't%x'", `[{"n":1}]`},
+		{"SELECT status FROM records WHERE status BETWEEN 200 AND 500 AND status NOT IN (200) ", `[{"status":500}]`},
+		// Text that is not a number compares greater than numbers, as in SQLite
+		{"SELECT CASE WHEN status >= 500 THEN 'fail' WHEN status IS NULL THEN '-' ELSE 'ok' END AS r, count(*) FROM records GROUP BY 1 ORDER BY r",
+			`[{"r":"-","count(*)":1},{"r":"fail","count(*)":3},{"r":"ok","count(*)":1}]`},
+		{"SELECT CAST(status AS TEXT) || '!' s, CAST('12.7' AS INTEGER) i, 7 / 2 d, 7 % 2 m, 1 / 0 z, -latency neg FROM records LIMIT 1",
+			`[{"s":"502!","i":12,"d":3.5,"m":1,"z":null,"neg":-120.5}]`},
+		{"SELECT log_stream FROM records ORDER BY timestamp LIMIT 2 OFFSET 3", `[{"log_stream":"s2"},{"log_stream":"b/2"}]`},
+		{"SELECT regexp_extract(message, 'talking to (\\w+)') db, substr(log_group, -7) g, json_extract(message, '$.http.path') p, typeof(timestamp) ty FROM records WHERE log_stream = 'b/1' OR event_id = 'e1' ORDER BY p",
+			`[{"db":"db","g":"billing","p":null,"ty":"timestamp"},{"db":null,"g":"bda/api","p":"/pay","ty":"timestamp"}]`},
+		{"SELECT coalesce(user, 'anon') u, max(timestamp) - min(timestamp) AS span_ms FROM records GROUP BY u ORDER BY span_ms DESC, u",
+			`[{"u":"anon","span_ms":3810000},{"u":"ann","span_ms":0},{"u":"bob","span_ms":0}]`},
+		// substr, round and arithmetic on text follow SQLite
+		{"SELECT substr('abc', 2, -1) a, substr('abc', -5) b, substr('abc', 0, 2) c, substr('abc', -2, -1) d, substr('abc', 4) e FROM records LIMIT 1",
+			`[{"a":"a","b":"abc","c":"a","d":"a","e":""}]`},
+		{"SELECT substr('abc', 2, 9223372036854775807) a, substr('abc', 2, -9223372036854775807) b, substr('abc', -9223372036854775807, 9223372036854775807) c, substr('abc', -100, 99) d, substr('abc', 1e300, 2) e, substr('abc', 3, -1e300) f FROM records LIMIT 1",
+			`[{"a":"bc","b":"a","c":"abc","d":"ab","e":"","f":"ab"}]`},
+		{"SELECT round(1.55, -1) a, round(1.55, 1) b, round(-2.5) c, round('3.7x') d FROM records LIMIT 1", `[{"a":2,"b":1.6,"c":-3,"d":4}]`},
+		{"SELECT 'abc' + 1 a, '12abc' * 2 b, -'5x' c, ' 1e2 ' + 0 d, abs('-3 apples') e, NULL + 1 f FROM records LIMIT 1",
+			`[{"a":1,"b":24,"c":-5,"d":100,"e":3,"f":null}]`},
+		{"SELECT count(*) count, count(*) FROM records", `[{"count":5,"count(*)":5}]`},
+		{"SELECT 1 AS x, 2 AS x FROM records LIMIT 1", `[{"x":1,"x_2":2}]`},
+	} {
+		if got := run(t, tt.sql); got != tt.want {
+			t.Errorf("%s\ngot  %s\nwant %s", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestRunStar(t *testing.T) {
+	q, _ := query.Parse(`SELECT * FROM records WHERE "event_id" = 'e2'`)
+	res, err := q.Run(records, parser.FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "timestamp log_group log_stream event_id message fields_message http_path latency level status user"
+	if got := strings.Join(res.Columns, " "); got != want {
+		t.Fatalf("columns = %s", got)
+	}
+	if len(res.Rows) != 1 || res.Rows[0][1] != "/aws/lambda/api" || res.Rows[0][10] != nil {
+		t.Fatalf("rows = %v", res.Rows)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	q, _ := query.Parse("SELECT timestamp, log_group, message, event_id FROM records WHERE log_stream = 'b/1'")
+	res, err := q.Run(records, parser.FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := res.WriteTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"timestamp                 log_group         message                          event_id\n" +
+		"2025-08-31T11:02:00.000Z  /aws/ecs/billing  timeout talking to db\\tretrying  NULL\n"
+	if buf.String() != want {
+		t.Fatalf("table:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for sql, want := range map[string]string{
+		"":                                                  "expected SELECT near end of statement",
+		"SELECT level":                                      "expected FROM near end of statement",
+		"SELECT level FROM logs":                            `expected table records near "logs" at position 19`,
+		"SELECT level FROM records WHERE":                   "expected an expression near end of statement",
+		"SELECT count(level FROM records":                   `expected ")" near "FROM" at position 20`,
+		"SELECT nosuch(level) FROM records":                 "no such function: nosuch",
+		"SELECT lower(level, 1) FROM records":               "wrong number of arguments to function lower()",
+		"SELECT sum(*) FROM records":                        `sum(*) is not a function; only count(*) is near "*" at position 12`,
+		"SELECT level FROM records LIMIT -1":                `LIMIT must be a non-negative integer near "-" at position 33`,
+		"SELECT 'open FROM records":                         "unterminated ' at position 8",
+		"SELECT level FROM records WHERE a ~ b":             `unexpected '~' at position 35`,
+		"SELECT level FROM records; DELETE":                 `unexpected input near "DELETE" at position 28`,
+		"SELECT level FROM records WHERE a NOT = 1":         `expected LIKE, REGEXP, IN or BETWEEN near "=" at position 39`,
+		"SELECT CAST(level AS blob) FROM records":           `expected a type: TEXT, REAL, INTEGER, BOOLEAN or TIMESTAMP near "blob" at position 22`,
+		"SELECT lower(DISTINCT level) FROM records":         "DISTINCT applies to aggregate functions only, not lower()",
+		"SELECT level AS FROM records":                      `expected a column alias near "FROM" at position 17`,
+		"SELECT level FROM records ORDER BY level ASC DESC": `unexpected input near "DESC" at position 46`,
+	} {
+		_, err := query.Parse(sql)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %s", sql, err, want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for sql, want := range map[string]string{
+		"SELECT nosuch FROM records":                             "no such column: nosuch",
+		"SELECT level FROM records WHERE count(*) > 1":           "misuse of aggregate function count() in WHERE or GROUP BY",
+		"SELECT max(count(*)) FROM records":                      "misuse of aggregate function count() inside max()",
+		"SELECT level FROM records HAVING level = 'x'":           "HAVING requires GROUP BY or an aggregate",
+		"SELECT level FROM records ORDER BY 3":                   "ORDER BY term out of range: 3",
+		"SELECT count(*) FROM records GROUP BY 1":                "misuse of aggregate function count() in WHERE or GROUP BY",
+		"SELECT level FROM records WHERE message REGEXP '('":     "REGEXP: error parsing regexp: missing closing ): `(`",
+		"SELECT date_trunc('fortnight', timestamp) FROM records": `date_trunc(): unknown unit "fortnight"; expected second, minute, hour, day, week, month, year or a duration such as 5m`,
+		"SELECT strftime('%Q', timestamp) FROM records":          "strftime(): unknown conversion %Q",
+		"SELECT json_extract(message, 'http.path') FROM records": `json_extract(): path "http.path" does not start with $`,
+	} {
+		q, err := query.Parse(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		if _, err := q.Run(records, parser.FormatAuto); err == nil || err.Error() != want {
+			t.Errorf("%q: err = %v, want %s", sql, err, want)
+		}
+	}
+
+	// With no records, any field column might exist
+	q, _ := query.Parse("SELECT nosuch, count(*) FROM records")
+	res, err := q.Run(nil, parser.FormatAuto)
+	if err != nil || len(res.Rows) != 1 || res.Rows[0][0] != nil || res.Rows[0][1] != 0.0 {
+		t.Fatalf("res = %v, err = %v", res, err)
+	}
+}
@@ -0,0 +1,121 @@
+package recordfile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TimeLayout is the format of timestamps in NDJSON files.
+const TimeLayout = "2006-01-02T15:04:05.000Z"
+
+// ndjsonWriter writes one JSON object per record, with the columns in order
+// followed by the flattened fields in name order.
+type ndjsonWriter struct {
+	opts Options
+	zw   io.WriteCloser
+	w    *bufio.Writer
+}
+
+func newNDJSONWriter(w io.Writer, format Format, opts Options) (*ndjsonWriter, error) {
+	var zw io.WriteCloser
+	if format == FormatNDJSONZstd {
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		zw = enc
+	} else {
+		zw = gzip.NewWriter(w)
+	}
+	return &ndjsonWriter{opts: opts, zw: zw, w: bufio.NewWriter(zw)}, nil
+}
+
+func (n *ndjsonWriter) Write(records []model.LogRecord) error {
+	for _, r := range records {
+		rw := n.opts.row(r)
+		n.w.WriteString(`{"` + ColumnTimestamp + `":`)
+		n.value(r.Timestamp.UTC().Format(TimeLayout))
+		n.field(ColumnGroup, r.LogGroup)
+		n.field(ColumnStream, r.LogStream)
+		if r.EventID != "" {
+			n.field(ColumnEventID, r.EventID)
+		}
+		n.field(ColumnMessage, message(r))
+		for _, k := range sortedKeys(rw.fields) {
+			n.field(k, rw.fields[k])
+		}
+		if _, err := n.w.WriteString("}\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) field(name string, v any) {
+	n.w.WriteByte(',')
+	n.value(name)
+	n.w.WriteByte(':')
+	n.value(v)
+}
+
+func (n *ndjsonWriter) value(v any) {
+	b, _ := json.Marshal(v)
+	n.w.Write(b)
+}
+
+func (n *ndjsonWriter) Close() error {
+	if err := n.w.Flush(); err != nil {
+		return err
+	}
+	return n.zw.Close()
+}
+
+// readNDJSON reads the records of an NDJSON file; fields other than the
+// columns are not read.
+func readNDJSON(r io.Reader, format Format) ([]model.LogRecord, error) {
+	var zr io.Reader
+	if format == FormatNDJSONZstd {
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		zr = dec
+	} else {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		zr = gr
+	}
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	var records []model.LogRecord
+	for line := 1; ; line++ {
+		var row struct {
+			Timestamp string `json:"timestamp"`
+			LogGroup  string `json:"log_group"`
+			LogStream string `json:"log_stream"`
+			EventID   string `json:"event_id"`
+			Message   string `json:"message"`
+		}
+		if err := dec.Decode(&row); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, row.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s %q", line, ColumnTimestamp, row.Timestamp)
+		}
+		records = append(records, model.LogRecord{Timestamp: ts.UTC(), LogGroup: row.LogGroup, LogStream: row.LogStream, EventID: row.EventID, Message: row.Message})
+	}
+}
@@ -0,0 +1,64 @@
+package recordfile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNDJSON(t *testing.T) {
+	for _, tt := range []struct {
+		format     recordfile.Format
+		decompress func(io.Reader) (io.Reader, error)
+	}{
+		{recordfile.FormatNDJSONGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{recordfile.FormatNDJSONZstd, func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+	} {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := recordfile.NewWriter(&buf, tt.format, recordfile.Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(records[:2])
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := tt.decompress(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(r)
+			want := `{"timestamp":"2025-08-31T11:00:00.000Z","log_group":"/aws/lambda/api","log_stream":"s1","event_id":"e1","message":"{\"level\":\"error\",\"status\":502,\"ok\":false,\"http\":{\"path\":\"/pay\",\"method\":\"POST\"},\"tags\":[\"a\",\"b\"],\"message\":\"boom\",\"none\":null}"}` + "\n" +
+				`{"timestamp":"2025-08-31T11:00:01.500Z","log_group":"/aws/ecs/billing","log_stream":"b/1","message":"plain text"}` + "\n"
+			if string(got) != want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestNDJSONFlatten(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := recordfile.NewWriter(&buf, recordfile.FormatNDJSONGzip, recordfile.Options{Flatten: true})
+	w.Write(records)
+	w.Close()
+	r, _ := gzip.NewReader(&buf)
+	got, _ := io.ReadAll(r)
+	lines := strings.Split(strings.TrimSuffix(string(got), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines = %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], `"fields_message":"boom","http_method":"POST","http_path":"/pay","level":"error","ok":false,"status":502,"tags":"[\"a\",\"b\"]"}`) {
+		t.Errorf("structured: %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `"message":"plain text"}`) {
+		t.Errorf("unstructured: %s", lines[1])
+	}
+}
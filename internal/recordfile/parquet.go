@@ -0,0 +1,583 @@
+package recordfile
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Parquet physical types, repetitions, encodings and codecs used.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecZstd = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	pageData = 0
+)
+
+// parquetMagic starts and ends a Parquet file.
+const parquetMagic = "PAR1"
+
+// CreatedBy is the writer named in Parquet files.
+const CreatedBy = "aws-multi-log-inspector"
+
+// parquetColumn is a leaf column of the schema.
+type parquetColumn struct {
+	name     string
+	typ      int32
+	optional bool
+	// value returns the column's value of a row, nil for null.
+	value func(row) any
+}
+
+// columnChunk is the metadata of a written column chunk.
+type columnChunk struct {
+	offset, compressed, uncompressed int64
+	values                           int64
+}
+
+type rowGroup struct {
+	rows    int64
+	columns []columnChunk
+}
+
+// parquetWriter writes a Parquet file with one ZSTD-compressed PLAIN data
+// page per column chunk, buffering RowGroupSize records per row group.
+type parquetWriter struct {
+	w       io.Writer
+	opts    Options
+	offset  int64
+	err     error
+	columns []parquetColumn
+	// fields holds the flattened fields that have a column, and names the
+	// lower-cased names of the columns.
+	fields  map[string]bool
+	names   map[string]bool
+	dropped int
+	rows    []row
+	groups  []rowGroup
+	enc     *zstd.Encoder
+}
+
+func newParquetWriter(w io.Writer, opts Options) *parquetWriter {
+	enc, _ := zstd.NewWriter(nil)
+	p := &parquetWriter{w: w, opts: opts, enc: enc, columns: baseColumns, fields: map[string]bool{}, names: map[string]bool{}}
+	for _, c := range baseColumns {
+		p.names[c.name] = true
+	}
+	return p
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	var n int
+	n, p.err = p.w.Write(b)
+	p.offset += int64(n)
+}
+
+func (p *parquetWriter) Write(records []model.LogRecord) error {
+	for _, r := range records {
+		p.rows = append(p.rows, p.opts.row(r))
+		if len(p.rows) == p.opts.RowGroupSize {
+			p.flush()
+		}
+	}
+	return p.err
+}
+
+// baseColumns are the columns of every file.
+var baseColumns = []parquetColumn{
+	{name: ColumnTimestamp, typ: parquetInt64, value: func(r row) any { return r.Timestamp.UnixMilli() }},
+	{name: ColumnGroup, typ: parquetByteArray, value: func(r row) any { return r.LogGroup }},
+	{name: ColumnStream, typ: parquetByteArray, value: func(r row) any { return r.LogStream }},
+	{name: ColumnEventID, typ: parquetByteArray, optional: true, value: func(r row) any {
+		if r.EventID == "" {
+			return nil
+		}
+		return r.EventID
+	}},
+	{name: ColumnMessage, typ: parquetByteArray, value: func(r row) any { return message(r.LogRecord) }},
+}
+
+// addColumns adds a column per flattened field first found in the buffered
+// rows: DOUBLE or BOOLEAN when all its values there are, else a string. A
+// name differing only in case from an earlier column gets the suffix _2, _3
+// and so on, as query engines match column names case-insensitively.
+func (p *parquetWriter) addColumns() {
+	types := map[string]int32{}
+	for _, r := range p.rows {
+		for k, v := range r.fields {
+			if p.fields[k] {
+				continue
+			}
+			typ := int32(parquetByteArray)
+			switch v.(type) {
+			case float64:
+				typ = parquetDouble
+			case bool:
+				typ = parquetBoolean
+			}
+			if t, ok := types[k]; ok && t != typ {
+				typ = parquetByteArray
+			}
+			types[k] = typ
+		}
+	}
+	for _, k := range sortedKeys(types) {
+		p.fields[k] = true
+		name := k
+		for i := 2; p.names[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s_%d", k, i)
+		}
+		p.names[strings.ToLower(name)] = true
+		typ := types[k]
+		p.columns = append(p.columns, parquetColumn{name: name, typ: typ, optional: true, value: func(r row) any {
+			v, ok := r.fields[k]
+			if !ok {
+				return nil
+			}
+			switch v := v.(type) {
+			case float64:
+				if typ == parquetDouble {
+					return v
+				}
+			case bool:
+				if typ == parquetBoolean {
+					return v
+				}
+			case string:
+				if typ == parquetByteArray {
+					return v
+				}
+			}
+			// A value of another type than the column's: text in a string
+			// column, else left out
+			if typ != parquetByteArray {
+				p.dropped++
+				return nil
+			}
+			b, _ := json.Marshal(v)
+			return string(b)
+		}})
+	}
+}
+
+// Dropped returns the number of flattened values left out because a
+// column of another type holds their field.
+func (p *parquetWriter) Dropped() int {
+	return p.dropped
+}
+
+// flush writes the buffered rows as a row group.
+func (p *parquetWriter) flush() {
+	if p.offset == 0 {
+		p.write([]byte(parquetMagic))
+	}
+	if len(p.rows) == 0 {
+		return
+	}
+	p.addColumns()
+	g := rowGroup{rows: int64(len(p.rows))}
+	for _, c := range p.columns {
+		g.columns = append(g.columns, p.writeColumn(c, p.rows))
+	}
+	p.groups = append(p.groups, g)
+	p.rows = p.rows[:0]
+}
+
+// writeColumn writes the column chunk of c over rows as one data page.
+func (p *parquetWriter) writeColumn(c parquetColumn, rows []row) columnChunk {
+	var levels []bool
+	var values []byte
+	var bits []bool
+	for _, r := range rows {
+		v := c.value(r)
+		if v == nil {
+			levels = append(levels, false)
+			continue
+		}
+		levels = append(levels, true)
+		switch v := v.(type) {
+		case int64:
+			values = binary.LittleEndian.AppendUint64(values, uint64(v))
+		case float64:
+			values = binary.LittleEndian.AppendUint64(values, math.Float64bits(v))
+		case bool:
+			bits = append(bits, v)
+		case string:
+			values = binary.LittleEndian.AppendUint32(values, uint32(len(v)))
+			values = append(values, v...)
+		}
+	}
+	if c.typ == parquetBoolean {
+		values = make([]byte, (len(bits)+7)/8)
+		for i, b := range bits {
+			if b {
+				values[i/8] |= 1 << (i % 8)
+			}
+		}
+	}
+	var page []byte
+	if c.optional {
+		rle := rleLevels(levels)
+		page = binary.LittleEndian.AppendUint32(page, uint32(len(rle)))
+		page = append(page, rle...)
+	}
+	page = append(page, values...)
+	compressed := p.enc.EncodeAll(page, nil)
+
+	var h thrift
+	h.i32(1, pageData)
+	h.i32(2, int32(len(page)))
+	h.i32(3, int32(len(compressed)))
+	h.structField(5, func() {
+		h.i32(1, int32(len(rows)))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+	})
+	h.buf = append(h.buf, 0)
+	chunk := columnChunk{
+		offset:       p.offset,
+		compressed:   int64(len(h.buf) + len(compressed)),
+		uncompressed: int64(len(h.buf) + len(page)),
+		values:       int64(len(rows)),
+	}
+	p.write(h.buf)
+	p.write(compressed)
+	return chunk
+}
+
+// rleLevels encodes definition levels of bit width 1 as RLE runs of the
+// RLE/bit-packing hybrid encoding.
+func rleLevels(levels []bool) []byte {
+	var b []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		b = binary.AppendUvarint(b, uint64(j-i)<<1)
+		if levels[i] {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+		i = j
+	}
+	return b
+}
+
+// Close writes the last row group and the file metadata. Row groups
+// written before a column was added get a chunk of nulls for it, after the
+// last row group.
+func (p *parquetWriter) Close() error {
+	p.flush()
+	for i := range p.groups {
+		g := &p.groups[i]
+		for _, c := range p.columns[len(g.columns):] {
+			g.columns = append(g.columns, p.writeColumn(c, make([]row, g.rows)))
+		}
+	}
+	var m thrift
+	m.i32(1, 1)
+	m.structList(2, len(p.columns)+1, func(i int) {
+		if i == 0 {
+			m.string(4, "schema")
+			m.i32(5, int32(len(p.columns)))
+			return
+		}
+		c := p.columns[i-1]
+		m.i32(1, c.typ)
+		if c.optional {
+			m.i32(3, parquetOptional)
+		} else {
+			m.i32(3, parquetRequired)
+		}
+		m.string(4, c.name)
+		switch {
+		case c.typ == parquetByteArray:
+			m.i32(6, convertedUTF8)
+			m.structField(10, func() { m.structField(1, func() {}) })
+		case c.name == ColumnTimestamp:
+			m.i32(6, convertedTimestampMillis)
+			m.structField(10, func() {
+				m.structField(8, func() {
+					m.bool(1, true)
+					m.structField(2, func() { m.structField(1, func() {}) })
+				})
+			})
+		}
+	})
+	var rows int64
+	for _, g := range p.groups {
+		rows += g.rows
+	}
+	m.i64(3, rows)
+	m.structList(4, len(p.groups), func(i int) {
+		g := p.groups[i]
+		var size int64
+		m.structList(1, len(g.columns), func(j int) {
+			cc, c := g.columns[j], p.columns[j]
+			size += cc.uncompressed
+			m.i64(2, cc.offset)
+			m.structField(3, func() {
+				m.i32(1, c.typ)
+				m.i32List(2, encodingPlain, encodingRLE)
+				m.stringList(3, c.name)
+				m.i32(4, codecZstd)
+				m.i64(5, cc.values)
+				m.i64(6, cc.uncompressed)
+				m.i64(7, cc.compressed)
+				m.i64(9, cc.offset)
+			})
+		})
+		m.i64(2, size)
+		m.i64(3, g.rows)
+	})
+	m.string(6, CreatedBy)
+	m.buf = append(m.buf, 0)
+	p.write(m.buf)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(m.buf))))
+	p.write([]byte(parquetMagic))
+	p.enc.Close()
+	return p.err
+}
+
+// Parquet codecs and page types read.
+const (
+	codecUncompressed = 0
+	pageDictionary    = 2
+)
+
+// errUnsupported reports Parquet files written differently from
+// parquetWriter.
+var errUnsupported = errors.New("unsupported Parquet file; only files written by this tool can be read")
+
+// readParquet reads the records of a Parquet file written by parquetWriter:
+// PLAIN-encoded pages, uncompressed or ZSTD-compressed. The flattened
+// columns are not read.
+func readParquet(data []byte) ([]model.LogRecord, error) {
+	n := len(data)
+	if n < 12 || string(data[:4]) != parquetMagic || string(data[n-4:]) != parquetMagic {
+		return nil, errors.New("not a Parquet file")
+	}
+	size := int(binary.LittleEndian.Uint32(data[n-8:]))
+	if size > n-12 {
+		return nil, errThrift
+	}
+	meta, _, err := decodeStruct(data[n-8-size : n-8])
+	if err != nil {
+		return nil, err
+	}
+	// index maps the base columns to their position in the row groups
+	index := map[string]int{}
+	var leaves []tstruct
+	for _, e := range meta.list(2) {
+		if e, ok := e.(tstruct); ok && e.int(5) == 0 {
+			index[e.string(4)] = len(leaves)
+			leaves = append(leaves, e)
+		}
+	}
+	for _, c := range Columns {
+		if _, ok := index[c]; !ok {
+			return nil, fmt.Errorf("%w: no %s column", errUnsupported, c)
+		}
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	var records []model.LogRecord
+	for _, g := range meta.list(4) {
+		g, _ := g.(tstruct)
+		chunks := g.list(1)
+		rows := int(g.int(3))
+		if rows < 0 || rows > n {
+			return nil, errThrift
+		}
+		columns := map[string][]any{}
+		for _, c := range Columns {
+			i := index[c]
+			if i >= len(chunks) {
+				return nil, errThrift
+			}
+			chunk, _ := chunks[i].(tstruct)
+			values, err := readColumn(data, dec, leaves[i], chunk.structField(3), rows)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c, err)
+			}
+			columns[c] = values
+		}
+		for i := range rows {
+			ts, _ := columns[ColumnTimestamp][i].(int64)
+			r := model.LogRecord{Timestamp: time.UnixMilli(ts).UTC()}
+			r.LogGroup, _ = columns[ColumnGroup][i].(string)
+			r.LogStream, _ = columns[ColumnStream][i].(string)
+			r.EventID, _ = columns[ColumnEventID][i].(string)
+			r.Message, _ = columns[ColumnMessage][i].(string)
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// readColumn reads the values of a column chunk: an int64, float64, bool or
+// string, or nil for null.
+func readColumn(data []byte, dec *zstd.Decoder, schema, meta tstruct, rows int) ([]any, error) {
+	codec := meta.int(4)
+	if codec != codecZstd && codec != codecUncompressed {
+		return nil, errUnsupported
+	}
+	typ, optional := schema.int(1), schema.int(3) == parquetOptional
+	offset := meta.int(9)
+	var values []any
+	for len(values) < rows {
+		if offset < 0 || offset >= int64(len(data)) {
+			return nil, errThrift
+		}
+		header, rest, err := decodeStruct(data[offset:])
+		if err != nil {
+			return nil, err
+		}
+		size := header.int(3)
+		if size < 0 || size > int64(len(rest)) {
+			return nil, errThrift
+		}
+		offset = int64(len(data)-len(rest)) + size
+		page := rest[:size]
+		if header.int(1) == pageDictionary {
+			return nil, errUnsupported
+		}
+		dp := header.structField(5)
+		if header.int(1) != pageData || dp == nil || dp.int(2) != encodingPlain {
+			return nil, errUnsupported
+		}
+		if codec == codecZstd {
+			if page, err = dec.DecodeAll(page, nil); err != nil {
+				return nil, err
+			}
+		}
+		count := int(dp.int(1))
+		if count <= 0 || count > rows-len(values) {
+			return nil, errThrift
+		}
+		defined := make([]bool, count)
+		if optional {
+			if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+				return nil, errThrift
+			}
+			n := int(binary.LittleEndian.Uint32(page))
+			if defined, err = decodeLevels(page[4:4+n], count); err != nil {
+				return nil, err
+			}
+			page = page[4+n:]
+		} else {
+			for i := range defined {
+				defined[i] = true
+			}
+		}
+		if values, err = plainValues(values, page, typ, defined); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// decodeLevels decodes n definition levels of bit width 1 encoded with the
+// RLE/bit-packing hybrid encoding.
+func decodeLevels(b []byte, n int) ([]bool, error) {
+	levels := make([]bool, 0, n)
+	for len(levels) < n {
+		h, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, errThrift
+		}
+		b = b[k:]
+		if h&1 == 0 {
+			// RLE run of one value
+			if len(b) == 0 {
+				return nil, errThrift
+			}
+			for range min(int(h>>1), n-len(levels)) {
+				levels = append(levels, b[0] == 1)
+			}
+			b = b[1:]
+			continue
+		}
+		// Bit-packed run of h>>1 groups of 8 values, a byte each
+		groups := int(h >> 1)
+		if groups > len(b) {
+			return nil, errThrift
+		}
+		for i := 0; i < groups*8 && len(levels) < n; i++ {
+			levels = append(levels, b[i/8]&(1<<(i%8)) != 0)
+		}
+		b = b[groups:]
+	}
+	return levels, nil
+}
+
+// plainValues appends the PLAIN-encoded values of a page to values.
+func plainValues(values []any, b []byte, typ int64, defined []bool) ([]any, error) {
+	bit := 0
+	for _, d := range defined {
+		if !d {
+			values = append(values, nil)
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			if bit/8 >= len(b) {
+				return nil, errThrift
+			}
+			values = append(values, b[bit/8]&(1<<(bit%8)) != 0)
+			bit++
+		case parquetInt64, parquetDouble:
+			if len(b) < 8 {
+				return nil, errThrift
+			}
+			v := binary.LittleEndian.Uint64(b)
+			if typ == parquetInt64 {
+				values = append(values, int64(v))
+			} else {
+				values = append(values, math.Float64frombits(v))
+			}
+			b = b[8:]
+		case parquetByteArray:
+			if len(b) < 4 || int(binary.LittleEndian.Uint32(b)) > len(b)-4 {
+				return nil, errThrift
+			}
+			n := int(binary.LittleEndian.Uint32(b))
+			values = append(values, string(b[4:4+n]))
+			b = b[4+n:]
+		default:
+			return nil, errUnsupported
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,256 @@
+package recordfile_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// tstruct is a decoded Thrift compact struct: field id to an int64, bool,
+// float64, []byte, []any or tstruct.
+type tstruct map[int16]any
+
+func thriftStruct(t *testing.T, b []byte) (tstruct, []byte) {
+	t.Helper()
+	s := tstruct{}
+	var last int16
+	for {
+		h := b[0]
+		b = b[1:]
+		if h == 0 {
+			return s, b
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v, n := binary.Varint(b)
+			id, b = int16(v), b[n:]
+		}
+		last = id
+		s[id], b = thriftValue(t, h&0x0f, b)
+	}
+}
+
+func thriftValue(t *testing.T, typ byte, b []byte) (any, []byte) {
+	t.Helper()
+	switch typ {
+	case 1, 2:
+		return typ == 1, b
+	case 3:
+		return int64(b[0]), b[1:]
+	case 4, 5, 6:
+		v, n := binary.Varint(b)
+		return v, b[n:]
+	case 7:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:]
+	case 8:
+		l, n := binary.Uvarint(b)
+		return b[n : n+int(l)], b[n+int(l):]
+	case 9, 10:
+		size, elem := int(b[0]>>4), b[0]&0x0f
+		b = b[1:]
+		if size == 15 {
+			l, n := binary.Uvarint(b)
+			size, b = int(l), b[n:]
+		}
+		list := make([]any, size)
+		for i := range list {
+			if elem == 1 || elem == 2 {
+				list[i], b = b[0] == 1, b[1:]
+				continue
+			}
+			list[i], b = thriftValue(t, elem, b)
+		}
+		return list, b
+	case 12:
+		return thriftStruct(t, b)
+	}
+	t.Fatalf("thrift type %d", typ)
+	return nil, nil
+}
+
+// parquetFile is a Parquet file decoded for tests.
+type parquetFile struct {
+	data []byte
+	meta tstruct
+}
+
+func openParquet(t *testing.T, data []byte) parquetFile {
+	t.Helper()
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("no magic")
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta, rest := thriftStruct(t, data[len(data)-8-n:len(data)-8])
+	if len(rest) != 0 {
+		t.Fatalf("%d bytes after metadata", len(rest))
+	}
+	return parquetFile{data, meta}
+}
+
+// schema returns "name type repetition" of each leaf column.
+func (p parquetFile) schema() []string {
+	var cols []string
+	for _, e := range p.meta[2].([]any)[1:] {
+		e := e.(tstruct)
+		cols = append(cols, string(e[4].([]byte))+" "+map[int64]string{0: "BOOLEAN", 2: "INT64", 5: "DOUBLE", 6: "BYTE_ARRAY"}[e[1].(int64)]+" "+map[int64]string{0: "REQUIRED", 1: "OPTIONAL"}[e[3].(int64)])
+	}
+	return cols
+}
+
+// column returns the values of the column at index col in row group g: an
+// int64, float64, bool or string, or nil for null.
+func (p parquetFile) column(t *testing.T, g, col int) []any {
+	t.Helper()
+	schema := p.meta[2].([]any)[col+1].(tstruct)
+	optional := schema[3].(int64) == 1
+	chunk := p.meta[4].([]any)[g].(tstruct)[1].([]any)[col].(tstruct)
+	meta := chunk[3].(tstruct)
+	if meta[4].(int64) != 6 {
+		t.Fatalf("codec %d", meta[4])
+	}
+	header, rest := thriftStruct(t, p.data[meta[9].(int64):])
+	page, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := page.DecodeAll(rest[:header[3].(int64)], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(b)) != header[2].(int64) {
+		t.Fatalf("page size %d, header %d", len(b), header[2])
+	}
+	rows := int(header[5].(tstruct)[1].(int64))
+	defined := make([]bool, 0, rows)
+	if optional {
+		n := binary.LittleEndian.Uint32(b)
+		levels := b[4 : 4+n]
+		b = b[4+n:]
+		for len(levels) > 0 {
+			h, n := binary.Uvarint(levels)
+			if h&1 != 0 {
+				t.Fatal("bit-packed run")
+			}
+			for range h >> 1 {
+				defined = append(defined, levels[n] == 1)
+			}
+			levels = levels[n+1:]
+		}
+	} else {
+		for range rows {
+			defined = append(defined, true)
+		}
+	}
+	var values []any
+	bit := 0
+	for _, d := range defined {
+		if !d {
+			values = append(values, nil)
+			continue
+		}
+		switch schema[1].(int64) {
+		case 0:
+			values = append(values, b[bit/8]&(1<<(bit%8)) != 0)
+			bit++
+		case 2:
+			values = append(values, int64(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case 5:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(b)))
+			b = b[8:]
+		case 6:
+			n := binary.LittleEndian.Uint32(b)
+			values = append(values, string(b[4:4+n]))
+			b = b[4+n:]
+		}
+	}
+	return values
+}
+
+func TestParquet(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := recordfile.NewWriter(&buf, recordfile.FormatParquet, recordfile.Options{Flatten: true, RowGroupSize: 2})
+	w.Write(records[:1])
+	w.Write(records[1:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := openParquet(t, buf.Bytes())
+	// The fields of the first row group, then those found later: Level
+	// differs from level only in case
+	want := []string{
+		"timestamp INT64 REQUIRED", "log_group BYTE_ARRAY REQUIRED", "log_stream BYTE_ARRAY REQUIRED", "event_id BYTE_ARRAY OPTIONAL", "message BYTE_ARRAY REQUIRED",
+		"fields_message BYTE_ARRAY OPTIONAL", "http_method BYTE_ARRAY OPTIONAL", "http_path BYTE_ARRAY OPTIONAL", "level BYTE_ARRAY OPTIONAL", "ok BOOLEAN OPTIONAL", "status DOUBLE OPTIONAL", "tags BYTE_ARRAY OPTIONAL",
+		"Level_2 BYTE_ARRAY OPTIONAL",
+	}
+	if got := p.schema(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("schema:\n%q\nwant:\n%q", got, want)
+	}
+	ts := p.meta[2].([]any)[1].(tstruct)
+	if ts[6].(int64) != 9 || !ts[10].(tstruct)[8].(tstruct)[1].(bool) {
+		t.Errorf("timestamp schema = %v", ts)
+	}
+	if p.meta[3].(int64) != 3 || len(p.meta[4].([]any)) != 2 || string(p.meta[6].([]byte)) != recordfile.CreatedBy {
+		t.Fatalf("metadata = %v", p.meta)
+	}
+	for _, tt := range []struct {
+		group, col int
+		want       []any
+	}{
+		{0, 0, []any{t0.UnixMilli(), t0.UnixMilli() + 1500}},
+		{0, 3, []any{"e1", nil}},
+		{0, 4, []any{records[0].Message[:len(records[0].Message)-1], "plain text"}},
+		{0, 9, []any{false, nil}},
+		{0, 10, []any{502.0, nil}},
+		{0, 11, []any{`["a","b"]`, nil}},
+		{1, 1, []any{"/aws/lambda/api"}},
+		{1, 8, []any{"info"}},
+		{1, 9, []any{true}},
+		// Not a number: left out of a DOUBLE column
+		{1, 10, []any{nil}},
+		// Added by the second row group
+		{0, 12, []any{nil, nil}},
+		{1, 12, []any{"dup"}},
+	} {
+		if got := p.column(t, tt.group, tt.col); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("row group %d column %d = %v, want %v", tt.group, tt.col, got, tt.want)
+		}
+	}
+	if d := w.(interface{ Dropped() int }).Dropped(); d != 1 {
+		t.Errorf("dropped = %d", d)
+	}
+}
+
+func TestParquetColumnTypes(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := recordfile.NewWriter(&buf, recordfile.FormatParquet, recordfile.Options{Flatten: true})
+	w.Write(records)
+	w.Close()
+	p := openParquet(t, buf.Bytes())
+	schema := p.schema()
+	// status is a number and a string; level differs from Level only in case
+	if got := schema[5:]; !reflect.DeepEqual(got, []string{"Level BYTE_ARRAY OPTIONAL", "fields_message BYTE_ARRAY OPTIONAL", "http_method BYTE_ARRAY OPTIONAL", "http_path BYTE_ARRAY OPTIONAL", "level_2 BYTE_ARRAY OPTIONAL", "ok BOOLEAN OPTIONAL", "status BYTE_ARRAY OPTIONAL", "tags BYTE_ARRAY OPTIONAL"}) {
+		t.Fatalf("schema = %q", got)
+	}
+	if got := p.column(t, 0, 11); !reflect.DeepEqual(got, []any{"502", nil, "n/a"}) {
+		t.Errorf("status = %v", got)
+	}
+}
+
+func TestParquetEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := recordfile.NewWriter(&buf, recordfile.FormatParquet, recordfile.Options{Flatten: true})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p := openParquet(t, buf.Bytes())
+	if len(p.schema()) != 5 || p.meta[3].(int64) != 0 {
+		t.Fatalf("metadata = %v", p.meta)
+	}
+}
@@ -0,0 +1,322 @@
+// Package recordfile saves search results to files that query engines such
+// as DuckDB and Athena read directly: Parquet, or newline-delimited JSON
+// compressed with gzip or zstd. Records are written as they arrive, so large
+// result sets need not be held in memory.
+package recordfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+)
+
+// Format is a file format, named by its file extension.
+type Format string
+
+// File formats.
+const (
+	FormatParquet    Format = "parquet"
+	FormatNDJSONGzip Format = "ndjson.gz"
+	FormatNDJSONZstd Format = "ndjson.zst"
+)
+
+// Formats lists the supported formats.
+var Formats = []Format{FormatParquet, FormatNDJSONGzip, FormatNDJSONZstd}
+
+// DetectFormat returns the format of a file from its extension.
+func DetectFormat(path string) (Format, error) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, f := range Formats {
+		if strings.HasSuffix(name, "."+string(f)) {
+			return f, nil
+		}
+	}
+	exts := make([]string, len(Formats))
+	for i, f := range Formats {
+		exts[i] = "." + string(f)
+	}
+	return "", fmt.Errorf("unknown file format of %q; expected a name ending in %s", path, strings.Join(exts, ", "))
+}
+
+// Columns of every file, in order. Timestamps are UTC with millisecond
+// precision; EventID may be empty (null in Parquet).
+const (
+	ColumnTimestamp = "timestamp"
+	ColumnGroup     = "log_group"
+	ColumnStream    = "log_stream"
+	ColumnEventID   = "event_id"
+	ColumnMessage   = "message"
+)
+
+// Columns lists the columns of every file.
+var Columns = []string{ColumnTimestamp, ColumnGroup, ColumnStream, ColumnEventID, ColumnMessage}
+
+// DefaultRowGroupSize is the number of records per Parquet row group.
+const DefaultRowGroupSize = 65536
+
+// Options configures a Writer.
+type Options struct {
+	// Flatten adds the fields of structured messages as columns: nested
+	// objects are joined into names like http_status, arrays are kept as
+	// JSON text, and a name that is one of Columns gets the prefix
+	// "fields_". A name already taken by a shallower field, or an earlier
+	// one in key order, gets the suffix _2, _3 and so on. The raw line that
+	// parsers keep in "message" is left out.
+	Flatten bool
+	// Parser parses messages whose Fields are unset.
+	Parser parser.Format
+	// RowGroupSize is the number of records per Parquet row group (0 means
+	// DefaultRowGroupSize). A flattened column of a Parquet file takes its
+	// type from the row group it first appears in; later values of another
+	// type are written as text in string columns and left out otherwise
+	// (see File.Dropped).
+	RowGroupSize int
+}
+
+// Writer writes records in a file format.
+type Writer interface {
+	Write(records []model.LogRecord) error
+	// Close writes the buffered records and the end of the format. It does
+	// not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer of format writing to w.
+func NewWriter(w io.Writer, format Format, opts Options) (Writer, error) {
+	if opts.Parser == "" {
+		opts.Parser = parser.FormatAuto
+	}
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = DefaultRowGroupSize
+	}
+	switch format {
+	case FormatParquet:
+		return newParquetWriter(w, opts), nil
+	case FormatNDJSONGzip, FormatNDJSONZstd:
+		return newNDJSONWriter(w, format, opts)
+	}
+	return nil, fmt.Errorf("unknown file format %q", format)
+}
+
+// Read reads the records of a file of format written by a Writer. The
+// flattened fields are not read back; they are parsed from the messages.
+func Read(r io.Reader, format Format) ([]model.LogRecord, error) {
+	switch format {
+	case FormatParquet:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return readParquet(data)
+	case FormatNDJSONGzip, FormatNDJSONZstd:
+		return readNDJSON(r, format)
+	}
+	return nil, fmt.Errorf("unknown file format %q", format)
+}
+
+// ReadFile reads the records of a file written by a Writer, in the format of
+// its extension.
+func ReadFile(path string) ([]model.LogRecord, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := Read(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+// File is a result file being written. It is written under a temporary
+// name in the same directory and renamed by Close, so a failed run leaves no
+// truncated file behind.
+type File struct {
+	Writer
+	f    *os.File
+	path string
+	// Records is the number of records written.
+	Records int
+	// Dropped is the number of flattened values left out of a Parquet file
+	// for not matching the type of their column, known after Close.
+	Dropped int
+}
+
+// Create starts writing the file at path, in the format of its extension.
+func Create(path string, opts Options) (*File, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, format, opts)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &File{Writer: w, f: f, path: path}, nil
+}
+
+// Path returns the name of the file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// Write writes records.
+func (f *File) Write(records []model.LogRecord) error {
+	if err := f.Writer.Write(records); err != nil {
+		return err
+	}
+	f.Records += len(records)
+	return nil
+}
+
+// Close completes the file and gives it its name.
+func (f *File) Close() error {
+	err := f.Writer.Close()
+	if d, ok := f.Writer.(interface{ Dropped() int }); ok {
+		f.Dropped = d.Dropped()
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.f.Name())
+	}
+	return err
+}
+
+// Remove abandons the file.
+func (f *File) Remove() error {
+	f.f.Close()
+	return os.Remove(f.f.Name())
+}
+
+// row is a record with its flattened fields.
+type row struct {
+	model.LogRecord
+	fields map[string]any
+}
+
+func (opts Options) row(r model.LogRecord) row {
+	rw := row{LogRecord: r}
+	if opts.Flatten {
+		rw.fields = Flatten(r, opts.Parser)
+	}
+	return rw
+}
+
+// Flatten returns the fields of a structured message by the names of their
+// flattened columns (see Options.Flatten): a string, float64 or bool each.
+// Messages with no Fields are parsed with format. It returns nil for
+// unstructured messages.
+func Flatten(r model.LogRecord, format parser.Format) map[string]any {
+	v := r.Fields
+	if v == nil {
+		v = parser.Parse(format, r.Message)
+	}
+	obj, _ := v.(map[string]any)
+	// Parsers keep the raw line in "message", which the message column
+	// holds already; unstructured messages parse to that alone.
+	if m, ok := obj["message"].(string); ok && (m == r.Message || m == message(r)) {
+		obj = maps.Clone(obj)
+		delete(obj, "message")
+	}
+	if len(obj) == 0 {
+		return nil
+	}
+	var leaves []leaf
+	flatten(nil, obj, &leaves)
+	// Shallower fields take their names first, so a field named a_b keeps
+	// its name whatever the object a holds.
+	sort.SliceStable(leaves, func(i, j int) bool { return len(leaves[i].path) < len(leaves[j].path) })
+	fields := make(map[string]any, len(leaves))
+	for _, l := range leaves {
+		fields[fieldColumn(l.path, fields)] = l.value
+	}
+	return fields
+}
+
+// leaf is a flattened field: the keys leading to it and its value.
+type leaf struct {
+	path  []string
+	value any
+}
+
+// fieldColumn names the column of the field at path: its keys joined with
+// "_", prefixed with "fields_" when that is one of Columns, and suffixed
+// with _2, _3, ... when the name is already in taken.
+func fieldColumn(path []string, taken map[string]any) string {
+	name := strings.Join(path, "_")
+	for _, c := range Columns {
+		if name == c {
+			name = "fields_" + name
+			break
+		}
+	}
+	if _, ok := taken[name]; !ok {
+		return name
+	}
+	for i := 2; ; i++ {
+		n := fmt.Sprintf("%s_%d", name, i)
+		if _, ok := taken[n]; !ok {
+			return n
+		}
+	}
+}
+
+// flatten adds the leaves of v under path to out in key order: a string,
+// float64 or bool as is, an object as its fields, anything else as JSON
+// text. Nulls are left out.
+func flatten(path []string, v any, out *[]leaf) {
+	switch v := v.(type) {
+	case nil:
+	case string, float64, bool:
+		*out = append(*out, leaf{path, v})
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			flatten(append(path[:len(path):len(path)], k), v[k], out)
+		}
+	default:
+		b, _ := json.Marshal(v)
+		*out = append(*out, leaf{path, string(b)})
+	}
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// message is a record's message without its trailing newline.
+func message(r model.LogRecord) string {
+	return strings.TrimRight(r.Message, "\r\n")
+}
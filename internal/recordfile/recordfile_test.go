@@ -0,0 +1,193 @@
+package recordfile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/recordfile"
+)
+
+var t0 = time.Date(2025, 8, 31, 11, 0, 0, 0, time.UTC)
+
+var records = []model.LogRecord{
+	{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "e1",
+		Message: `{"level":"error","status":502,"ok":false,"http":{"path":"/pay","method":"POST"},"tags":["a","b"],"message":"boom","none":null}` + "\n"},
+	{Timestamp: t0.Add(1500 * time.Millisecond), LogGroup: "/aws/ecs/billing", LogStream: "b/1", Message: "plain text"},
+	{Timestamp: t0.Add(2 * time.Second), LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "e3",
+		Message: `{"level":"info","status":"n/a","ok":true,"Level":"dup"}`},
+}
+
+func TestDetectFormat(t *testing.T) {
+	for path, want := range map[string]recordfile.Format{
+		"out.parquet":          recordfile.FormatParquet,
+		"dir.v1/OUT.NDJSON.GZ": recordfile.FormatNDJSONGzip,
+		"/tmp/a.b.ndjson.zst":  recordfile.FormatNDJSONZstd,
+	} {
+		if got, err := recordfile.DetectFormat(path); err != nil || got != want {
+			t.Errorf("%s = %q, %v", path, got, err)
+		}
+	}
+	for _, path := range []string{"out.json", "out.ndjson", "parquet", "out.gz"} {
+		if _, err := recordfile.DetectFormat(path); err == nil || !strings.Contains(err.Error(), ".parquet, .ndjson.gz, .ndjson.zst") {
+			t.Errorf("%s: err = %v", path, err)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.ndjson.gz")
+	f, err := recordfile.Create(path, recordfile.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(records); err != nil {
+		t.Fatal(err)
+	}
+	// Not visible under its name until closed
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("stat before Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Records != 3 || f.Path() != path {
+		t.Errorf("records/path = %d/%s", f.Records, f.Path())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "out.ndjson.gz" {
+		t.Errorf("dir = %v", entries)
+	}
+
+	// An abandoned file leaves nothing behind
+	f, _ = recordfile.Create(filepath.Join(dir, "other.parquet"), recordfile.Options{})
+	f.Write(records)
+	if err := f.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("dir = %v", entries)
+	}
+
+	if _, err := recordfile.Create(filepath.Join(dir, "out.csv"), recordfile.Options{}); err == nil {
+		t.Error("csv accepted")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	wantRecords := slices.Clone(records)
+	wantRecords[0].Message = strings.TrimSuffix(wantRecords[0].Message, "\n")
+	for _, format := range recordfile.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+string(format))
+			f, err := recordfile.Create(path, recordfile.Options{Flatten: true, RowGroupSize: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(records[:1])
+			f.Write(records[1:])
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// status "n/a" does not fit the DOUBLE column of the first row group
+			want := 0
+			if format == recordfile.FormatParquet {
+				want = 1
+			}
+			if f.Dropped != want {
+				t.Errorf("dropped = %d, want %d", f.Dropped, want)
+			}
+			got, err := recordfile.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, wantRecords) {
+				t.Fatalf("records:\n%v\nwant:\n%v", got, wantRecords)
+			}
+		})
+	}
+}
+
+func TestFlattenParsedMessage(t *testing.T) {
+	alb := model.LogRecord{Message: `https 2024-01-01T00:00:00.000000Z app/my-lb/50dc6c495c0c9188 192.0.2.1:4321 10.0.0.5:80 0.001 0.050 0.000 504 - 34 366 "GET https://example.com:443/api HTTP/1.1" "curl/8.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:tg "Root=1-abc" "example.com" "-" 0` + "\n"}
+	fields := recordfile.Flatten(alb, parser.FormatALB)
+	if fields["elbStatusCode"] != 504.0 {
+		t.Fatalf("alb fields = %v", fields)
+	}
+	// The raw line is the message column already.
+	if _, ok := fields["fields_message"]; ok {
+		t.Errorf("alb fields_message = %q", fields["fields_message"])
+	}
+	logfmt := model.LogRecord{Message: `message="db down" level=error`}
+	if got, want := recordfile.Flatten(logfmt, parser.FormatLogfmt), map[string]any{"body": "db down", "level": "error"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("logfmt fields = %v", got)
+	}
+}
+
+func TestFlattenCollisions(t *testing.T) {
+	r := model.LogRecord{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "e1",
+		Message: `{"event":{"id":"x"},"log":{"group":"y"},"a":{"b":2},"a_b":1,"fields_event_id":"z"}`}
+	want := map[string]any{"fields_event_id": "z", "fields_event_id_2": "x", "fields_log_group": "y", "a_b": 1.0, "a_b_2": 2.0}
+	if got := recordfile.Flatten(r, ""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Flatten = %v", got)
+	}
+	for _, format := range recordfile.Formats {
+		t.Run(string(format), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+string(format))
+			f, err := recordfile.Create(path, recordfile.Options{Flatten: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write([]model.LogRecord{r})
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := recordfile.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != r {
+				t.Fatalf("records = %+v", got)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := recordfile.NewWriter(&buf, recordfile.FormatParquet, recordfile.Options{})
+	w.Write(records)
+	w.Close()
+	data := buf.Bytes()
+	for name, tt := range map[string]struct {
+		data   []byte
+		format recordfile.Format
+		want   string
+	}{
+		"not parquet":    {[]byte("timestamp,message\n"), recordfile.FormatParquet, "not a Parquet file"},
+		"truncated":      {append([]byte("PAR1"), data[len(data)-40:]...), recordfile.FormatParquet, "malformed"},
+		"bad page":       {slices.Concat(data[:4], make([]byte, 100), data[104:]), recordfile.FormatParquet, "column timestamp"},
+		"not compressed": {[]byte(`{"timestamp":"2025-08-31T11:00:00.000Z"}`), recordfile.FormatNDJSONGzip, "gzip"},
+	} {
+		if _, err := recordfile.Read(bytes.NewReader(tt.data), tt.format); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("{\"timestamp\":\"2025-08-31T11:00:00.000Z\",\"message\":\"ok\"}\n{\"timestamp\":\"yesterday\"}\n"))
+	zw.Close()
+	if _, err := recordfile.Read(&gz, recordfile.FormatNDJSONGzip); err == nil || err.Error() != `line 2: invalid timestamp "yesterday"` {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package recordfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Thrift compact protocol field types.
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thrift encodes structs in the Thrift compact protocol, in which Parquet
+// metadata is written. Fields must be written in increasing id order.
+type thrift struct {
+	buf  []byte
+	last int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.buf = append(t.buf, byte(d)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.last = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thrift) bool(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+func (t *thrift) string(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+// structField writes a struct whose fields fn writes.
+func (t *thrift) structField(id int16, fn func()) {
+	t.field(id, thriftStruct)
+	t.body(fn)
+}
+
+// body writes the fields written by fn and the stop field.
+func (t *thrift) body(fn func()) {
+	last := t.last
+	t.last = 0
+	fn()
+	t.buf = append(t.buf, 0)
+	t.last = last
+}
+
+func (t *thrift) listHeader(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
+
+// structList writes a list of n structs, the fields of each written by fn.
+func (t *thrift) structList(id int16, n int, fn func(i int)) {
+	t.listHeader(id, thriftStruct, n)
+	for i := range n {
+		t.body(func() { fn(i) })
+	}
+}
+
+func (t *thrift) i32List(id int16, vs ...int32) {
+	t.listHeader(id, thriftI32, len(vs))
+	for _, v := range vs {
+		t.buf = binary.AppendVarint(t.buf, int64(v))
+	}
+}
+
+func (t *thrift) stringList(id int16, ss ...string) {
+	t.listHeader(id, thriftBinary, len(ss))
+	for _, s := range ss {
+		t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+		t.buf = append(t.buf, s...)
+	}
+}
+
+// tstruct is a struct decoded from the Thrift compact protocol: field id to
+// an int64, bool, float64, []byte, []any or tstruct.
+type tstruct map[int16]any
+
+func (s tstruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) string(id int16) string {
+	b, _ := s[id].([]byte)
+	return string(b)
+}
+
+func (s tstruct) list(id int16) []any {
+	l, _ := s[id].([]any)
+	return l
+}
+
+func (s tstruct) structField(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+// errThrift reports malformed Thrift data.
+var errThrift = errors.New("malformed Thrift metadata")
+
+// thriftDecoder decodes Thrift compact protocol structs.
+type thriftDecoder struct {
+	b     []byte
+	depth int
+}
+
+// decodeStruct decodes a struct from b, returning it and the rest of b.
+func decodeStruct(b []byte) (tstruct, []byte, error) {
+	d := &thriftDecoder{b: b}
+	s, err := d.structValue()
+	return s, d.b, err
+}
+
+func (d *thriftDecoder) byte() (byte, error) {
+	if len(d.b) == 0 {
+		return 0, errThrift
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c, nil
+}
+
+func (d *thriftDecoder) varint() (int64, error) {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		return 0, errThrift
+	}
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *thriftDecoder) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return 0, errThrift
+	}
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *thriftDecoder) structValue() (tstruct, error) {
+	if d.depth++; d.depth > 64 {
+		return nil, errThrift
+	}
+	defer func() { d.depth-- }()
+	s := tstruct{}
+	var last int16
+	for {
+		h, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if h == 0 {
+			return s, nil
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v, err := d.varint()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		last = id
+		if s[id], err = d.value(h & 0x0f); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *thriftDecoder) value(typ byte) (any, error) {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		return typ == thriftTrue, nil
+	case 3: // byte
+		c, err := d.byte()
+		return int64(c), err
+	case 4, thriftI32, thriftI64:
+		return d.varint()
+	case 7: // double
+		if len(d.b) < 8 {
+			return nil, errThrift
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d.b))
+		d.b = d.b[8:]
+		return v, nil
+	case thriftBinary:
+		n, err := d.uvarint()
+		if err != nil || n > uint64(len(d.b)) {
+			return nil, errThrift
+		}
+		v := d.b[:n]
+		d.b = d.b[n:]
+		return v, nil
+	case thriftList, 10: // list, set
+		h, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, elem := uint64(h>>4), h&0x0f
+		if size == 15 {
+			if size, err = d.uvarint(); err != nil {
+				return nil, err
+			}
+		}
+		if size > uint64(len(d.b)) {
+			return nil, errThrift
+		}
+		list := make([]any, size)
+		for i := range list {
+			if elem == thriftTrue || elem == thriftFalse {
+				c, err := d.byte()
+				if err != nil {
+					return nil, err
+				}
+				list[i] = c == thriftTrue
+				continue
+			}
+			if list[i], err = d.value(elem); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case thriftStruct:
+		return d.structValue()
+	}
+	return nil, errThrift
+}
@@ -0,0 +1,394 @@
+// Package redact replaces sensitive values in log messages with stable
+// placeholders before they are printed. The same value always becomes the
+// same placeholder (for a given salt), so records can still be correlated
+// by user, key or address without revealing them.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Config is the redact section of the config file.
+//
+//	redact:
+//	  enabled: true
+//	  builtins: [email, jwt, aws-key, card, ip]
+//	  salt: team-secret
+//	  rules:
+//	    - {name: user, regex: 'user=(\w+)'}
+//	    - {name: phone, path: customer.phone}
+type Config struct {
+	// Enabled redacts output without --redact.
+	Enabled bool `yaml:"enabled"`
+	// Builtins selects the built-in detectors; empty means all of them and
+	// [none] disables them.
+	Builtins []string `yaml:"builtins"`
+	// Salt keys the placeholder hash, so placeholders cannot be matched
+	// against hashes of guessed values without it.
+	Salt  string `yaml:"salt"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is a user-defined detector. Exactly one of Regex and Path is set.
+type Rule struct {
+	// Name labels the placeholders, as in [name:1a2b3c4d].
+	Name string `yaml:"name"`
+	// Regex matches the values to replace: capture group 1 when the
+	// expression has one, the whole match otherwise.
+	Regex string `yaml:"regex"`
+	// Path is a JMESPath expression evaluated on the parsed message; the
+	// strings and numbers it selects are replaced wherever they appear in it.
+	Path string `yaml:"path"`
+}
+
+// Builtins lists the built-in detector names.
+var Builtins = []string{"email", "jwt", "aws-key", "card", "ip"}
+
+// detector finds values in a message. Values are capture group 1 of re when
+// it has one, else the whole match; valid, when set, rejects candidates.
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+	path  *jmespath.JMESPath
+}
+
+var builtinDetectors = map[string][]detector{
+	// JWTs are detected before emails and keys, which their segments could contain.
+	"jwt": {{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)}},
+	"aws-key": {
+		{name: "aws-key", re: regexp.MustCompile(`\b((?:AKIA|ASIA|AIDA|AROA|ABIA|ACCA)[A-Z0-9]{16})\b`)},
+		// Secret keys are plain base64, so they are only recognized next to their name.
+		{name: "aws-secret", re: regexp.MustCompile(`(?i)(?:aws_?secret_?access_?key|secretAccessKey)["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`)},
+	},
+	"email": {{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)}},
+	// Card numbers start with 2-6 (Mastercard, Amex, Visa, Discover), which
+	// also keeps millisecond timestamps out.
+	"card": {{name: "card", re: regexp.MustCompile(`\b[2-6]\d(?:[ -]?\d){11,17}\b`), valid: luhn}},
+	"ip": {
+		{name: "ip", re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`)},
+		{name: "ip", re: regexp.MustCompile(`(?i)(?:^|[^\w:.])((?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4})`), valid: isIPv6},
+	},
+}
+
+// Redactor replaces detected values with placeholders. A nil Redactor
+// leaves messages unchanged.
+type Redactor struct {
+	detectors []detector
+	salt      []byte
+}
+
+// New returns a Redactor for cfg, or an error for an unknown built-in or an
+// invalid rule. It does not look at cfg.Enabled.
+func New(cfg Config) (*Redactor, error) {
+	r := &Redactor{salt: []byte(cfg.Salt)}
+	builtins := cfg.Builtins
+	if len(builtins) == 0 {
+		builtins = Builtins
+	}
+	for _, b := range builtins {
+		if b == "none" {
+			continue
+		}
+		if _, ok := builtinDetectors[b]; !ok {
+			return nil, fmt.Errorf("unknown built-in detector %q; expected one of %s or none", b, strings.Join(Builtins, ", "))
+		}
+	}
+	// Built-ins run in a fixed order, whatever order the config lists them in.
+	for _, b := range Builtins {
+		if slices.Contains(builtins, b) {
+			r.detectors = append(r.detectors, builtinDetectors[b]...)
+		}
+	}
+	for i, rule := range cfg.Rules {
+		d := detector{name: rule.Name}
+		if d.name == "" {
+			d.name = "redacted"
+		}
+		var err error
+		switch {
+		case rule.Regex != "" && rule.Path != "":
+			return nil, fmt.Errorf("rule %d (%s): set regex or path, not both", i+1, d.name)
+		case rule.Regex != "":
+			d.re, err = regexp.Compile(rule.Regex)
+		case rule.Path != "":
+			d.path, err = jmespath.Compile(rule.Path)
+		default:
+			return nil, fmt.Errorf("rule %d (%s): regex or path is required", i+1, d.name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, d.name, err)
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	return r, nil
+}
+
+// Placeholder returns the placeholder for value found by the named detector:
+// [name:xxxxxxxx], where x is the start of its salted hash.
+func (r *Redactor) Placeholder(name, value string) string {
+	h := hmac.New(sha256.New, r.salt)
+	h.Write([]byte(value))
+	return "[" + name + ":" + hex.EncodeToString(h.Sum(nil))[:8] + "]"
+}
+
+// String returns s with every detected value replaced.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		if d.path != nil {
+			s = r.replacePath(d, s)
+			continue
+		}
+		s = r.replaceRegexp(d, s)
+	}
+	return s
+}
+
+// Records redacts the Message of each record in place, and the strings in
+// Fields when a parser set them.
+func (r *Redactor) Records(records []model.LogRecord) {
+	if r == nil {
+		return
+	}
+	for i := range records {
+		records[i].Message = r.String(records[i].Message)
+		if records[i].Fields != nil {
+			records[i].Fields = r.Value(records[i].Fields)
+		}
+	}
+}
+
+// Value returns a copy of a decoded JSON value with its strings redacted.
+// Path rules select values of the whole document, which are replaced by
+// the placeholders they get in the message; strings that hold structured
+// text of their own, such as an embedded JSON body, are redacted as
+// messages are.
+func (r *Redactor) Value(v any) any {
+	if r == nil {
+		return v
+	}
+	selected := map[any]string{}
+	for _, d := range r.detectors {
+		if d.path == nil {
+			continue
+		}
+		res, err := d.path.Search(v)
+		if err != nil {
+			continue
+		}
+		for _, l := range leaves(res) {
+			switch l := l.(type) {
+			case string:
+				if l != "" {
+					selected[l] = r.Placeholder(d.name, l)
+				}
+			case float64:
+				selected[l] = r.Placeholder(d.name, strconv.FormatFloat(l, 'f', -1, 64))
+			}
+		}
+	}
+	return r.value(v, selected)
+}
+
+// value copies v, replacing the selected leaves and redacting the other
+// strings.
+func (r *Redactor) value(v any, selected map[any]string) any {
+	switch v := v.(type) {
+	case string, float64:
+		if p, ok := selected[v]; ok {
+			return p
+		}
+		if s, ok := v.(string); ok {
+			return r.field(s)
+		}
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = r.value(e, selected)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = r.value(e, selected)
+		}
+		return out
+	}
+	return v
+}
+
+// field redacts a string of a decoded value: path rules apply only when it
+// holds structured text, since plain text would parse to {"message": s}.
+func (r *Redactor) field(s string) string {
+	if s == "" {
+		return s
+	}
+	obj, _ := parser.Parse(parser.FormatAuto, s).(map[string]any)
+	structured := !(len(obj) == 1 && obj["message"] == s)
+	for _, d := range r.detectors {
+		if d.path != nil {
+			if structured {
+				s = r.replacePath(d, s)
+			}
+			continue
+		}
+		s = r.replaceRegexp(d, s)
+	}
+	return s
+}
+
+func (r *Redactor) replaceRegexp(d detector, s string) string {
+	groups := d.re.NumSubexp() > 0
+	var b strings.Builder
+	last := 0
+	for _, m := range d.re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if groups {
+			if m[2] < 0 {
+				continue
+			}
+			start, end = m[2], m[3]
+		}
+		value := s[start:end]
+		if value == "" || isPlaceholder(s, start, end) || (d.valid != nil && !d.valid(value)) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.Placeholder(d.name, value))
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// replacePath replaces the values selected by a JMESPath rule, in their JSON
+// form first (quoted and escaped) and, for text formats, as they are written.
+func (r *Redactor) replacePath(d detector, s string) string {
+	res, err := d.path.Search(parser.Parse(parser.FormatAuto, s))
+	if err != nil {
+		return s
+	}
+	for _, v := range leaves(res) {
+		switch v := v.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+			p := r.Placeholder(d.name, v)
+			if quoted := jsonString(v); strings.Contains(s, quoted) {
+				s = strings.ReplaceAll(s, quoted, jsonString(p))
+			} else {
+				s = strings.ReplaceAll(s, v, p)
+			}
+		case float64:
+			n := strconv.FormatFloat(v, 'f', -1, 64)
+			p := r.Placeholder(d.name, n)
+			if strings.Contains(s, "{") {
+				// Keep JSON documents valid: the number becomes a string.
+				p = jsonString(p)
+			}
+			re := regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(n) + `($|[^\w.])`)
+			s = re.ReplaceAllString(s, "${1}"+strings.ReplaceAll(p, "$", "$$")+"${2}")
+		}
+	}
+	return s
+}
+
+// leaves returns the strings and numbers in v.
+func leaves(v any) []any {
+	switch v := v.(type) {
+	case string, float64:
+		return []any{v}
+	case []any:
+		var out []any
+		for _, e := range v {
+			out = append(out, leaves(e)...)
+		}
+		return out
+	case map[string]any:
+		var out []any
+		for _, e := range v {
+			out = append(out, leaves(e)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// jsonString returns s as a JSON string literal without HTML escaping.
+func jsonString(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// isPlaceholder reports whether s[start:end] lies inside an earlier
+// placeholder, so that detectors do not redact each other's output.
+func isPlaceholder(s string, start, end int) bool {
+	open := strings.LastIndexByte(s[:start], '[')
+	if open < 0 {
+		return false
+	}
+	close := strings.IndexByte(s[open:], ']')
+	return close >= 0 && open+close >= end-1 && placeholderRE.MatchString(s[open:open+close+1])
+}
+
+var placeholderRE = regexp.MustCompile(`^\[[\w.-]+:[0-9a-f]{8}\]$`)
+
+// luhn reports whether the digits of s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// isIPv6 reports whether s is an IPv6 address with at least two non-zero
+// groups, which leaves out times like 12:30:00 and separators like "::".
+func isIPv6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is6() {
+		return false
+	}
+	groups := 0
+	for _, g := range strings.Split(s, ":") {
+		if strings.Trim(g, "0") != "" {
+			groups++
+		}
+	}
+	return groups >= 2
+}
@@ -0,0 +1,428 @@
+// Package server exposes search, extract/next-filter and stats over HTTP with
+// JSON bodies. Record lists can be streamed as NDJSON. Every request runs
+// under a timeout, and the number of requests in flight is capped.
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Defaults for Config fields left zero.
+const (
+	DefaultTimeout       = time.Minute
+	DefaultMaxConcurrent = 8
+	DefaultWorkers       = 4
+	// maxBodyBytes bounds request bodies.
+	maxBodyBytes = 1 << 20
+)
+
+// ContentTypeNDJSON is the media type of streamed record lists; clients ask
+// for it with the Accept header or ?stream=true.
+const ContentTypeNDJSON = "application/x-ndjson"
+
+// Config configures New.
+type Config struct {
+	Retriever inspector.CloudWatchLogsRetriever
+	// Groups are searched when a request names none.
+	Groups []string
+	// Workers bounds the groups searched concurrently by one request.
+	Workers int
+	// MaxConcurrent bounds the requests served at once; more are refused
+	// with 429 Too Many Requests.
+	MaxConcurrent int
+	// Timeout bounds each request, including the AWS calls it makes.
+	Timeout time.Duration
+	// Window resolves a request's start, end and since into a time window.
+	Window func(start, end, since string) (time.Time, time.Time, error)
+	// Redactor masks sensitive values in responses; nil returns them as logged.
+	Redactor *redact.Redactor
+	// Metrics records the searches of requests, and its registry is served
+	// at GET /metrics; nil serves no metrics.
+	Metrics *metrics.Search
+	// Logger receives the diagnostics of request searches; nil discards them.
+	Logger *slog.Logger
+}
+
+// Server is an http.Handler serving the API described by OpenAPI.
+type Server struct {
+	cfg Config
+	sem chan struct{}
+	mux *http.ServeMux
+}
+
+// New returns a server; zero Config limits take their defaults.
+func New(cfg Config) *Server {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = DefaultMaxConcurrent
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	s := &Server{cfg: cfg, sem: make(chan struct{}, cfg.MaxConcurrent), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	s.mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPI)
+	})
+	if cfg.Metrics != nil {
+		s.mux.Handle("GET /metrics", cfg.Metrics.Registry())
+	}
+	s.mux.Handle("POST /v1/search", s.limit(s.search))
+	s.mux.Handle("POST /v1/stats", s.limit(s.stats))
+	return s
+}
+
+// OpenAPI returns the OpenAPI 3 description of the API.
+func OpenAPI() []byte { return openAPI }
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// limit applies the concurrency cap and the request timeout.
+func (s *Server) limit(h func(http.ResponseWriter, *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case s.sem <- struct{}{}:
+			defer func() { <-s.sem }()
+		default:
+			writeError(w, http.StatusTooManyRequests, fmt.Errorf("too many concurrent requests (limit %d)", s.cfg.MaxConcurrent))
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+		defer cancel()
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		if err := h(w, r.WithContext(ctx)); err != nil {
+			writeError(w, statusOf(err), err)
+		}
+	})
+}
+
+// Query is the part of a request shared by every endpoint.
+type Query struct {
+	Groups        []string `json:"groups"`
+	FilterPattern string   `json:"filterPattern"`
+	Start         string   `json:"start"`
+	End           string   `json:"end"`
+	Since         string   `json:"since"`
+	Parser        string   `json:"parser"`
+}
+
+// SearchRequest is the body of POST /v1/search. With Extract ("name=path"),
+// a value is extracted from the matches; with NextFilter as well, a second
+// search is run with the filter built from it, as in the search command.
+type SearchRequest struct {
+	Query
+	Extract    string `json:"extract"`
+	NextFilter string `json:"nextFilter"`
+}
+
+// SearchResponse is the JSON response of POST /v1/search.
+type SearchResponse struct {
+	// Value and NextFilterPattern are set for extract requests.
+	Value             string `json:",omitempty"`
+	NextFilterPattern string `json:",omitempty"`
+	Count             int
+	Records           []model.LogRecord
+}
+
+// StatsRequest is the body of POST /v1/stats.
+type StatsRequest struct {
+	Query
+	// Interval is a bucket size such as "5m"; empty picks one automatically.
+	Interval string `json:"interval"`
+	// By and Top are as in the stats command; By defaults to "group".
+	By  string `json:"by"`
+	Top int    `json:"top"`
+}
+
+// badRequest marks client errors.
+type badRequest struct{ error }
+
+// statusOf maps a handler error to an HTTP status.
+func statusOf(err error) int {
+	var br badRequest
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &br):
+		return http.StatusBadRequest
+	case errors.As(err, &mbe):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errNoValue):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+var errNoValue = errors.New("no extractable value found from initial logs")
+
+func decode(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return err
+		}
+		return badRequest{fmt.Errorf("invalid request body: %w", err)}
+	}
+	return nil
+}
+
+// prepare validates a query and returns an inspector over its groups and window.
+func (s *Server) prepare(q Query) (*inspector.Inspector, time.Time, time.Time, parser.Format, error) {
+	groups := q.Groups
+	if len(groups) == 0 {
+		groups = s.cfg.Groups
+	}
+	if len(groups) == 0 {
+		return nil, time.Time{}, time.Time{}, "", badRequest{errors.New("no log groups provided")}
+	}
+	if q.FilterPattern == "" {
+		return nil, time.Time{}, time.Time{}, "", badRequest{errors.New("filterPattern is required")}
+	}
+	format, err := parser.ParseFormat(q.Parser)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, "", badRequest{fmt.Errorf("parser: %w", err)}
+	}
+	start, end, err := s.cfg.Window(q.Start, q.End, q.Since)
+	if err != nil {
+		return nil, time.Time{}, time.Time{}, "", badRequest{fmt.Errorf("invalid time window: %w", err)}
+	}
+	insp := inspector.New(s.cfg.Retriever, groups, start, end)
+	insp.SetWorkers(min(s.cfg.Workers, len(groups)))
+	insp.SetMetrics(s.cfg.Metrics)
+	insp.SetLogger(s.cfg.Logger)
+	return insp, start, end, format, nil
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) error {
+	var req SearchRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	if req.NextFilter != "" && req.Extract == "" {
+		return badRequest{errors.New("nextFilter requires extract")}
+	}
+	var name, path string
+	if req.Extract != "" {
+		var ok bool
+		name, path, ok = strings.Cut(req.Extract, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || name == "" || path == "" {
+			return badRequest{errors.New("invalid extract format; expected name=path")}
+		}
+	}
+	insp, _, _, format, err := s.prepare(req.Query)
+	if err != nil {
+		return err
+	}
+	stream := wantsNDJSON(r)
+	if stream && req.Extract == "" {
+		return s.streamSearch(r.Context(), w, insp, req.FilterPattern, req.Parser != "", format)
+	}
+	records, err := insp.Search(r.Context(), req.FilterPattern)
+	if err != nil {
+		return err
+	}
+
+	var res SearchResponse
+	if req.Extract != "" {
+		evs := make([]types.FilteredLogEvent, 0, len(records))
+		for _, rec := range records {
+			evs = append(evs, types.FilteredLogEvent{Message: aws.String(rec.Message)})
+		}
+		value, ok, err := util.ExtractFirstValueWithParser(evs, path, format)
+		if err != nil {
+			return badRequest{fmt.Errorf("extract error: %w", err)}
+		}
+		if !ok {
+			return errNoValue
+		}
+		res.Value = value
+		records = nil
+		if req.NextFilter != "" {
+			res.NextFilterPattern, err = util.BuildNextFilter(util.ReplacePlaceholder(req.NextFilter, name, value), value)
+			if err != nil {
+				return badRequest{fmt.Errorf("next-filter build error: %w", err)}
+			}
+		}
+		if stream {
+			// Extract results travel in headers; the body is the records alone.
+			if v := s.cfg.Redactor.String(res.Value); v != "" {
+				w.Header().Set("X-Extracted-Value", v)
+			}
+			if p := s.cfg.Redactor.String(res.NextFilterPattern); p != "" {
+				w.Header().Set("X-Next-Filter-Pattern", p)
+			}
+			if req.NextFilter == "" {
+				startNDJSON(w)
+				return nil
+			}
+			return s.streamSearch(r.Context(), w, insp, res.NextFilterPattern, req.Parser != "", format)
+		}
+		if req.NextFilter != "" {
+			if records, err = insp.Search(r.Context(), res.NextFilterPattern); err != nil {
+				return err
+			}
+		}
+	}
+	if req.Parser != "" {
+		parser.Annotate(records, format)
+	}
+	s.cfg.Redactor.Records(records)
+	res.Value = s.cfg.Redactor.String(res.Value)
+	res.NextFilterPattern = s.cfg.Redactor.String(res.NextFilterPattern)
+	if records == nil {
+		records = []model.LogRecord{}
+	}
+	res.Count, res.Records = len(records), records
+	writeJSON(w, http.StatusOK, res)
+	return nil
+}
+
+// streamSearch writes the matches of filterPattern as NDJSON while the groups
+// are searched, each page as it arrives, so the result is never held in
+// memory. Records are in page order per group, not sorted across groups. An
+// error before the first record is returned for an error status; after it,
+// the response ends with an ErrorResponse line instead.
+func (s *Server) streamSearch(ctx context.Context, w http.ResponseWriter, insp *inspector.Inspector, filterPattern string, annotate bool, format parser.Format) error {
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	err := insp.SearchPages(ctx, filterPattern, func(records []model.LogRecord) error {
+		if !started {
+			startNDJSON(w)
+			started = true
+		}
+		records = slices.Clone(records)
+		if annotate {
+			parser.Annotate(records, format)
+		}
+		s.cfg.Redactor.Records(records)
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err // client went away
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if !started {
+		if err != nil {
+			return err
+		}
+		startNDJSON(w)
+		return nil
+	}
+	if err != nil {
+		_ = enc.Encode(ErrorResponse{Error: err.Error()})
+	}
+	return nil
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) error {
+	req := StatsRequest{By: stats.ByGroup}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	var interval time.Duration
+	if req.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(req.Interval); err != nil || interval <= 0 {
+			return badRequest{fmt.Errorf("invalid interval %q", req.Interval)}
+		}
+	}
+	insp, start, end, format, err := s.prepare(req.Query)
+	if err != nil {
+		return err
+	}
+	if interval == 0 {
+		interval = stats.AutoInterval(start, end, stats.TargetBuckets)
+	}
+	opts := stats.Options{
+		Start:    start,
+		End:      end,
+		Interval: interval,
+		By:       req.By,
+		Format:   format,
+		Top:      req.Top,
+	}
+	// Refuse bad options before the search, which may take long
+	if err := opts.Validate(); err != nil {
+		return badRequest{err}
+	}
+	records, err := insp.Search(r.Context(), req.FilterPattern)
+	if err != nil {
+		return err
+	}
+	s.cfg.Redactor.Records(records)
+	res, err := stats.Aggregate(records, opts)
+	if err != nil {
+		return badRequest{err}
+	}
+	writeJSON(w, http.StatusOK, res)
+	return nil
+}
+
+// wantsNDJSON reports whether the client asked for a streamed record list.
+func wantsNDJSON(r *http.Request) bool {
+	if v := r.URL.Query().Get("stream"); v == "true" || v == "1" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), ContentTypeNDJSON)
+}
+
+// startNDJSON starts a streamed record list.
+func startNDJSON(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ErrorResponse is the body of every non-2xx response.
+type ErrorResponse struct {
+	Error string
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
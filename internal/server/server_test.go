@@ -0,0 +1,330 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/metrics"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/server"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+)
+
+var t0 = time.Date(2025, 8, 31, 11, 30, 0, 0, time.UTC)
+
+// fakeRetriever returns the group's records whose message contains the
+// filter pattern. When block is set, every call reports on started and
+// waits until block is closed or the context ends.
+type fakeRetriever struct {
+	records map[string][]model.LogRecord
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (f *fakeRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	if f.block != nil {
+		select {
+		case f.started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var out []model.LogRecord
+	for _, r := range f.records[group] {
+		if strings.Contains(r.Message, strings.Trim(filterPattern, `"`)) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func newServer(f *fakeRetriever, cfg server.Config) *httptest.Server {
+	cfg.Retriever = f
+	cfg.Groups = []string{"/a", "/b"}
+	cfg.Window = func(start, end, since string) (time.Time, time.Time, error) {
+		return t0.Add(-time.Hour), t0.Add(time.Hour), nil
+	}
+	return httptest.NewServer(server.New(cfg))
+}
+
+func retriever() *fakeRetriever {
+	return &fakeRetriever{records: map[string][]model.LogRecord{
+		"/a": {
+			{Timestamp: t0, LogGroup: "/a", LogStream: "s", Message: `{"level":"ERROR","user":{"id":"u1"}}`},
+			{Timestamp: t0.Add(2 * time.Second), LogGroup: "/a", LogStream: "s", Message: "u1 checkout"},
+		},
+		"/b": {
+			{Timestamp: t0.Add(time.Second), LogGroup: "/b", LogStream: "s", Message: `{"level":"ERROR","user":{"id":"u2"}}`},
+		},
+	}}
+}
+
+func post(t *testing.T, url, body string, header ...string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSearch(t *testing.T) {
+	ts := newServer(retriever(), server.Config{})
+	defer ts.Close()
+
+	resp := post(t, ts.URL+"/v1/search", `{"filterPattern":"ERROR"}`)
+	var res server.SearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, err %v", resp.StatusCode, err)
+	}
+	if res.Count != 2 || res.Records[0].LogGroup != "/a" || res.Records[1].LogGroup != "/b" {
+		t.Fatalf("got %+v", res)
+	}
+
+	resp = post(t, ts.URL+"/v1/search", `{"groups":["/a"],"filterPattern":"ERROR","extract":"id=user.id","nextFilter":"value"}`)
+	res = server.SearchResponse{}
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	if res.Value != "u1" || res.NextFilterPattern != "u1" || res.Count != 2 {
+		t.Fatalf("extract response %+v", res)
+	}
+
+	resp = post(t, ts.URL+"/v1/search", `{"filterPattern":"ERROR","extract":"id=missing"}`)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("missing value status = %d", resp.StatusCode)
+	}
+}
+
+func TestSearchRedact(t *testing.T) {
+	r, err := redact.New(redact.Config{Rules: []redact.Rule{{Name: "user", Regex: `\bu\d\b`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newServer(retriever(), server.Config{Redactor: r})
+	defer ts.Close()
+
+	resp := post(t, ts.URL+"/v1/search", `{"groups":["/a"],"filterPattern":"ERROR","extract":"id=user.id","nextFilter":"value"}`)
+	var res server.SearchResponse
+	_ = json.NewDecoder(resp.Body).Decode(&res)
+	// The next search used the real value and found both records.
+	if res.Count != 2 || !strings.HasPrefix(res.Value, "[user:") || res.NextFilterPattern != res.Value {
+		t.Fatalf("extract response %+v", res)
+	}
+	for _, rec := range res.Records {
+		if strings.Contains(rec.Message, "u1") {
+			t.Fatalf("unredacted record %+v", rec)
+		}
+	}
+}
+
+func TestSearchNDJSON(t *testing.T) {
+	ts := newServer(retriever(), server.Config{})
+	defer ts.Close()
+
+	for _, resp := range []*http.Response{
+		post(t, ts.URL+"/v1/search?stream=true", `{"filterPattern":"ERROR"}`),
+		post(t, ts.URL+"/v1/search", `{"filterPattern":"ERROR"}`, "Accept", server.ContentTypeNDJSON),
+	} {
+		if ct := resp.Header.Get("Content-Type"); ct != server.ContentTypeNDJSON {
+			t.Fatalf("Content-Type = %q", ct)
+		}
+		var lines int
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			var r model.LogRecord
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				t.Fatalf("line %q: %v", sc.Text(), err)
+			}
+			lines++
+		}
+		if lines != 2 {
+			t.Fatalf("got %d lines", lines)
+		}
+	}
+
+	resp := post(t, ts.URL+"/v1/search?stream=true", `{"filterPattern":"ERROR","extract":"id=user.id","nextFilter":"value"}`)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("X-Extracted-Value") != "u1" || resp.Header.Get("X-Next-Filter-Pattern") != "u1" || strings.Count(string(body), "\n") != 2 {
+		t.Fatalf("headers %v, body:\n%s", resp.Header, body)
+	}
+}
+
+// failingRetriever fails the searches of one group.
+type failingRetriever struct {
+	*fakeRetriever
+	group string
+}
+
+func (f failingRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]model.LogRecord, error) {
+	if group == f.group {
+		return nil, errors.New("throttled")
+	}
+	return f.fakeRetriever.SearchGroup(ctx, group, filterPattern, startMs, endMs)
+}
+
+func TestSearchNDJSONError(t *testing.T) {
+	// Groups are searched in order with one worker: /a streams before /b fails
+	ts := httptest.NewServer(server.New(server.Config{
+		Retriever: failingRetriever{retriever(), "/b"},
+		Groups:    []string{"/a", "/b"},
+		Workers:   1,
+		Window: func(start, end, since string) (time.Time, time.Time, error) {
+			return t0.Add(-time.Hour), t0.Add(time.Hour), nil
+		},
+	}))
+	defer ts.Close()
+
+	resp := post(t, ts.URL+"/v1/search?stream=true", `{"filterPattern":"ERROR"}`)
+	body, _ := io.ReadAll(resp.Body)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if resp.StatusCode != http.StatusOK || len(lines) != 2 || lines[1] != `{"Error":"throttled"}` {
+		t.Fatalf("status %d, body:\n%s", resp.StatusCode, body)
+	}
+
+	// Nothing written yet: the error has its status
+	resp = post(t, ts.URL+"/v1/search?stream=true", `{"filterPattern":"ERROR","groups":["/b"]}`)
+	if resp.StatusCode != http.StatusBadGateway || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestStats(t *testing.T) {
+	ts := newServer(retriever(), server.Config{})
+	defer ts.Close()
+
+	resp := post(t, ts.URL+"/v1/stats", `{"filterPattern":"ERROR","interval":"30m","by":"user.id"}`)
+	var res stats.Result
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, err %v", resp.StatusCode, err)
+	}
+	if res.Total != 2 || len(res.Series) != 2 || res.IntervalSeconds != 1800 {
+		t.Fatalf("got %+v", res)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := retriever()
+	f.block = make(chan struct{})
+	ts := newServer(f, server.Config{MaxConcurrent: 1, Timeout: 200 * time.Millisecond})
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+	}{
+		{"/v1/search", `{}`, http.StatusBadRequest},
+		{"/v1/search", `{"filterPattern":"x","nextFilter":"y"}`, http.StatusBadRequest},
+		{"/v1/search", `{"filterPattern":"x","extract":"nopath"}`, http.StatusBadRequest},
+		{"/v1/search", `{"filterPattern":"x","unknown":1}`, http.StatusBadRequest},
+		{"/v1/stats", `{"filterPattern":"x","interval":"soon"}`, http.StatusBadRequest},
+		// Refused before the (blocking) search
+		{"/v1/stats", `{"filterPattern":"x","by":"user.["}`, http.StatusBadRequest},
+		{"/v1/stats", `{"filterPattern":"x","top":-1}`, http.StatusBadRequest},
+		{"/v1/stats", `{"filterPattern":"x","interval":"1ms"}`, http.StatusBadRequest},
+		{"/v1/search", `{"filterPattern":"x"}`, http.StatusGatewayTimeout},
+	} {
+		resp := post(t, ts.URL+tc.path, tc.body)
+		var e server.ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if resp.StatusCode != tc.status || e.Error == "" {
+			t.Errorf("%s %s: status %d (%q), want %d", tc.path, tc.body, resp.StatusCode, e.Error, tc.status)
+		}
+	}
+}
+
+func TestConcurrencyCap(t *testing.T) {
+	f := retriever()
+	f.started, f.block = make(chan struct{}, 1), make(chan struct{})
+	ts := newServer(f, server.Config{MaxConcurrent: 1})
+	defer ts.Close()
+
+	// A request in flight takes the only slot until the retriever is released.
+	done := make(chan int)
+	go func() {
+		resp, err := http.Post(ts.URL+"/v1/search", "application/json", strings.NewReader(`{"filterPattern":"ERROR"}`))
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	<-f.started
+	if resp := post(t, ts.URL+"/v1/search", `{"filterPattern":"ERROR"}`); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", resp.StatusCode)
+	}
+	close(f.block)
+	if status := <-done; status != http.StatusOK {
+		t.Fatalf("in-flight request status = %d", status)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	ts := newServer(retriever(), server.Config{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var doc struct {
+		OpenAPI string
+		Paths   map[string]any
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/v1/search", "/v1/stats", "/healthz", "/metrics", "/openapi.json"} {
+		if doc.Paths[p] == nil {
+			t.Errorf("OpenAPI description lacks %s", p)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.NewSearch(metrics.NewRegistry())
+	ts := newServer(retriever(), server.Config{Metrics: m})
+	defer ts.Close()
+
+	post(t, ts.URL+"/v1/search", `{"filterPattern":"ERROR"}`).Body.Close()
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	_, _ = io.Copy(&body, resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body.String(), "aws_multi_log_inspector_searches_total 1\n") || !strings.Contains(body.String(), "aws_multi_log_inspector_search_records_total 2\n") {
+		t.Fatalf("status %d body:\n%s", resp.StatusCode, body.String())
+	}
+
+	plain := newServer(retriever(), server.Config{})
+	defer plain.Close()
+	resp, err = http.Get(plain.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("metrics without Config.Metrics: %s", resp.Status)
+	}
+}
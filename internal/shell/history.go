@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultHistorySize is the number of lines History keeps.
+const DefaultHistorySize = 1000
+
+// History is the command history, kept in a file across sessions. It
+// implements the history of golang.org/x/term's Terminal.
+type History struct {
+	path  string
+	size  int
+	lines []string // oldest first
+}
+
+// LoadHistory reads the history file at path, which need not exist. An empty
+// path keeps the history in memory only.
+func LoadHistory(path string, size int) (*History, error) {
+	h := &History{path: path, size: size}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(h.lines) > size {
+		// Compact the file so it does not grow without bound.
+		h.lines = h.lines[len(h.lines)-size:]
+		err = os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600)
+	}
+	return h, err
+}
+
+// Add appends entry unless it is blank or repeats the latest entry. Failing
+// to write the history file does not interrupt the session, so write errors
+// are ignored.
+func (h *History) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == entry) {
+		return
+	}
+	h.lines = append(h.lines, entry)
+	if len(h.lines) > h.size {
+		h.lines = h.lines[1:]
+	}
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(entry + "\n")
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int { return len(h.lines) }
+
+// At returns an entry; 0 is the most recent.
+func (h *History) At(idx int) string { return h.lines[len(h.lines)-1-idx] }
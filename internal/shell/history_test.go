@@ -0,0 +1,37 @@
+package shell_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/shell"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "history")
+	h, err := shell.LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []string{"search a", "search a", " ", "extract x=y", "search b", "next x"} {
+		h.Add(l)
+	}
+	if h.Len() != 3 || h.At(0) != "next x" || h.At(2) != "extract x=y" {
+		t.Fatalf("history len %d, newest %q, oldest %q", h.Len(), h.At(0), h.At(h.Len()-1))
+	}
+
+	// Reloading keeps the newest entries and compacts the file.
+	h, err = shell.LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != 3 || h.At(0) != "next x" || h.At(2) != "extract x=y" {
+		t.Fatalf("reloaded len %d, newest %q", h.Len(), h.At(0))
+	}
+	b, _ := os.ReadFile(path)
+	if got := strings.Count(string(b), "\n"); got != 3 {
+		t.Fatalf("file has %d lines:\n%s", got, b)
+	}
+}
@@ -0,0 +1,376 @@
+// Package shell is an interactive session that keeps the log groups, time
+// window and last result between commands, so a search can be refined with
+// extract and next-filter steps without re-running the whole command line.
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Commands lists the session commands with their help text.
+var Commands = []struct{ Name, Args, Help string }{
+	{"search", "<pattern>", "search the groups and keep the result"},
+	{"extract", "<name=path>", "extract a value from the last result into {{name}}"},
+	{"next", "<expr>", "search with a filter built from the last extracted value, like --next-filter"},
+	{"show", "", "print the last result again"},
+	{"window", "[-1h | <start> [<end>]]", "show or set the time window (relative to now, or RFC3339)"},
+	{"groups", "[+g | -g | g1,g2 ...]", "show, add, remove or replace log groups"},
+	{"vars", "", "show extracted values"},
+	{"help", "", "show this help"},
+	{"exit", "", "leave the shell (or Ctrl-D)"},
+}
+
+// Config configures New.
+type Config struct {
+	// Search returns the records matching pattern in groups between start and end.
+	Search func(ctx context.Context, groups []string, start, end time.Time, pattern string) ([]model.LogRecord, error)
+	// ListGroups returns the names of log groups starting with prefix, for
+	// completion; nil disables group completion.
+	ListGroups func(ctx context.Context, prefix string) ([]string, error)
+	// ParseDuration parses relative windows such as "1h" or "2d".
+	ParseDuration func(string) (time.Duration, error)
+	Groups        []string
+	// The window is the Since before now when Since > 0, else Start..End.
+	Start, End time.Time
+	Since      time.Duration
+	Format     parser.Format
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+	// Redactor masks sensitive values in what the session prints; searches
+	// and extracted values keep the real ones.
+	Redactor *redact.Redactor
+	// Unmask is set when searches read unmasked events; otherwise extract
+	// warns about results masked by a data protection policy.
+	Unmask bool
+}
+
+// ErrExit is returned by Exec for the exit command.
+var ErrExit = errors.New("exit")
+
+// Session is the state kept between commands.
+type Session struct {
+	cfg     Config
+	groups  []string
+	pattern string
+	last    []model.LogRecord
+	vars    map[string]string
+	// lastVar is the name of the most recently extracted value, the one next uses.
+	lastVar string
+	// groupNames caches ListGroups results by prefix.
+	groupNames map[string][]string
+}
+
+// New returns a session.
+func New(cfg Config) *Session {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Session{cfg: cfg, groups: slices.Clone(cfg.Groups), vars: map[string]string{}, groupNames: map[string][]string{}}
+}
+
+// Exec runs one command line, writing its output to w. Blank lines and
+// comments (#) do nothing.
+func (s *Session) Exec(ctx context.Context, line string, w io.Writer) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "search":
+		if arg == "" {
+			return errors.New("usage: search <pattern>")
+		}
+		return s.search(ctx, arg, w)
+	case "extract":
+		return s.extract(arg, w)
+	case "next":
+		return s.next(ctx, arg, w)
+	case "show":
+		if s.last == nil {
+			return errors.New("no result yet; run search first")
+		}
+		s.print(w)
+		return nil
+	case "window":
+		return s.window(arg, w)
+	case "groups":
+		return s.setGroups(arg, w)
+	case "vars":
+		names := make([]string, 0, len(s.vars))
+		for n := range s.vars {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(w, "%s = %s\n", n, s.cfg.Redactor.String(s.vars[n]))
+		}
+		return nil
+	case "help", "?":
+		for _, c := range Commands {
+			fmt.Fprintf(w, "  %-30s %s\n", strings.TrimSpace(c.Name+" "+c.Args), c.Help)
+		}
+		return nil
+	case "exit", "quit":
+		return ErrExit
+	}
+	return fmt.Errorf("unknown command %q; try help", name)
+}
+
+// Window returns the current time window.
+func (s *Session) Window() (time.Time, time.Time) {
+	if s.cfg.Since > 0 {
+		now := s.cfg.Now()
+		return now.Add(-s.cfg.Since), now
+	}
+	return s.cfg.Start, s.cfg.End
+}
+
+// Groups returns the current log groups.
+func (s *Session) Groups() []string { return s.groups }
+
+// Last returns the last search result and its pattern.
+func (s *Session) Last() ([]model.LogRecord, string) { return s.last, s.pattern }
+
+func (s *Session) search(ctx context.Context, pattern string, w io.Writer) error {
+	if len(s.groups) == 0 {
+		return errors.New("no log groups; add some with groups +<name>")
+	}
+	start, end := s.Window()
+	records, err := s.cfg.Search(ctx, s.groups, start, end, pattern)
+	if err != nil {
+		return err
+	}
+	s.pattern, s.last = pattern, records
+	if s.last == nil {
+		s.last = []model.LogRecord{}
+	}
+	s.print(w)
+	return nil
+}
+
+func (s *Session) print(w io.Writer) {
+	for _, r := range s.last {
+		fmt.Fprintf(w, "%s %s/%s %s\n", r.Timestamp.UTC().Format(time.RFC3339), r.LogGroup, r.LogStream, s.cfg.Redactor.String(r.Message))
+	}
+	fmt.Fprintf(w, "(%d records for %s)\n", len(s.last), s.cfg.Redactor.String(s.pattern))
+}
+
+func (s *Session) extract(spec string, w io.Writer) error {
+	name, path, ok := strings.Cut(spec, "=")
+	name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+	if !ok || name == "" || path == "" {
+		return errors.New("usage: extract <name=path>")
+	}
+	if s.last == nil {
+		return errors.New("no result yet; run search first")
+	}
+	evs := make([]types.FilteredLogEvent, 0, len(s.last))
+	for _, r := range s.last {
+		evs = append(evs, types.FilteredLogEvent{Message: aws.String(r.Message)})
+	}
+	value, found, err := util.ExtractFirstValueWithParser(evs, path, s.cfg.Format)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no extractable value for %s in the last result", path)
+	}
+	s.vars[name], s.lastVar = value, name
+	fmt.Fprintf(w, "%s = %s\n", name, s.cfg.Redactor.String(value))
+	if masked := s.masked(); masked > 0 && !s.cfg.Unmask {
+		fmt.Fprintf(w, "warning: %d of %d records look masked by a data protection policy; restart with --unmask to read them unmasked\n", masked, len(s.last))
+	}
+	return nil
+}
+
+// masked counts the records of the last result that look masked.
+func (s *Session) masked() int {
+	n := 0
+	for _, r := range s.last {
+		if r.Masked() {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Session) next(ctx context.Context, expr string, w io.Writer) error {
+	if expr == "" {
+		return errors.New("usage: next <expr>")
+	}
+	if s.lastVar == "" {
+		return errors.New("nothing extracted yet; run extract first")
+	}
+	for name, value := range s.vars {
+		expr = util.ReplacePlaceholder(expr, name, value)
+	}
+	pattern, err := util.BuildNextFilter(expr, s.vars[s.lastVar])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "next filter: %s\n", s.cfg.Redactor.String(pattern))
+	return s.search(ctx, pattern, w)
+}
+
+func (s *Session) window(arg string, w io.Writer) error {
+	args := strings.Fields(arg)
+	switch {
+	case len(args) == 1 && !strings.Contains(args[0], "T"):
+		d, err := s.cfg.ParseDuration(strings.TrimPrefix(args[0], "-"))
+		if err != nil {
+			return err
+		}
+		s.cfg.Since = d
+	case len(args) == 1 || len(args) == 2:
+		start, err := time.Parse(time.RFC3339, args[0])
+		if err != nil {
+			return err
+		}
+		end := s.cfg.Now()
+		if len(args) == 2 {
+			if end, err = time.Parse(time.RFC3339, args[1]); err != nil {
+				return err
+			}
+		}
+		if !end.After(start) {
+			return errors.New("window end must be after its start")
+		}
+		s.cfg.Start, s.cfg.End, s.cfg.Since = start, end, 0
+	case len(args) > 2:
+		return errors.New("usage: window [-1h | <start> [<end>]]")
+	}
+	start, end := s.Window()
+	if s.cfg.Since > 0 {
+		fmt.Fprintf(w, "window: last %s (now %s .. %s)\n", s.cfg.Since, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "window: %s .. %s\n", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// setGroups applies "+g" (add), "-g" (remove) and plain names, which replace
+// the groups given so far; names may also be comma-separated.
+func (s *Session) setGroups(arg string, w io.Writer) error {
+	replaced := false
+	for _, tok := range strings.FieldsFunc(arg, func(r rune) bool { return r == ' ' || r == ',' }) {
+		switch {
+		case strings.HasPrefix(tok, "+"):
+			if g := tok[1:]; g != "" && !slices.Contains(s.groups, g) {
+				s.groups = append(s.groups, g)
+			}
+		case strings.HasPrefix(tok, "-"):
+			s.groups = slices.DeleteFunc(s.groups, func(g string) bool { return g == tok[1:] })
+		default:
+			if !replaced {
+				s.groups, replaced = nil, true
+			}
+			if !slices.Contains(s.groups, tok) {
+				s.groups = append(s.groups, tok)
+			}
+		}
+	}
+	if len(s.groups) == 0 {
+		fmt.Fprintln(w, "groups: (none)")
+		return nil
+	}
+	fmt.Fprintf(w, "groups: %s\n", strings.Join(s.groups, ","))
+	return nil
+}
+
+// Complete returns line completed at its end: command names, group names
+// after groups (with their +/- prefix), and {{name}} placeholders of
+// extracted values. ok is false when nothing can be added.
+func (s *Session) Complete(ctx context.Context, line string) (string, bool) {
+	name, rest, hasArgs := strings.Cut(line, " ")
+	if !hasArgs {
+		var names []string
+		for _, c := range Commands {
+			names = append(names, c.Name)
+		}
+		return extend(line, name, names, " ")
+	}
+	word := rest[strings.LastIndexAny(rest, " ,")+1:]
+	switch name {
+	case "groups":
+		prefix := strings.TrimLeft(word, "+-")
+		if s.cfg.ListGroups == nil || (prefix == "" && word != "-") {
+			return line, false
+		}
+		candidates := s.groups
+		if !strings.HasPrefix(word, "-") {
+			var err error
+			if candidates, err = s.listGroups(ctx, prefix); err != nil {
+				return line, false
+			}
+		}
+		return extend(line, prefix, candidates, "")
+	case "next", "extract":
+		i := strings.LastIndex(word, "{{")
+		if i < 0 || strings.Contains(word[i:], "}}") {
+			return line, false
+		}
+		var names []string
+		for n := range s.vars {
+			names = append(names, n+"}}")
+		}
+		return extend(line, word[i+2:], names, "")
+	}
+	return line, false
+}
+
+func (s *Session) listGroups(ctx context.Context, prefix string) ([]string, error) {
+	if names, ok := s.groupNames[prefix]; ok {
+		return names, nil
+	}
+	names, err := s.cfg.ListGroups(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.groupNames[prefix] = names
+	return names, nil
+}
+
+// extend appends to line the longest common continuation of word among
+// candidates, and suffix when a single candidate matches.
+func extend(line, word string, candidates []string, suffix string) (string, bool) {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return line, false
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	add := common[len(word):]
+	if len(matches) == 1 {
+		add += suffix
+	}
+	if add == "" {
+		return line, false
+	}
+	return line + add, true
+}
@@ -0,0 +1,204 @@
+package shell_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/shell"
+)
+
+var now = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+type call struct {
+	groups     string
+	start, end time.Time
+	pattern    string
+}
+
+// fakeSearch returns the records containing the pattern (quotes removed)
+// and records each call.
+func fakeSearch(calls *[]call) func(context.Context, []string, time.Time, time.Time, string) ([]model.LogRecord, error) {
+	records := []model.LogRecord{
+		{Timestamp: now.Add(-time.Minute), LogGroup: "/a", LogStream: "s", Message: `{"level":"ERROR","user":{"id":"u1"}}`},
+		{Timestamp: now.Add(-30 * time.Second), LogGroup: "/a", LogStream: "s", Message: "checkout userId=u1 done"},
+	}
+	return func(ctx context.Context, groups []string, start, end time.Time, pattern string) ([]model.LogRecord, error) {
+		*calls = append(*calls, call{strings.Join(groups, ","), start, end, pattern})
+		var out []model.LogRecord
+		for _, r := range records {
+			if strings.Contains(r.Message, strings.ReplaceAll(pattern, `"`, "")) {
+				out = append(out, r)
+			}
+		}
+		return out, nil
+	}
+}
+
+func parseDuration(s string) (time.Duration, error) { return time.ParseDuration(s) }
+
+func newConfig(calls *[]call) shell.Config {
+	return shell.Config{
+		Search:        fakeSearch(calls),
+		ParseDuration: parseDuration,
+		ListGroups: func(ctx context.Context, prefix string) ([]string, error) {
+			var out []string
+			for _, g := range []string{"/aws/lambda/api", "/aws/lambda/billing", "/ecs/web"} {
+				if strings.HasPrefix(g, prefix) {
+					out = append(out, g)
+				}
+			}
+			return out, nil
+		},
+		Groups: []string{"/a"},
+		Since:  time.Hour,
+		Format: parser.FormatAuto,
+		Now:    func() time.Time { return now },
+	}
+}
+
+func newSession(calls *[]call) *shell.Session { return shell.New(newConfig(calls)) }
+
+func run(t *testing.T, s *shell.Session, line string) string {
+	t.Helper()
+	var b strings.Builder
+	if err := s.Exec(context.Background(), line, &b); err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+	return b.String()
+}
+
+func TestSearchExtractNext(t *testing.T) {
+	var calls []call
+	s := newSession(&calls)
+
+	out := run(t, s, "search ERROR")
+	if !strings.Contains(out, `2025-08-31T11:59:00Z /a/s {"level"`) || !strings.HasSuffix(out, "(1 records for ERROR)\n") {
+		t.Fatalf("search output:\n%s", out)
+	}
+	if out := run(t, s, "extract userId=user.id"); out != "userId = u1\n" {
+		t.Fatalf("extract output %q", out)
+	}
+	out = run(t, s, "next userId={{userId}}")
+	if !strings.HasPrefix(out, `next filter: userId="u1"`) || !strings.Contains(out, "(1 records for userId=\"u1\")") {
+		t.Fatalf("next output:\n%s", out)
+	}
+	if records, pattern := s.Last(); len(records) != 1 || pattern != `userId="u1"` {
+		t.Fatalf("last = %d records for %q", len(records), pattern)
+	}
+	if len(calls) != 2 || !calls[0].start.Equal(now.Add(-time.Hour)) || !calls[1].end.Equal(now) {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if out := run(t, s, "vars"); out != "userId = u1\n" {
+		t.Fatalf("vars %q", out)
+	}
+}
+
+func TestWindowAndGroups(t *testing.T) {
+	var calls []call
+	s := newSession(&calls)
+
+	run(t, s, "window -15m")
+	if start, end := s.Window(); !start.Equal(now.Add(-15*time.Minute)) || !end.Equal(now) {
+		t.Fatalf("relative window %v..%v", start, end)
+	}
+	run(t, s, "window 2025-08-30T00:00:00Z 2025-08-30T06:00:00Z")
+	if start, end := s.Window(); start.Hour() != 0 || end.Hour() != 6 {
+		t.Fatalf("absolute window %v..%v", start, end)
+	}
+
+	if out := run(t, s, "groups +/b +/c -/a"); out != "groups: /b,/c\n" {
+		t.Fatalf("groups %q", out)
+	}
+	run(t, s, "groups /x,/y")
+	run(t, s, "search ERROR")
+	if calls[0].groups != "/x,/y" || calls[0].start.Day() != 30 {
+		t.Fatalf("call = %+v", calls[0])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var calls []call
+	s := newSession(&calls)
+	for _, line := range []string{"bogus", "search", "extract a=b", "next x", "extract nopath", "window 1 2 3"} {
+		if err := s.Exec(context.Background(), line, &strings.Builder{}); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+	if err := s.Exec(context.Background(), "exit", &strings.Builder{}); !errors.Is(err, shell.ErrExit) {
+		t.Fatalf("exit = %v", err)
+	}
+	run(t, s, "groups -/a")
+	if err := s.Exec(context.Background(), "search x", &strings.Builder{}); err == nil {
+		t.Fatal("search without groups succeeded")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	var calls []call
+	s := newSession(&calls)
+	run(t, s, "search ERROR")
+	run(t, s, "extract userId=user.id")
+
+	for _, tc := range []struct{ line, want string }{
+		{"ext", "extract "},
+		{"se", "search "},
+		{"e", "ex"}, // extract or exit
+		{"groups +/aws/l", "groups +/aws/lambda/"},
+		{"groups +/aws/lambda/b", "groups +/aws/lambda/billing"},
+		{"groups -/", "groups -/a"},
+		{"next userId={{us", "next userId={{userId}}"},
+		{"search ERR", "search ERR"},
+	} {
+		got, _ := s.Complete(context.Background(), tc.line)
+		if got != tc.want {
+			t.Errorf("Complete(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := redact.New(redact.Config{Rules: []redact.Rule{{Name: "user", Regex: `\bu\d+\b`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []call
+	cfg := newConfig(&calls)
+	cfg.Redactor = r
+	s := shell.New(cfg)
+
+	for _, line := range []string{"search ERROR", "extract userId=user.id", "vars"} {
+		if out := run(t, s, line); strings.Contains(out, "u1") || !strings.Contains(out, "[user:") {
+			t.Fatalf("%s:\n%s", line, out)
+		}
+	}
+	// the next search uses the real value
+	run(t, s, "next userId={{userId}}")
+	if calls[len(calls)-1].pattern != `userId="u1"` {
+		t.Fatalf("calls = %+v", calls)
+	}
+}
+
+func TestExtractMaskedWarning(t *testing.T) {
+	cfg := newConfig(new([]call))
+	cfg.Search = func(context.Context, []string, time.Time, time.Time, string) ([]model.LogRecord, error) {
+		return []model.LogRecord{{Timestamp: now, LogGroup: "/a", LogStream: "s", Message: `{"user":{"id":"u1","email":"********"}}`}}, nil
+	}
+	s := shell.New(cfg)
+	run(t, s, "search x")
+	if out := run(t, s, "extract id=user.id"); !strings.Contains(out, "warning: 1 of 1 records look masked") {
+		t.Fatalf("extract output %q", out)
+	}
+
+	cfg.Unmask = true
+	s = shell.New(cfg)
+	run(t, s, "search x")
+	if out := run(t, s, "extract id=user.id"); out != "id = u1\n" {
+		t.Fatalf("unmasked extract output %q", out)
+	}
+}
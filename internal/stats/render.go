@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats understood by Render.
+const (
+	OutputTable     = "table"
+	OutputJSON      = "json"
+	OutputSparkline = "sparkline"
+	OutputHistogram = "histogram"
+)
+
+// Outputs lists the formats accepted by --output.
+var Outputs = []string{OutputTable, OutputJSON, OutputSparkline, OutputHistogram}
+
+// sparkBlocks are the eight levels used by sparklines.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// histogramWidth is the width of the longest histogram bar.
+const histogramWidth = 50
+
+// WriteTable writes one row per bucket and one column per series, plus totals.
+func (r *Result) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := []string{"time"}
+	for _, s := range r.Series {
+		header = append(header, s.Key)
+	}
+	if len(r.Series) != 1 {
+		header = append(header, "total")
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+	for i, b := range r.Buckets {
+		row := []string{b.UTC().Format(time.RFC3339)}
+		sum := 0
+		for _, s := range r.Series {
+			row = append(row, fmt.Sprint(s.Counts[i]))
+			sum += s.Counts[i]
+		}
+		if len(r.Series) != 1 {
+			row = append(row, fmt.Sprint(sum))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	row := []string{"total"}
+	for _, s := range r.Series {
+		row = append(row, fmt.Sprint(s.Total))
+	}
+	if len(r.Series) != 1 {
+		row = append(row, fmt.Sprint(r.Total))
+	}
+	fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	return tw.Flush()
+}
+
+// WriteSparklines writes one sparkline per series, scaled to the series maximum.
+func (r *Result) WriteSparklines(w io.Writer) error {
+	width := 0
+	for _, s := range r.Series {
+		width = max(width, len(s.Key))
+	}
+	fmt.Fprintf(w, "%s .. %s every %s\n", r.Buckets[0].UTC().Format(time.RFC3339), r.Buckets[len(r.Buckets)-1].UTC().Format(time.RFC3339), r.Interval)
+	for _, s := range r.Series {
+		if _, err := fmt.Fprintf(w, "%-*s %s %d\n", width, s.Key, Sparkline(s.Counts), s.Total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sparkline renders counts as a line of block characters; zero counts are spaces.
+func Sparkline(counts []int) string {
+	peak := 0
+	for _, c := range counts {
+		peak = max(peak, c)
+	}
+	var b strings.Builder
+	for _, c := range counts {
+		if c == 0 || peak == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(sparkBlocks[(c*len(sparkBlocks)-1)/peak])
+	}
+	return b.String()
+}
+
+// WriteHistogram writes a horizontal bar per bucket for each series, scaled to
+// the largest count across all series.
+func (r *Result) WriteHistogram(w io.Writer) error {
+	peak := 0
+	for _, s := range r.Series {
+		for _, c := range s.Counts {
+			peak = max(peak, c)
+		}
+	}
+	for i, s := range r.Series {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (%d)\n", s.Key, s.Total)
+		for j, b := range r.Buckets {
+			bar := 0
+			if peak > 0 {
+				bar = (s.Counts[j]*histogramWidth + peak - 1) / peak
+			}
+			if _, err := fmt.Fprintf(w, "%s %-*s %d\n", b.UTC().Format(time.RFC3339), histogramWidth, strings.Repeat("#", bar), s.Counts[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
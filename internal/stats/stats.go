@@ -0,0 +1,195 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// Reserved --by values; anything else is a JMESPath expression evaluated
+// against the parsed message (quote it, e.g. `"group"`, to select a field
+// with a reserved name).
+const (
+	ByGroup  = "group"
+	ByStream = "stream"
+	ByNone   = "none"
+)
+
+// MissingKey is the series key for records where the --by expression yields nothing.
+const MissingKey = "(none)"
+
+// OtherKey is the series key that collects series beyond the top N.
+const OtherKey = "(other)"
+
+// MaxBuckets bounds the number of buckets to keep output and memory reasonable.
+const MaxBuckets = 10000
+
+// TargetBuckets is the bucket count aimed for when the interval is automatic.
+const TargetBuckets = 60
+
+// niceIntervals are the candidates for automatic interval selection.
+var niceIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// AutoInterval picks the smallest "nice" interval producing at most target buckets.
+func AutoInterval(start, end time.Time, target int) time.Duration {
+	span := end.Sub(start)
+	for _, d := range niceIntervals {
+		if int(span/d) <= target {
+			return d
+		}
+	}
+	return niceIntervals[len(niceIntervals)-1]
+}
+
+// Options configures Aggregate.
+type Options struct {
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration
+	// By selects the series key: ByGroup, ByStream, ByNone, or a JMESPath expression.
+	By string
+	// Format structures messages for JMESPath keys.
+	Format parser.Format
+	// Top keeps the N series with the highest totals and folds the rest into
+	// OtherKey. 0 keeps every series.
+	Top int
+}
+
+// Validate checks the options without records, so that a bad request can be
+// refused before searching.
+func (o Options) Validate() error {
+	if o.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if o.End.Before(o.Start) {
+		return fmt.Errorf("end is before start")
+	}
+	if n := o.buckets(); n > MaxBuckets {
+		return fmt.Errorf("%d buckets exceed the limit of %d; use a larger interval", n, MaxBuckets)
+	}
+	if o.Top < 0 {
+		return fmt.Errorf("top must not be negative")
+	}
+	_, err := KeyFunc(o.By, o.Format)
+	return err
+}
+
+// buckets returns the number of buckets over [Start, End].
+func (o Options) buckets() int {
+	return int(o.End.Sub(o.Start.Truncate(o.Interval))/o.Interval) + 1
+}
+
+// Series is the per-bucket counts of one key.
+type Series struct {
+	Key    string
+	Total  int
+	Counts []int
+}
+
+// Result is a time-bucketed count of records per key.
+type Result struct {
+	Start           time.Time
+	End             time.Time
+	Interval        time.Duration `json:"-"`
+	IntervalSeconds float64
+	// Buckets holds the start time of each bucket.
+	Buckets []time.Time
+	// Series is ordered by descending total, then key.
+	Series []Series
+	Total  int
+}
+
+// Aggregate counts records per key and interval bucket over [Start, End].
+func Aggregate(records []model.LogRecord, o Options) (*Result, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	first := o.Start.Truncate(o.Interval)
+	n := o.buckets()
+	keyOf, _ := KeyFunc(o.By, o.Format)
+
+	res := &Result{Start: o.Start, End: o.End, Interval: o.Interval, IntervalSeconds: o.Interval.Seconds()}
+	for i := 0; i < n; i++ {
+		res.Buckets = append(res.Buckets, first.Add(time.Duration(i)*o.Interval))
+	}
+	byKey := map[string]*Series{}
+	for _, r := range records {
+		i := int(r.Timestamp.Sub(first) / o.Interval)
+		if r.Timestamp.Before(first) || i >= n {
+			continue
+		}
+		k := keyOf(r)
+		s, ok := byKey[k]
+		if !ok {
+			s = &Series{Key: k, Counts: make([]int, n)}
+			byKey[k] = s
+		}
+		s.Counts[i]++
+		s.Total++
+		res.Total++
+	}
+	for _, s := range byKey {
+		res.Series = append(res.Series, *s)
+	}
+	sort.Slice(res.Series, func(i, j int) bool {
+		if res.Series[i].Total != res.Series[j].Total {
+			return res.Series[i].Total > res.Series[j].Total
+		}
+		return res.Series[i].Key < res.Series[j].Key
+	})
+	if o.Top > 0 && len(res.Series) > o.Top {
+		other := Series{Key: OtherKey, Counts: make([]int, n)}
+		for _, s := range res.Series[o.Top:] {
+			other.Total += s.Total
+			for i, c := range s.Counts {
+				other.Counts[i] += c
+			}
+		}
+		res.Series = append(res.Series[:o.Top:o.Top], other)
+	}
+	return res, nil
+}
+
+// KeyFunc returns the key extractor for a --by value: ByGroup, ByStream,
+// ByNone, or a JMESPath expression over the parsed message.
+func KeyFunc(by string, format parser.Format) (func(model.LogRecord) string, error) {
+	switch by {
+	case "", ByGroup:
+		return func(r model.LogRecord) string { return r.LogGroup }, nil
+	case ByStream:
+		return func(r model.LogRecord) string { return r.LogGroup + "/" + r.LogStream }, nil
+	case ByNone:
+		return func(model.LogRecord) string { return "all" }, nil
+	}
+	expr, err := jmespath.Compile(by)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --by expression: %w", err)
+	}
+	return func(r model.LogRecord) string {
+		v, err := expr.Search(parser.Parse(format, r.Message))
+		if err != nil || v == nil {
+			return MissingKey
+		}
+		if s, ok := v.(string); ok {
+			if s == "" {
+				return MissingKey
+			}
+			return s
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return MissingKey
+		}
+		return string(b)
+	}, nil
+}
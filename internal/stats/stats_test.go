@@ -0,0 +1,139 @@
+package stats_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/stats"
+)
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+func rec(offset time.Duration, group, stream, msg string) model.LogRecord {
+	return model.LogRecord{Timestamp: t0.Add(offset), LogGroup: group, LogStream: stream, Message: msg}
+}
+
+func TestAutoInterval(t *testing.T) {
+	tests := []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{30 * time.Second, time.Second},
+		{time.Hour, time.Minute},
+		{24 * time.Hour, 30 * time.Minute},
+		{365 * 24 * time.Hour, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := stats.AutoInterval(t0, t0.Add(tt.span), 60); got != tt.want {
+			t.Fatalf("AutoInterval(%v) = %v, want %v", tt.span, got, tt.want)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	records := []model.LogRecord{
+		rec(10*time.Second, "/a", "s1", `{"status":500}`),
+		rec(20*time.Second, "/a", "s2", `{"status":502}`),
+		rec(70*time.Second, "/b", "s1", `{"status":500}`),
+		rec(150*time.Second, "/a", "s1", `plain`),
+		rec(-time.Hour, "/a", "s1", "outside window"),
+	}
+	tests := []struct {
+		name      string
+		by        string
+		top       int
+		wantKeys  []string
+		wantFirst []int
+	}{
+		{"by group", stats.ByGroup, 0, []string{"/a", "/b"}, []int{2, 0, 1}},
+		{"by stream", stats.ByStream, 0, []string{"/a/s1", "/a/s2", "/b/s1"}, []int{1, 0, 1}},
+		{"by none", stats.ByNone, 0, []string{"all"}, []int{2, 1, 1}},
+		{"by jmespath", "status", 0, []string{"500", "(none)", "502"}, []int{1, 1, 0}},
+		{"top folds others", stats.ByStream, 1, []string{"/a/s1", "(other)"}, []int{1, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := stats.Aggregate(records, stats.Options{
+				Start: t0, End: t0.Add(3 * time.Minute), Interval: time.Minute,
+				By: tt.by, Format: parser.FormatAuto, Top: tt.top,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res.Buckets) != 4 || res.Total != 4 {
+				t.Fatalf("buckets=%d total=%d", len(res.Buckets), res.Total)
+			}
+			var keys []string
+			for _, s := range res.Series {
+				keys = append(keys, s.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Fatalf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+			got := res.Series[0].Counts[:3]
+			for i := range tt.wantFirst {
+				if got[i] != tt.wantFirst[i] {
+					t.Fatalf("first series counts = %v, want prefix %v", res.Series[0].Counts, tt.wantFirst)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateErrors(t *testing.T) {
+	if _, err := stats.Aggregate(nil, stats.Options{Start: t0, End: t0.Add(time.Hour)}); err == nil {
+		t.Fatal("expected error for zero interval")
+	}
+	if _, err := stats.Aggregate(nil, stats.Options{Start: t0, End: t0.Add(time.Hour), Interval: time.Millisecond}); err == nil {
+		t.Fatal("expected error for too many buckets")
+	}
+	if _, err := stats.Aggregate(nil, stats.Options{Start: t0, End: t0.Add(time.Hour), Interval: time.Minute, By: "a.["}); err == nil {
+		t.Fatal("expected error for invalid expression")
+	}
+}
+
+func TestRender(t *testing.T) {
+	records := []model.LogRecord{rec(0, "/a", "s", "x"), rec(0, "/a", "s", "x"), rec(time.Minute, "/b", "s", "x")}
+	res, err := stats.Aggregate(records, stats.Options{Start: t0, End: t0.Add(time.Minute), Interval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := res.WriteTable(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "/a") || !strings.Contains(lines[0], "total") || !strings.HasPrefix(strings.TrimSpace(lines[3]), "total") {
+		t.Fatalf("table:\n%s", buf.String())
+	}
+	if f := strings.Fields(lines[1]); f[1] != "2" || f[2] != "0" || f[3] != "2" {
+		t.Fatalf("first row = %v", f)
+	}
+
+	buf.Reset()
+	if err := res.WriteSparklines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/a █  2") || !strings.Contains(buf.String(), "/b  █ 1") {
+		t.Fatalf("sparklines:\n%q", buf.String())
+	}
+
+	buf.Reset()
+	if err := res.WriteHistogram(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/a (2)") || !strings.Contains(buf.String(), strings.Repeat("#", 50)+" 2") {
+		t.Fatalf("histogram:\n%s", buf.String())
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := stats.Sparkline([]int{0, 1, 4, 8}); got != " ▁▄█" {
+		t.Fatalf("Sparkline = %q", got)
+	}
+}
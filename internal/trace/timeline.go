@@ -0,0 +1,159 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// Timeline is the chronological view of a trace across log groups, each
+// group standing for a service.
+type Timeline struct {
+	Start    time.Time
+	Duration time.Duration
+	Entries  []Entry
+	Services []Service
+}
+
+// Entry is one event of a timeline.
+type Entry struct {
+	model.LogRecord
+	// Offset is the time since the first event of the trace.
+	Offset time.Duration
+	// Gap is set on the first event after an event of another group: the
+	// latency of the hop between the two services.
+	Gap time.Duration `json:",omitempty"`
+	Hop bool          `json:",omitempty"`
+}
+
+// Service summarizes the events of one log group.
+type Service struct {
+	Group  string
+	Events int
+	// Offset is the time from the start of the trace to the group's first
+	// event; Duration runs from its first to its last event.
+	Offset   time.Duration
+	Duration time.Duration
+	// Hops counts the times the trace moved into the group from another
+	// one, and Gap sums their latency.
+	Hops int
+	Gap  time.Duration
+}
+
+// Timeline orders the records of r and measures the gaps between services.
+func (r *Result) Timeline() Timeline {
+	records := append([]model.LogRecord(nil), r.Records...)
+	sortRecords(records)
+	var tl Timeline
+	if len(records) == 0 {
+		return tl
+	}
+	tl.Start = records[0].Timestamp
+	tl.Duration = records[len(records)-1].Timestamp.Sub(tl.Start)
+	services := map[string]*Service{}
+	var order []string
+	for i, rec := range records {
+		e := Entry{LogRecord: rec, Offset: rec.Timestamp.Sub(tl.Start)}
+		s, ok := services[rec.LogGroup]
+		if !ok {
+			s = &Service{Group: rec.LogGroup, Offset: e.Offset}
+			services[rec.LogGroup] = s
+			order = append(order, rec.LogGroup)
+		}
+		if i > 0 && records[i-1].LogGroup != rec.LogGroup {
+			e.Hop, e.Gap = true, rec.Timestamp.Sub(records[i-1].Timestamp)
+			s.Hops++
+			s.Gap += e.Gap
+		}
+		s.Events++
+		s.Duration = e.Offset - s.Offset
+		tl.Entries = append(tl.Entries, e)
+	}
+	for _, g := range order {
+		tl.Services = append(tl.Services, *services[g])
+	}
+	return tl
+}
+
+// WriteText writes the timeline: one line per event with its offset from
+// the start of the trace, a line for each hop between groups with its
+// latency, and a table of the groups.
+func (tl Timeline) WriteText(w io.Writer) error {
+	if len(tl.Entries) == 0 {
+		return nil
+	}
+	width := 0
+	for _, s := range tl.Services {
+		width = max(width, len(s.Group))
+	}
+	for _, e := range tl.Entries {
+		if e.Hop {
+			fmt.Fprintf(w, "%10s  %s -> %s\n", "", "+"+formatDuration(e.Gap), e.LogGroup)
+		}
+		msg := strings.TrimRight(e.Message, "\r\n")
+		fmt.Fprintf(w, "%10s  %s  %-*s  %s\n", "+"+formatDuration(e.Offset), e.Timestamp.UTC().Format("15:04:05.000"), width, e.LogGroup, msg)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "group\tevents\tstart\tduration\thops\tgap")
+	for _, s := range tl.Services {
+		fmt.Fprintf(tw, "%s\t%d\t+%s\t%s\t%d\t%s\n", s.Group, s.Events, formatDuration(s.Offset), formatDuration(s.Duration), s.Hops, formatDuration(s.Gap))
+	}
+	fmt.Fprintf(tw, "total\t%d\t\t%s\n", len(tl.Entries), formatDuration(tl.Duration))
+	return tw.Flush()
+}
+
+// formatDuration rounds d to milliseconds.
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// sortRecords orders records by time, then group and stream, keeping the
+// search order of equal events.
+func sortRecords(records []model.LogRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+		if a.LogGroup != b.LogGroup {
+			return a.LogGroup < b.LogGroup
+		}
+		return a.LogStream < b.LogStream
+	})
+}
+
+// WriteSummary writes the IDs searched and whether the expansion reached
+// closure, as a header for the timeline.
+func (r *Result) WriteSummary(w io.Writer) error {
+	groups := map[string]bool{}
+	for _, rec := range r.Records {
+		groups[rec.LogGroup] = true
+	}
+	fmt.Fprintf(w, "Trace %s: %d events in %d groups, %d IDs searched in %d rounds\n", r.ID, len(r.Records), len(groups), len(r.IDs), r.Rounds)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, id := range r.IDs {
+		from := "given"
+		if id.Round > 0 {
+			from = fmt.Sprintf("round %d, %s", id.Round, id.Group)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", id.Name, id.Value, from)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !r.Complete {
+		pending := make([]string, len(r.Pending))
+		for i, id := range r.Pending {
+			pending[i] = id.Name + "=" + id.Value
+		}
+		fmt.Fprintf(w, "Stopped before closure; not searched: %s\n", strings.Join(pending, ", "))
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,69 @@
+package trace_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+)
+
+func TestTimeline(t *testing.T) {
+	// Out of order, as several rounds of searching return them.
+	res := &trace.Result{Records: append(events[2:5:5], events[0:2]...)}
+	tl := res.Timeline()
+	if len(tl.Entries) != 5 || !tl.Start.Equal(t0) || tl.Duration != 400*time.Millisecond {
+		t.Fatalf("timeline = %+v", tl)
+	}
+	if e := tl.Entries[2]; !e.Hop || e.Gap != 230*time.Millisecond || e.Offset != 250*time.Millisecond {
+		t.Fatalf("hop to worker = %+v", e)
+	}
+	want := []trace.Service{
+		{Group: "/aws/lambda/api", Events: 2, Duration: 20 * time.Millisecond},
+		{Group: "/aws/lambda/worker", Events: 2, Offset: 250 * time.Millisecond, Duration: 10 * time.Millisecond, Hops: 1, Gap: 230 * time.Millisecond},
+		{Group: "/aws/ecs/billing", Events: 1, Offset: 400 * time.Millisecond, Hops: 1, Gap: 140 * time.Millisecond},
+	}
+	for i, s := range tl.Services {
+		if s != want[i] {
+			t.Errorf("service %d = %+v, want %+v", i, s, want[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := tl.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	text := out.String()
+	for _, line := range []string{
+		"       +0s  11:00:00.000  /aws/lambda/api     ",
+		"            +230ms -> /aws/lambda/worker\n    +250ms  11:00:00.250  /aws/lambda/worker  START RequestId",
+		"/aws/ecs/billing    1       +400ms  0s        1     140ms",
+		"total               5               400ms",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("output lacks %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	res := &trace.Result{
+		ID:      "abc",
+		IDs:     []trace.ID{{Value: "abc", Name: "id"}, {Value: "req-api-0001", Name: "requestId", Round: 1, Group: "/aws/lambda/api"}},
+		Rounds:  2,
+		Pending: []trace.ID{{Value: "job-000042", Name: "job", Round: 2}},
+		Records: events[:2],
+	}
+	var out bytes.Buffer
+	if err := res.WriteSummary(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := "Trace abc: 2 events in 1 groups, 2 IDs searched in 2 rounds\n" +
+		"  id         abc           given\n" +
+		"  requestId  req-api-0001  round 1, /aws/lambda/api\n" +
+		"Stopped before closure; not searched: job=job-000042\n\n"
+	if out.String() != want {
+		t.Fatalf("summary =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,338 @@
+// Package trace follows a request across log groups. Starting from a trace
+// ID it searches for every event mentioning the ID, extracts related IDs
+// (span, parent and request IDs) from the matched events with JMESPath
+// extractors, and searches again for the new IDs until no new ID turns up or
+// a depth limit is reached. Timeline orders the events and measures the
+// latency between services.
+package trace
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// DefaultDepth is the number of expansion rounds after the search for the
+// given ID.
+const DefaultDepth = 3
+
+// DefaultMaxIDs bounds the IDs searched in one trace, so that an extractor
+// matching something shared by many requests cannot fan out without end.
+const DefaultMaxIDs = 50
+
+// MaxPatternLength is the longest filter pattern CloudWatch Logs accepts;
+// the IDs of a round are split into patterns of at most this length.
+const MaxPatternLength = 1024
+
+// Config is the trace section of the config file.
+//
+//	trace:
+//	  depth: 2
+//	  maxIds: 20
+//	  extractors:
+//	    - {name: orderId, path: 'detail.orderId'}
+type Config struct {
+	// Depth is the number of expansion rounds; 0 searches the given ID only.
+	Depth int `yaml:"depth"`
+	// MaxIDs bounds the IDs searched; 0 means DefaultMaxIDs.
+	MaxIDs int `yaml:"maxIds"`
+	// Extractors are added to DefaultExtractors.
+	Extractors []Extractor `yaml:"extractors"`
+}
+
+// Extractor finds related IDs in a matched event.
+type Extractor struct {
+	// Name labels the IDs it finds.
+	Name string `yaml:"name"`
+	// Path is a JMESPath expression evaluated on the parsed message; the
+	// strings and numbers it selects, directly or in a list, are IDs.
+	Path string `yaml:"path"`
+}
+
+// DefaultExtractors find the trace, span and request IDs written under
+// their common field names. X-Ray and W3C traceparent header values are
+// split into their trace and parent IDs.
+var DefaultExtractors = []Extractor{
+	{Name: "traceId", Path: `[traceId, trace_id, traceID, xrayTraceId, "X-Amzn-Trace-Id", traceparent, headers."X-Amzn-Trace-Id", headers.traceparent]`},
+	{Name: "spanId", Path: `[spanId, span_id, parentSpanId, parent_span_id, parentId, parent_id]`},
+	{Name: "requestId", Path: `[requestId, request_id, requestID, awsRequestId, "x-request-id", correlationId, correlation_id]`},
+}
+
+// ParseExtractor parses "name=path".
+func ParseExtractor(s string) (Extractor, error) {
+	name, path, ok := strings.Cut(s, "=")
+	name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+	if !ok || name == "" || path == "" {
+		return Extractor{}, fmt.Errorf("invalid extractor %q; expected name=path", s)
+	}
+	return Extractor{Name: name, Path: path}, nil
+}
+
+// Searcher returns the events matching a filter pattern.
+type Searcher func(ctx context.Context, pattern string) ([]model.LogRecord, error)
+
+// Tracer expands traces with one searcher and set of extractors.
+type Tracer struct {
+	search     Searcher
+	format     parser.Format
+	depth      int
+	maxIDs     int
+	extractors []extractor
+}
+
+type extractor struct {
+	name string
+	path *jmespath.JMESPath
+}
+
+// New returns a Tracer for cfg, parsing messages in format for the
+// extractors, or an error for an invalid extractor.
+func New(search Searcher, cfg Config, format parser.Format) (*Tracer, error) {
+	if cfg.Depth < 0 {
+		return nil, fmt.Errorf("depth must not be negative")
+	}
+	t := &Tracer{search: search, format: format, depth: cfg.Depth, maxIDs: cfg.MaxIDs}
+	if t.maxIDs <= 0 {
+		t.maxIDs = DefaultMaxIDs
+	}
+	for i, e := range append(append([]Extractor(nil), DefaultExtractors...), cfg.Extractors...) {
+		if e.Name == "" || e.Path == "" {
+			return nil, fmt.Errorf("extractor %d: name and path are required", i+1-len(DefaultExtractors))
+		}
+		path, err := jmespath.Compile(e.Path)
+		if err != nil {
+			return nil, fmt.Errorf("extractor %s: %w", e.Name, err)
+		}
+		t.extractors = append(t.extractors, extractor{e.Name, path})
+	}
+	return t, nil
+}
+
+// ID is an identifier searched for in a trace.
+type ID struct {
+	Value string
+	// Name is the extractor that found the ID, or the part of the given ID
+	// it is ("id", "traceId", "parentId").
+	Name string
+	// Round is the search round that found the ID; 0 for the given ID.
+	Round int
+	// Group is the log group of the first event it was found in.
+	Group string `json:",omitempty"`
+}
+
+// Result is an expanded trace.
+type Result struct {
+	ID string
+	// IDs lists the IDs searched, in the order found.
+	IDs []ID
+	// Rounds is the number of search rounds run.
+	Rounds int
+	// Complete reports that the last round found no new ID; otherwise the
+	// depth or ID limit stopped the expansion and Pending holds the IDs
+	// found but not searched.
+	Complete bool
+	Pending  []ID `json:",omitempty"`
+	// Records are the matched events in chronological order.
+	Records []model.LogRecord `json:"-"`
+}
+
+// Trace searches for id and the IDs related to it.
+func (t *Tracer) Trace(ctx context.Context, id string) (*Result, error) {
+	res := &Result{ID: id}
+	seen := map[string]bool{}
+	var next []ID
+	add := func(list *[]ID, cand ID) {
+		if !seen[cand.Value] {
+			seen[cand.Value] = true
+			*list = append(*list, cand)
+		}
+	}
+	for _, s := range Split(id) {
+		add(&next, ID{Value: s.Value, Name: s.Name})
+	}
+	records := map[string]bool{}
+	for round := 0; len(next) > 0; round++ {
+		if round > t.depth || len(res.IDs) >= t.maxIDs {
+			res.Pending = next
+			return res, nil
+		}
+		batch := next
+		if room := t.maxIDs - len(res.IDs); len(batch) > room {
+			batch, res.Pending = batch[:room], batch[room:]
+		}
+		next = nil
+		res.IDs = append(res.IDs, batch...)
+		res.Rounds++
+
+		values := make([]string, len(batch))
+		for i, b := range batch {
+			values[i] = b.Value
+		}
+		var found []model.LogRecord
+		for _, pattern := range Patterns(values) {
+			matched, err := t.search(ctx, pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range matched {
+				if k := recordKey(r); !records[k] {
+					records[k] = true
+					found = append(found, r)
+				}
+			}
+		}
+		sortRecords(found)
+		for _, r := range found {
+			for _, cand := range t.extract(r) {
+				cand.Round = round + 1
+				add(&next, cand)
+			}
+		}
+		res.Records = append(res.Records, found...)
+		if res.Pending != nil {
+			// The ID limit cut this round short.
+			res.Pending = append(res.Pending, next...)
+			sortRecords(res.Records)
+			return res, nil
+		}
+	}
+	sortRecords(res.Records)
+	res.Complete = true
+	return res, nil
+}
+
+// extract returns the IDs the extractors find in r.
+func (t *Tracer) extract(r model.LogRecord) []ID {
+	doc := parser.Parse(t.format, r.Message)
+	var ids []ID
+	for _, e := range t.extractors {
+		v, err := e.path.Search(doc)
+		if err != nil {
+			continue
+		}
+		for _, s := range values(v) {
+			for _, part := range Split(s) {
+				// Parts of a header are named by the header; a plain value
+				// by the extractor.
+				name := e.name
+				if part.Value != strings.TrimSpace(s) {
+					name = part.Name
+				}
+				if validID(part.Value) {
+					ids = append(ids, ID{Value: part.Value, Name: name, Group: r.LogGroup})
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// values returns the strings and numbers of v, or of its elements when v is
+// a list.
+func values(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		var out []string
+		for _, e := range v {
+			switch e.(type) {
+			case string, float64:
+				out = append(out, values(e)...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// minIDLength keeps short values such as status codes and flags, which
+// would match unrelated events, out of the expansion.
+const minIDLength = 8
+
+func validID(s string) bool {
+	return len(s) >= minIDLength && len(s) <= 256 && !strings.ContainsAny(s, " \t\r\n\"")
+}
+
+var (
+	// traceparentRe matches a W3C traceparent: version-traceid-parentid-flags.
+	traceparentRe = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+	// xrayHeaderRe matches the Root and Parent fields of an X-Amzn-Trace-Id header.
+	xrayHeaderRe = regexp.MustCompile(`(?:^|;)\s*(Root|Parent)=([^;\s]+)`)
+	// traceIDRe matches a bare X-Ray or W3C trace ID.
+	traceIDRe = regexp.MustCompile(`^(?:1-[0-9a-f]{8}-[0-9a-f]{24}|[0-9a-f]{32})$`)
+)
+
+// Split returns the IDs searched for a trace identifier: the trace and
+// parent IDs of a W3C traceparent or X-Amzn-Trace-Id header value, or the
+// value itself, named "traceId" when it has the form of a trace ID and "id"
+// otherwise.
+func Split(s string) []ID {
+	s = strings.TrimSpace(s)
+	if m := traceparentRe.FindStringSubmatch(strings.ToLower(s)); m != nil {
+		return []ID{{Value: m[1], Name: "traceId"}, {Value: m[2], Name: "parentId"}}
+	}
+	if strings.Contains(s, "Root=") {
+		var ids []ID
+		for _, m := range xrayHeaderRe.FindAllStringSubmatch(s, -1) {
+			name := "traceId"
+			if m[1] == "Parent" {
+				name = "parentId"
+			}
+			ids = append(ids, ID{Value: m[2], Name: name})
+		}
+		if len(ids) > 0 {
+			return ids
+		}
+	}
+	switch {
+	case s == "":
+		return nil
+	case traceIDRe.MatchString(s):
+		return []ID{{Value: s, Name: "traceId"}}
+	}
+	return []ID{{Value: s, Name: "id"}}
+}
+
+// Patterns returns filter patterns matching any of ids: a quoted term for a
+// single ID, else ?"a" ?"b" alternatives, split to stay within
+// MaxPatternLength.
+func Patterns(ids []string) []string {
+	if len(ids) == 1 {
+		return []string{strconv.Quote(ids[0])}
+	}
+	var out []string
+	var b strings.Builder
+	for _, id := range ids {
+		term := "?" + strconv.Quote(id)
+		if b.Len() > 0 && b.Len()+1+len(term) > MaxPatternLength {
+			out = append(out, b.String())
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(term)
+	}
+	if b.Len() > 0 {
+		out = append(out, b.String())
+	}
+	return out
+}
+
+// recordKey identifies an event across searches.
+func recordKey(r model.LogRecord) string {
+	if r.EventID != "" {
+		return r.LogGroup + "\x00" + r.EventID
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%s", r.LogGroup, r.LogStream, r.Timestamp.UnixNano(), r.Message)
+}
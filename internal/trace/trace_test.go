@@ -0,0 +1,195 @@
+package trace_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/trace"
+)
+
+var t0 = time.Date(2025, 8, 31, 11, 0, 0, 0, time.UTC)
+
+// events is a request entering an API (X-Ray trace ID), which queues a job
+// handled by a worker under its own request ID, which calls a billing
+// service with an orderId.
+var events = []model.LogRecord{
+	{Timestamp: t0, LogGroup: "/aws/lambda/api", EventID: "1", Message: `{"traceId":"1-5759e988-bd862e3fe1be46a994272793","requestId":"req-api-0001","msg":"received"}`},
+	{Timestamp: t0.Add(20 * time.Millisecond), LogGroup: "/aws/lambda/api", EventID: "2", Message: `{"requestId":"req-api-0001","jobId":"job-000042","msg":"queued"}`},
+	{Timestamp: t0.Add(250 * time.Millisecond), LogGroup: "/aws/lambda/worker", EventID: "3", Message: "START RequestId: 0f8e7d6c-1111-2222-3333-444455556666 Version: $LATEST"},
+	{Timestamp: t0.Add(260 * time.Millisecond), LogGroup: "/aws/lambda/worker", EventID: "4", Message: `{"requestId":"0f8e7d6c-1111-2222-3333-444455556666","jobId":"job-000042","detail":{"orderId":"order-777777"}}`},
+	{Timestamp: t0.Add(400 * time.Millisecond), LogGroup: "/aws/ecs/billing", EventID: "5", Message: `{"orderId":"order-777777","status":200}`},
+	{Timestamp: t0.Add(time.Hour), LogGroup: "/aws/lambda/api", EventID: "6", Message: `{"requestId":"req-api-0002","msg":"unrelated","status":"ok"}`},
+}
+
+var termRe = regexp.MustCompile(`"([^"]+)"`)
+
+// fakeSearch matches events whose message contains any quoted term of the
+// pattern, recording the patterns searched.
+func fakeSearch(patterns *[]string) trace.Searcher {
+	return func(_ context.Context, pattern string) ([]model.LogRecord, error) {
+		*patterns = append(*patterns, pattern)
+		var out []model.LogRecord
+		for _, e := range events {
+			for _, m := range termRe.FindAllStringSubmatch(pattern, -1) {
+				if strings.Contains(e.Message, m[1]) {
+					out = append(out, e)
+					break
+				}
+			}
+		}
+		return out, nil
+	}
+}
+
+func eventIDs(records []model.LogRecord) []string {
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.EventID)
+	}
+	return ids
+}
+
+func TestTraceClosure(t *testing.T) {
+	var patterns []string
+	cfg := trace.Config{Depth: 5, Extractors: []trace.Extractor{{Name: "job", Path: "jobId"}, {Name: "orderId", Path: "detail.orderId"}}}
+	tr, err := trace.New(fakeSearch(&patterns), cfg, parser.FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.Trace(context.Background(), "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(res.Records); !reflect.DeepEqual(got, []string{"1", "2", "3", "4", "5"}) {
+		t.Fatalf("events = %v", got)
+	}
+	if !res.Complete || res.Rounds != 4 {
+		t.Fatalf("complete = %v, rounds = %d", res.Complete, res.Rounds)
+	}
+	var found []string
+	for _, id := range res.IDs {
+		found = append(found, id.Name+"="+id.Value)
+	}
+	want := []string{
+		"traceId=1-5759e988-bd862e3fe1be46a994272793", "parentId=53995c3f42cd8ad8",
+		"requestId=req-api-0001",
+		"job=job-000042",
+		"requestId=0f8e7d6c-1111-2222-3333-444455556666", "orderId=order-777777",
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Fatalf("IDs = %v", found)
+	}
+	if res.IDs[2].Round != 1 || res.IDs[2].Group != "/aws/lambda/api" {
+		t.Fatalf("requestId found in %+v", res.IDs[2])
+	}
+	if patterns[0] != `?"1-5759e988-bd862e3fe1be46a994272793" ?"53995c3f42cd8ad8"` || patterns[1] != `"req-api-0001"` {
+		t.Fatalf("patterns = %q", patterns)
+	}
+}
+
+func TestTraceDepthLimit(t *testing.T) {
+	var patterns []string
+	tr, err := trace.New(fakeSearch(&patterns), trace.Config{Depth: 1, Extractors: []trace.Extractor{{Name: "job", Path: "jobId"}}}, parser.FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tr.Trace(context.Background(), "1-5759e988-bd862e3fe1be46a994272793")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Complete || res.Rounds != 2 || len(res.Pending) != 1 || res.Pending[0].Value != "job-000042" {
+		t.Fatalf("result = %+v", res)
+	}
+	if got := eventIDs(res.Records); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Fatalf("events = %v", got)
+	}
+}
+
+func TestTraceMaxIDs(t *testing.T) {
+	var patterns []string
+	tr, _ := trace.New(fakeSearch(&patterns), trace.Config{Depth: 5, MaxIDs: 1}, parser.FormatAuto)
+	res, err := tr.Trace(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Complete || len(res.IDs) != 1 || res.IDs[0].Value != "4bf92f3577b34da6a3ce929d0e0e4736" || res.Pending[0].Name != "parentId" {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestTraceSearchError(t *testing.T) {
+	boom := errors.New("boom")
+	tr, _ := trace.New(func(context.Context, string) ([]model.LogRecord, error) { return nil, boom }, trace.Config{}, parser.FormatAuto)
+	if _, err := tr.Trace(context.Background(), "abc"); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestNewInvalidExtractor(t *testing.T) {
+	for _, cfg := range []trace.Config{
+		{Extractors: []trace.Extractor{{Name: "x", Path: "a[["}}},
+		{Extractors: []trace.Extractor{{Name: "x"}}},
+		{Depth: -1},
+	} {
+		if _, err := trace.New(nil, cfg, parser.FormatAuto); err == nil {
+			t.Fatalf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestParseExtractor(t *testing.T) {
+	if e, err := trace.ParseExtractor(" order = detail.orderId "); err != nil || e != (trace.Extractor{Name: "order", Path: "detail.orderId"}) {
+		t.Fatalf("ParseExtractor = %+v, %v", e, err)
+	}
+	for _, s := range []string{"order", "=path", "order="} {
+		if _, err := trace.ParseExtractor(s); err == nil {
+			t.Fatalf("ParseExtractor(%q) succeeded", s)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := map[string][]trace.ID{
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01": {{Value: "4bf92f3577b34da6a3ce929d0e0e4736", Name: "traceId"}, {Value: "00f067aa0ba902b7", Name: "parentId"}},
+		"Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1":      {{Value: "1-5759e988-bd862e3fe1be46a994272793", Name: "traceId"}},
+		"1-5759e988-bd862e3fe1be46a994272793":                     {{Value: "1-5759e988-bd862e3fe1be46a994272793", Name: "traceId"}},
+		" req-1 ":                                                 {{Value: "req-1", Name: "id"}},
+		"":                                                        nil,
+	}
+	for in, want := range tests {
+		if got := trace.Split(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(%q) = %+v, want %+v", in, got, want)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	if got := trace.Patterns([]string{"a b"}); !reflect.DeepEqual(got, []string{`"a b"`}) {
+		t.Fatalf("single = %q", got)
+	}
+	ids := make([]string, 40)
+	for i := range ids {
+		ids[i] = strings.Repeat(string(rune('a'+i%26)), 30)
+	}
+	got := trace.Patterns(ids)
+	if len(got) != 2 {
+		t.Fatalf("%d patterns", len(got))
+	}
+	terms := 0
+	for _, p := range got {
+		if len(p) > trace.MaxPatternLength {
+			t.Fatalf("pattern of %d bytes", len(p))
+		}
+		terms += strings.Count(p, "?")
+	}
+	if terms != len(ids) {
+		t.Fatalf("%d terms, want %d", terms, len(ids))
+	}
+}
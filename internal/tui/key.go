@@ -0,0 +1,87 @@
+package tui
+
+import "unicode/utf8"
+
+// KeyType is a decoded key press.
+type KeyType int
+
+const (
+	KeyRune KeyType = iota
+	KeyEnter
+	KeyBackspace
+	KeyEsc
+	KeyCtrlC
+	KeyUp
+	KeyDown
+	KeyPgUp
+	KeyPgDown
+	KeyHome
+	KeyEnd
+	KeyUnknown
+)
+
+// Key is one key press; Rune is set for KeyRune.
+type Key struct {
+	Type KeyType
+	Rune rune
+}
+
+// escapes maps the terminal escape sequences of special keys.
+var escapes = map[string]KeyType{
+	"\x1b[A": KeyUp, "\x1bOA": KeyUp,
+	"\x1b[B": KeyDown, "\x1bOB": KeyDown,
+	"\x1b[5~": KeyPgUp, "\x1b[6~": KeyPgDown,
+	"\x1b[H": KeyHome, "\x1bOH": KeyHome, "\x1b[1~": KeyHome, "\x1b[7~": KeyHome,
+	"\x1b[F": KeyEnd, "\x1bOF": KeyEnd, "\x1b[4~": KeyEnd, "\x1b[8~": KeyEnd,
+}
+
+// DecodeKeys splits input read from a raw-mode terminal into key presses. A
+// lone ESC is the Escape key; unknown escape sequences are reported once as
+// KeyUnknown.
+func DecodeKeys(b []byte) []Key {
+	var keys []Key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			n := escapeLen(b)
+			if n == 1 {
+				keys = append(keys, Key{Type: KeyEsc})
+			} else if t, ok := escapes[string(b[:n])]; ok {
+				keys = append(keys, Key{Type: t})
+			} else {
+				keys = append(keys, Key{Type: KeyUnknown})
+			}
+			b = b[n:]
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, Key{Type: KeyEnter})
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, Key{Type: KeyBackspace})
+		case c == 0x03:
+			keys = append(keys, Key{Type: KeyCtrlC})
+		case c < ' ':
+			keys = append(keys, Key{Type: KeyUnknown})
+		default:
+			r, n := utf8.DecodeRune(b)
+			keys = append(keys, Key{Type: KeyRune, Rune: r})
+			b = b[n:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// escapeLen returns the length of the escape sequence at the start of b.
+func escapeLen(b []byte) int {
+	if len(b) < 2 || (b[1] != '[' && b[1] != 'O') {
+		return 1
+	}
+	for i := 2; i < len(b); i++ {
+		// CSI and SS3 sequences end with a byte in 0x40..0x7e
+		if b[i] >= 0x40 && b[i] <= 0x7e {
+			return i + 1
+		}
+	}
+	return len(b)
+}
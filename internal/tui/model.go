@@ -0,0 +1,528 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// ActionKind is what the runner must do after a key press.
+type ActionKind int
+
+const (
+	ActionNone ActionKind = iota
+	ActionQuit
+	// ActionSearch stops any tail, runs Action.Pattern and reports back
+	// with SetResults.
+	ActionSearch
+	// ActionTail starts following Action.Pattern from Action.From;
+	// ActionStopTail stops it.
+	ActionTail
+	ActionStopTail
+)
+
+// Action is a request from the model to the runner.
+type Action struct {
+	Kind    ActionKind
+	Pattern string
+	From    time.Time
+}
+
+type mode int
+
+const (
+	modeList mode = iota
+	modeFilter
+	modeExtract
+	modeNext
+)
+
+// result is one search's records, kept so "back" can return to it.
+type result struct {
+	pattern string
+	records []model.LogRecord
+}
+
+// groupColors are the ANSI foreground colors assigned to log groups.
+var groupColors = []int{36, 33, 32, 35, 34, 31, 96, 93, 92, 95, 94, 91}
+
+const helpLine = "j/k move  / filter  e extract  n next-filter  b back  t tail  q quit"
+
+// Model is the state of the TUI: the current result set, the filtered list,
+// the selection and the prompt. It does no I/O; the runner feeds it keys and
+// results and draws View.
+type Model struct {
+	format  parser.Format
+	pattern string
+	records []model.LogRecord
+	seen    map[string]bool
+	history []result
+
+	filter  string
+	visible []int // indexes into records
+	cursor  int   // index into visible
+	offset  int   // first visible row shown
+
+	mode   mode
+	input  string
+	status string
+	busy   bool
+	tail   bool
+
+	extractSpec        string
+	extractName, value string
+
+	// redactor masks what is shown; records keep their raw messages so
+	// extract and next-filter work on the real values.
+	redactor *redact.Redactor
+}
+
+// NewModel returns a model about to run the search for pattern.
+func NewModel(pattern string, format parser.Format) *Model {
+	return &Model{format: format, pattern: pattern, busy: true, status: "searching " + pattern + " ..."}
+}
+
+// SetRedactor masks sensitive values in the list, detail pane and extracted
+// values with r.
+func (m *Model) SetRedactor(r *redact.Redactor) { m.redactor = r }
+
+// Pattern returns the filter pattern of the shown results.
+func (m *Model) Pattern() string { return m.pattern }
+
+// Tailing reports whether live tail is on.
+func (m *Model) Tailing() bool { return m.tail }
+
+// SetResults replaces the shown records with the result of searching pattern.
+func (m *Model) SetResults(pattern string, records []model.LogRecord, err error) {
+	m.busy = false
+	if err != nil {
+		m.status = "search error: " + err.Error()
+		return
+	}
+	if m.records != nil || m.pattern != pattern {
+		m.history = append(m.history, result{m.pattern, m.records})
+	}
+	m.pattern = pattern
+	m.setRecords(records)
+	m.status = fmt.Sprintf("%d records for %s", len(records), pattern)
+}
+
+func (m *Model) setRecords(records []model.LogRecord) {
+	m.records = records
+	m.seen = map[string]bool{}
+	for _, r := range records {
+		m.seen[recordKey(r)] = true
+	}
+	m.cursor, m.offset = 0, 0
+	m.refilter()
+}
+
+// Append adds tailed records not shown yet. The selection follows the end
+// of the list when it was already there.
+func (m *Model) Append(records []model.LogRecord) {
+	atEnd := len(m.visible) == 0 || m.cursor == len(m.visible)-1
+	for _, r := range records {
+		k := recordKey(r)
+		if m.seen[k] {
+			continue
+		}
+		m.seen[k] = true
+		m.records = append(m.records, r)
+		if m.matches(r) {
+			m.visible = append(m.visible, len(m.records)-1)
+		}
+	}
+	if atEnd && len(m.visible) > 0 {
+		m.cursor = len(m.visible) - 1
+	}
+}
+
+// TailStopped reports that tailing ended, with the error that stopped it.
+func (m *Model) TailStopped(err error) {
+	m.tail = false
+	if err != nil {
+		m.status = "tail error: " + err.Error()
+	}
+}
+
+// recordKey identifies a record across a search and overlapping tail polls.
+func recordKey(r model.LogRecord) string {
+	if r.EventID != "" {
+		return r.LogGroup + "\x00" + r.EventID
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%s", r.LogGroup, r.LogStream, r.Timestamp.UnixMilli(), r.Message)
+}
+
+func (m *Model) matches(r model.LogRecord) bool {
+	if m.filter == "" {
+		return true
+	}
+	f := strings.ToLower(m.filter)
+	return strings.Contains(strings.ToLower(m.redactor.String(r.Message)), f) ||
+		strings.Contains(strings.ToLower(r.LogGroup), f) ||
+		strings.Contains(strings.ToLower(r.LogStream), f)
+}
+
+func (m *Model) refilter() {
+	m.visible = m.visible[:0]
+	for i, r := range m.records {
+		if m.matches(r) {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.cursor = min(m.cursor, max(len(m.visible)-1, 0))
+}
+
+// Selected returns the selected record.
+func (m *Model) Selected() (model.LogRecord, bool) {
+	if len(m.visible) == 0 {
+		return model.LogRecord{}, false
+	}
+	return m.records[m.visible[m.cursor]], true
+}
+
+// HandleKey applies a key press. page is the number of list rows shown, for
+// page up and down.
+func (m *Model) HandleKey(k Key, page int) Action {
+	if k.Type == KeyCtrlC {
+		return Action{Kind: ActionQuit}
+	}
+	if m.mode != modeList {
+		return m.handlePrompt(k)
+	}
+	switch {
+	case k.Type == KeyDown || k.Rune == 'j':
+		m.move(1)
+	case k.Type == KeyUp || k.Rune == 'k':
+		m.move(-1)
+	case k.Type == KeyPgDown || k.Rune == ' ':
+		m.move(max(page, 1))
+	case k.Type == KeyPgUp:
+		m.move(-max(page, 1))
+	case k.Type == KeyHome || k.Rune == 'g':
+		m.cursor = 0
+	case k.Type == KeyEnd || k.Rune == 'G':
+		m.cursor = max(len(m.visible)-1, 0)
+	case k.Rune == 'q':
+		return Action{Kind: ActionQuit}
+	case k.Type == KeyEsc:
+		if m.filter != "" {
+			m.filter = ""
+			m.refilter()
+		}
+	case k.Rune == '/':
+		m.mode, m.input = modeFilter, m.filter
+	case k.Rune == 'e':
+		if _, ok := m.Selected(); !ok {
+			m.status = "no record selected"
+			break
+		}
+		m.mode, m.input = modeExtract, m.extractSpec
+	case k.Rune == 'n':
+		if m.extractName == "" {
+			m.status = "extract a value first (e)"
+			break
+		}
+		m.mode, m.input = modeNext, "value"
+	case k.Rune == 'b' || k.Type == KeyBackspace:
+		return m.back()
+	case k.Rune == 't':
+		if m.tail {
+			m.tail = false
+			m.status = "tail stopped"
+			return Action{Kind: ActionStopTail}
+		}
+		if m.busy {
+			break
+		}
+		m.tail = true
+		m.status = "tailing " + m.pattern
+		return Action{Kind: ActionTail, Pattern: m.pattern, From: m.newest()}
+	}
+	return Action{}
+}
+
+func (m *Model) move(n int) {
+	m.cursor = max(0, min(m.cursor+n, len(m.visible)-1))
+}
+
+// newest is where a tail of the shown results starts.
+func (m *Model) newest() time.Time {
+	t := time.Now()
+	if len(m.records) > 0 {
+		t = m.records[len(m.records)-1].Timestamp
+	}
+	return t
+}
+
+func (m *Model) back() Action {
+	if len(m.history) == 0 || m.busy {
+		return Action{}
+	}
+	prev := m.history[len(m.history)-1]
+	m.history = m.history[:len(m.history)-1]
+	m.pattern = prev.pattern
+	m.setRecords(prev.records)
+	m.status = fmt.Sprintf("back to %d records for %s", len(prev.records), prev.pattern)
+	if m.tail {
+		m.tail = false
+		return Action{Kind: ActionStopTail}
+	}
+	return Action{}
+}
+
+func (m *Model) handlePrompt(k Key) Action {
+	switch k.Type {
+	case KeyEsc:
+		if m.mode == modeFilter {
+			m.filter = ""
+			m.refilter()
+		}
+		m.mode = modeList
+		return Action{}
+	case KeyBackspace:
+		if r := []rune(m.input); len(r) > 0 {
+			m.input = string(r[:len(r)-1])
+		}
+	case KeyRune:
+		m.input += string(k.Rune)
+	case KeyEnter:
+		md := m.mode
+		m.mode = modeList
+		switch md {
+		case modeExtract:
+			m.extract(m.input)
+		case modeNext:
+			return m.next(m.input)
+		}
+		return Action{}
+	default:
+		return Action{}
+	}
+	if m.mode == modeFilter {
+		// filter as you type
+		m.filter = m.input
+		m.refilter()
+	}
+	return Action{}
+}
+
+// extract evaluates spec ("name=path") against the selected record.
+func (m *Model) extract(spec string) {
+	name, path, ok := strings.Cut(spec, "=")
+	name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+	if !ok || name == "" || path == "" {
+		m.status = "invalid extract format; expected name=path"
+		return
+	}
+	m.extractSpec = spec
+	r, _ := m.Selected()
+	ev := []types.FilteredLogEvent{{Message: aws.String(r.Message)}}
+	value, found, err := util.ExtractFirstValueWithParser(ev, path, m.format)
+	switch {
+	case err != nil:
+		m.status = "extract error: " + err.Error()
+	case !found:
+		m.status = "no value for " + path + " in the selected record"
+	default:
+		m.extractName, m.value = name, value
+		m.status = fmt.Sprintf("%s = %s (n: next-filter search)", name, m.redactor.String(value))
+		if r.Masked() {
+			m.status += " - record is masked; see --unmask"
+		}
+	}
+}
+
+// next builds the next filter from the extracted value and searches it.
+func (m *Model) next(expr string) Action {
+	pattern, err := util.BuildNextFilter(util.ReplacePlaceholder(expr, m.extractName, m.value), m.value)
+	if err != nil {
+		m.status = "next-filter build error: " + err.Error()
+		return Action{}
+	}
+	if m.busy {
+		m.status = "a search is already running"
+		return Action{}
+	}
+	m.busy, m.tail = true, false
+	m.status = "searching " + m.redactor.String(pattern) + " ..."
+	return Action{Kind: ActionSearch, Pattern: pattern}
+}
+
+// listRows is how many list rows fit in a screen of height rows; the rest
+// goes to the header, separator, detail pane and status line.
+func listRows(height int) int {
+	return max((height-3)/2, 1)
+}
+
+// View renders the screen as height lines at most width columns wide (ANSI
+// escapes excluded).
+func (m *Model) View(width, height int) []string {
+	if width < 10 || height < 5 {
+		return []string{truncate("terminal too small", width)}
+	}
+	rows := listRows(height)
+	m.scroll(rows)
+
+	lines := make([]string, 0, height)
+	header := fmt.Sprintf(" %s  %d/%d", m.redactor.String(m.pattern), len(m.visible), len(m.records))
+	if m.filter != "" {
+		header += "  filter: " + m.filter
+	}
+	if m.tail {
+		header += "  [TAIL]"
+	}
+	lines = append(lines, reverse(pad(truncate(header, width), width)))
+
+	for i := m.offset; i < m.offset+rows; i++ {
+		if i >= len(m.visible) {
+			lines = append(lines, "")
+			continue
+		}
+		lines = append(lines, m.row(m.records[m.visible[i]], i == m.cursor, width))
+	}
+	lines = append(lines, strings.Repeat("─", width))
+
+	detail := m.detail()
+	for i := 0; len(lines) < height-1; i++ {
+		if i < len(detail) {
+			lines = append(lines, truncate(detail[i], width))
+		} else {
+			lines = append(lines, "")
+		}
+	}
+
+	var status string
+	switch m.mode {
+	case modeFilter:
+		status = "/" + m.input
+	case modeExtract:
+		status = "extract name=path: " + m.input
+	case modeNext:
+		status = "next-filter: " + m.input
+	default:
+		status = m.status
+		if status == "" {
+			status = helpLine
+		}
+	}
+	return append(lines, truncate(status, width))
+}
+
+// scroll keeps the cursor inside the shown rows.
+func (m *Model) scroll(rows int) {
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.visible)-rows))
+}
+
+func (m *Model) row(r model.LogRecord, selected bool, width int) string {
+	ts := r.Timestamp.UTC().Format("01-02 15:04:05")
+	group := r.LogGroup
+	if i := strings.LastIndexByte(group, '/'); i >= 0 && i < len(group)-1 {
+		group = group[i+1:]
+	}
+	group = truncate(group, 20)
+	msg := truncate(oneLine(m.redactor.String(r.Message)), max(width-len(ts)-len([]rune(group))-2, 0))
+	if selected {
+		return reverse(pad(ts+" "+group+" "+msg, width))
+	}
+	return ts + " " + color(r.LogGroup, group) + " " + msg
+}
+
+// detail is the selected record: where it came from, then its message with
+// JSON and parsed formats pretty-printed.
+func (m *Model) detail() []string {
+	r, ok := m.Selected()
+	if !ok {
+		if m.busy {
+			return nil
+		}
+		return []string{"no records"}
+	}
+	lines := []string{
+		fmt.Sprintf("%s  %s", r.Timestamp.UTC().Format(time.RFC3339Nano), color(r.LogGroup, r.LogGroup)),
+		"stream: " + r.LogStream,
+	}
+	if r.EventID != "" {
+		lines = append(lines, "event:  "+r.EventID)
+	}
+	lines = append(lines, "")
+	v := r.Fields
+	if v == nil {
+		v = parser.Parse(m.format, r.Message)
+	}
+	msg := m.redactor.String(r.Message)
+	if obj, ok := v.(map[string]any); ok && len(obj) == 1 && obj["message"] == r.Message {
+		// unstructured text
+		return append(lines, expandLines(msg)...)
+	}
+	b, err := json.MarshalIndent(m.redactor.Value(v), "", "  ")
+	if err != nil {
+		return append(lines, expandLines(msg)...)
+	}
+	return append(lines, strings.Split(string(b), "\n")...)
+}
+
+func expandLines(s string) []string {
+	var out []string
+	for _, l := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+		out = append(out, oneLine(l))
+	}
+	return out
+}
+
+// oneLine replaces control characters so a message takes a single row.
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case r < ' ' || r == 0x7f:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string(r[:width])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+func pad(s string, width int) string {
+	if n := width - len([]rune(s)); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+func reverse(s string) string { return "\x1b[7m" + s + "\x1b[0m" }
+
+// color renders s in the color of group; the color depends only on the group
+// name, so it is the same in every session.
+func color(group, s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(group))
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", groupColors[h.Sum32()%uint32(len(groupColors))], s)
+}
@@ -0,0 +1,190 @@
+package tui_test
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/tui"
+)
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+func sampleRecords() []model.LogRecord {
+	return []model.LogRecord{
+		{Timestamp: t0, LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "1", Message: `{"level":"ERROR","user":{"id":"u1"}}`},
+		{Timestamp: t0.Add(time.Second), LogGroup: "/aws/lambda/billing", LogStream: "s2", EventID: "2", Message: "plain ERROR text"},
+		{Timestamp: t0.Add(2 * time.Second), LogGroup: "/aws/lambda/api", LogStream: "s1", EventID: "3", Message: `{"level":"ERROR","user":{"id":"u3"}}`},
+	}
+}
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func screen(m *tui.Model) string {
+	return ansi.ReplaceAllString(strings.Join(m.View(80, 20), "\n"), "")
+}
+
+func keys(m *tui.Model, s string) tui.Action {
+	var a tui.Action
+	for _, k := range tui.DecodeKeys([]byte(s)) {
+		a = m.HandleKey(k, 5)
+	}
+	return a
+}
+
+func TestNavigateAndFilter(t *testing.T) {
+	m := tui.NewModel("ERROR", parser.FormatAuto)
+	m.SetResults("ERROR", sampleRecords(), nil)
+
+	if r, _ := m.Selected(); r.EventID != "1" {
+		t.Fatalf("initial selection %q", r.EventID)
+	}
+	out := screen(m)
+	if !strings.Contains(out, "ERROR  3/3") || !strings.Contains(out, `"id": "u1"`) {
+		t.Fatalf("screen:\n%s", out)
+	}
+	keys(m, "jj")
+	if r, _ := m.Selected(); r.EventID != "3" {
+		t.Fatalf("after jj selected %q", r.EventID)
+	}
+	keys(m, "\x1b[A") // up
+	if r, _ := m.Selected(); r.EventID != "2" {
+		t.Fatalf("after up selected %q", r.EventID)
+	}
+	if out := screen(m); !strings.Contains(out, "plain ERROR text") {
+		t.Fatalf("text detail missing:\n%s", out)
+	}
+
+	keys(m, "/BILLING\r")
+	if r, _ := m.Selected(); r.EventID != "2" || !strings.Contains(screen(m), "1/3  filter: BILLING") {
+		t.Fatalf("filtered screen:\n%s", screen(m))
+	}
+	keys(m, "\x1b")
+	if !strings.Contains(screen(m), "3/3") {
+		t.Fatalf("Esc did not clear filter:\n%s", screen(m))
+	}
+	if a := keys(m, "q"); a.Kind != tui.ActionQuit {
+		t.Fatalf("q = %+v", a)
+	}
+}
+
+func TestExtractAndNext(t *testing.T) {
+	m := tui.NewModel("ERROR", parser.FormatAuto)
+	m.SetResults("ERROR", sampleRecords(), nil)
+
+	if a := keys(m, "n"); a.Kind != tui.ActionNone || !strings.Contains(screen(m), "extract a value first") {
+		t.Fatalf("n without extract: %+v\n%s", a, screen(m))
+	}
+	keys(m, "G")
+	keys(m, "euserId=user.id\r")
+	if !strings.Contains(screen(m), "userId = u3") {
+		t.Fatalf("extract status:\n%s", screen(m))
+	}
+	a := keys(m, "n\r")
+	if a.Kind != tui.ActionSearch || a.Pattern != "u3" {
+		t.Fatalf("next action = %+v", a)
+	}
+	m.SetResults(a.Pattern, sampleRecords()[2:], nil)
+	if !strings.Contains(screen(m), " u3  1/1") {
+		t.Fatalf("next results:\n%s", screen(m))
+	}
+	keys(m, "b")
+	if m.Pattern() != "ERROR" || !strings.Contains(screen(m), "3/3") {
+		t.Fatalf("back:\n%s", screen(m))
+	}
+
+	m.SetResults("x", nil, errors.New("AccessDenied"))
+	if m.Pattern() != "ERROR" || !strings.Contains(screen(m), "search error: AccessDenied") {
+		t.Fatalf("error kept results:\n%s", screen(m))
+	}
+}
+
+func TestTail(t *testing.T) {
+	m := tui.NewModel("ERROR", parser.FormatAuto)
+	records := sampleRecords()
+	m.SetResults("ERROR", records[:2], nil)
+	keys(m, "G")
+
+	a := keys(m, "t")
+	if a.Kind != tui.ActionTail || a.Pattern != "ERROR" || !a.From.Equal(records[1].Timestamp) || !m.Tailing() {
+		t.Fatalf("tail action = %+v", a)
+	}
+	// overlapping polls repeat records already shown
+	m.Append(records[1:])
+	if !strings.Contains(screen(m), "3/3  [TAIL]") {
+		t.Fatalf("appended:\n%s", screen(m))
+	}
+	if r, _ := m.Selected(); r.EventID != "3" {
+		t.Fatalf("selection did not follow the end: %q", r.EventID)
+	}
+	if a := keys(m, "t"); a.Kind != tui.ActionStopTail || m.Tailing() {
+		t.Fatalf("toggle off = %+v", a)
+	}
+}
+
+func TestGroupColors(t *testing.T) {
+	m := tui.NewModel("ERROR", parser.FormatAuto)
+	m.SetResults("ERROR", sampleRecords(), nil)
+	lines := m.View(80, 20)
+	// rows 2 and 3 are unselected records of different groups
+	c2, c3 := ansi.FindString(lines[2]), ansi.FindString(lines[3])
+	if c2 == "" || c3 == "" {
+		t.Fatalf("rows are not colored: %q %q", lines[2], lines[3])
+	}
+	if !strings.Contains(lines[2], "billing") || !strings.Contains(lines[3], "api") {
+		t.Fatalf("rows %q %q", lines[2], lines[3])
+	}
+	if c3 != ansi.FindString(m.View(80, 20)[3]) {
+		t.Fatal("group color is not stable")
+	}
+}
+
+func TestDecodeKeys(t *testing.T) {
+	got := tui.DecodeKeys([]byte("a\x1b[B\x1b[6~\x1b\r\x7f\x03é"))
+	want := []tui.Key{
+		{Type: tui.KeyRune, Rune: 'a'},
+		{Type: tui.KeyDown},
+		{Type: tui.KeyPgDown},
+		{Type: tui.KeyEsc},
+		{Type: tui.KeyEnter},
+		{Type: tui.KeyBackspace},
+		{Type: tui.KeyCtrlC},
+		{Type: tui.KeyRune, Rune: 'é'},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("key %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := redact.New(redact.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tui.NewModel("ERROR", parser.FormatAuto)
+	m.SetRedactor(r)
+	m.SetResults("ERROR", []model.LogRecord{
+		{Timestamp: t0, LogGroup: "/a", LogStream: "s", EventID: "1", Message: `{"level":"ERROR","email":"bob@example.com"}`},
+	}, nil)
+	if out := screen(m); strings.Contains(out, "bob@example.com") || !strings.Contains(out, `"email": "[email:`) {
+		t.Fatalf("screen:\n%s", out)
+	}
+	keys(m, "eemail=email\r")
+	if out := screen(m); strings.Contains(out, "bob@example.com") {
+		t.Fatalf("extracted value shown:\n%s", out)
+	}
+	// the search itself uses the real value
+	if a := keys(m, "n\r"); a.Pattern != "bob@example.com" {
+		t.Fatalf("next action = %+v", a)
+	}
+}
@@ -0,0 +1,205 @@
+// Package tui is an interactive terminal view of search results: a
+// scrollable, filterable record list with a detail pane, extract and
+// next-filter shortcuts, and live tail.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/redact"
+
+	"golang.org/x/term"
+)
+
+// DefaultTailInterval is the polling interval of live tail.
+const DefaultTailInterval = 5 * time.Second
+
+// resizePoll is how often the terminal size is checked.
+const resizePoll = 250 * time.Millisecond
+
+// Config configures Run.
+type Config struct {
+	// Pattern is searched when the TUI starts.
+	Pattern string
+	Format  parser.Format
+	// Search returns the records matching pattern.
+	Search func(ctx context.Context, pattern string) ([]model.LogRecord, error)
+	// Tail passes records matching pattern from from onwards to emit until
+	// ctx is canceled.
+	Tail func(ctx context.Context, pattern string, from time.Time, emit func([]model.LogRecord) error) error
+	// Redactor masks sensitive values on screen; nil shows them as logged.
+	Redactor *redact.Redactor
+}
+
+type searchDone struct {
+	pattern string
+	records []model.LogRecord
+	err     error
+}
+
+type tailDone struct {
+	id  int
+	err error
+}
+
+type tailBatch struct {
+	id      int
+	records []model.LogRecord
+}
+
+// Run shows the TUI on the terminal in until the user quits or ctx is
+// canceled. in must be a terminal; it is put in raw mode and restored.
+func Run(ctx context.Context, cfg Config, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("--tui requires a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	w := bufio.NewWriter(out)
+	// alternate screen, hidden cursor
+	w.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		w.WriteString("\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			b := make([]byte, n)
+			copy(b, buf[:n])
+			select {
+			case keys <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	searches := make(chan searchDone)
+	search := func(pattern string) {
+		go func() {
+			records, err := cfg.Search(ctx, pattern)
+			select {
+			case searches <- searchDone{pattern, records, err}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	// Each tail gets an id so batches of a stopped tail are ignored.
+	batches := make(chan tailBatch)
+	tails := make(chan tailDone)
+	tailID := 0
+	stopTail := func() {}
+	startTail := func(pattern string, from time.Time) {
+		stopTail()
+		tailID++
+		id := tailID
+		tctx, tcancel := context.WithCancel(ctx)
+		stopTail = tcancel
+		go func() {
+			err := cfg.Tail(tctx, pattern, from, func(records []model.LogRecord) error {
+				select {
+				case batches <- tailBatch{id, records}:
+					return nil
+				case <-tctx.Done():
+					return tctx.Err()
+				}
+			})
+			if tctx.Err() != nil {
+				err = nil
+			}
+			select {
+			case tails <- tailDone{id, err}:
+			case <-ctx.Done():
+			}
+		}()
+	}
+	defer func() { stopTail() }()
+
+	m := NewModel(cfg.Pattern, cfg.Format)
+	m.SetRedactor(cfg.Redactor)
+	search(cfg.Pattern)
+
+	width, height := size(fd)
+	ticker := time.NewTicker(resizePoll)
+	defer ticker.Stop()
+	for {
+		draw(w, m.View(width, height))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if nw, nh := size(fd); nw != width || nh != height {
+				width, height = nw, nh
+			}
+		case res := <-searches:
+			m.SetResults(res.pattern, res.records, res.err)
+		case b := <-batches:
+			if b.id == tailID && m.Tailing() {
+				m.Append(b.records)
+			}
+		case t := <-tails:
+			if t.id == tailID {
+				m.TailStopped(t.err)
+			}
+		case b, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range DecodeKeys(b) {
+				a := m.HandleKey(k, listRows(height))
+				switch a.Kind {
+				case ActionQuit:
+					return nil
+				case ActionSearch:
+					stopTail()
+					search(a.Pattern)
+				case ActionTail:
+					startTail(a.Pattern, a.From)
+				case ActionStopTail:
+					stopTail()
+				}
+			}
+		}
+	}
+}
+
+func size(fd int) (int, int) {
+	w, h, err := term.GetSize(fd)
+	if err != nil || w == 0 || h == 0 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// draw repaints the screen from the top left.
+func draw(w *bufio.Writer, lines []string) {
+	w.WriteString("\x1b[H")
+	w.WriteString(strings.Join(lines, "\x1b[K\r\n"))
+	w.WriteString("\x1b[K\x1b[J")
+	w.Flush()
+}
@@ -1,39 +1,52 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"reflect"
 	"strings"
+	"sync/atomic"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
 
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 	"github.com/jmespath/go-jmespath"
 )
 
+// logger receives the package's debug diagnostics; see SetLogger.
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sends debug diagnostics of extraction and next-filter building to
+// l; values themselves are not logged. A nil l discards them (the default).
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+func debug(msg string, attrs ...slog.Attr) {
+	if l := logger.Load(); l != nil {
+		l.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+	}
+}
+
 // ExtractFirstValue evaluates the given JMESPath expression against each event's message
-// (decoded as JSON if possible; otherwise wrapped as {"message": raw}) and returns the
-// first non-empty string representation found. Array results use the first element only.
+// (structured by the auto-detecting parser; unrecognized text is wrapped as {"message": raw})
+// and returns the first non-empty string representation found. Array results use the first
+// element only.
 // Returns (value, true, nil) on success; ("", false, nil) if not found; or error.
 func ExtractFirstValue(events []types.FilteredLogEvent, jmes string) (string, bool, error) {
-	for _, e := range events {
+	return ExtractFirstValueWithParser(events, jmes, parser.FormatAuto)
+}
+
+// ExtractFirstValueWithParser behaves like ExtractFirstValue but structures messages
+// with the given parser format instead of auto-detection.
+func ExtractFirstValueWithParser(events []types.FilteredLogEvent, jmes string, format parser.Format) (string, bool, error) {
+	for i, e := range events {
 		if e.Message == nil {
 			continue
 		}
-		raw := *e.Message
-		var input any
-		var decoded any
-		// Fast-path: avoid JSON unmarshal if it clearly isn't JSON
-		if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
-			if err := json.Unmarshal([]byte(raw), &decoded); err == nil {
-				input = decoded
-			} else {
-				input = map[string]any{"message": raw}
-			}
-		} else if err := json.Unmarshal([]byte(raw), &decoded); err == nil {
-			input = decoded
-		} else {
-			input = map[string]any{"message": raw}
-		}
+		input := parser.Parse(format, *e.Message)
 
 		res, err := jmespath.Search(jmes, input)
 		if err != nil {
@@ -60,6 +73,7 @@ func ExtractFirstValue(events []types.FilteredLogEvent, jmes string) (string, bo
 			if v == "" {
 				continue
 			}
+			debug("value extracted", slog.String("path", jmes), slog.Int("event", i), slog.Int("events", len(events)))
 			return v, true, nil
 		default:
 			b, err := json.Marshal(v)
@@ -69,9 +83,11 @@ func ExtractFirstValue(events []types.FilteredLogEvent, jmes string) (string, bo
 			if len(b) == 0 || string(b) == "null" || string(b) == "[]" || string(b) == "{}" {
 				continue
 			}
+			debug("value extracted", slog.String("path", jmes), slog.Int("event", i), slog.Int("events", len(events)))
 			return string(b), true, nil
 		}
 	}
+	debug("no value extracted", slog.String("path", jmes), slog.Int("events", len(events)))
 	return "", false, nil
 }
 
@@ -83,6 +99,7 @@ func BuildNextFilter(jmes string, extracted string) (string, error) {
 	out, err := jmespath.Search(jmes, input)
 	if err != nil {
 		// Fallback: treat as literal pattern
+		debug("next filter is not JMESPath; used literally")
 		return jmes, nil
 	}
 	// If evaluation result is nil/empty, treat as an error to avoid sending
@@ -1,8 +1,11 @@
 package util_test
 
 import (
+	"log/slog"
+	"strings"
 	"testing"
 
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
 	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
 )
@@ -108,6 +111,20 @@ func TestExtractFirstValue(t *testing.T) {
 	}
 }
 
+func TestExtractFirstValueWithParser(t *testing.T) {
+	msg := "2024-01-01T00:00:00.000Z\t8f5c3b1a-1234-4cde-9abc-0123456789ab\tERROR\t{\"user\":{\"id\":\"u1\"}}"
+	evs := []types.FilteredLogEvent{{Message: &msg}}
+
+	got, ok, err := util.ExtractFirstValueWithParser(evs, "data.user.id", parser.FormatLambda)
+	if err != nil || !ok || got != "u1" {
+		t.Fatalf("lambda parser: got (%q,%v,%v), want (\"u1\",true,nil)", got, ok, err)
+	}
+	got, ok, err = util.ExtractFirstValueWithParser(evs, "requestId", parser.FormatJSON)
+	if err != nil || ok {
+		t.Fatalf("json parser should not find requestId: got (%q,%v,%v)", got, ok, err)
+	}
+}
+
 func TestBuildNextFilter(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -195,3 +212,21 @@ func TestReplacePlaceholder(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLogger(t *testing.T) {
+	var buf strings.Builder
+	util.SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { util.SetLogger(nil) })
+
+	events := []types.FilteredLogEvent{{Message: strptr(`{"a":1}`)}, {Message: strptr(`{"user":"secret-id"}`)}}
+	if _, ok, _ := util.ExtractFirstValue(events, "user"); !ok {
+		t.Fatal("no value")
+	}
+	if _, ok, _ := util.ExtractFirstValue(events, "missing"); ok {
+		t.Fatal("unexpected value")
+	}
+	out := buf.String()
+	if !strings.Contains(out, `msg="value extracted" path=user event=1 events=2`) || !strings.Contains(out, `msg="no value extracted" path=missing events=2`) || strings.Contains(out, "secret-id") {
+		t.Fatalf("log:\n%s", out)
+	}
+}
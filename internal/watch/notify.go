@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Notifier delivers alerts.
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Webhook formats.
+const (
+	// FormatSlack posts {"text": ...}, accepted by Slack incoming webhooks
+	// and compatible chat services.
+	FormatSlack = "slack"
+	// FormatHTTP posts the Alert as JSON.
+	FormatHTTP = "http"
+	// FormatSNS posts an SNS HTTP notification whose Message is the Alert as
+	// JSON, for endpoints that subscribe to SNS topics.
+	FormatSNS = "sns"
+)
+
+// Formats lists the webhook formats.
+var Formats = []string{FormatSlack, FormatHTTP, FormatSNS}
+
+// DefaultTopicArn is the TopicArn of FormatSNS notifications.
+const DefaultTopicArn = "arn:aws:sns:local:000000000000:aws-multi-log-inspector"
+
+// notifyTimeout bounds one webhook request.
+const notifyTimeout = 10 * time.Second
+
+// Webhook posts alerts to URL in one of Formats.
+type Webhook struct {
+	URL    string
+	Format string
+	Client *http.Client
+}
+
+// Notify posts a; a response status other than 2xx is an error.
+func (h *Webhook) Notify(ctx context.Context, a Alert) error {
+	body, header, err := h.encode(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func (h *Webhook) encode(a Alert) ([]byte, map[string]string, error) {
+	switch h.Format {
+	case FormatSlack, "":
+		b, err := json.Marshal(map[string]string{"text": a.Text()})
+		return b, nil, err
+	case FormatHTTP:
+		b, err := json.Marshal(a)
+		return b, nil, err
+	case FormatSNS:
+		msg, err := json.Marshal(a)
+		if err != nil {
+			return nil, nil, err
+		}
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		n := snsNotification{
+			Type:      "Notification",
+			MessageID: hex.EncodeToString(id),
+			TopicArn:  DefaultTopicArn,
+			Subject:   fmt.Sprintf("%d events matching %s", a.Count, a.Pattern),
+			Message:   string(msg),
+			Timestamp: a.End.UTC().Format(time.RFC3339Nano),
+		}
+		b, err := json.Marshal(n)
+		return b, map[string]string{"x-amz-sns-message-type": "Notification", "x-amz-sns-topic-arn": DefaultTopicArn}, err
+	}
+	return nil, nil, fmt.Errorf("unknown webhook format %q", h.Format)
+}
+
+// snsNotification is the body SNS posts to HTTP subscribers.
+type snsNotification struct {
+	Type      string
+	MessageID string `json:"MessageId"`
+	TopicArn  string
+	Subject   string
+	Message   string
+	Timestamp string
+}
+
+// Printer writes alerts to W as JSON lines, for runs without a webhook.
+type Printer struct {
+	W io.Writer
+}
+
+// Notify writes a.
+func (p Printer) Notify(_ context.Context, a Alert) error {
+	return json.NewEncoder(p.W).Encode(a)
+}
@@ -0,0 +1,72 @@
+package watch_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/watch"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+func receiver(t *testing.T, status int) (*httptest.Server, *[]request) {
+	var got []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = append(got, request{r.Header, b})
+		w.WriteHeader(status)
+		io.WriteString(w, "nope")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &got
+}
+
+var alert = watch.Alert{
+	Pattern: "ERROR", Start: t0.Add(-time.Minute), End: t0, Count: 7, Threshold: 5,
+	Signatures: []watch.Signature{{Template: "ERROR payment <NUM> failed", Count: 7, Groups: []string{"/a"}}},
+}
+
+func TestWebhookFormats(t *testing.T) {
+	ts, got := receiver(t, http.StatusOK)
+	for _, format := range watch.Formats {
+		if err := (&watch.Webhook{URL: ts.URL, Format: format}).Notify(context.Background(), alert); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal((*got)[0].body, &slack); err != nil || !strings.HasPrefix(slack["text"], "7 events matching ERROR") || !strings.Contains(slack["text"], "7x ERROR payment <NUM> failed [/a]") {
+		t.Fatalf("slack body %s", (*got)[0].body)
+	}
+
+	var generic watch.Alert
+	if err := json.Unmarshal((*got)[1].body, &generic); err != nil || generic.Count != 7 || generic.Signatures[0].Template != alert.Signatures[0].Template {
+		t.Fatalf("http body %s", (*got)[1].body)
+	}
+
+	var sns struct{ Type, MessageId, TopicArn, Subject, Message string }
+	if err := json.Unmarshal((*got)[2].body, &sns); err != nil || sns.Type != "Notification" || sns.MessageId == "" || sns.TopicArn != watch.DefaultTopicArn {
+		t.Fatalf("sns body %s", (*got)[2].body)
+	}
+	if (*got)[2].header.Get("x-amz-sns-message-type") != "Notification" || !bytes.Contains([]byte(sns.Message), []byte(`"Count":7`)) {
+		t.Fatalf("sns request %v %q", (*got)[2].header, sns.Message)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	ts, _ := receiver(t, http.StatusForbidden)
+	err := (&watch.Webhook{URL: ts.URL, Format: watch.FormatHTTP}).Notify(context.Background(), alert)
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden: nope") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+// Package watch repeatedly searches the interval since its last poll and
+// raises an alert when the new matches reach a threshold. Alerts are keyed by
+// message signature (a template of one clusterer kept for the whole watch),
+// and a signature that alerted is not reported again until its cooldown has
+// passed.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/cluster"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+)
+
+// Defaults of the watch command.
+const (
+	DefaultEvery    = time.Minute
+	DefaultCooldown = 15 * time.Minute
+	DefaultLag      = time.Minute
+)
+
+// Config configures New.
+type Config struct {
+	// Search returns the records matching Pattern between start and end.
+	Search  func(ctx context.Context, start, end time.Time) ([]model.LogRecord, error)
+	Pattern string
+	// Every is the polling interval; each poll searches the time since the
+	// previous one, the first poll the last Every.
+	Every time.Duration
+	// Lag is how far each poll reaches back before the end of the previous
+	// one, so that events ingested late are still counted; each event is
+	// counted once. Zero means DefaultLag.
+	Lag time.Duration
+	// Threshold is the number of new matches in one poll that raises an alert.
+	Threshold int
+	// Cooldown is how long a signature that alerted is left out of alerts.
+	Cooldown time.Duration
+	// ClusterThreshold is the similarity needed to share a signature.
+	ClusterThreshold float64
+	Notifier         Notifier
+	// Retryable reports whether a search error is transient, such as
+	// throttling: Run logs it and the next poll searches the interval again.
+	// Other errors, and every error when nil, end Run.
+	Retryable func(error) bool
+	// Log receives one line per poll; nil discards them.
+	Log io.Writer
+	// Now returns the current time; nil means time.Now.
+	Now func() time.Time
+}
+
+// Alert is what a Notifier sends.
+type Alert struct {
+	Pattern    string
+	Start, End time.Time
+	Count      int
+	Threshold  int
+	// Signatures are the signatures not in cooldown, largest first.
+	Signatures []Signature
+}
+
+// Signature is one message template of an alert.
+type Signature struct {
+	Template string
+	Count    int
+	Groups   []string
+	Example  model.LogRecord
+}
+
+// Text is the alert as a short human-readable message.
+func (a Alert) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d events matching %s between %s and %s (threshold %d)", a.Count, a.Pattern,
+		a.Start.UTC().Format(time.RFC3339), a.End.UTC().Format(time.RFC3339), a.Threshold)
+	for _, s := range a.Signatures {
+		fmt.Fprintf(&b, "\n%dx %s [%s]", s.Count, s.Template, strings.Join(s.Groups, ","))
+	}
+	return b.String()
+}
+
+// Watcher polls and alerts; it is not safe for concurrent use.
+type Watcher struct {
+	cfg Config
+	// last is the end of the previous poll.
+	last time.Time
+	// seen holds the events counted by earlier polls, with their times, until
+	// they fall out of the polled windows.
+	seen map[string]time.Time
+	// pending are the matches of polls whose notification failed, counted
+	// again by the next alert; pendingStart is the start of the first one.
+	pending      []match
+	pendingStart time.Time
+	// clusters assigns the signatures of every poll, so that a message keeps
+	// its signature whatever else a poll finds.
+	clusters *cluster.Clusterer
+	// alerted holds when each signature last alerted.
+	alerted map[*cluster.Cluster]time.Time
+}
+
+// match is a new event and its signature.
+type match struct {
+	r model.LogRecord
+	c *cluster.Cluster
+}
+
+// New returns a watcher.
+func New(cfg Config) *Watcher {
+	if cfg.Every <= 0 {
+		cfg.Every = DefaultEvery
+	}
+	if cfg.Lag <= 0 {
+		cfg.Lag = DefaultLag
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 1
+	}
+	if cfg.Log == nil {
+		cfg.Log = io.Discard
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Watcher{
+		cfg:      cfg,
+		seen:     map[string]time.Time{},
+		clusters: cluster.New(cluster.Options{Threshold: cfg.ClusterThreshold}),
+		alerted:  map[*cluster.Cluster]time.Time{},
+	}
+}
+
+// Run polls every cfg.Every until ctx is canceled. Retryable search errors
+// are logged and the interval is searched again by the next poll; other
+// search errors end the run. Notification errors are logged, and the matches
+// are sent again with the next alert.
+func (w *Watcher) Run(ctx context.Context) error {
+	t := time.NewTicker(w.cfg.Every)
+	defer t.Stop()
+	for {
+		if _, err := w.Poll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if w.cfg.Retryable == nil || !w.cfg.Retryable(err) {
+				return err
+			}
+			fmt.Fprintf(w.cfg.Log, "%s search failed, retrying with the next poll: %v\n", w.cfg.Now().UTC().Format(time.RFC3339), err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// Poll searches the time since the previous poll, reaching back cfg.Lag for
+// late events, and notifies when the new matches reach the threshold. It
+// returns the alert sent, if any. After a search error, the next poll starts
+// where this one would have.
+func (w *Watcher) Poll(ctx context.Context) (*Alert, error) {
+	end := w.cfg.Now()
+	start := end.Add(-w.cfg.Every)
+	if !w.last.IsZero() {
+		start = w.last.Add(-w.cfg.Lag)
+	}
+	records, err := w.cfg.Search(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	w.last = end
+
+	var matches []match
+	for _, r := range records {
+		k := key(r)
+		if _, ok := w.seen[k]; ok {
+			continue
+		}
+		w.seen[k] = r.Timestamp
+		matches = append(matches, match{r: r, c: w.clusters.Add(r)})
+	}
+	for k, ts := range w.seen {
+		if ts.Before(start) {
+			delete(w.seen, k)
+		}
+	}
+	from := start
+	if len(w.pending) > 0 {
+		matches, from = append(w.pending, matches...), w.pendingStart
+		w.pending = nil
+	}
+
+	stamp := end.UTC().Format(time.RFC3339)
+	if len(matches) < w.cfg.Threshold {
+		fmt.Fprintf(w.cfg.Log, "%s %d matches (threshold %d)\n", stamp, len(matches), w.cfg.Threshold)
+		return nil, nil
+	}
+
+	alert := &Alert{Pattern: w.cfg.Pattern, Start: from, End: end, Count: len(matches), Threshold: w.cfg.Threshold}
+	sigs, suppressed := w.signatures(matches, end)
+	if len(sigs) == 0 {
+		fmt.Fprintf(w.cfg.Log, "%s %d matches: %d signatures in cooldown, no alert\n", stamp, len(matches), suppressed)
+		return nil, nil
+	}
+	for _, s := range sigs {
+		alert.Signatures = append(alert.Signatures, *s.sig)
+	}
+	if err := w.cfg.Notifier.Notify(ctx, *alert); err != nil {
+		w.pending, w.pendingStart = matches, from
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		fmt.Fprintf(w.cfg.Log, "%s %d matches: notification failed: %v; sending them with the next alert\n", stamp, len(matches), err)
+		return nil, nil
+	}
+	for _, s := range sigs {
+		w.alerted[s.c] = end
+	}
+	for c, at := range w.alerted {
+		if end.Sub(at) >= w.cfg.Cooldown {
+			delete(w.alerted, c)
+		}
+	}
+	fmt.Fprintf(w.cfg.Log, "%s %d matches: alert sent (%d signatures, %d in cooldown)\n", stamp, len(matches), len(sigs), suppressed)
+	return alert, nil
+}
+
+// signature is an alert signature and the cluster it counts.
+type signature struct {
+	c   *cluster.Cluster
+	sig *Signature
+}
+
+// signatures counts matches per signature, largest first, leaving out the
+// signatures in cooldown at now, which it counts.
+func (w *Watcher) signatures(matches []match, now time.Time) ([]signature, int) {
+	w.clusters.Clusters() // brings each cluster's Template up to date
+	var sigs []signature
+	index := map[*cluster.Cluster]int{}
+	for _, m := range matches {
+		i, ok := index[m.c]
+		if !ok {
+			i = len(sigs)
+			index[m.c] = i
+			sigs = append(sigs, signature{c: m.c, sig: &Signature{Template: m.c.Template, Example: m.r}})
+		}
+		s := sigs[i].sig
+		s.Count++
+		if !slices.Contains(s.Groups, m.r.LogGroup) {
+			s.Groups = append(s.Groups, m.r.LogGroup)
+		}
+		if m.r.Timestamp.Before(s.Example.Timestamp) {
+			s.Example = m.r
+		}
+	}
+	suppressed := 0
+	sigs = slices.DeleteFunc(sigs, func(s signature) bool {
+		at, ok := w.alerted[s.c]
+		if ok && now.Sub(at) < w.cfg.Cooldown {
+			suppressed++
+			return true
+		}
+		return false
+	})
+	for _, s := range sigs {
+		sort.Strings(s.sig.Groups)
+	}
+	sort.SliceStable(sigs, func(i, j int) bool { return sigs[i].sig.Count > sigs[j].sig.Count })
+	return sigs, suppressed
+}
+
+// key identifies an event across overlapping polls.
+func key(r model.LogRecord) string {
+	if r.EventID != "" {
+		return r.LogGroup + "\x00" + r.EventID
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%s", r.LogGroup, r.LogStream, r.Timestamp.UnixMilli(), r.Message)
+}
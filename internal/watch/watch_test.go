@@ -0,0 +1,202 @@
+package watch_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/watch"
+)
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+type window struct{ start, end time.Time }
+
+// fakeNotifier records alerts and fails while err is set.
+type fakeNotifier struct {
+	alerts []watch.Alert
+	err    error
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, a watch.Alert) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.alerts = append(f.alerts, a)
+	return nil
+}
+
+func records(msgs ...string) []model.LogRecord {
+	var out []model.LogRecord
+	for i, m := range msgs {
+		out = append(out, model.LogRecord{Timestamp: t0.Add(time.Duration(i) * time.Second), LogGroup: "/a", LogStream: "s", Message: m})
+	}
+	return out
+}
+
+func TestPoll(t *testing.T) {
+	now := t0
+	var windows []window
+	var next []model.LogRecord
+	n := &fakeNotifier{}
+	var log strings.Builder
+	w := watch.New(watch.Config{
+		Search: func(_ context.Context, start, end time.Time) ([]model.LogRecord, error) {
+			windows = append(windows, window{start, end})
+			return next, nil
+		},
+		Pattern:   "ERROR",
+		Every:     time.Minute,
+		Threshold: 3,
+		Cooldown:  10 * time.Minute,
+		Notifier:  n,
+		Log:       &log,
+		Now:       func() time.Time { return now },
+	})
+	poll := func(msgs ...string) *watch.Alert {
+		t.Helper()
+		next = records(msgs...)
+		for i := range next {
+			next[i].Timestamp = now.Add(-time.Duration(len(next)-i) * time.Second)
+		}
+		a, err := w.Poll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+		return a
+	}
+
+	if a := poll("ERROR a 1", "ERROR a 2"); a != nil {
+		t.Fatalf("below threshold alerted: %+v", a)
+	}
+	a := poll("ERROR payment 1 failed", "ERROR payment 2 failed", "ERROR payment 3 failed", "ERROR queue timeout")
+	if a == nil || a.Count != 4 || len(a.Signatures) != 2 || a.Signatures[0].Template != "ERROR payment <NUM> failed" || a.Signatures[0].Count != 3 {
+		t.Fatalf("alert = %+v", a)
+	}
+	// The same signatures are in cooldown; a new one alerts alone.
+	a = poll("ERROR payment 4 failed", "ERROR payment 5 failed", "ERROR queue timeout", "ERROR disk full")
+	if a == nil || len(a.Signatures) != 1 || a.Signatures[0].Template != "ERROR disk full" {
+		t.Fatalf("alert = %+v", a)
+	}
+	if a := poll("ERROR payment 6 failed", "ERROR payment 7 failed", "ERROR payment 8 failed"); a != nil {
+		t.Fatalf("cooldown alerted: %+v", a)
+	}
+	now = now.Add(10 * time.Minute)
+	if a := poll("ERROR payment 6 failed", "ERROR payment 7 failed", "ERROR payment 8 failed"); a == nil {
+		t.Fatal("no alert after the cooldown")
+	}
+
+	// Each poll searches from the end of the previous one, less the lag.
+	if len(windows) != 5 || !windows[0].start.Equal(t0.Add(-time.Minute)) || !windows[1].start.Equal(windows[0].end.Add(-watch.DefaultLag)) || !windows[4].start.Equal(windows[3].end.Add(-watch.DefaultLag)) {
+		t.Fatalf("windows = %+v", windows)
+	}
+	if len(n.alerts) != 3 || !strings.Contains(log.String(), "1 signatures in cooldown, no alert") {
+		t.Fatalf("%d alerts, log:\n%s", len(n.alerts), log.String())
+	}
+}
+
+func TestPollOverlap(t *testing.T) {
+	now := t0
+	var next []model.LogRecord
+	n := &fakeNotifier{}
+	w := watch.New(watch.Config{
+		Search: func(context.Context, time.Time, time.Time) ([]model.LogRecord, error) {
+			return next, nil
+		},
+		Threshold: 2,
+		Notifier:  n,
+		Now:       func() time.Time { return now },
+	})
+	late := model.LogRecord{EventID: "1", Timestamp: t0.Add(-time.Second), LogGroup: "/a", Message: "ERROR late"}
+	next = []model.LogRecord{late}
+	if a, err := w.Poll(context.Background()); a != nil || err != nil {
+		t.Fatalf("alert %+v err %v", a, err)
+	}
+	// The overlap finds the event again, which is not counted twice.
+	now = now.Add(time.Minute)
+	next = []model.LogRecord{late, {EventID: "2", Timestamp: now.Add(-time.Second), LogGroup: "/a", Message: "ERROR late"}}
+	if a, err := w.Poll(context.Background()); a != nil || err != nil {
+		t.Fatalf("overlap alerted: %+v err %v", a, err)
+	}
+}
+
+func TestPollNotifyFailure(t *testing.T) {
+	now := t0
+	var next []model.LogRecord
+	n := &fakeNotifier{err: errors.New("503")}
+	var log strings.Builder
+	w := watch.New(watch.Config{
+		Search: func(context.Context, time.Time, time.Time) ([]model.LogRecord, error) {
+			return next, nil
+		},
+		Cooldown: time.Hour,
+		Notifier: n,
+		Log:      &log,
+		Now:      func() time.Time { return now },
+	})
+	next = records("ERROR x")
+	if a, err := w.Poll(context.Background()); a != nil || err != nil || !strings.Contains(log.String(), "notification failed: 503") {
+		t.Fatalf("alert %+v err %v log %q", a, err, log.String())
+	}
+	// A failed notification does not start the cooldown, and its matches
+	// are sent with the next alert.
+	n.err = nil
+	now = now.Add(time.Minute)
+	next = []model.LogRecord{{Timestamp: now.Add(-time.Second), LogGroup: "/b", Message: "ERROR x"}}
+	a, _ := w.Poll(context.Background())
+	if a == nil || len(n.alerts) != 1 || a.Count != 2 || !a.Start.Equal(t0.Add(-time.Minute)) || len(a.Signatures) != 1 || a.Signatures[0].Count != 2 {
+		t.Fatalf("retry alert = %+v", a)
+	}
+	if g := a.Signatures[0].Groups; len(g) != 2 || g[0] != "/a" || g[1] != "/b" {
+		t.Fatalf("groups = %v", g)
+	}
+}
+
+func TestRunRetriesSearchError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var windows []window
+	now := t0
+	var log strings.Builder
+	w := watch.New(watch.Config{
+		Search: func(_ context.Context, start, end time.Time) ([]model.LogRecord, error) {
+			windows = append(windows, window{start, end})
+			now = now.Add(time.Minute)
+			if len(windows) == 2 {
+				return nil, errors.New("throttled")
+			}
+			if len(windows) == 3 {
+				cancel()
+			}
+			return nil, nil
+		},
+		Every:     time.Millisecond,
+		Notifier:  &fakeNotifier{},
+		Retryable: func(err error) bool { return err.Error() == "throttled" },
+		Log:       &log,
+		Now:       func() time.Time { return now },
+	})
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("Run = %v", err)
+	}
+	// The poll after the failed one searches its interval again.
+	if len(windows) != 3 || !windows[2].start.Equal(windows[1].start) || !strings.Contains(log.String(), "search failed, retrying with the next poll: throttled") {
+		t.Fatalf("windows = %+v, log:\n%s", windows, log.String())
+	}
+}
+
+func TestRunStopsOnSearchError(t *testing.T) {
+	w := watch.New(watch.Config{
+		Search: func(context.Context, time.Time, time.Time) ([]model.LogRecord, error) {
+			return nil, errors.New("AccessDenied")
+		},
+		Notifier: &fakeNotifier{},
+	})
+	if err := w.Run(context.Background()); err == nil || err.Error() != "AccessDenied" {
+		t.Fatalf("Run = %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package inspector_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/pkg/inspector"
+)
+
+// memoryRetriever serves fixed records, matching filter patterns by substring.
+type memoryRetriever map[string][]inspector.LogRecord
+
+func (m memoryRetriever) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]inspector.LogRecord, error) {
+	var out []inspector.LogRecord
+	for _, r := range m[group] {
+		ms := r.Timestamp.UnixMilli()
+		if ms >= startMs && ms <= endMs && strings.Contains(r.Message, strings.Trim(filterPattern, `"`)) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+var t0 = time.Date(2025, 8, 31, 12, 0, 0, 0, time.UTC)
+
+var logs = memoryRetriever{
+	"/aws/lambda/api": {
+		{Timestamp: t0.Add(2 * time.Minute), LogGroup: "/aws/lambda/api", LogStream: "s1", Message: `{"level":"ERROR","user":{"id":"u-42"}}`},
+	},
+	"/aws/lambda/billing": {
+		{Timestamp: t0.Add(time.Minute), LogGroup: "/aws/lambda/billing", LogStream: "s2", Message: "ERROR card declined"},
+		{Timestamp: t0.Add(3 * time.Minute), LogGroup: "/aws/lambda/billing", LogStream: "s2", Message: "refund issued for u-42"},
+	},
+}
+
+func ExampleInspector_Search() {
+	in, err := inspector.New(logs, []string{"/aws/lambda/api", "/aws/lambda/billing"},
+		inspector.WithTimeWindow(t0, t0.Add(time.Hour)),
+		inspector.WithWorkers(2),
+	)
+	if err != nil {
+		panic(err)
+	}
+	records, err := in.Search(context.Background(), "ERROR")
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range records {
+		fmt.Println(r.Timestamp.Format(time.Kitchen), r.LogGroup, r.Message)
+	}
+	// Output:
+	// 12:01PM /aws/lambda/billing ERROR card declined
+	// 12:02PM /aws/lambda/api {"level":"ERROR","user":{"id":"u-42"}}
+}
+
+func ExampleInspector_SearchNext() {
+	in, err := inspector.New(logs, []string{"/aws/lambda/api", "/aws/lambda/billing"}, inspector.WithTimeWindow(t0, t0.Add(time.Hour)))
+	if err != nil {
+		panic(err)
+	}
+	// Find the user of the first error, then everything mentioning that user.
+	value, records, ok, err := in.SearchNext(context.Background(), "ERROR", "userId", "user.id", "value")
+	if err != nil || !ok {
+		panic(fmt.Sprint(ok, err))
+	}
+	fmt.Println("userId:", value)
+	for _, r := range records {
+		fmt.Println(r.LogGroup, r.Message)
+	}
+	// Output:
+	// userId: u-42
+	// /aws/lambda/api {"level":"ERROR","user":{"id":"u-42"}}
+	// /aws/lambda/billing refund issued for u-42
+}
+
+func ExampleExtract() {
+	records := []inspector.LogRecord{
+		{Message: "plain text without fields"},
+		{Message: `{"requestId":"r-1","status":500}`},
+	}
+	v, ok, err := inspector.Extract(records, "requestId")
+	fmt.Println(v, ok, err)
+	// Output: r-1 true <nil>
+}
+
+func ExampleNextFilter() {
+	// A JMESPath expression over {"value": ...}
+	p, _ := inspector.NextFilter("join('', ['{ $.userId = \"', value, '\" }'])", "", "u-42")
+	fmt.Println(p)
+	// Not valid JMESPath: used literally after {{name}} substitution
+	p, _ = inspector.NextFilter("{ $.userId = {{userId}} }", "userId", "u-42")
+	fmt.Println(p)
+	// Output:
+	// { $.userId = "u-42" }
+	// { $.userId = "u-42" }
+}
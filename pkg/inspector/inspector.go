@@ -0,0 +1,290 @@
+// Package inspector searches CloudWatch Logs across many log groups at once
+// and merges the matches into one chronological list. It is the library form
+// of the aws-multi-log-inspector CLI: the same concurrent search, two-phase
+// extract and next-filter helpers, and tailing.
+//
+// The package follows semantic versioning (see Version): within a major
+// version, exported identifiers are only added, never removed or changed.
+//
+// A search needs a Retriever. NewCloudWatchClient returns one backed by AWS;
+// NewReplayClient serves a recording made with the CLI's --record flag, and
+// any type with a SearchGroup method works in tests.
+package inspector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/client"
+	internal "github.com/Nao-Mk2/aws-multi-log-inspector/internal/inspector"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/model"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/parser"
+	"github.com/Nao-Mk2/aws-multi-log-inspector/internal/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Version is the semantic version of this package's API.
+const Version = "1.0.0"
+
+// LogRecord is a single matched log event: Timestamp, LogGroup, LogStream,
+// Message, the CloudWatch EventID and, when a parser was applied, the
+// structured message in Fields.
+type LogRecord = model.LogRecord
+
+// Retriever searches one log group for events matching a CloudWatch Logs
+// filter pattern between two times in Unix milliseconds.
+type Retriever interface {
+	SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]LogRecord, error)
+}
+
+// CloudWatchClient is the AWS-backed Retriever.
+type CloudWatchClient struct {
+	cw *client.CloudWatchClient
+}
+
+// SearchGroup returns the events of group matching filterPattern between
+// startMs and endMs (Unix milliseconds), following every page.
+func (c *CloudWatchClient) SearchGroup(ctx context.Context, group, filterPattern string, startMs, endMs int64) ([]LogRecord, error) {
+	return c.cw.SearchGroup(ctx, group, filterPattern, startMs, endMs)
+}
+
+// ClientOption configures NewCloudWatchClient. Without any, the default AWS
+// configuration chain is used.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	cw []client.CloudWatchOption
+}
+
+// WithRegion sets the AWS region.
+func WithRegion(region string) ClientOption {
+	return func(o *clientOptions) { o.cw = append(o.cw, client.WithRegion(region)) }
+}
+
+// WithProfile takes credentials and configuration from a shared config
+// profile.
+func WithProfile(profile string) ClientOption {
+	return func(o *clientOptions) { o.cw = append(o.cw, client.WithProfile(profile)) }
+}
+
+// WithStaticCredentials uses the given access key, secret key and optional
+// session token.
+func WithStaticCredentials(accessKey, secretKey, sessionToken string) ClientOption {
+	return func(o *clientOptions) {
+		o.cw = append(o.cw, client.WithStaticCredentials(accessKey, secretKey, sessionToken))
+	}
+}
+
+// WithUnmask reads events without data protection masking. It needs the
+// logs:Unmask permission (see ErrUnmaskDenied).
+func WithUnmask() ClientOption {
+	return func(o *clientOptions) { o.cw = append(o.cw, client.WithUnmask()) }
+}
+
+// WithClientLogger logs each page (debug) and group search (info), and at
+// debug level the AWS SDK requests, responses and retries.
+func WithClientLogger(l *slog.Logger) ClientOption {
+	return func(o *clientOptions) { o.cw = append(o.cw, client.WithLogger(l)) }
+}
+
+// ErrUnmaskDenied is wrapped by search errors of a WithUnmask client that
+// lacks the logs:Unmask permission.
+var ErrUnmaskDenied = client.ErrUnmaskDenied
+
+// NewCloudWatchClient loads the AWS configuration and returns a client.
+func NewCloudWatchClient(ctx context.Context, opts ...ClientOption) (*CloudWatchClient, error) {
+	var o clientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	cw, err := client.NewCloudWatchClient(ctx, o.cw...)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudWatchClient{cw: cw}, nil
+}
+
+// NewReplayClient returns a client answering searches from a recording
+// written by the CLI's --record flag, without AWS access.
+func NewReplayClient(r io.Reader) (*CloudWatchClient, error) {
+	rp, err := client.LoadReplay(r)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudWatchClient{cw: client.NewCloudWatchClientFromAPI(rp)}, nil
+}
+
+// DefaultWindow is the search window ending now used when no window option is given.
+const DefaultWindow = 24 * time.Hour
+
+// DefaultWorkers is the number of groups searched concurrently by default.
+const DefaultWorkers = 4
+
+// Option configures New.
+type Option func(*options)
+
+type options struct {
+	start, end time.Time
+	last       time.Duration
+	workers    int
+	parser     string
+	log        *slog.Logger
+}
+
+// WithTimeWindow searches between start and end.
+func WithTimeWindow(start, end time.Time) Option {
+	return func(o *options) { o.start, o.end, o.last = start, end, 0 }
+}
+
+// WithLast searches the window of length d ending when New is called.
+func WithLast(d time.Duration) Option {
+	return func(o *options) { o.start, o.end, o.last = time.Time{}, time.Time{}, d }
+}
+
+// WithWorkers sets how many groups are searched concurrently; it is bounded
+// by the number of groups.
+func WithWorkers(n int) Option {
+	return func(o *options) { o.workers = n }
+}
+
+// WithParser structures messages with the named parser (auto, lambda, apigw,
+// vpcflow, alb, logfmt, json) and stores the result in LogRecord.Fields. It
+// also applies to Inspector.Extract.
+func WithParser(name string) Option {
+	return func(o *options) { o.parser = name }
+}
+
+// WithLogger logs each search (info) and each group of a search (debug).
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) { o.log = l }
+}
+
+// Inspector searches a fixed set of log groups over a time window.
+type Inspector struct {
+	in        *internal.Inspector
+	groups    []string
+	start     time.Time
+	end       time.Time
+	format    parser.Format
+	annotated bool
+}
+
+// New returns an Inspector over groups. It fails when no group is given, the
+// window is empty or the parser is unknown.
+func New(r Retriever, groups []string, opts ...Option) (*Inspector, error) {
+	o := options{last: DefaultWindow, workers: DefaultWorkers}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("no log groups given")
+	}
+	if o.last > 0 {
+		o.end = time.Now()
+		o.start = o.end.Add(-o.last)
+	}
+	if !o.end.After(o.start) {
+		return nil, fmt.Errorf("empty time window %s..%s", o.start.Format(time.RFC3339), o.end.Format(time.RFC3339))
+	}
+	format, err := parser.ParseFormat(o.parser)
+	if err != nil {
+		return nil, err
+	}
+	in := internal.New(r, groups, o.start, o.end)
+	in.SetWorkers(min(max(o.workers, 1), len(groups)))
+	in.SetLogger(o.log)
+	return &Inspector{in: in, groups: groups, start: o.start, end: o.end, format: format, annotated: o.parser != ""}, nil
+}
+
+// Groups returns the searched log groups.
+func (in *Inspector) Groups() []string { return in.groups }
+
+// Window returns the searched time window.
+func (in *Inspector) Window() (start, end time.Time) { return in.start, in.end }
+
+// Search returns the events matching filterPattern in every group, sorted by
+// time, then group, stream and message. It stops at the first group error.
+func (in *Inspector) Search(ctx context.Context, filterPattern string) ([]LogRecord, error) {
+	records, err := in.in.Search(ctx, filterPattern)
+	if err != nil {
+		return nil, err
+	}
+	in.annotate(records)
+	return records, nil
+}
+
+// Tail searches from the window start to now and then polls every interval
+// for newer events until ctx is canceled, passing each batch of events not
+// seen before to emit. An error from emit stops tailing and is returned.
+func (in *Inspector) Tail(ctx context.Context, filterPattern string, interval time.Duration, emit func([]LogRecord) error) error {
+	return in.in.Tail(ctx, filterPattern, interval, func(records []LogRecord) error {
+		in.annotate(records)
+		return emit(records)
+	})
+}
+
+// SearchNext runs the two-phase search of the CLI's --extract/--next-filter:
+// it extracts a value named name with the JMESPath expression extract from the
+// first search's results, builds the next filter with NextFilter, and searches
+// again. It returns the extracted value and the second search's records; ok is
+// false when nothing could be extracted.
+func (in *Inspector) SearchNext(ctx context.Context, filterPattern, name, extract, nextFilter string) (value string, records []LogRecord, ok bool, err error) {
+	first, err := in.Search(ctx, filterPattern)
+	if err != nil {
+		return "", nil, false, err
+	}
+	value, ok, err = in.Extract(first, extract)
+	if err != nil || !ok {
+		return "", nil, false, err
+	}
+	pattern, err := NextFilter(nextFilter, name, value)
+	if err != nil {
+		return value, nil, true, err
+	}
+	records, err = in.Search(ctx, pattern)
+	return value, records, true, err
+}
+
+// Extract evaluates a JMESPath expression against each record's message,
+// structured by the Inspector's parser (auto-detected by default), and
+// returns the first non-empty result.
+func (in *Inspector) Extract(records []LogRecord, expr string) (string, bool, error) {
+	return extract(records, expr, in.format)
+}
+
+func (in *Inspector) annotate(records []LogRecord) {
+	if in.annotated {
+		parser.Annotate(records, in.format)
+	}
+}
+
+// Extract evaluates a JMESPath expression against each record's message and
+// returns the first non-empty result as a string (JSON for non-strings; the
+// first element of arrays). JSON messages are used as-is, known AWS formats
+// are parsed, and other text is available as "message". ok is false when no
+// record yields a value.
+func Extract(records []LogRecord, expr string) (value string, ok bool, err error) {
+	return extract(records, expr, parser.FormatAuto)
+}
+
+func extract(records []LogRecord, expr string, format parser.Format) (string, bool, error) {
+	evs := make([]types.FilteredLogEvent, 0, len(records))
+	for _, r := range records {
+		evs = append(evs, types.FilteredLogEvent{Message: aws.String(r.Message)})
+	}
+	return util.ExtractFirstValueWithParser(evs, expr, format)
+}
+
+// NextFilter builds a filter pattern from an extracted value. Occurrences of
+// {{name}} in expr are replaced with the JSON-quoted value, then expr is
+// evaluated as JMESPath against {"value": value}; if it is not valid JMESPath
+// it is returned as a literal pattern.
+func NextFilter(expr, name, value string) (string, error) {
+	return util.BuildNextFilter(util.ReplacePlaceholder(expr, name, value), value)
+}
@@ -0,0 +1,80 @@
+package inspector_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nao-Mk2/aws-multi-log-inspector/pkg/inspector"
+)
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+		opts   []inspector.Option
+		want   string
+	}{
+		{"no groups", nil, nil, "no log groups"},
+		{"empty window", []string{"/a"}, []inspector.Option{inspector.WithTimeWindow(t0, t0)}, "empty time window"},
+		{"bad parser", []string{"/a"}, []inspector.Option{inspector.WithParser("syslog")}, "unknown parser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := inspector.New(logs, tt.groups, tt.opts...); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	in, err := inspector.New(logs, []string{"/aws/lambda/api"}, inspector.WithLast(time.Hour), inspector.WithParser("json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, end := in.Window()
+	if end.Sub(start) != time.Hour || time.Since(end) > time.Minute {
+		t.Fatalf("window = %v..%v", start, end)
+	}
+
+	in, _ = inspector.New(logs, []string{"/aws/lambda/api"}, inspector.WithTimeWindow(t0, t0.Add(time.Hour)), inspector.WithParser("json"))
+	records, err := in.Search(context.Background(), "ERROR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Fields == nil {
+		t.Fatalf("records = %+v, want parsed Fields", records)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var buf strings.Builder
+	in, _ := inspector.New(logs, []string{"/aws/lambda/api"}, inspector.WithTimeWindow(t0, t0.Add(time.Hour)),
+		inspector.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if _, err := in.Search(context.Background(), "ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `msg="search finished" groups=1 records=1`) {
+		t.Fatalf("log:\n%s", buf.String())
+	}
+}
+
+// CloudWatchClient exposes only the Retriever method.
+var _ inspector.Retriever = (*inspector.CloudWatchClient)(nil)
+
+func TestReplayClient(t *testing.T) {
+	const recording = `{"Version":1,"Now":"2025-08-31T12:00:00Z"}
+{"Request":{"LogGroupName":"/aws/lambda/api","FilterPattern":"ERROR","StartTime":1756638000000,"EndTime":1756641600000},"Response":{"Events":[{"Timestamp":1756638600000,"LogStreamName":"s","Message":"ERROR payment 42 failed","EventID":"e1"}]}}
+`
+	cw, err := inspector.NewReplayClient(strings.NewReader(recording))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := cw.SearchGroup(context.Background(), "/aws/lambda/api", "ERROR", 1756638000000, 1756641600000)
+	if err != nil || len(records) != 1 || records[0].EventID != "e1" {
+		t.Fatalf("SearchGroup() = %+v, %v", records, err)
+	}
+}